@@ -0,0 +1,719 @@
+package asm
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Tinch334/Computer-one-v2/co"
+	"github.com/Tinch334/Computer-one-v2/expr"
+	"github.com/Tinch334/Computer-one-v2/link"
+	"github.com/Tinch334/Computer-one-v2/obj"
+	"github.com/Tinch334/Computer-one-v2/symbols"
+)
+
+//Maximum amount of errors reported before giving up.
+const maxErrors = 20
+
+//Section code goes to until a ".section" or ".org" directive is found.
+const DefaultSection = "text"
+
+//Labels starting with this prefix are not written to the object.
+const TemporaryPrefix = ".L"
+
+//Operands starting with this character always use the immediate field, even if their value is only known when linking.
+const shortPrefix = "<"
+
+//Values given to unknowns when checking if an expression can be relocated, they must be large and unrelated.
+var relocProbes = []int{1021, 4093}
+
+type section struct {
+	name string
+	absolute bool
+	origin uint16
+
+	//Location counter, in the first pass.
+	size int
+
+	//Contents, in the second pass.
+	words []uint16
+	used []bool
+}
+
+type symbolDef struct {
+	//Section the symbol is in, "obj.NoSection" for constants.
+	section int
+	value int
+
+	kind string
+	size uint16
+}
+
+//Layout information computed for each line in the first pass.
+type lineLayout struct {
+	section int
+	offset uint16
+	size uint16
+
+	//For instructions, set if the operand is stored in the next word.
+	double bool
+}
+
+type assembler struct {
+	lines []sourceLine
+	layout []lineLayout
+
+	macros map[string]macro
+	expansions int
+
+	sections []*section
+	current int
+
+	syms map[string]*symbolDef
+	globals map[string]sourceLine
+	externs []string
+
+	//Constants that couldn't be evaluated in the first pass.
+	pendingEqu []int
+
+	relocs []obj.Reloc
+
+	errs []error
+}
+
+
+func newAssembler() *assembler {
+	return &assembler{
+		macros: make(map[string]macro),
+		sections: []*section{{name: DefaultSection}},
+		syms: make(map[string]*symbolDef),
+		globals: make(map[string]sourceLine),
+	}
+}
+
+func (a *assembler) errorf(format string, args ...any) {
+	if len(a.errs) < maxErrors {
+		a.errs = append(a.errs, fmt.Errorf(format, args...))
+	}
+}
+
+func (a *assembler) lineErrorf(l sourceLine, format string, args ...any) {
+	a.errorf("%s: %s", l.pos(), fmt.Sprintf(format, args...))
+}
+
+//Assembles the given file into a relocatable object, included files are searched relative to it.
+func AssembleObjectFile(path string) (error, *obj.Object) {
+	a := newAssembler()
+	a.preprocessFile(path, 0)
+
+	return a.assemble(path)
+}
+
+//Assembles source code into a relocatable object, "name" is used in error messages and to resolve includes.
+func AssembleObjectString(name string, src string) (error, *obj.Object) {
+	a := newAssembler()
+	a.preprocess(name, src, 1, 0)
+
+	return a.assemble(name)
+}
+
+//Assembles and links a single file with the default layout.
+func AssembleFile(path string) (error, *link.Image) {
+	err, o := AssembleObjectFile(path)
+	if err != nil {
+		return err, nil
+	}
+
+	return link.Link([]*obj.Object{o}, nil)
+}
+
+//Assembles and links source code with the default layout.
+func AssembleString(name string, src string) (error, *link.Image) {
+	err, o := AssembleObjectString(name, src)
+	if err != nil {
+		return err, nil
+	}
+
+	return link.Link([]*obj.Object{o}, nil)
+}
+
+func (a *assembler) assemble(name string) (error, *obj.Object) {
+	steps := []func(){a.layoutPass, a.resolvePendingEqu, a.checkGlobals, a.emitPass}
+
+	for _, step := range steps {
+		if len(a.errs) == 0 {
+			step()
+		}
+	}
+
+	if len(a.errs) > 0 {
+		return errors.Join(a.errs...), nil
+	}
+
+	return nil, a.object(name)
+}
+
+
+/*
+	SYMBOLS AND EXPRESSIONS
+*/
+func (a *assembler) define(l sourceLine, name string, def symbolDef) {
+	if _, exists := a.syms[name]; exists || a.isExtern(name) {
+		a.lineErrorf(l, "symbol %s already defined", name)
+		return
+	}
+
+	if err := symbols.ValidateName(name); err != nil {
+		a.lineErrorf(l, "%s", err)
+		return
+	}
+
+	a.syms[name] = &def
+}
+
+func (a *assembler) isExtern(name string) bool {
+	for _, e := range a.externs {
+		if e == name {
+			return true
+		}
+	}
+	return false
+}
+
+//Key of the unknown base address of a relocatable section.
+func sectionKey(i int) string {
+	return fmt.Sprintf("section %d", i)
+}
+
+//Key of the unknown address of an imported symbol.
+func importKey(name string) string {
+	return "import " + name
+}
+
+//Evaluates an expression, relocatable addresses take their value from "bases" and are recorded in "used". "$" is the
+//address of the current line.
+func (a *assembler) evalWith(s string, sec int, offset uint16, bases map[string]int, used map[string]bool) (error, int) {
+	addrOf := func(i int, value int) int {
+		if a.sections[i].absolute {
+			return int(a.sections[i].origin) + value
+		}
+
+		key := sectionKey(i)
+		used[key] = true
+		return bases[key] + value
+	}
+
+	lookup := func(name string) (int, bool) {
+		if name == "$" {
+			return addrOf(sec, int(offset)), true
+		}
+
+		if def, ok := a.syms[name]; ok {
+			if def.section == obj.NoSection {
+				return def.value, true
+			}
+			return addrOf(def.section, def.value), true
+		}
+
+		if a.isExtern(name) {
+			key := importKey(name)
+			used[key] = true
+			return bases[key], true
+		}
+
+		return 0, false
+	}
+
+	return expr.Eval(s, expr.Env{Lookup: lookup})
+}
+
+//Evaluates an expression that may depend on one relocatable address. Returns the key of the address it depends on, if
+//any, and the value relative to it.
+func (a *assembler) resolve(s string, sec int, offset uint16) (error, int, string) {
+	used := make(map[string]bool)
+
+	err, base := a.evalWith(s, sec, offset, map[string]int{}, used)
+	if err != nil {
+		return err, 0, ""
+	}
+
+	keys := make([]string, 0, len(used))
+	for k := range used {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	//The expression must be the address plus a constant, which is checked by moving the unknown address around.
+	target := ""
+	for _, k := range keys {
+		moves := 0
+
+		for _, probe := range relocProbes {
+			_, v := a.evalWith(s, sec, offset, map[string]int{k: probe}, map[string]bool{})
+
+			switch v - base {
+			case probe:
+				moves++
+			case 0:
+			default:
+				return fmt.Errorf("expression %q can't be relocated", s), 0, ""
+			}
+		}
+
+		switch moves {
+		case 0:
+		case len(relocProbes):
+			if target != "" {
+				return fmt.Errorf("expression %q depends on more than one relocatable address", s), 0, ""
+			}
+			target = k
+		default:
+			return fmt.Errorf("expression %q can't be relocated", s), 0, ""
+		}
+	}
+
+	return nil, base, target
+}
+
+//Evaluates an expression whose value must be known while assembling.
+func (a *assembler) evalAbsolute(s string, sec int, offset uint16) (error, int) {
+	err, v, target := a.resolve(s, sec, offset)
+	if err != nil {
+		return err, 0
+	}
+
+	if target != "" {
+		return fmt.Errorf("expression %q is only known when linking", s), 0
+	}
+
+	return nil, v
+}
+
+//Evaluates a value stored in the word at "wordOffset", adding a relocation if needed. "$" is the line at "offset", negative
+//values are stored in two's complement.
+func (a *assembler) evalWord(l sourceLine, s string, sec int, offset uint16, wordOffset uint16, kind string) (bool, uint16) {
+	err, v, target := a.resolve(s, sec, offset)
+	if err != nil {
+		a.lineErrorf(l, "%s", err)
+		return false, 0
+	}
+
+	if target != "" {
+		a.addReloc(sec, wordOffset, kind, target, v)
+		return true, 0
+	}
+
+	if v < -0x8000 || v > 0xFFFF {
+		a.lineErrorf(l, "value %d does not fit in 16 bits", v)
+		return false, 0
+	}
+
+	if kind == obj.RELOC_IMM7 && (v < 0 || v > co.MaxImmediate) {
+		a.lineErrorf(l, "value %d does not fit in the immediate field", v)
+		return false, 0
+	}
+
+	return true, uint16(v)
+}
+
+func (a *assembler) addReloc(sec int, offset uint16, kind string, target string, addend int) {
+	r := obj.Reloc{Section: sec, Offset: offset, Kind: kind, Addend: addend}
+
+	if name, ok := strings.CutPrefix(target, "import "); ok {
+		r.TargetSection = obj.NoSection
+		r.Symbol = name
+	} else {
+		fmt.Sscanf(target, "section %d", &r.TargetSection)
+	}
+
+	a.relocs = append(a.relocs, r)
+}
+
+
+/*
+	FIRST PASS
+*/
+//Assigns a section, offset and size to every line and defines all labels.
+func (a *assembler) layoutPass() {
+	a.layout = make([]lineLayout, len(a.lines))
+
+	for i, l := range a.lines {
+		op := strings.ToLower(l.op)
+
+		//Section changes take effect before the line's label is defined.
+		switch op {
+		case ".section":
+			if len(l.args) != 1 {
+				a.lineErrorf(l, ".section expects a name")
+				continue
+			}
+
+			a.switchSection(l.args[0])
+
+		case ".org":
+			if len(l.args) != 1 {
+				a.lineErrorf(l, ".org expects an address")
+				continue
+			}
+
+			//The address must be known at this point.
+			err, v := a.evalAbsolute(l.args[0], a.current, uint16(a.sections[a.current].size))
+			if err != nil {
+				a.lineErrorf(l, "%s", err)
+				continue
+			}
+
+			if v < 0 || v >= co.MemorySize {
+				a.lineErrorf(l, "address 0x%X out of range", v)
+				continue
+			}
+
+			//Code following an ".org" goes to a new absolute section.
+			a.sections = append(a.sections, &section{name: a.sections[a.current].name, absolute: true, origin: uint16(v)})
+			a.current = len(a.sections) - 1
+		}
+
+		sec := a.sections[a.current]
+		if sec.size > co.MemorySize {
+			a.lineErrorf(l, "section %s does not fit in memory", sec.name)
+			return
+		}
+
+		a.layout[i].section = a.current
+		a.layout[i].offset = uint16(sec.size)
+
+		if l.label != "" {
+			kind := symbols.KIND_LABEL
+			if isDataDirective(op) {
+				kind = symbols.KIND_DATA
+			}
+
+			a.define(l, l.label, symbolDef{section: a.current, value: sec.size, kind: kind})
+		}
+
+		switch op {
+		case "", ".section", ".org":
+
+		case ".equ":
+			if len(l.args) != 2 {
+				a.lineErrorf(l, ".equ expects a name and a value")
+				continue
+			}
+
+			//Constants may depend on labels defined later, those are resolved once all labels are known.
+			if err, v, target := a.resolve(l.args[1], a.current, uint16(sec.size)); err == nil {
+				a.defineEqu(l, v, target)
+			} else {
+				a.pendingEqu = append(a.pendingEqu, i)
+			}
+
+		case ".global", ".extern":
+			if len(l.args) == 0 {
+				a.lineErrorf(l, "%s expects at least one name", op)
+			}
+
+			for _, name := range l.args {
+				if err := symbols.ValidateName(name); err != nil {
+					a.lineErrorf(l, "%s", err)
+					continue
+				}
+
+				if op == ".global" {
+					a.globals[name] = l
+				} else if _, defined := a.syms[name]; defined || a.isExtern(name) {
+					a.lineErrorf(l, "symbol %s already defined", name)
+				} else {
+					a.externs = append(a.externs, name)
+				}
+			}
+
+		default:
+			size, double := a.lineSize(l, op, a.current, uint16(sec.size))
+			a.layout[i].size = size
+			a.layout[i].double = double
+
+			if l.label != "" && isDataDirective(op) {
+				a.syms[l.label].size = size
+			}
+
+			sec.size += int(size)
+		}
+	}
+
+	for _, s := range a.sections {
+		if s.size > co.MemorySize || (s.absolute && int(s.origin) + s.size > co.MemorySize) {
+			a.errorf("section %s does not fit in memory", s.name)
+		}
+	}
+}
+
+//Switches to the relocatable section with the given name, creating it if needed.
+func (a *assembler) switchSection(name string) {
+	for i, s := range a.sections {
+		if s.name == name && !s.absolute {
+			a.current = i
+			return
+		}
+	}
+
+	a.sections = append(a.sections, &section{name: name})
+	a.current = len(a.sections) - 1
+}
+
+//Defines a constant, constants relative to a section label are labels themselves.
+func (a *assembler) defineEqu(l sourceLine, v int, target string) {
+	def := symbolDef{section: obj.NoSection, value: v, kind: symbols.KIND_CONST}
+
+	if target != "" {
+		if strings.HasPrefix(target, "import ") {
+			a.lineErrorf(l, "constants can't depend on imported symbols")
+			return
+		}
+
+		fmt.Sscanf(target, "section %d", &def.section)
+		def.kind = symbols.KIND_LABEL
+	}
+
+	a.define(l, l.args[0], def)
+}
+
+func isDataDirective(op string) bool {
+	return op == ".word" || op == ".fill" || op == ".string" || op == ".pstring"
+}
+
+//Returns the size of a directive or instruction, and for instructions whether the operand needs double mode.
+func (a *assembler) lineSize(l sourceLine, op string, sec int, offset uint16) (uint16, bool) {
+	switch op {
+	case ".word":
+		if len(l.args) == 0 {
+			a.lineErrorf(l, ".word expects at least one value")
+		}
+		return uint16(len(l.args)), false
+
+	case ".fill":
+		if len(l.args) != 1 && len(l.args) != 2 {
+			a.lineErrorf(l, ".fill expects a count and an optional value")
+			return 0, false
+		}
+
+		err, count := a.evalAbsolute(l.args[0], sec, offset)
+		if err != nil || count < 0 || count > co.MemorySize {
+			a.lineErrorf(l, "invalid .fill count %q", l.args[0])
+			return 0, false
+		}
+		return uint16(count), false
+
+	case ".string", ".pstring":
+		if len(l.args) != 1 {
+			a.lineErrorf(l, "%s expects a string", op)
+			return 0, false
+		}
+
+		err, s := parseString(l.args[0])
+		if err != nil {
+			a.lineErrorf(l, "%s", err)
+			return 0, false
+		}
+
+		//Strings are zero terminated, packed strings store two characters per word.
+		if op == ".pstring" {
+			return uint16(len(s) / 2 + 1), false
+		}
+		return uint16(len(s) + 1), false
+	}
+
+	err, ins := parseInstruction(l)
+	if err != nil {
+		a.lineErrorf(l, "%s", err)
+		return 0, false
+	}
+
+	if ins.operand == "" || strings.HasPrefix(ins.operand, shortPrefix) {
+		return 1, false
+	}
+
+	//Operands that aren't known yet, or don't fit the immediate field, are stored in the next word.
+	if err, v := a.evalAbsolute(ins.operand, sec, offset); err == nil && v >= 0 && v <= co.MaxImmediate {
+		return 1, false
+	}
+
+	return 2, true
+}
+
+//Resolves constants that depend on later labels.
+func (a *assembler) resolvePendingEqu() {
+	for _, i := range a.pendingEqu {
+		l := a.lines[i]
+		lay := a.layout[i]
+
+		err, v, target := a.resolve(l.args[1], lay.section, lay.offset)
+		if err != nil {
+			a.lineErrorf(l, "%s", err)
+			continue
+		}
+
+		a.defineEqu(l, v, target)
+	}
+}
+
+//Checks that every exported symbol is defined.
+func (a *assembler) checkGlobals() {
+	for name, l := range a.globals {
+		if _, ok := a.syms[name]; !ok {
+			a.lineErrorf(l, "exported symbol %s is not defined", name)
+		}
+	}
+}
+
+
+/*
+	SECOND PASS
+*/
+//Emits the words of every line.
+func (a *assembler) emitPass() {
+	for _, s := range a.sections {
+		s.words = make([]uint16, s.size)
+		s.used = make([]bool, s.size)
+	}
+
+	for i, l := range a.lines {
+		lay := a.layout[i]
+		op := strings.ToLower(l.op)
+
+		switch op {
+		case "", ".org", ".equ", ".section", ".global", ".extern":
+
+		case ".word":
+			for j, arg := range l.args {
+				offset := lay.offset + uint16(j)
+
+				if ok, v := a.evalWord(l, arg, lay.section, offset, offset, obj.RELOC_WORD); ok {
+					a.emit(l, lay.section, offset, v)
+				}
+			}
+
+		case ".fill":
+			value := 0
+			if len(l.args) == 2 {
+				err, v := a.evalAbsolute(l.args[1], lay.section, lay.offset)
+				if err != nil || v < -0x8000 || v > 0xFFFF {
+					a.lineErrorf(l, "invalid .fill value %q", l.args[1])
+					continue
+				}
+				value = v
+			}
+
+			for j := uint16(0); j < lay.size; j++ {
+				a.emit(l, lay.section, lay.offset + j, uint16(value))
+			}
+
+		case ".string", ".pstring":
+			_, s := parseString(l.args[0])
+			words := encodeString(s, op == ".pstring")
+
+			for j, w := range words {
+				a.emit(l, lay.section, lay.offset + uint16(j), w)
+			}
+
+		default:
+			words := a.encodeInstruction(l, lay)
+
+			for j, w := range words {
+				a.emit(l, lay.section, lay.offset + uint16(j), w)
+			}
+		}
+	}
+}
+
+func (a *assembler) emit(l sourceLine, sec int, offset uint16, word uint16) {
+	s := a.sections[sec]
+
+	if s.used[offset] {
+		a.lineErrorf(l, "address 0x%X is already in use", int(s.origin) + int(offset))
+		return
+	}
+
+	s.words[offset] = word
+	s.used[offset] = true
+}
+
+//Encodes a string, one character per word or two per word when packed, always zero terminated.
+func encodeString(s string, packed bool) []uint16 {
+	if !packed {
+		words := make([]uint16, 0, len(s) + 1)
+		for i := 0; i < len(s); i++ {
+			words = append(words, uint16(s[i]))
+		}
+		return append(words, 0)
+	}
+
+	words := make([]uint16, len(s) / 2 + 1)
+	for i := 0; i < len(s); i++ {
+		if i % 2 == 0 {
+			words[i / 2] |= uint16(s[i]) << 8
+		} else {
+			words[i / 2] |= uint16(s[i])
+		}
+	}
+
+	return words
+}
+
+//Builds the object from the assembled sections.
+func (a *assembler) object(name string) *obj.Object {
+	o := &obj.Object{
+		Name: name,
+		Sections: make([]obj.Section, 0, len(a.sections)),
+		Symbols: make([]obj.Symbol, 0, len(a.syms)),
+		Imports: a.externs,
+		Relocs: a.relocs,
+		Lines: make([]obj.Line, 0),
+	}
+
+	for _, s := range a.sections {
+		o.Sections = append(o.Sections, obj.Section{Name: s.name, Absolute: s.absolute, Origin: s.origin, Words: s.words})
+	}
+
+	names := make([]string, 0, len(a.syms))
+	for name := range a.syms {
+		//Temporary labels are only used inside the file, references to them are already relocated by section.
+		if _, global := a.globals[name]; strings.HasPrefix(name, TemporaryPrefix) && !global {
+			continue
+		}
+
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		def := a.syms[name]
+		_, global := a.globals[name]
+
+		o.Symbols = append(o.Symbols, obj.Symbol{
+			Name: name,
+			Section: def.section,
+			Value: def.value,
+			Global: global,
+			Kind: def.kind,
+			Size: def.size,
+		})
+	}
+
+	for i, l := range a.lines {
+		lay := a.layout[i]
+
+		if lay.size > 0 {
+			o.Lines = append(o.Lines, obj.Line{
+				Section: lay.section,
+				Offset: lay.offset,
+				Size: lay.size,
+				File: l.file,
+				Line: l.num,
+				Text: strings.TrimSpace(stripComment(l.text)),
+			})
+		}
+	}
+
+	return o
+}
@@ -0,0 +1,332 @@
+package asm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Tinch334/Computer-one-v2/co"
+	"github.com/Tinch334/Computer-one-v2/obj"
+)
+
+func TestAssembleString(t *testing.T) {
+	src := `
+.equ COUNT, 3
+.macro inc reg
+	ADD \reg, 1
+.endm
+
+start:	MOV R1, COUNT
+loop:	inc R2
+	ADD R1, -1
+	JMP P, loop
+	JMP done
+data:	.word 0x1234, data, end - start
+	.fill 2, 7
+	.string "hi"
+done:	HLT
+end:
+`
+	err, p := AssembleString("test.asm", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want []uint16
+	for _, ins := range []co.Instruction{
+		{Opcode: co.MOV, Reg: 1, Operand: 3},
+		{Opcode: co.ADD, Reg: 2, Operand: 1},
+		{Opcode: co.ADD, Reg: 1, DoubleMode: true, Operand: 0xFFFF},
+		//Labels are relocatable, so they are always stored in the next word.
+		{Opcode: co.JMP, Reg: co.COND_P, DoubleMode: true, Operand: 1},
+		{Opcode: co.JMP, Reg: co.COND_ALL, DoubleMode: true, Operand: 16},
+	} {
+		want = append(want, ins.Encode()...)
+	}
+	want = append(want, 0x1234, 8, 17, 7, 7, 'h', 'i', 0)
+	want = append(want, co.Instruction{Opcode: co.HLT}.Encode()...)
+
+	if len(p.Segments) != 1 || p.Segments[0].Addr != 0 || !reflect.DeepEqual(p.Segments[0].Words, want) {
+		t.Fatalf("segments %+v, want %04X at 0", p.Segments, want)
+	}
+
+	if s, ok := p.Symbols.Lookup("data"); !ok || s.Addr != 8 {
+		t.Errorf("symbol data = %+v, want address 8", s)
+	}
+	if line, ok := p.LineAt(6); !ok || line.Line != 11 || line.Addr != 6 {
+		t.Errorf("LineAt(6) = %+v, want line 11 at address 6", line)
+	}
+
+	//The program runs to the halt.
+	ci := co.NewComputerInfo()
+	if err := p.Load(ci); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; ; i++ {
+		if i == 100 {
+			t.Fatal("The program didn't halt")
+		}
+
+		err, running := ci.Step()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !running {
+			break
+		}
+	}
+
+	if regs := ci.GetRegisters(); regs.R2 != 3 || regs.PC != 16 {
+		t.Errorf("registers %+v, want R2 = 3 and PC = 16", regs)
+	}
+}
+
+func TestAssembleObject(t *testing.T) {
+	err, o := AssembleObjectString("test.asm", ".extern f\n.global main\nmain:\tJSR f\n\tMOV R1, buf + 1\nbuf:\t.word 0\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//References to labels and imports are left for the linker.
+	want := []obj.Reloc{
+		{Section: 0, Offset: 1, Kind: obj.RELOC_WORD, TargetSection: obj.NoSection, Symbol: "f"},
+		{Section: 0, Offset: 3, Kind: obj.RELOC_WORD, TargetSection: 0, Addend: 5},
+	}
+	if !reflect.DeepEqual(o.Relocs, want) {
+		t.Errorf("relocations %+v, want %+v", o.Relocs, want)
+	}
+
+	if !reflect.DeepEqual(o.Imports, []string{"f"}) {
+		t.Errorf("imports %v, want [f]", o.Imports)
+	}
+
+	for _, s := range o.Symbols {
+		if global := s.Name == "main"; s.Global != global {
+			t.Errorf("symbol %s is global: %v, want %v", s.Name, s.Global, global)
+		}
+	}
+
+	if err, _ := AssembleObjectString("test.asm", ".global nope\nNOP"); err == nil || !strings.Contains(err.Error(), "exported symbol nope is not defined") {
+		t.Errorf("got error %v for an undefined global", err)
+	}
+}
+
+func TestJumpConditions(t *testing.T) {
+	tests := []struct {
+		line string
+		cond uint16
+	}{
+		{"JMP 5", co.COND_ALL},
+		{"JMP N, 5", co.COND_N},
+		{"JMP z, 5", co.COND_Z},
+		{"JMP NP, 5", co.COND_N | co.COND_P},
+		{"JMP ZP, 5", co.COND_P | co.COND_Z},
+		{"JMP NPZ, 5", co.COND_ALL},
+	}
+
+	for _, tt := range tests {
+		err, p := AssembleString("test.asm", tt.line)
+		if err != nil {
+			t.Errorf("assembling %q failed: %v", tt.line, err)
+			continue
+		}
+
+		want := co.Instruction{Opcode: co.JMP, Reg: tt.cond, Operand: 5}.Encode()
+		if got := p.Segments[0].Words; !reflect.DeepEqual(got, want) {
+			t.Errorf("%q assembled to %04X, want %04X", tt.line, got, want)
+		}
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		errs []string
+	}{
+		{"a: NOP\na: NOP", []string{"test.asm:2", "already defined"}},
+		{"FOO R1", []string{"unknown instruction or directive"}},
+		{"MOV R8, 1", []string{"invalid operands"}},
+		{"JMP R1", []string{"can't be a register"}},
+		{"JMP Q, 1", []string{"invalid jump conditions"}},
+		{"JMP NN, 1", []string{"invalid jump conditions"}},
+		{"MOV R1, 0x10000", []string{"16 bits"}},
+		{"MOV R1, nope", []string{"nope"}},
+		{".org 0x400\nNOP", []string{"out of range"}},
+		{".fill -1", []string{"invalid .fill count"}},
+		{".fill 2, 0x10000", []string{"invalid .fill value"}},
+		{".macro m\nNOP", []string{"without a matching .endm"}},
+	}
+
+	for _, tt := range tests {
+		err, _ := AssembleString("test.asm", tt.src)
+		if err == nil {
+			t.Errorf("assembling %q succeeded", tt.src)
+			continue
+		}
+
+		for _, e := range tt.errs {
+			if !strings.Contains(err.Error(), e) {
+				t.Errorf("assembling %q: got error %v, want one containing %q", tt.src, err, e)
+			}
+		}
+	}
+
+	//An invalid value is reported once, not followed by errors about the words it would have filled.
+	err, _ := AssembleObjectString("test.asm", ".fill 2, 0x10000")
+	if n := strings.Count(err.Error(), "\n") + 1; n != 1 {
+		t.Errorf("got %d errors for an invalid .fill value:\n%v", n, err)
+	}
+}
+
+func TestAssembleLine(t *testing.T) {
+	lookup := func(name string) (int, bool) {
+		v, ok := map[string]int{"loop": 0x10, "buf": 0x200, "minus": -1}[name]
+		return v, ok
+	}
+
+	tests := []struct {
+		line string
+		want co.Instruction
+	}{
+		{"NOP", co.Instruction{Opcode: co.NOP}},
+		{"hlt", co.Instruction{Opcode: co.HLT}},
+		{"NOT R3", co.Instruction{Opcode: co.NOT, Reg: 3}},
+		{"MOV R1, 5", co.Instruction{Opcode: co.MOV, Reg: 1, Operand: 5}},
+		{"MOV R1, 0x7F", co.Instruction{Opcode: co.MOV, Reg: 1, Operand: 0x7F}},
+		{"MOV R1, 0x80", co.Instruction{Opcode: co.MOV, Reg: 1, DoubleMode: true, Operand: 0x80}},
+		{"MOV R1, -1", co.Instruction{Opcode: co.MOV, Reg: 1, DoubleMode: true, Operand: 0xFFFF}},
+		{"ADD R2, R7", co.Instruction{Opcode: co.ADD, Reg: 2, RegisterMode: true, Operand: 7}},
+		{"LD R0, [R1]", co.Instruction{Opcode: co.LD, Reg: 0, RegisterMode: true, Operand: 1}},
+		{"ST R4, [buf + 1]", co.Instruction{Opcode: co.ST, Reg: 4, DoubleMode: true, Operand: 0x201}},
+		{"CAS R1, [loop]", co.Instruction{Opcode: co.CAS, Reg: 1, Operand: 0x10}},
+		{"TAS R1, R2", co.Instruction{Opcode: co.TAS, Reg: 1, RegisterMode: true, Operand: 2}},
+		{"SHL R5, 3", co.Instruction{Opcode: co.SHL, Reg: 5, Operand: 3}},
+		{"MUL R1, minus", co.Instruction{Opcode: co.MUL, Reg: 1, DoubleMode: true, Operand: 0xFFFF}},
+		{"JSR buf", co.Instruction{Opcode: co.JSR, DoubleMode: true, Operand: 0x200}},
+		{"TRAP 3", co.Instruction{Opcode: co.TRAP, Operand: 3}},
+		{"USR $ + 2", co.Instruction{Opcode: co.USR, Operand: 0x42}},
+
+		//Jumps without conditions are always taken.
+		{"JMP loop", co.Instruction{Opcode: co.JMP, Reg: co.COND_ALL, Operand: 0x10}},
+		{"JMP N, loop", co.Instruction{Opcode: co.JMP, Reg: co.COND_N, Operand: 0x10}},
+		{"JMP p, loop", co.Instruction{Opcode: co.JMP, Reg: co.COND_P, Operand: 0x10}},
+		{"JMP Z, buf", co.Instruction{Opcode: co.JMP, Reg: co.COND_Z, DoubleMode: true, Operand: 0x200}},
+		{"JMP NZ, loop", co.Instruction{Opcode: co.JMP, Reg: co.COND_N | co.COND_Z, Operand: 0x10}},
+		{"JMP ZP, loop", co.Instruction{Opcode: co.JMP, Reg: co.COND_P | co.COND_Z, Operand: 0x10}},
+		{"JMP NPZ, loop", co.Instruction{Opcode: co.JMP, Reg: co.COND_ALL, Operand: 0x10}},
+	}
+
+	for _, tt := range tests {
+		err, got := AssembleLine(tt.line, 0x40, lookup)
+		if err != nil {
+			t.Errorf("AssembleLine(%q) failed: %v", tt.line, err)
+			continue
+		}
+
+		if want := tt.want.Encode(); !reflect.DeepEqual(got, want) {
+			t.Errorf("AssembleLine(%q) = %04X, want %04X", tt.line, got, want)
+		}
+	}
+}
+
+func TestJumpWithoutConditions(t *testing.T) {
+	err, words := AssembleLine("JMP 0x10", 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//No instruction has set the flags yet.
+	ci := co.NewComputerInfo()
+	if err, _ := ci.Execute(words); err != nil {
+		t.Fatal(err)
+	}
+
+	if pc := ci.GetRegisters().PC; pc != 0x10 {
+		t.Errorf("PC 0x%04X after the jump, want 0x0010", pc)
+	}
+}
+
+func TestAssembleLineErrors(t *testing.T) {
+	tests := []struct {
+		line string
+		err string
+	}{
+		{"FOO R1", "Unknown instruction"},
+		{"label: NOP", "single instruction"},
+		{".word 1", "single instruction"},
+		{"MOV R8, 1", "invalid operands"},
+		{"MOV R1", "invalid operands"},
+		{"RET R1", "invalid operands"},
+		{"JSR R1", "can't be a register"},
+		{"JMP R1", "can't be a register"},
+		{"JMP NN, 1", "invalid jump conditions"},
+		{"JMP X, 1", "invalid jump conditions"},
+		{"JMP NPZN, 1", "invalid jump conditions"},
+		{"JMP N, 1, 2", "invalid operands"},
+		{"MOV R1, <0x80", "immediate field"},
+		{"MOV R1, 0x10000", "16 bits"},
+		{"MOV R1, nope", "Unknown identifier"},
+	}
+
+	for _, tt := range tests {
+		err, _ := AssembleLine(tt.line, 0, nil)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("AssembleLine(%q): got error %v, want one containing %q", tt.line, err, tt.err)
+		}
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	//Instructions are shown the way they are written, so they assemble to the same words.
+	lines := []string{
+		"NOP",
+		"NOT R3",
+		"MOV R1, 0x5",
+		"MOV R1, 0xFFFF",
+		"ADD R2, R7",
+		"LD R0, R1",
+		"JSR 0x200",
+		"JMP 0x10",
+		"JMP N, 0x10",
+		"JMP PZ, 0x10",
+		"JMP NPZ, 0x10",
+	}
+
+	for _, line := range lines {
+		err, words := AssembleLine(line, 0, nil)
+		if err != nil {
+			t.Fatalf("AssembleLine(%q) failed: %v", line, err)
+		}
+		words = append(words, 0)
+
+		got := Disassemble(words[0], words[1], nil)
+
+		want := line
+		if line == "JMP NPZ, 0x10" {
+			want = "JMP 0x10"
+		}
+		if got != want {
+			t.Errorf("Disassemble(%04X) = %q, want %q", words[:1], got, want)
+		}
+	}
+
+	//Jumps with no conditions and invalid opcodes aren't instructions.
+	never := co.Instruction{Opcode: co.JMP, Reg: 0, Operand: 3}.Encode()[0]
+	if got := Disassemble(never, 0, nil); got != ".word 0x5003" {
+		t.Errorf("Disassemble(%04X) = %q, want \".word 0x5003\"", never, got)
+	}
+	if got := Disassemble(0xFFFF, 0, nil); got != ".word 0xFFFF" {
+		t.Errorf("Disassemble(FFFF) = %q, want \".word 0xFFFF\"", got)
+	}
+
+	describe := func(addr uint16) string {
+		if addr == 0x10 {
+			return "loop"
+		}
+		return ""
+	}
+	if got := Disassemble(co.Instruction{Opcode: co.JMP, Reg: co.COND_Z, Operand: 0x10}.Encode()[0], 0, describe); got != "JMP Z, 0x10 <loop>" {
+		t.Errorf("Disassemble with symbols = %q", got)
+	}
+}
@@ -0,0 +1,68 @@
+package asm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Tinch334/Computer-one-v2/co"
+)
+
+//Returns the instruction starting at "word" in assembly syntax, "next" is only used in double mode. Words that aren't
+//instructions are shown as ".word". If "describe" isn't nil it's used to annotate operands that are addresses, it returns
+//an empty string if there is nothing to add.
+func Disassemble(word uint16, next uint16, describe func(uint16) string) string {
+	ins := co.Decode(word, next)
+
+	if !co.ValidOpcode(ins.Opcode) {
+		return fmt.Sprintf(".word 0x%04X", word)
+	}
+
+	name := co.InstructionNames[ins.Opcode]
+
+	operand := fmt.Sprintf("0x%X", ins.Operand)
+	if ins.RegisterMode {
+		operand = fmt.Sprintf("R%d", ins.Operand)
+	}
+
+	//Operands of memory and flow control instructions are addresses.
+	if describe != nil && !ins.RegisterMode {
+		switch ins.Opcode {
+		case co.LD, co.ST, co.JMP, co.JSR, co.CAS, co.TAS, co.USR:
+			if desc := describe(ins.Operand); desc != "" {
+				operand += " <" + desc + ">"
+			}
+		}
+	}
+
+	switch instructionFormats[ins.Opcode] {
+	case FORMAT_REG:
+		return fmt.Sprintf("%s R%d", name, ins.Reg)
+
+	case FORMAT_REG_OPERAND:
+		return fmt.Sprintf("%s R%d, %s", name, ins.Reg, operand)
+
+	case FORMAT_OPERAND:
+		return fmt.Sprintf("%s %s", name, operand)
+
+	case FORMAT_JUMP:
+		if ins.Reg == co.COND_ALL {
+			return fmt.Sprintf("%s %s", name, operand)
+		}
+
+		var conds strings.Builder
+		for _, c := range []struct{bit uint16; name string}{{co.COND_N, "N"}, {co.COND_P, "P"}, {co.COND_Z, "Z"}} {
+			if ins.Reg & c.bit != 0 {
+				conds.WriteString(c.name)
+			}
+		}
+
+		//A jump with no conditions is never taken.
+		if conds.Len() == 0 {
+			return fmt.Sprintf(".word 0x%04X", word)
+		}
+
+		return fmt.Sprintf("%s %s, %s", name, conds.String(), operand)
+	}
+
+	return name
+}
@@ -0,0 +1,306 @@
+package asm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Tinch334/Computer-one-v2/co"
+	"github.com/Tinch334/Computer-one-v2/expr"
+	"github.com/Tinch334/Computer-one-v2/obj"
+)
+
+//Operand formats.
+const (
+	//No operands, "RET".
+	FORMAT_NONE = iota
+	//A register, "NOT R1".
+	FORMAT_REG
+	//A register and a register or value, "ADD R1, R2" or "ADD R1, 5".
+	FORMAT_REG_OPERAND
+	//A value, "JSR label".
+	FORMAT_OPERAND
+	//Optional conditions and a value, "JMP NZ, label", without conditions the jump is always taken.
+	FORMAT_JUMP
+)
+
+//Operand format of every instruction, indexed by opcode.
+var instructionFormats = []int{
+	co.LD: FORMAT_REG_OPERAND,
+	co.ST: FORMAT_REG_OPERAND,
+	co.MOV: FORMAT_REG_OPERAND,
+	co.ADD: FORMAT_REG_OPERAND,
+	co.MUL: FORMAT_REG_OPERAND,
+	co.AND: FORMAT_REG_OPERAND,
+	co.NOT: FORMAT_REG,
+	co.OR: FORMAT_REG_OPERAND,
+	co.SHL: FORMAT_REG_OPERAND,
+	co.SHR: FORMAT_REG_OPERAND,
+	co.JMP: FORMAT_JUMP,
+	co.JSR: FORMAT_OPERAND,
+	co.RET: FORMAT_NONE,
+	co.NOP: FORMAT_NONE,
+	co.HLT: FORMAT_NONE,
+	co.CAS: FORMAT_REG_OPERAND,
+	co.TAS: FORMAT_REG_OPERAND,
+	co.SPP: FORMAT_REG_OPERAND,
+	co.GPP: FORMAT_REG_OPERAND,
+	co.USR: FORMAT_OPERAND,
+	co.TRAP: FORMAT_OPERAND,
+	co.RTT: FORMAT_NONE,
+	co.RTI: FORMAT_NONE,
+}
+
+//An instruction with its operands parsed, the value operand is kept as an expression.
+type parsedInstruction struct {
+	opcode uint16
+	reg uint16
+
+	//Set if the second operand is a register, stored in "operandReg".
+	regMode bool
+	operandReg uint16
+
+	//Expression for the value operand, empty if there is none.
+	operand string
+}
+
+//Returns the opcode for the given mnemonic, mnemonics are case insensitive.
+func LookupOpcode(mnemonic string) (uint16, bool) {
+	for i, name := range co.InstructionNames {
+		if strings.EqualFold(name, mnemonic) {
+			return uint16(i), true
+		}
+	}
+
+	return 0, false
+}
+
+//Parses a register name, "R0" through "R7".
+func parseRegister(s string) (uint16, bool) {
+	if len(s) == 2 && (s[0] == 'R' || s[0] == 'r') && s[1] >= '0' && s[1] <= '7' {
+		return uint16(s[1] - '0'), true
+	}
+
+	return 0, false
+}
+
+//Parses jump conditions, any combination of "N", "P" and "Z".
+func parseConditions(s string) (uint16, bool) {
+	if s == "" || len(s) > 3 {
+		return 0, false
+	}
+
+	var cond uint16
+	for _, c := range strings.ToUpper(s) {
+		var bit uint16
+
+		switch c {
+		case 'N':
+			bit = co.COND_N
+		case 'P':
+			bit = co.COND_P
+		case 'Z':
+			bit = co.COND_Z
+		default:
+			return 0, false
+		}
+
+		if cond & bit != 0 {
+			return 0, false
+		}
+		cond |= bit
+	}
+
+	return cond, true
+}
+
+func parseInstruction(l sourceLine) (error, parsedInstruction) {
+	op, ok := LookupOpcode(l.op)
+	if !ok {
+		return fmt.Errorf("unknown instruction or directive %q", l.op), parsedInstruction{}
+	}
+
+	ins := parsedInstruction{opcode: op}
+	args := l.args
+
+	wrongArgs := func(usage string) (error, parsedInstruction) {
+		return fmt.Errorf("invalid operands, expected \"%s %s\"", co.InstructionNames[op], usage), parsedInstruction{}
+	}
+
+	switch instructionFormats[op] {
+	case FORMAT_NONE:
+		if len(args) != 0 {
+			return wrongArgs("")
+		}
+
+	case FORMAT_REG:
+		if len(args) != 1 {
+			return wrongArgs("<register>")
+		}
+
+		reg, ok := parseRegister(args[0])
+		if !ok {
+			return wrongArgs("<register>")
+		}
+		ins.reg = reg
+
+	case FORMAT_REG_OPERAND:
+		if len(args) != 2 {
+			return wrongArgs("<register>, <register or value>")
+		}
+
+		reg, ok := parseRegister(args[0])
+		if !ok {
+			return wrongArgs("<register>, <register or value>")
+		}
+		ins.reg = reg
+
+		//Memory operands may be written in brackets for readability.
+		operand := args[1]
+		if op == co.LD || op == co.ST || op == co.CAS || op == co.TAS {
+			if strings.HasPrefix(operand, "[") && strings.HasSuffix(operand, "]") {
+				operand = strings.TrimSpace(operand[1 : len(operand) - 1])
+			}
+		}
+
+		if second, ok := parseRegister(operand); ok {
+			ins.regMode = true
+			ins.operandReg = second
+		} else {
+			ins.operand = operand
+		}
+
+	case FORMAT_OPERAND:
+		if len(args) != 1 {
+			return wrongArgs("<value>")
+		}
+
+		if _, ok := parseRegister(args[0]); ok {
+			return errors.New("the operand can't be a register"), parsedInstruction{}
+		}
+		ins.operand = args[0]
+
+	case FORMAT_JUMP:
+		switch len(args) {
+		case 1:
+			ins.reg = co.COND_ALL
+			ins.operand = args[0]
+		case 2:
+			cond, ok := parseConditions(args[0])
+			if !ok {
+				return fmt.Errorf("invalid jump conditions %q, expected a combination of N, P and Z", args[0]), parsedInstruction{}
+			}
+
+			ins.reg = cond
+			ins.operand = args[1]
+		default:
+			return wrongArgs("[conditions,] <value>")
+		}
+
+		if _, ok := parseRegister(ins.operand); ok {
+			return errors.New("the operand can't be a register"), parsedInstruction{}
+		}
+	}
+
+	return nil, ins
+}
+
+//Encodes an instruction, using the operand size chosen in the first pass.
+func (a *assembler) encodeInstruction(l sourceLine, lay lineLayout) []uint16 {
+	err, p := parseInstruction(l)
+	if err != nil {
+		a.lineErrorf(l, "%s", err)
+		return nil
+	}
+
+	ins := co.Instruction{Opcode: p.opcode, Reg: p.reg}
+
+	switch {
+	case p.regMode:
+		ins.RegisterMode = true
+		ins.Operand = p.operandReg
+
+	case lay.double:
+		//The operand is in the next word.
+		ok, v := a.evalWord(l, p.operand, lay.section, lay.offset, lay.offset + 1, obj.RELOC_WORD)
+		if !ok {
+			return nil
+		}
+
+		ins.DoubleMode = true
+		ins.Operand = v
+
+	case p.operand != "":
+		//Sizes are fixed in the first pass, by then every value that fit the immediate field was known, the rest are
+		//forced with the short prefix.
+		ok, v := a.evalWord(l, strings.TrimPrefix(p.operand, shortPrefix), lay.section, lay.offset, lay.offset, obj.RELOC_IMM7)
+		if !ok {
+			return nil
+		}
+
+		ins.Operand = v
+	}
+
+	return ins.Encode()
+}
+
+//Assembles a single instruction as if it was at "addr", used to patch memory. Symbols are resolved with "lookup", which
+//may be nil, and "$" is the address.
+func AssembleLine(line string, addr uint16, lookup func(string) (int, bool)) (error, []uint16) {
+	err, label, op, args := parseLine(line)
+	if err != nil {
+		return err, nil
+	}
+
+	if label != "" || op == "" || strings.HasPrefix(op, ".") {
+		return errors.New("Expected a single instruction"), nil
+	}
+
+	if _, ok := LookupOpcode(op); !ok {
+		return fmt.Errorf("Unknown instruction %q", op), nil
+	}
+
+	err, p := parseInstruction(sourceLine{op: op, args: args, text: line})
+	if err != nil {
+		return err, nil
+	}
+
+	ins := co.Instruction{Opcode: p.opcode, Reg: p.reg}
+
+	switch {
+	case p.regMode:
+		ins.RegisterMode = true
+		ins.Operand = p.operandReg
+
+	case p.operand != "":
+		env := expr.Env{Lookup: func(name string) (int, bool) {
+			if name == "$" {
+				return int(addr), true
+			}
+			if lookup == nil {
+				return 0, false
+			}
+			return lookup(name)
+		}}
+
+		short := strings.HasPrefix(p.operand, shortPrefix)
+
+		err, v := expr.Eval(strings.TrimPrefix(p.operand, shortPrefix), env)
+		if err != nil {
+			return err, nil
+		}
+
+		switch {
+		case v < -0x8000 || v > 0xFFFF:
+			return fmt.Errorf("The value %d does not fit in 16 bits", v), nil
+		case short && (v < 0 || v > co.MaxImmediate):
+			return fmt.Errorf("The value %d does not fit in the immediate field", v), nil
+		case v < 0 || v > co.MaxImmediate:
+			ins.DoubleMode = true
+		}
+
+		ins.Operand = uint16(v)
+	}
+
+	return nil, ins.Encode()
+}
@@ -0,0 +1,337 @@
+package asm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Tinch334/Computer-one-v2/expr"
+)
+
+//Maximum nesting for includes and macro expansions, avoids infinite recursion.
+const maxDepth = 16
+
+//A source line after includes and macros are expanded.
+type sourceLine struct {
+	file string
+	num int
+
+	//Name of the macro the line was expanded from, if any.
+	macro string
+
+	label string
+	op string
+	args []string
+	text string
+}
+
+func (l sourceLine) pos() string {
+	if l.macro != "" {
+		return fmt.Sprintf("%s:%d (in macro %s)", l.file, l.num, l.macro)
+	}
+	return fmt.Sprintf("%s:%d", l.file, l.num)
+}
+
+type macro struct {
+	name string
+	params []string
+	body []string
+
+	//Where the macro was defined, used for errors.
+	file string
+	num int
+}
+
+//Matches "@name" local labels in macro bodies.
+var localLabelRegex = regexp.MustCompile(`@[A-Za-z_][A-Za-z0-9_]*`)
+
+
+/*
+	LINE PARSING
+*/
+//Removes a ";" comment, ignoring semicolons inside string and character literals.
+func stripComment(line string) string {
+	var quote byte
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+
+		switch {
+		case quote != 0 && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == ';':
+			return line[:i]
+		}
+	}
+
+	return line
+}
+
+//Splits operands on commas, ignoring commas inside literals, parentheses and brackets.
+func splitArgs(s string) []string {
+	args := make([]string, 0)
+
+	if strings.TrimSpace(s) == "" {
+		return args
+	}
+
+	var quote byte
+	depth := 0
+	start := 0
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		switch {
+		case quote != 0 && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(' || c == '[':
+			depth++
+		case c == ')' || c == ']':
+			depth--
+		case c == ',' && depth == 0:
+			args = append(args, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+
+	return append(args, strings.TrimSpace(s[start:]))
+}
+
+//Splits a line into its label, operation and operands.
+func parseLine(text string) (error, string, string, []string) {
+	line := strings.TrimSpace(stripComment(text))
+	label := ""
+
+	//A label is an identifier followed by ":".
+	i := 0
+	for i < len(line) && expr.IsIdentChar(line[i], i == 0) {
+		i++
+	}
+
+	if i > 0 && i < len(line) && line[i] == ':' {
+		label = line[:i]
+		line = strings.TrimSpace(line[i + 1:])
+	}
+
+	if line == "" {
+		return nil, label, "", nil
+	}
+
+	op, rest, _ := strings.Cut(line, " ")
+	if tab := strings.IndexByte(op, '\t'); tab >= 0 {
+		op, rest = op[:tab], op[tab:] + " " + rest
+	}
+
+	args := splitArgs(rest)
+	for _, a := range args {
+		if a == "" {
+			return fmt.Errorf("Empty operand in %q", strings.TrimSpace(text)), "", "", nil
+		}
+	}
+
+	return nil, label, op, args
+}
+
+//Parses a double quoted string literal.
+func parseString(arg string) (error, string) {
+	if !strings.HasPrefix(arg, "\"") {
+		return fmt.Errorf("Expected a string literal, got %q", arg), ""
+	}
+
+	s, err := strconv.Unquote(arg)
+	if err != nil {
+		return fmt.Errorf("Invalid string literal %s", arg), ""
+	}
+
+	return nil, s
+}
+
+
+/*
+	PREPROCESSING
+*/
+//Reads a source file, expanding includes and macros into the list of lines.
+func (a *assembler) preprocessFile(path string, depth int) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		a.errorf("%s", err)
+		return
+	}
+
+	a.preprocess(path, string(contents), 1, depth)
+}
+
+//Processes source lines, "firstLine" is the line number of the first line in "src".
+func (a *assembler) preprocess(file string, src string, firstLine int, depth int) {
+	if depth > maxDepth {
+		a.errorf("%s: includes nested too deeply", file)
+		return
+	}
+
+	lines := strings.Split(src, "\n")
+
+	for i := 0; i < len(lines); i++ {
+		num := i + firstLine
+
+		err, label, op, args := parseLine(lines[i])
+		if err != nil {
+			a.errorf("%s:%d: %s", file, num, err)
+			continue
+		}
+
+		switch strings.ToLower(op) {
+		case ".include":
+			if len(args) != 1 {
+				a.errorf("%s:%d: .include expects a file name", file, num)
+				continue
+			}
+
+			err, name := parseString(args[0])
+			if err != nil {
+				a.errorf("%s:%d: %s", file, num, err)
+				continue
+			}
+
+			//Included files are relative to the including file.
+			if !filepath.IsAbs(name) {
+				name = filepath.Join(filepath.Dir(file), name)
+			}
+
+			if label != "" {
+				a.lines = append(a.lines, sourceLine{file: file, num: num, label: label, text: lines[i]})
+			}
+
+			a.preprocessFile(name, depth + 1)
+
+		case ".macro":
+			if len(args) == 0 {
+				a.errorf("%s:%d: .macro expects a name", file, num)
+				continue
+			}
+
+			//The name and the first parameter are separated by a space, not a comma.
+			fields := strings.Fields(args[0])
+			m := macro{name: fields[0], params: append(fields[1:], args[1:]...), file: file, num: num}
+
+			//Collect the body.
+			closed := false
+			for i++; i < len(lines); i++ {
+				_, _, bodyOp, _ := parseLine(lines[i])
+
+				if strings.ToLower(bodyOp) == ".endm" {
+					closed = true
+					break
+				}
+
+				m.body = append(m.body, lines[i])
+			}
+
+			if !closed {
+				a.errorf("%s:%d: .macro %s without a matching .endm", file, num, m.name)
+				continue
+			}
+
+			if _, exists := a.macros[m.name]; exists {
+				a.errorf("%s:%d: macro %s already defined", file, num, m.name)
+				continue
+			}
+
+			a.macros[m.name] = m
+
+		case ".endm":
+			a.errorf("%s:%d: .endm without a matching .macro", file, num)
+
+		default:
+			if m, ok := a.macros[op]; ok {
+				if label != "" {
+					a.lines = append(a.lines, sourceLine{file: file, num: num, label: label, text: lines[i]})
+				}
+
+				a.expandMacro(m, args, file, num, depth + 1)
+				continue
+			}
+
+			a.lines = append(a.lines, sourceLine{file: file, num: num, label: label, op: op, args: args, text: lines[i]})
+		}
+	}
+}
+
+//Expands a macro invocation, parameters are written "\name" in the body and labels starting with "@" are local to each
+//expansion.
+func (a *assembler) expandMacro(m macro, args []string, file string, num int, depth int) {
+	if depth > maxDepth {
+		a.errorf("%s:%d: macros nested too deeply", file, num)
+		return
+	}
+
+	if len(args) != len(m.params) {
+		a.errorf("%s:%d: macro %s expects %d arguments, got %d", file, num, m.name, len(m.params), len(args))
+		return
+	}
+
+	a.expansions++
+	suffix := fmt.Sprintf("__%s_%d", m.name, a.expansions)
+
+	body := make([]string, len(m.body))
+	for i, line := range m.body {
+		line = replaceParams(line, m.params, args)
+		body[i] = localLabelRegex.ReplaceAllStringFunc(line, func(l string) string {
+			return l[1:] + suffix
+		})
+	}
+
+	//The expanded body is processed like regular source, so it may use other macros. Errors found while doing so point
+	//to the definition, once expanded lines point to the invocation.
+	start := len(a.lines)
+	a.preprocess(m.file, strings.Join(body, "\n"), m.num + 1, depth)
+
+	for i := start; i < len(a.lines); i++ {
+		if a.lines[i].macro == "" {
+			a.lines[i].file = file
+			a.lines[i].num = num
+			a.lines[i].macro = m.name
+		}
+	}
+}
+
+//Replaces "\param" with its argument, longest parameter names first.
+func replaceParams(line string, params []string, args []string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(line); i++ {
+		if line[i] != '\\' {
+			b.WriteByte(line[i])
+			continue
+		}
+
+		best := -1
+		for j, p := range params {
+			if strings.HasPrefix(line[i + 1:], p) && (best < 0 || len(p) > len(params[best])) {
+				best = j
+			}
+		}
+
+		if best < 0 {
+			b.WriteByte(line[i])
+			continue
+		}
+
+		b.WriteString(args[best])
+		i += len(params[best])
+	}
+
+	return b.String()
+}
@@ -0,0 +1,62 @@
+package cli
+
+import (
+    "fmt"
+    "os"
+    "text/tabwriter"
+
+    "github.com/Tinch334/Computer-one-v2/co"
+)
+
+//Instructions run by each benchmark if no amount is given.
+const DefaultBenchInstructions = 10_000_000
+
+type BenchOptions struct {
+    //Instructions run by each benchmark, with each execution path.
+    Instructions int
+
+    //If set this program is measured instead of the benchmark suite.
+    ProgramPath string
+}
+
+//Runs the benchmarks and prints the simulated instructions per second of each execution path.
+func RunBench(opts BenchOptions) error {
+    if opts.Instructions <= 0 {
+        return fmt.Errorf("The amount of instructions must be positive")
+    }
+
+    benchmarks := co.Benchmarks()
+
+    if opts.ProgramPath != "" {
+        ci := co.NewComputerInfo()
+        if err := loadProgram(opts.ProgramPath, ci, newControl(ci, nil, nil)); err != nil {
+            return err
+        }
+
+        _, mem := ci.GetMemory(0, co.MemorySize)
+        benchmarks = []co.Benchmark{{Name: opts.ProgramPath, Program: mem, Entry: ci.GetRegisters().PC}}
+    }
+
+    w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+    fmt.Fprintf(w, "Benchmark\tInstructions\tDecoding (ins/s)\tPredecoded (ins/s)\tSpeedup\t\n")
+
+    for _, b := range benchmarks {
+        err, res := co.RunBenchmark(b, opts.Instructions)
+        if err != nil {
+            w.Flush()
+            return err
+        }
+
+        decoding := co.PerSecond(res.Instructions, res.Decoding)
+        predecoded := co.PerSecond(res.Instructions, res.Predecoded)
+
+        speedup := 0.0
+        if decoding > 0 {
+            speedup = predecoded / decoding
+        }
+
+        fmt.Fprintf(w, "%s\t%d\t%.0f\t%.0f\t%.2fx\t\n", res.Name, res.Instructions, decoding, predecoded, speedup)
+    }
+
+    return w.Flush()
+}
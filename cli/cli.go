@@ -1,22 +1,44 @@
 package cli
 
 import (
+    "context"
     "fmt"
     "strings"
-    "bufio"
+    "io"
     "os"
+    "os/signal"
 
     "github.com/Tinch334/Computer-one-v2/co"
-    "github.com/fatih/color"
+    "github.com/Tinch334/Computer-one-v2/lineedit"
+    "github.com/Tinch334/Computer-one-v2/link"
+    "github.com/Tinch334/Computer-one-v2/symbols"
+    "github.com/Tinch334/Computer-one-v2/system"
 )
 
-func RunCli() {
+//Options for a debugger session.
+type Options struct {
+    //If set the commands in this file are run, and the session ends once it's done.
+    ScriptPath string
+
+    //If set this assembly file is loaded instead of the default program.
+    ProgramPath string
+
+    //If set the default system is loaded with a console, and the program runs in user mode after it.
+    System bool
+
+    //If set the display is recorded every "CaptureEvery" instructions, and saved to this file as an animated GIF if
+    //it ends in ".gif" or as PNG files in this directory otherwise. A display is attached if the session has none.
+    CapturePath string
+    CaptureEvery int
+}
+
+func RunCli(opts Options) {
     ci := co.NewComputerInfo()
 
     memLoad := []uint16{
         0b0000010011111111, //LD r4 <- mem[PC + 1]
         0b0000000000000011, //Double mode value
-        0b0000001010000100, //LD r2 <- mem[r2]
+        0b0000001010000100, //LD r2 <- mem[r4]
         0b0111000000000000, //HLT
         0b0000000000001110,
         0b0000000000000000,
@@ -31,99 +53,230 @@ func RunCli() {
         0b0000000000000011,
     }
 
-    ci.SetMemoryBlock(0, memLoad)
+    //SIGINT pauses execution instead of terminating the program.
+    interrupt := make(chan os.Signal, 1)
+    signal.Notify(interrupt, os.Interrupt)
 
-    reader := bufio.NewReader(os.Stdin)
+    //Stops the runners once the session ends.
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
 
-    control := interpreterControl{
-        running: true,
-        step: false,
-        cont: false,
+    machines := &machineList{ctx: ctx, headless: opts.ScriptPath != ""}
+    control := newControl(ci, interrupt, machines)
+
+    config := defaultConfig()
+    loadConfig(&config, control.syms)
+
+    machines.Add(&machine{name: firstMachine, ctrl: control, cfg: &config})
+    machines.switched = false
+
+    if opts.System {
+        if err := loadSystem("", ci, control); err != nil {
+            fmt.Fprintf(os.Stderr, "%s\n", err)
+            os.Exit(1)
+        }
     }
 
-    config := interpreterConfig {
-        memoryLimitL: 0,
-        memoryLimitH: 40,
+    if opts.ProgramPath != "" {
+        if err := loadProgram(opts.ProgramPath, ci, control); err != nil {
+            fmt.Fprintf(os.Stderr, "%s\n", err)
+            os.Exit(1)
+        }
+    } else if !opts.System {
+        ci.SetMemoryBlock(0, memLoad)
+    }
 
-        highlightPC: true,
-        highlightPCColour: color.New(color.FgBlue),
+    if opts.CapturePath != "" {
+        if control.display == nil {
+            if err := attachDisplay(system.DISPLAY, ci, control); err != nil {
+                fmt.Fprintf(os.Stderr, "%s\n", err)
+                os.Exit(1)
+            }
+        }
 
-        exitOnError: false,
+        control.recorder = newRecorder(opts.CapturePath, opts.CaptureEvery)
+        defer saveCapture(control)
     }
 
-    run(ci, reader, &control, &config)
+    //Non-interactive session.
+    if opts.ScriptPath != "" {
+        if err := runScriptFile(opts.ScriptPath, ci, control, &config); err != nil {
+            fmt.Fprintf(os.Stderr, "%s\n", err)
+            saveCapture(control)
+            os.Exit(1)
+        }
+
+        return
+    }
+
+    editor := lineedit.New(os.Stdin, os.Stdout)
+    editor.Complete = completer(machines)
+    loadHistory(editor)
+
+    run(machines, editor)
+}
+
+//Saves the frames recorded by the capture, if there is one.
+func saveCapture(ctrl *interpreterControl) {
+    if ctrl.recorder == nil {
+        return
+    }
+
+    err, n := ctrl.recorder.Save(ctrl.display)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Saving the capture: %s\n", err)
+        return
+    }
+
+    fmt.Fprintf(os.Stderr, "Saved %d frames to %s\n", n, ctrl.recorder.path)
 }
 
-func run(ci *co.ComputerInfo, reader *bufio.Reader, ctrl *interpreterControl, cfg *interpreterConfig) {
+func run(machines *machineList, editor *lineedit.Editor) {
     printNext := true
 
     //Runs the interpreting loop as long as the program runs.
-    for ctrl.running {
+    for machines.current.ctrl.running {
+        ci, ctrl, cfg := machines.Current()
+
+        //Report what happened while the program ran in the background.
+        if ctrl.runner.Running() || len(ctrl.runner.Events()) > 0 {
+            printNext = pollEvents(ctrl, cfg) || printNext
+            ci = ctrl.CurrentCore()
+
+            if !ctrl.running {
+                break
+            }
+        }
+
+        printProgramOutput(ctrl)
+        printDisplay(ctrl)
+
         //Print info.
         if printNext {
-            printRegs(ci)
-            printMemory(ci, cfg)
+            ctrl.Locked(func() {
+                changes := diffState(ctrl.savedState, ci, cfg)
+                ctrl.savedState = nil
+
+                if status := coreStatus(ctrl); status != "" {
+                    fmt.Printf("%s\n", status)
+                }
+                printRegs(ci, ctrl.syms, changes)
+                if cfg.changeSummary {
+                    fmt.Printf("%s\n\n", changes.Summary())
+                }
+                printSourceLine(ci, ctrl.program, ctrl.system)
+                printMemory(ci, ctrl.syms, cfg, changes)
+            })
 
             printNext = false
         }
 
-        ctrl.step = false
+        defining := ctrl.definition != nil
+        processInput(editor, ci, ctrl, cfg)
 
-        //Check if we should continue or check for a step.
-        if ctrl.cont {
-            //Step the program until a breakpoint is reached
-            if ctrl.HasBreakpoint(ci.GetRegisters().PC) {
-                ctrl.cont = false
-            } else {
-                ctrl.step = true
-            }
-            
-        } else {
-            processInput(reader, ci, ctrl, cfg)
+        //Wait for a background run to pause.
+        if ctrl.pausing {
+            ctrl.pausing = false
+            waitForStop(ctrl, cfg)
+        }
+
+        //Commands may switch to another machine.
+        if machines.switched {
+            machines.switched = false
+            printNext = true
+            ci, ctrl, cfg = machines.Current()
         }
 
         //Step program.
         if ctrl.step {
-            err, run := ci.Step()
-            if !run {
-                ctrl.running = false
-                fmt.Printf("Program halted\n")
-            }
-
-            if err != nil {
-                if cfg.exitOnError {
-                    ctrl.running = false
-                } else {
-                    fmt.Printf("An error occurred during execution: %s\n", err)
-                }
-            }
+            execute(ci, ctrl, cfg)
+        }
 
+        //Scripts may also execute instructions.
+        if ctrl.executed {
+            ctrl.executed = false
             printNext = true
         }
 
-        fmt.Printf("\n")
+        //Lines of a macro being defined print nothing.
+        if !defining || ctrl.definition == nil {
+            fmt.Printf("\n")
+        }
     }
 }
 
-func processInput(reader *bufio.Reader, ci *co.ComputerInfo, ctrl *interpreterControl, cfg *interpreterConfig) {
-    fmt.Printf(">")
-    line, err := reader.ReadString('\n')
+func processInput(editor *lineedit.Editor, ci *co.ComputerInfo, ctrl *interpreterControl, cfg *interpreterConfig) {
+    prompt := ctrl.machines.Prompt()
+    if ctrl.definition != nil {
+        prompt = ">>"
+    }
+
+    line, err := editor.ReadLine(prompt)
 
     if err != nil {
+        //Ctrl-C discards the line, and the macro being defined. It also pauses a program running in the background.
+        if err == lineedit.ErrInterrupted {
+            ctrl.definition = nil
+
+            if ctrl.runner.Running() {
+                ctrl.runner.Pause()
+                ctrl.pausing = true
+            }
+            return
+        }
+
+        //End of input ends the session, after running the last line and any execution it started.
+        if err == io.EOF {
+            ctrl.Locked(func() { runCommand(line, ci, ctrl, cfg) })
+
+            if ctrl.running && ctrl.step {
+                execute(ci, ctrl, cfg)
+            }
+
+            ctrl.running = false
+            return
+        }
+
         fmt.Println("Error reading input:", err)
         return
     }
 
-    //Remove newline and check for an empty line.
-    line = strings.TrimSuffix(line, "\n")
+    if ctrl.definition != nil {
+        addDefinitionLine(line, ctrl, cfg)
+        return
+    }
+
+    //Commands may inspect the state while the program runs in the background.
+    ctrl.Locked(func() { runCommand(line, ci, ctrl, cfg) })
+}
 
-    if line == "" {
+//Runs a single command line, steps and continues are left pending for "execute".
+func runCommand(line string, ci *co.ComputerInfo, ctrl *interpreterControl, cfg *interpreterConfig) {
+    //Remove newline and check for an empty line or a comment.
+    line = strings.TrimSpace(line)
+
+    if line == "" || strings.HasPrefix(line, COMMENT) {
         return
     }
     
     contents := strings.Fields(line)
     command, arguments := contents[0], contents[1:]
 
+    //Expressions are evaluated by their commands, everywhere else variables are replaced by their values.
+    if command != SET && command != ECHO && command != ALIAS {
+        err, expanded := expandVariables(arguments, ctrl)
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "%s\n", err)
+            return
+        }
+
+        arguments = expanded
+    }
+
+    if refuseWhileRunning(command, ctrl) {
+        return
+    }
+
     switch command {
     case STEP:
         fallthrough
@@ -133,13 +286,136 @@ func processInput(reader *bufio.Reader, ci *co.ComputerInfo, ctrl *interpreterCo
     case CONTINUE:
         fallthrough
     case CONTINUE_SHORT:
-        ctrl.cont = true
+        ctrl.StartContinue(cfg.stepLimit, cfg.timeout)
+
+    case RUN:
+        fallthrough
+    case RUN_SHORT:
+        runHandler(ctrl, cfg, arguments)
+
+    case NEXT:
+        fallthrough
+    case NEXT_SHORT:
+        nextHandler(ci, ctrl, cfg)
+
+    case FINISH:
+        fallthrough
+    case FINISH_SHORT:
+        ctrl.StartContinue(cfg.stepLimit, cfg.timeout)
+        ctrl.StartDepthTracking(-1)
+
+    case UNTIL:
+        fallthrough
+    case UNTIL_SHORT:
+        untilHandler(ctrl, cfg, arguments)
 
     case BREAKPOINT:
         fallthrough
     case BREAKPOINT_SHORT:
         breakpointHandler(ctrl, cfg, arguments)
 
+    case REGISTER:
+        fallthrough
+    case REGISTER_SHORT:
+        registerHandler(ci, ctrl, arguments)
+
+    case FLAG:
+        fallthrough
+    case FLAG_SHORT:
+        flagHandler(ci, ctrl, arguments)
+
+    case PC:
+        pcHandler(ci, ctrl, arguments)
+
+    case SYMBOL:
+        fallthrough
+    case SYMBOL_SHORT:
+        symbolHandler(ctrl, arguments)
+
+    case LOAD:
+        loadHandler(ci, ctrl, arguments)
+
+    case ASM:
+        asmHandler(ci, ctrl, arguments)
+
+    case EXEC:
+        execHandler(ci, ctrl, arguments)
+
+    case SOURCE:
+        sourceHandler(ci, ctrl, cfg, arguments)
+
+    case BACKGROUND:
+        fallthrough
+    case BACKGROUND_SHORT:
+        backgroundHandler(ctrl, cfg, arguments)
+
+    case PAUSE:
+        pauseHandler(ctrl, arguments)
+
+    case CORE:
+        fallthrough
+    case CORE_SHORT:
+        coreHandler(ctrl, arguments)
+
+    case MACHINE:
+        fallthrough
+    case MACHINE_SHORT:
+        machineHandler(ctrl, arguments)
+
+    case MPU:
+        mpuHandler(ci, ctrl, arguments)
+
+    case SYSTEM:
+        fallthrough
+    case SYSTEM_SHORT:
+        systemHandler(ci, ctrl, cfg, arguments)
+
+    case CONSOLE:
+        fallthrough
+    case CONSOLE_SHORT:
+        consoleHandler(ci, ctrl, line, arguments)
+
+    case DISPLAY:
+        fallthrough
+    case DISPLAY_SHORT:
+        displayHandler(ci, ctrl, arguments)
+
+    case SCREENSHOT:
+        screenshotHandler(ctrl, arguments)
+
+    case DISK:
+        fallthrough
+    case DISK_SHORT:
+        diskHandler(ci, ctrl, arguments)
+
+    case TIMER:
+        fallthrough
+    case TIMER_SHORT:
+        timerHandler(ci, ctrl, arguments)
+
+    case CLOCK:
+        fallthrough
+    case CLOCK_SHORT:
+        clockHandler(ci, ctrl, arguments)
+
+    case ALIAS:
+        aliasHandler(line, cfg)
+
+    case DEFINE:
+        defineHandler(ctrl, cfg, arguments)
+
+    case UNALIAS, UNDEFINE:
+        deleteUserCommand(command, cfg, arguments)
+
+    case SET:
+        setHandler(line, ci, ctrl)
+
+    case ECHO:
+        echoHandler(line, ci, ctrl)
+
+    case IF, ELSE, WHILE, END:
+        fmt.Fprintf(os.Stderr, "%q can only be used in scripts\n", command)
+
     case EXIT:
         fallthrough
     case EXIT_SHORT:
@@ -153,16 +429,17 @@ func processInput(reader *bufio.Reader, ci *co.ComputerInfo, ctrl *interpreterCo
     case CONFIGURE:
         fallthrough
     case CONFIGURE_SHORT:
-        configurationHandler(cfg, arguments)
+        configurationHandler(ctrl, cfg, arguments)
 
     case MEMORY_CONTROL:
         fallthrough
     case MEMORY_CONTROL_SHORT:
-        memoryControlHandler(ci, arguments)
+        memoryControlHandler(ci, ctrl, cfg, arguments)
 
     default:
-        fmt.Println("Unknown command, use \"h\" for help")
-        return
+        if !runUserCommand(command, arguments, ci, ctrl, cfg) {
+            fmt.Println("Unknown command, use \"h\" for help")
+        }
     }
 }
 
@@ -177,52 +454,48 @@ func btoi(b bool) string {
     return "0"
 }
 
-//Prints all registers.
-func printRegs(ci *co.ComputerInfo) {
+//Prints all registers, the PC is annotated with the nearest symbol. Registers and flags in "changes" are highlighted, it
+//may be nil.
+func printRegs(ci *co.ComputerInfo, syms *symbols.Table, changes *stateChanges) {
     regs := ci.GetRegisters()
-    flags := ci.GetFlags()
-    flagsStr := btoi(flags.N) + btoi(flags.P) + btoi(flags.Z)
-
-    fmt.Printf("PC: 0x%04x | NPZ: %s | R0: 0x%04x R1: 0x%04x R2: 0x%04x R3:0x%04x R4:0x%04x R5:0x%04x R6:0x%04x R7:0x%04x\n",
-        regs.PC, flagsStr, regs.R0, regs.R1, regs.R2, regs.R3, regs.R4, regs.R5, regs.R6, regs.R7)
-
-    fmt.Printf("\n",
-        )
-}
-
-//Prints memory contents, note that "tabwriter" cannot be used because ANSI escape codes are used for colour, and they get counted
-//by the package.
-func printMemory(ci *co.ComputerInfo, cfg *interpreterConfig) {
-    start := cfg.memoryLimitL
-    end := cfg.memoryLimitH
+    flags := flagString(ci.GetFlags())
 
-    pc := int(ci.GetRegisters().PC)
+    pcSymbol := ""
+    if desc := syms.Describe(regs.PC); desc != "" {
+        pcSymbol = " <" + desc + ">"
+    }
 
-    valuesPerRow := 8
-    const hexAddrWidth = 4
+    flagsStr := ""
+    for i := range flags {
+        flagsStr += changes.highlight(changes.flag(i), flags[i:i + 1])
+    }
 
-    //Get appropriate memory cells to print.
-    _, mem := ci.GetMemory(start, end)
+    regsStr := make([]string, len(registerNames))
+    for i, value := range generalRegisters(regs) {
+        regsStr[i] = changes.highlight(changes.register(i), fmt.Sprintf("%s: 0x%04x", registerNames[i], value))
+    }
 
-    for i, elem := range mem {
-        //Print memory cell number along with spacing.
-        if (i % valuesPerRow) == 0 {
-            if i != 0 {
-                fmt.Printf("\n")
-            }
+    fmt.Printf("PC: 0x%04x%s | NPZ: %s | %s | Mode: %s\n\n", regs.PC, pcSymbol, flagsStr, strings.Join(regsStr, " "), modeName(ci))
+}
 
-            fmt.Printf("0x%0*x : ", hexAddrWidth, (start + uint16(i)))
-        }
-        //Print element.
-        if i + int(start) == pc {
-            cfg.highlightPCColour.Printf("0x%04x", elem)
-        } else {
-            fmt.Printf("0x%04x", elem)
+//Prints the source line the instruction at the PC comes from, if it's known.
+func printSourceLine(ci *co.ComputerInfo, images ...*link.Image) {
+    for _, img := range images {
+        if img == nil {
+            continue
         }
 
-        //Space between cells.
-        fmt.Printf("  ")
+        if l, ok := img.LineAt(ci.GetRegisters().PC); ok {
+            fmt.Printf("%s:%d: %s\n\n", l.File, l.Line, l.Text)
+            return
+        }
     }
+}
 
+//Prints the configured memory window in the configured view.
+func printMemory(ci *co.ComputerInfo, syms *symbols.Table, cfg *interpreterConfig, changes *stateChanges) {
+    start, end := memoryWindow(ci.GetRegisters().PC, cfg)
+
+    printMemoryView(ci, syms, cfg, start, end, cfg.memoryView, changes)
     fmt.Printf("\n")
-}
\ No newline at end of file
+}
@@ -5,15 +5,65 @@ import (
 	"fmt"
 	"strconv"
 	"os"
+	"path/filepath"
 	"strings"
 	"errors"
 
 	"text/tabwriter"
 
+	"github.com/Tinch334/Computer-one-v2/asm"
 	"github.com/Tinch334/Computer-one-v2/co"
+	"github.com/Tinch334/Computer-one-v2/compiler"
+	"github.com/Tinch334/Computer-one-v2/device"
+	"github.com/Tinch334/Computer-one-v2/expr"
+	"github.com/Tinch334/Computer-one-v2/link"
+	"github.com/Tinch334/Computer-one-v2/obj"
+	"github.com/Tinch334/Computer-one-v2/symbols"
+	"github.com/Tinch334/Computer-one-v2/system"
 )
 
 
+//Steps over subroutine calls and traps, any other instruction is a regular step.
+func nextHandler(ci *co.ComputerInfo, ctrl *interpreterControl, cfg *interpreterConfig) {
+    if ins := ci.GetCurrentInstruction(); ins == co.JSR || ins == co.TRAP {
+        ctrl.StartContinue(cfg.stepLimit, cfg.timeout)
+        ctrl.StartDepthTracking(0)
+    } else {
+        ctrl.step = true
+    }
+}
+
+//Continues execution for at most the given amount of steps, the configured timeout still applies.
+func runHandler(ctrl *interpreterControl, cfg *interpreterConfig, args []string) {
+    if len(args) != 1 {
+        printErrorMsg(RUN)
+        return
+    }
+
+    steps, err := strconv.Atoi(args[0])
+    if err != nil || steps <= 0 {
+        fmt.Fprintf(os.Stderr, "Invalid step count: %q\n", args[0])
+        return
+    }
+
+    ctrl.StartContinue(steps, cfg.timeout)
+}
+
+func untilHandler(ctrl *interpreterControl, cfg *interpreterConfig, args []string) {
+    if len(args) != 1 {
+        printErrorMsg(UNTIL)
+        return
+    }
+
+    err, addr := convValidateMemoryAddr(args[0], ctrl.syms)
+    if err != nil {
+        return
+    }
+
+    ctrl.StartContinue(cfg.stepLimit, cfg.timeout)
+    ctrl.SetTempBreakpoint(addr)
+}
+
 func breakpointHandler(ctrl *interpreterControl, cfg *interpreterConfig, args []string) {
     if len(args) == 0 {
         printErrorMsg(BREAKPOINT)
@@ -22,19 +72,32 @@ func breakpointHandler(ctrl *interpreterControl, cfg *interpreterConfig, args []
 
     switch args[0] {
     case BREAKPOINT_SET:
-    	if len(args) != 2 {
+    	if len(args) != 2 && len(args) != 3 {
             printErrorMsg(BREAKPOINT)
             return
         }
 
         //Get line number and check for errors.
-        err, addr := convValidateMemoryAddr(args[1])
+        err, addr := convValidateMemoryAddr(args[1], ctrl.syms)
         if err != nil {
         	return
         }
 
-        ctrl.AddBreakpoint(addr)
-        fmt.Printf("Breakpoint added at address 0x%X", addr)
+        //Without a core the breakpoint stops any of them.
+        if len(args) == 2 {
+            ctrl.AddBreakpoint(addr, ANY_CORE)
+            fmt.Printf("Breakpoint added at address 0x%X", addr)
+            return
+        }
+
+        err, core := parseCore(args[2], ctrl)
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "%s\n", err)
+            return
+        }
+
+        ctrl.AddBreakpoint(addr, core)
+        fmt.Printf("Breakpoint added at address 0x%X for core %d", addr, core)
 
     case BREAKPOINT_LIST:
         if len(args) != 1 {
@@ -47,7 +110,7 @@ func breakpointHandler(ctrl *interpreterControl, cfg *interpreterConfig, args []
     	if len(br) == 0 {
     		fmt.Printf("No breakpoints set")
     	} else {
-    		fmt.Printf("Breakpoints set at addresses: %s", strings.Join(sliceMap(br, uint16ToHexStr()), ", "))
+    		fmt.Printf("Breakpoints set at addresses: %s", strings.Join(sliceMap(br, breakpointStr(ctrl.syms)), ", "))
     	}
 
     case BREAKPOINT_DELETE:
@@ -57,13 +120,12 @@ func breakpointHandler(ctrl *interpreterControl, cfg *interpreterConfig, args []
         }
 
     	//Get line number and check for errors.
-        err, addr := convValidateMemoryAddr(args[1])
+        err, addr := convValidateMemoryAddr(args[1], ctrl.syms)
         if err != nil {
         	return
         }
 
-        if ctrl.HasBreakpoint(addr) {
-        	ctrl.DeleteBreakpoint(addr)
+        if ctrl.DeleteBreakpoint(addr) {
         	fmt.Printf("Breakpoint successfully deleted")
         } else {
         	fmt.Printf("Breakpoint not found")
@@ -83,41 +145,373 @@ func breakpointHandler(ctrl *interpreterControl, cfg *interpreterConfig, args []
     }
 }
 
-func configurationHandler(cfg *interpreterConfig, args []string) {
+func symbolHandler(ctrl *interpreterControl, args []string) {
+    if len(args) == 0 {
+        printErrorMsg(SYMBOL)
+        return
+    }
+
+    switch args[0] {
+    case SYMBOL_LOAD:
+        if len(args) != 2 {
+            printErrorMsg(SYMBOL)
+            return
+        }
+
+        err, table := symbols.ReadFile(args[1])
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Could not load symbols: %s\n", err)
+            return
+        }
+
+        ctrl.syms.Merge(table)
+        fmt.Printf("Loaded %d symbols", table.Len())
+
+    case SYMBOL_LIST:
+        if len(args) != 1 {
+            printErrorMsg(SYMBOL)
+            return
+        }
+
+        if ctrl.syms.Len() == 0 {
+            fmt.Printf("No symbols loaded")
+            return
+        }
+
+        //Use tab-writer for easy alignment.
+        tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+
+        for _, s := range ctrl.syms.Symbols() {
+            fmt.Fprintf(tw, "0x%04X\t%s\t%d\t%s\n", s.Addr, s.Name, s.Size, s.Kind)
+        }
+
+        tw.Flush()
+        fmt.Printf("%d symbols", ctrl.syms.Len())
+
+    case SYMBOL_ADD:
+        if len(args) < 3 || len(args) > 5 {
+            printErrorMsg(SYMBOL)
+            return
+        }
+
+        if err := symbols.ValidateName(args[1]); err != nil {
+            fmt.Fprintf(os.Stderr, "%s\n", err)
+            return
+        }
+
+        err, addr := convValidateMemoryAddr(args[2], ctrl.syms)
+        if err != nil {
+            return
+        }
+
+        s := symbols.Symbol{Name: args[1], Addr: addr}
+
+        if len(args) >= 4 {
+            size, err := strconv.ParseUint(args[3], 0, 16)
+            if err != nil {
+                printErrorMsg(SYMBOL)
+                return
+            }
+
+            s.Size = uint16(size)
+        }
+
+        if len(args) == 5 {
+            s.Kind = args[4]
+        }
+
+        ctrl.syms.Add(s)
+        fmt.Printf("Symbol %s added at address 0x%X", s.Name, s.Addr)
+
+    case SYMBOL_DELETE:
+        if len(args) != 2 {
+            printErrorMsg(SYMBOL)
+            return
+        }
+
+        if ctrl.syms.Remove(args[1]) {
+            fmt.Printf("Symbol successfully deleted")
+        } else {
+            fmt.Printf("Symbol not found")
+        }
+
+    case SYMBOL_DELETE_ALL:
+        if len(args) != 1 {
+            printErrorMsg(SYMBOL)
+            return
+        }
+
+        ctrl.syms.Clear()
+        fmt.Printf("All symbols successfully deleted")
+
+    default:
+        printErrorMsg(SYMBOL)
+    }
+}
+
+func loadHandler(ci *co.ComputerInfo, ctrl *interpreterControl, args []string) {
+    if len(args) != 1 {
+        printErrorMsg(LOAD)
+        return
+    }
+
+    if err := loadProgram(args[0], ci, ctrl); err != nil {
+        fmt.Fprintf(os.Stderr, "%s\n", err)
+        return
+    }
+
+    printRegs(ci, ctrl.syms, nil)
+    fmt.Printf("Program loaded")
+}
+
+//Loads a program into memory, its symbols are added and the PC is set to its entry point. Assembly and source files are
+//assembled or compiled and linked, any other file is taken as a flat image, its symbol map and source map are loaded from
+//".sym" and ".map" files next to it if there are any. With a system loaded, programs are linked after it and run in user
+//mode.
+func loadProgram(path string, ci *co.ComputerInfo, ctrl *interpreterControl) error {
+    err, prog := readProgram(path, ctrl.system != nil)
+    if err != nil {
+        return err
+    }
+
+    //Absolute sections aren't moved by the layout, they could overwrite the trap table and service routines.
+    if ctrl.system != nil {
+        if err := system.CheckProgram(prog); err != nil {
+            return err
+        }
+    }
+
+    if err := prog.Load(ci); err != nil {
+        return err
+    }
+
+    ctrl.syms.Merge(prog.Symbols)
+    ctrl.program = prog
+
+    regs := ci.GetRegisters()
+    regs.PC = prog.Entry
+    ci.SetRegisters(regs, ci.GetFlags())
+    ci.SetSupervisor(ctrl.system == nil)
+
+    return nil
+}
+
+//Reads a program as "loadProgram" does, if "user" is set sources are linked after the system.
+func readProgram(path string, user bool) (error, *link.Image) {
+    var err error
+    var prog *link.Image
+
+    var layout *link.Layout
+    if user {
+        layout = system.UserLayout()
+    }
+
+    switch strings.ToLower(filepath.Ext(path)) {
+    case ".asm", ".s":
+        var o *obj.Object
+        if err, o = asm.AssembleObjectFile(path); err == nil {
+            err, prog = link.Link([]*obj.Object{o}, layout)
+        }
+    case compiler.SourceExt:
+        var o *obj.Object
+        if err, o = compiler.CompileObjectFile(path); err == nil {
+            err, prog = link.Link([]*obj.Object{o}, layout)
+        }
+    default:
+        err, prog = link.ReadFlatFile(path)
+
+        //Images without segments in their symbol map start at address 0, what comes before the user's memory would
+        //overwrite the system.
+        if err == nil && user {
+            for i := range prog.Segments {
+                seg := &prog.Segments[i]
+                skip := min(len(seg.Words), max(0, system.End - int(seg.Addr)))
+
+                seg.Words = seg.Words[skip:]
+                seg.Addr += uint16(skip)
+            }
+        }
+    }
+
+    if err != nil {
+        return err, nil
+    }
+
+    return nil, prog
+}
+
+//Loads a system image, the default one if "path" is empty, and protects its memory. Programs loaded afterwards are
+//placed after it, one loaded before must not use its memory. A console is attached at the system's address if there is
+//none.
+func loadSystem(path string, ci *co.ComputerInfo, ctrl *interpreterControl) error {
+    var err error
+    var img *link.Image
+
+    if path == "" {
+        err, img = system.Image()
+    } else {
+        err, img = readProgram(path, false)
+    }
+
+    if err != nil {
+        return err
+    }
+
+    //The system would overwrite a program loaded without one, its trap table is at the start of memory.
+    if ctrl.program != nil && system.CheckProgram(ctrl.program) != nil {
+        return errors.New("The loaded program uses the memory of the system, load the system before the program")
+    }
+
+    if err := system.Load(ci, img); err != nil {
+        return err
+    }
+
+    ctrl.syms.Merge(img.Symbols)
+    ctrl.system = img
+
+    //The default routines print through the console.
+    if ctrl.console == nil {
+        return attachConsole(system.CONSOLE, ci, ctrl)
+    }
+
+    return nil
+}
+
+//Returns a function that resolves symbols to their addresses, for assembling instructions and parsing addresses.
+func symbolLookup(syms *symbols.Table) func(string) (int, bool) {
+    return func(name string) (int, bool) {
+        s, ok := syms.Lookup(name)
+        return int(s.Addr), ok
+    }
+}
+
+func asmHandler(ci *co.ComputerInfo, ctrl *interpreterControl, args []string) {
+    if len(args) < 2 {
+        printErrorMsg(ASM)
+        return
+    }
+
+    err, addr := convValidateMemoryAddr(args[0], ctrl.syms)
+    if err != nil {
+        printErrorMsg(ASM)
+        return
+    }
+
+    err, words := asm.AssembleLine(strings.Join(args[1:], " "), addr, symbolLookup(ctrl.syms))
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "%s\n", err)
+        return
+    }
+
+    //Replacing a two word instruction with a shorter one leaves its operand behind.
+    oldSize := co.InstructionSize(ci.GetMemoryCell(addr))
+
+    if err := ci.SetMemoryBlock(addr, words); err != nil {
+        fmt.Fprintf(os.Stderr, "%s\n", err)
+        return
+    }
+
+    fmt.Printf("Assembled at 0x%04X: %s", addr, strings.Join(sliceMap(words, uint16ToHexStr()), " "))
+
+    if int(oldSize) > len(words) {
+        fmt.Printf("\nThe operand of the previous instruction is left at 0x%04X", addr + uint16(len(words)))
+    }
+}
+
+//Runs an instruction against the current state without placing it in memory.
+func execHandler(ci *co.ComputerInfo, ctrl *interpreterControl, args []string) {
+    if len(args) == 0 {
+        printErrorMsg(EXEC)
+        return
+    }
+
+    pc := ci.GetRegisters().PC
+
+    err, words := asm.AssembleLine(strings.Join(args, " "), pc, symbolLookup(ctrl.syms))
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "%s\n", err)
+        return
+    }
+
+    ctrl.SaveState(ci)
+
+    err, run := ci.Execute(words)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "An error occurred during execution: %s\n", err)
+        return
+    }
+
+    if !run {
+        fmt.Printf("HLT has no effect when executed from the prompt")
+        return
+    }
+
+    ctrl.executed = true
+}
+
+func configurationHandler(ctrl *interpreterControl, cfg *interpreterConfig, args []string) {
     if len(args) == 0 {
         printErrorMsg(CONFIGURE)
         return
     }
 
     switch args[0] {
-    case CONFIGURE_MEMORY_LIMITS:
-        if len(args) != 3 {
+    case CONFIGURE_SET:
+        if len(args) < 3 {
             printErrorMsg(CONFIGURE)
             return
         }
 
-        e1, lower := convValidateMemoryAddr(args[1])
-        e2, higher := convValidateMemoryAddr(args[2])
+        if err := cfg.Set(args[1], strings.Join(args[2:], " "), ctrl.syms); err != nil {
+            fmt.Fprintf(os.Stderr, "%s\n", err)
+        }
 
-        if (e1 != nil) || (e2 != nil) {
+    case CONFIGURE_SHOW:
+        if len(args) != 1 {
             printErrorMsg(CONFIGURE)
             return
         }
 
-        if (lower >= higher || higher >= co.MemorySize) {
+        printConfig(cfg)
+
+    case CONFIGURE_SAVE:
+        if len(args) > 2 {
             printErrorMsg(CONFIGURE)
             return
         }
 
-        cfg.memoryLimitL = lower
-        cfg.memoryLimitH = higher
+        path := cfg.path
+        if len(args) == 2 {
+            path = args[1]
+        }
+
+        if path == "" {
+            fmt.Fprintf(os.Stderr, "There is no configuration file to save to, a path must be given\n")
+            return
+        }
+
+        if err := cfg.Save(path); err != nil {
+            fmt.Fprintf(os.Stderr, "%s\n", err)
+            return
+        }
+
+        fmt.Printf("Configuration saved to %s", path)
 
     default:
-        printErrorMsg(CONFIGURE)
+        //Shortcuts for common settings.
+        key, ok := configShortcuts[args[0]]
+        if !ok || len(args) < 2 {
+            printErrorMsg(CONFIGURE)
+            return
+        }
+
+        if err := cfg.Set(key, strings.Join(args[1:], " "), ctrl.syms); err != nil {
+            fmt.Fprintf(os.Stderr, "%s\n", err)
+        }
     }
 }
 
-func memoryControlHandler(ci *co.ComputerInfo, args []string) {
+func memoryControlHandler(ci *co.ComputerInfo, ctrl *interpreterControl, cfg *interpreterConfig, args []string) {
     if len(args) == 0 {
         printErrorMsg(MEMORY_CONTROL)
         return
@@ -127,21 +521,33 @@ func memoryControlHandler(ci *co.ComputerInfo, args []string) {
     case MEMORY_CONTROL_PEEK:
         fallthrough
     case MEMORY_CONTROL_PEEK_SHORT:
-        if len(args) != 3 {
+        if len(args) != 3 && len(args) != 4 {
             printErrorMsg(MEMORY_CONTROL)
             return
         }
 
         //Get memory address.
-        e1, addr := convValidateMemoryAddr(args[1])
+        e1, addr := convValidateMemoryAddr(args[1], ctrl.syms)
         //Get number of values to read address.
-        e2, length := convValidateMemoryAddr(args[2])
+        e2, length := convValidateMemoryAddr(args[2], ctrl.syms)
 
         if (e1 != nil) || (e2 != nil) {
             printErrorMsg(CONFIGURE)
             return
         }
 
+        //With a view the values are printed like the memory block, stopping at the end of memory.
+        if len(args) == 4 {
+            if !validMemoryView(args[3]) || length == 0 {
+                printErrorMsg(MEMORY_CONTROL)
+                return
+            }
+
+            end := min(int(addr) + int(length), co.MemorySize)
+            printMemoryView(ci, ctrl.syms, cfg, addr, uint16(end), args[3], nil)
+            return
+        }
+
         //Read list of all values, store them as string in slice.
         valuesStr := make([]string, int(length))
         for i := 0; i < int(length); i++ {
@@ -159,7 +565,7 @@ func memoryControlHandler(ci *co.ComputerInfo, args []string) {
         }
 
         //Get memory address.
-        err, addr := convValidateMemoryAddr(args[1])
+        err, addr := convValidateMemoryAddr(args[1], ctrl.syms)
         if err != nil {
             printErrorMsg(MEMORY_CONTROL)
             return
@@ -171,7 +577,7 @@ func memoryControlHandler(ci *co.ComputerInfo, args []string) {
             val, parseErr := strconv.ParseUint(e, 0, 16)
 
             if parseErr != nil {
-                fmt.Fprintf(os.Stderr, "The value '0x%04X' does not fit in 16 bits\n")
+                fmt.Fprintf(os.Stderr, "The value %q does not fit in 16 bits\n", e)
                 printErrorMsg(MEMORY_CONTROL)
                 return
             }
@@ -193,12 +599,123 @@ func memoryControlHandler(ci *co.ComputerInfo, args []string) {
     }
 }
 
+func registerHandler(ci *co.ComputerInfo, ctrl *interpreterControl, args []string) {
+    if len(args) == 0 {
+        printErrorMsg(REGISTER)
+        return
+    }
+
+    regs := ci.GetRegisters()
+    flags := ci.GetFlags()
+
+    switch args[0] {
+    case REGISTER_SET:
+        if len(args) != 3 {
+            printErrorMsg(REGISTER)
+            return
+        }
+
+        err, reg := getRegisterByName(&regs, args[1])
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "%s\n", err)
+            return
+        }
+
+        //The PC must always point to a valid memory address.
+        var value uint16
+        if reg == &regs.PC {
+            err, value = convValidateMemoryAddr(args[2], ctrl.syms)
+        } else {
+            err, value = convValue(args[2])
+        }
+
+        if err != nil {
+            return
+        }
+
+        *reg = value
+        ci.SetRegisters(regs, flags)
+        printRegs(ci, ctrl.syms, nil)
+
+    case REGISTER_GET:
+        if len(args) != 2 {
+            printErrorMsg(REGISTER)
+            return
+        }
+
+        err, reg := getRegisterByName(&regs, args[1])
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "%s\n", err)
+            return
+        }
+
+        fmt.Printf("%s: 0x%04X (%d)", strings.ToUpper(args[1]), *reg, int16(*reg))
+
+    default:
+        printErrorMsg(REGISTER)
+    }
+}
+
+func flagHandler(ci *co.ComputerInfo, ctrl *interpreterControl, args []string) {
+    if len(args) != 2 {
+        printErrorMsg(FLAG)
+        return
+    }
+
+    regs := ci.GetRegisters()
+    flags := ci.GetFlags()
+
+    var value bool
+
+    switch args[0] {
+    case FLAG_SET:
+        value = true
+    case FLAG_CLEAR:
+        value = false
+    default:
+        printErrorMsg(FLAG)
+        return
+    }
+
+    switch strings.ToUpper(args[1]) {
+    case "N":
+        flags.N = value
+    case "P":
+        flags.P = value
+    case "Z":
+        flags.Z = value
+    default:
+        fmt.Fprintf(os.Stderr, "Unknown flag: %q, valid flags are N, P and Z\n", args[1])
+        return
+    }
+
+    ci.SetRegisters(regs, flags)
+    printRegs(ci, ctrl.syms, nil)
+}
+
+func pcHandler(ci *co.ComputerInfo, ctrl *interpreterControl, args []string) {
+    if len(args) != 1 {
+        printErrorMsg(PC)
+        return
+    }
+
+    err, addr := convValidateMemoryAddr(args[0], ctrl.syms)
+    if err != nil {
+        return
+    }
+
+    regs := ci.GetRegisters()
+    regs.PC = addr
+    ci.SetRegisters(regs, ci.GetFlags())
+    printRegs(ci, ctrl.syms, nil)
+}
+
 func printHelp() {
     //Use tab-writer for easy alignment.
     tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
     defer func() { _ = tw.Flush() }()
 
-    fmt.Fprintln(tw, "Available commands:\n")
+    fmt.Fprint(tw, "Available commands:\n\n")
 
     type cmd struct {
         name     string
@@ -209,17 +726,192 @@ func printHelp() {
 
     cmds := []cmd{
         {name: STEP, short: STEP_SHORT, desc: "Perform one execution step"},
-        {name: CONTINUE, short: CONTINUE_SHORT, desc: "Continue execution until a breakpoint or program end"},
+        {name: CONTINUE, short: CONTINUE_SHORT, desc: "Continue execution until a breakpoint, a limit or program end, Ctrl-C pauses"},
+        {name: RUN + " <n>", short: RUN_SHORT, desc: "Continue execution for at most <n> steps"},
+        {name: NEXT, short: NEXT_SHORT, desc: "Perform one execution step, running subroutine calls as a single step"},
+        {name: FINISH, short: FINISH_SHORT, desc: "Continue execution until the current subroutine returns to its caller"},
+        {name: UNTIL + " <address>", short: UNTIL_SHORT, desc: "Continue execution until <address> is reached"},
+        {name: BACKGROUND, short: BACKGROUND_SHORT, desc: "Continue execution in the background, commands can inspect the state while it runs"},
+        {name: PAUSE, short: PAUSE, desc: "Pause a program running in the background, Ctrl-C also does"},
         {
             name:  BREAKPOINT,
             short: BREAKPOINT_SHORT,
             desc:  "Breakpoint handler, options:",
             options: []string{
-                fmt.Sprintf("%s <address>\tSet breakpoint at <address>", BREAKPOINT_SET),
+                fmt.Sprintf("%s <address> [core]\tSet breakpoint at <address>, if [core] is given it only stops that core", BREAKPOINT_SET),
                 fmt.Sprintf("%s\tList all breakpoints", BREAKPOINT_LIST),
                 fmt.Sprintf("%s <address>\tDelete the breakpoint at <address>, if it exists", BREAKPOINT_DELETE),
             },
         },
+        {
+            name: REGISTER,
+            short: REGISTER_SHORT,
+            desc: "Allows for reading and writing registers, names are PC and R0 through R7",
+            options: []string{
+                fmt.Sprintf("%s <name> <value>\tSets register <name> to <value>", REGISTER_SET),
+                fmt.Sprintf("%s <name>\tPrints the value of register <name>", REGISTER_GET),
+            },
+        },
+        {
+            name: FLAG,
+            short: FLAG_SHORT,
+            desc: "Allows for changing the status flags",
+            options: []string{
+                fmt.Sprintf("%s <N|P|Z>\tSets the given flag", FLAG_SET),
+                fmt.Sprintf("%s <N|P|Z>\tClears the given flag", FLAG_CLEAR),
+            },
+        },
+        {name: PC + " <address>", short: PC, desc: "Sets the PC to <address>"},
+        {
+            name: SYMBOL,
+            short: SYMBOL_SHORT,
+            desc: "Symbol handler, symbols and \"symbol+offset\" can be used wherever an address is expected, options:",
+            options: []string{
+                fmt.Sprintf("%s <file>\tLoad the symbol map in <file>, with lines \"name address [size] [kind]\"", SYMBOL_LOAD),
+                fmt.Sprintf("%s\tList all symbols", SYMBOL_LIST),
+                fmt.Sprintf("%s <name> <address> [size] [kind]\tAdd a symbol", SYMBOL_ADD),
+                fmt.Sprintf("%s <name>\tDelete the symbol <name>, if it exists", SYMBOL_DELETE),
+                fmt.Sprintf("%s\tDelete all symbols", SYMBOL_DELETE_ALL),
+            },
+        },
+        {name: LOAD + " <file>", short: LOAD, desc: "Load a \".asm\" or \"" + compiler.SourceExt + "\" file, or a flat image, into memory with its symbols"},
+        {name: ASM + " <address> <instruction>", short: ASM, desc: "Assembles <instruction> into memory at <address>, operands may use symbols and \"$\""},
+        {name: EXEC + " <instruction>", short: EXEC, desc: "Runs <instruction> without placing it in memory, the PC only changes if it jumps"},
+        {name: SOURCE + " <file>", short: SOURCE, desc: "Run the commands in <file>, lines starting with \"#\" are comments"},
+        {
+            name: CORE,
+            short: CORE_SHORT,
+            desc: "Core handler, cores share the memory and run one instruction at a time as the scheduler picks them, options:",
+            options: []string{
+                fmt.Sprintf("%s\tLists all cores, the current one is marked with \"*\"", CORE_LIST),
+                fmt.Sprintf("%s <n>\tMakes <n> the current core, commands act on it", CORE_SWITCH),
+                fmt.Sprintf("%s <n>\tSets the amount of cores, new ones start with cleared registers", CORE_COUNT),
+                fmt.Sprintf("%s <%s|%s <seed>|%s <cores...>>\tSets how cores are interleaved", CORE_SCHEDULE, SCHEDULE_ROUND_ROBIN, SCHEDULE_RANDOM, SCHEDULE_FIXED),
+                "Setting \"lock_core\" runs only the current core, CAS and TAS are atomic",
+            },
+        },
+        {
+            name: MPU,
+            short: MPU,
+            desc: fmt.Sprintf("Memory protection, pages of %d words have read, write and execute permissions enforced in user mode, options:", co.PageSize),
+            options: []string{
+                fmt.Sprintf("%s\tShows the mode of the current core and the permissions of each region, the PC's is marked with \"*\"", MPU_MAP),
+                fmt.Sprintf("%s <start> <end> <rwx>\tSets the permissions of the pages from <start> to <end>, e.g. \"r-x\"", MPU_SET),
+                fmt.Sprintf("%s [%s|%s]\tShows or sets the mode of the current core", MPU_MODE, MODE_SUPERVISOR, MODE_USER),
+                "SPP and GPP set and get the permissions of a page, USR jumps in user mode, all three are privileged",
+            },
+        },
+        {
+            name: SYSTEM,
+            short: SYSTEM_SHORT,
+            desc: "System handler, \"TRAP n\" calls the service routine in vector <n> in supervisor mode and RTT returns, options:",
+            options: []string{
+                fmt.Sprintf("%s [file]\tLoads the default system or [file], later programs are placed after it and run in user mode", SYSTEM_LOAD),
+                fmt.Sprintf("%s\tShows the user's program", SYSTEM_USER),
+                fmt.Sprintf("%s\tShows the trap vectors and the system's code", SYSTEM_OS),
+                "Default routines: 0 reads a character into R0, 1 prints R0, 2 prints the string R0 points to, 3 halts",
+            },
+        },
+        {
+            name: CONSOLE,
+            short: CONSOLE_SHORT,
+            desc: "Console handler, status registers have the ready flag in bit 15 and the keyboard interrupt enable in bit 14, options:",
+            options: []string{
+                fmt.Sprintf("%s [address]\tAttaches a console, its registers are KBSR, KBDR, DSR and DDR from [address] on", CONSOLE_ATTACH),
+                fmt.Sprintf("%s\tDetaches the console", CONSOLE_DETACH),
+                fmt.Sprintf("%s <text>\tQueues <text> and a newline as keyboard input, escape sequences are allowed", CONSOLE_INPUT),
+                fmt.Sprintf("%s\tShows everything the program printed", CONSOLE_SHOW),
+                fmt.Sprintf("%s\tClears the program's output", CONSOLE_CLEAR),
+                "Program output is shown apart from the debugger's, with \"-script\" the console uses stdin and stdout",
+            },
+        },
+        {
+            name: DISPLAY,
+            short: DISPLAY_SHORT,
+            desc: fmt.Sprintf("Display handler, %dx%d monochrome pixels, each word holds 16 pixels of a row with the leftmost in bit 15, options:", device.DISPLAY_WIDTH, device.DISPLAY_HEIGHT),
+            options: []string{
+                fmt.Sprintf("%s [address]\tAttaches a display, its %d words start at [address], by default at the end of memory", DISPLAY_ATTACH, device.DisplayWords),
+                fmt.Sprintf("%s\tDetaches the display", DISPLAY_DETACH),
+                fmt.Sprintf("%s\tShows the display", DISPLAY_SHOW),
+                fmt.Sprintf("%s\tTurns every pixel off", DISPLAY_CLEAR),
+                "The display is shown whenever it changes, and redrawn in place while the program runs",
+            },
+        },
+        {name: SCREENSHOT + " <file.png>", short: SCREENSHOT, desc: "Saves the display as a PNG image"},
+        {
+            name: DISK,
+            short: DISK_SHORT,
+            desc: "Disk handler, its registers are command, sector, address and status, options:",
+            options: []string{
+                fmt.Sprintf("%s <image> [address]\tAttaches a disk image, its registers start at [address]", DISK_ATTACH),
+                fmt.Sprintf("%s\tDetaches the disk image", DISK_DETACH),
+                fmt.Sprintf("%s <image> <sectors>\tCreates a blank disk image", DISK_CREATE),
+                fmt.Sprintf("Sectors have %d words, command %d reads one into memory and %d writes one, they take %d instructions", device.SectorWords, device.DISK_READ, device.DISK_WRITE, device.DiskLatency),
+                "The status has the ready flag in bit 15, the completion interrupt enable in bit 14 and the error flag in bit 0",
+            },
+        },
+        {
+            name: TIMER,
+            short: TIMER_SHORT,
+            desc: "Timer handler, its registers are control, reload and count, it counts instructions, options:",
+            options: []string{
+                fmt.Sprintf("%s [address]\tAttaches a timer, its registers start at [address]", TIMER_ATTACH),
+                fmt.Sprintf("%s\tDetaches the timer", TIMER_DETACH),
+                fmt.Sprintf("%s\tShows the state of the timer", TIMER_SHOW),
+                "Control bits: 0 enables it and loads the count, 1 makes it periodic, 14 interrupts on expiry, 15 is set on expiry",
+            },
+        },
+        {
+            name: CLOCK,
+            short: CLOCK_SHORT,
+            desc: "Clock handler, its read only registers are year, month, day, hours, minutes, seconds and milliseconds, options:",
+            options: []string{
+                fmt.Sprintf("%s [%s|%s] [address]\tAttaches a clock, virtual time starts at %d and advances a microsecond per instruction", CLOCK_ATTACH, CLOCK_VIRTUAL, CLOCK_HOST, device.ClockEpoch.Year()),
+                fmt.Sprintf("%s\tDetaches the clock", CLOCK_DETACH),
+                fmt.Sprintf("%s\tShows the time of the clock", CLOCK_SHOW),
+                "Reading the year latches the time, so the registers read after it are consistent",
+            },
+        },
+        {
+            name: MACHINE,
+            short: MACHINE_SHORT,
+            desc: "Machine handler, each machine has its own memory, registers, breakpoints, symbols and configuration, options:",
+            options: []string{
+                fmt.Sprintf("%s <name> [file]\tCreates a machine and switches to it, [file] is loaded into it", MACHINE_NEW),
+                fmt.Sprintf("%s <name>\tCopies the current machine into a new one and switches to it", MACHINE_CLONE),
+                fmt.Sprintf("%s <name>\tMakes <name> the current machine", MACHINE_SWITCH),
+                fmt.Sprintf("%s\tLists all machines, the current one is marked with \"*\"", MACHINE_LIST),
+                fmt.Sprintf("%s <a> [b]\tCompares the registers and memory of two machines, [b] defaults to the current one", MACHINE_DIFF),
+            },
+        },
+        {
+            name: ALIAS + " <name> <expansion>",
+            short: ALIAS,
+            desc: "Defines a command that runs <expansion>, without arguments lists all aliases",
+            options: []string{
+                "\"$1\" to \"$9\" are replaced by the arguments and \"$*\" by all of them, if none are used arguments are appended",
+            },
+        },
+        {
+            name: DEFINE + " <name>",
+            short: DEFINE,
+            desc: "Defines a macro, the lines that follow up to \"end\" are run as a script, without a name lists all macros",
+            options: []string{
+                "Macros take arguments like aliases, both are saved with \"cfg save\"",
+            },
+        },
+        {name: UNALIAS + " <name>", short: UNALIAS, desc: "Deletes an alias"},
+        {name: UNDEFINE + " <name>", short: UNDEFINE, desc: "Deletes a macro"},
+        {name: SET + " <name> = <expr>", short: SET, desc: "Sets variable <name>, \"$name\" is replaced by its value in commands"},
+        {name: ECHO + " <text>", short: ECHO, desc: "Prints <text>, \"{expr}\" is replaced by its value, \"{expr:x}\" in hex"},
+        {
+            name: IF + " <expr>",
+            short: WHILE,
+            desc: "Script blocks, closed by \"end\", \"if\" blocks may contain an \"else\"",
+            options: []string{
+                "Expressions use C operators, registers (R0, PC), flags (N, P, Z), variables ($name) and memory ([addr])",
+            },
+        },
         {name: EXIT, short: EXIT_SHORT, desc: "Exit interpreter"},
         {name: HELP, short: HELP_SHORT, desc: "Display this help message"},
         {
@@ -227,7 +919,17 @@ func printHelp() {
             short: CONFIGURE_SHORT,
             desc: "Configure the interpreter",
             options: []string{
+                fmt.Sprintf("%s <key> <value>\tChanges a setting", CONFIGURE_SET),
+                fmt.Sprintf("%s\tLists all settings and their values", CONFIGURE_SHOW),
+                fmt.Sprintf("%s [path]\tSaves the settings to the loaded configuration file, or the given one", CONFIGURE_SAVE),
                 fmt.Sprintf("%s <lower> <upper>\tSets the bounds determining which memory cells are printed", CONFIGURE_MEMORY_LIMITS),
+                fmt.Sprintf("%s <n>\tSets the maximum amount of steps a continue runs for, 0 means no limit", CONFIGURE_STEP_LIMIT),
+                fmt.Sprintf("%s <duration>\tSets the maximum time a continue runs for, like \"2s\", 0 means no limit", CONFIGURE_TIMEOUT),
+                fmt.Sprintf("%s <view>\tSets the format of the printed memory cells, one of: %s", CONFIGURE_MEMORY_VIEW, strings.Join(memoryViews, ", ")),
+                fmt.Sprintf("%s <n>\tSets the amount of memory cells printed per row", CONFIGURE_MEMORY_COLUMNS),
+                fmt.Sprintf("%s <%s|%s>\tKeeps the printed memory centred on the PC, the memory bounds only set its size", CONFIGURE_FOLLOW_PC, CONFIGURE_ON, CONFIGURE_OFF),
+                fmt.Sprintf("%s <%s|%s>\tHighlights the registers, flags and memory cells changed by the last execution", CONFIGURE_HIGHLIGHT_CHANGES, CONFIGURE_ON, CONFIGURE_OFF),
+                fmt.Sprintf("%s <%s|%s>\tPrints a line listing the changes made by the last execution", CONFIGURE_CHANGE_SUMMARY, CONFIGURE_ON, CONFIGURE_OFF),
             },
         },
         {
@@ -235,7 +937,7 @@ func printHelp() {
             short: MEMORY_CONTROL_SHORT,
             desc: "Allows for reading and writing values to and from memory",
             options: []string{
-                fmt.Sprintf("%s <start> <n>\tReads <n> amount of memory values, starting from <start>", MEMORY_CONTROL_PEEK),
+                fmt.Sprintf("%s <start> <n> [view]\tReads <n> amount of memory values, starting from <start>, optionally in the given view", MEMORY_CONTROL_PEEK),
                 fmt.Sprintf("%s <start> <values...>\tWrites all the values passed, sequentially, starting from <start>", MEMORY_CONTROL_POKE),
             },
         },
@@ -263,18 +965,84 @@ func uint16ToHexStr() func(uint16) string {
 	}	
 }
 
-//Takes a string and if possible converts it to a uint16 number, otherwise returns an error.
-func convValidateMemoryAddr(addr string) (error, uint16) {
-	//Using base "0" automatically detects the base based on the string.
-	num, err := strconv.ParseUint(addr, 0, 16)
+//Returns a pointer to the register with the given name in "regs", names are case insensitive.
+func getRegisterByName(regs *co.Registers, name string) (error, *uint16) {
+    switch strings.ToUpper(name) {
+    case "PC":
+        return nil, &regs.PC
+    case "R0":
+        return nil, &regs.R0
+    case "R1":
+        return nil, &regs.R1
+    case "R2":
+        return nil, &regs.R2
+    case "R3":
+        return nil, &regs.R3
+    case "R4":
+        return nil, &regs.R4
+    case "R5":
+        return nil, &regs.R5
+    case "R6":
+        return nil, &regs.R6
+    case "R7":
+        return nil, &regs.R7
+    }
+
+    return fmt.Errorf("Unknown register: %q, valid registers are PC and R0 through R7", name), nil
+}
+
+//Takes a string and if possible converts it to a 16 bit value, negative numbers are stored in two's complement.
+func convValue(value string) (error, uint16) {
+    num, err := strconv.ParseInt(value, 0, 32)
+    if err != nil || num < -0x8000 || num > 0xFFFF {
+        fmt.Fprintf(os.Stderr, "The value %q does not fit in 16 bits\n", value)
+        return errors.New("Invalid value"), 0
+    }
+
+    return nil, uint16(num)
+}
+
+//A function that converts the given address to a string with it's hex representation, followed by the nearest symbol if any.
+func addrWithSymbolStr(syms *symbols.Table) func(uint16) string {
+    return func(addr uint16) string {
+        if desc := syms.Describe(addr); desc != "" {
+            return fmt.Sprintf("0x%X <%s>", addr, desc)
+        }
+        return fmt.Sprintf("0x%X", addr)
+    }
+}
+
+//Like "addrWithSymbolStr", breakpoints for a single core are followed by it.
+func breakpointStr(syms *symbols.Table) func(breakpoint) string {
+    return func(b breakpoint) string {
+        if b.core == ANY_CORE {
+            return addrWithSymbolStr(syms)(b.addr)
+        }
+        return fmt.Sprintf("%s (core %d)", addrWithSymbolStr(syms)(b.addr), b.core)
+    }
+}
+
+//Takes a string and if possible converts it to a uint16 number, otherwise prints why and returns an error. Besides
+//numbers, symbol names and simple expressions over them like "label+2" are accepted.
+func convValidateMemoryAddr(addr string, syms *symbols.Table) (error, uint16) {
+    err, num := parseAddr(addr, syms)
     if err != nil {
-    	fmt.Fprintf(os.Stderr, "Invalid memory address: %q", addr)
+        fmt.Fprintf(os.Stderr, "%s\n", err)
         return errors.New("Invalid memory address"), 0
     }
 
-    if num >= co.MemorySize {
-    	fmt.Fprintf(os.Stderr, "Memory address out of range: 0x%X (>= %d)\n", num, co.MemorySize)
-    	return errors.New("Invalid memory address"), 0
+    return nil, num
+}
+
+//Parses a memory address as "convValidateMemoryAddr" does, the error says why it's invalid.
+func parseAddr(addr string, syms *symbols.Table) (error, uint16) {
+    err, num := expr.Eval(addr, expr.Env{Lookup: symbolLookup(syms)})
+    if err != nil {
+        return fmt.Errorf("Invalid memory address %q: %s", addr, err), 0
+    }
+
+    if num < 0 || num >= co.MemorySize {
+        return fmt.Errorf("Memory address out of range: %q is %d, it must be between 0 and %d", addr, num, co.MemorySize - 1), 0
     }
 
     return nil, uint16(num)
@@ -0,0 +1,134 @@
+package cli
+
+import (
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    "github.com/Tinch334/Computer-one-v2/co"
+    "github.com/Tinch334/Computer-one-v2/symbols"
+)
+
+func TestGetRegisterByName(t *testing.T) {
+    regs := co.Registers{PC: 1, R0: 2, R7: 3}
+
+    for name, want := range map[string]uint16{"pc": 1, "PC": 1, "r0": 2, "R7": 3} {
+        err, reg := getRegisterByName(&regs, name)
+        if err != nil || *reg != want {
+            t.Errorf("getRegisterByName(%q) = %v, %v, want %d", name, err, reg, want)
+        }
+    }
+
+    //The pointer refers to the given registers.
+    _, reg := getRegisterByName(&regs, "R1")
+    *reg = 4
+    if regs.R1 != 4 {
+        t.Errorf("writing through the pointer left R1 = %d", regs.R1)
+    }
+
+    for _, name := range []string{"", "R8", "SP", "R"} {
+        if err, _ := getRegisterByName(&regs, name); err == nil {
+            t.Errorf("getRegisterByName(%q) succeeded", name)
+        }
+    }
+}
+
+func TestConvValue(t *testing.T) {
+    tests := []struct {
+        value string
+        want uint16
+        ok bool
+    }{
+        {"0", 0, true},
+        {"0x1F", 0x1F, true},
+        {"0b101", 5, true},
+        {"65535", 0xFFFF, true},
+        {"-1", 0xFFFF, true},
+        {"-32768", 0x8000, true},
+        {"-32769", 0, false},
+        {"65536", 0, false},
+        {"R1", 0, false},
+    }
+
+    for _, tt := range tests {
+        err, got := convValue(tt.value)
+        if (err == nil) != tt.ok || got != tt.want {
+            t.Errorf("convValue(%q) = %v, 0x%X, want ok %v and 0x%X", tt.value, err, got, tt.ok, tt.want)
+        }
+    }
+}
+
+func TestLoadOverSystem(t *testing.T) {
+    dir := t.TempDir()
+    write := func(name string, src string) string {
+        path := filepath.Join(dir, name)
+        if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+            t.Fatal(err)
+        }
+        return path
+    }
+
+    plain := write("plain.asm", "main: NOP\nHLT\n")
+    absolute := write("absolute.asm", ".org 0x10\nNOP\n")
+
+    tests := []struct {
+        name string
+        system bool
+        program string
+        //Loads the system after the program instead of before it.
+        after bool
+        err string
+    }{
+        {"program after the system", true, plain, false, ""},
+        {"absolute program after the system", true, absolute, false, "over the system"},
+        {"program before the system", true, plain, true, "load the system before the program"},
+        {"program without a system", false, absolute, false, ""},
+    }
+
+    for _, tt := range tests {
+        ci := co.NewComputerInfo()
+        ctrl := newControl(ci, nil, &machineList{})
+
+        if tt.system && !tt.after {
+            if err := loadSystem("", ci, ctrl); err != nil {
+                t.Fatal(err)
+            }
+        }
+
+        err := loadProgram(tt.program, ci, ctrl)
+        if err == nil && tt.system && tt.after {
+            err = loadSystem("", ci, ctrl)
+        }
+
+        if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+            t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+        }
+    }
+}
+
+func TestParseAddr(t *testing.T) {
+    syms := symbols.NewTable()
+    syms.Add(symbols.Symbol{Name: "buf", Addr: 0x20})
+
+    tests := []struct {
+        addr string
+        want uint16
+        err string
+    }{
+        {"0x10", 0x10, ""},
+        {"buf", 0x20, ""},
+        {"buf + 2 * 3", 0x26, ""},
+        {"0x3FF", 0x3FF, ""},
+        {"0x400", 0, "out of range"},
+        {"buf - 0x21", 0, "out of range"},
+        {"nope", 0, "Invalid memory address"},
+    }
+
+    for _, tt := range tests {
+        err, got := parseAddr(tt.addr, syms)
+        if tt.err == "" && (err != nil || got != tt.want) || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+            t.Errorf("parseAddr(%q) = %v, 0x%X, want 0x%X or an error containing %q", tt.addr, err, got, tt.want, tt.err)
+        }
+    }
+}
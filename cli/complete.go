@@ -0,0 +1,400 @@
+package cli
+
+import (
+    "maps"
+    "os"
+    "path/filepath"
+    "slices"
+    "strings"
+
+    "github.com/Tinch334/Computer-one-v2/co"
+)
+
+//Kinds of arguments, used to offer completions.
+const (
+    ARG_NONE = iota
+    ARG_ADDRESS
+    ARG_REGISTER
+    ARG_FLAG
+    ARG_FILE
+    ARG_SYMBOL
+    ARG_INSTRUCTION
+    ARG_OPERAND
+    ARG_SETTING
+    ARG_SETTING_VALUE
+    ARG_VIEW
+    ARG_SWITCH
+    ARG_ALIAS
+    ARG_MACRO
+    ARG_MACHINE
+    ARG_SCHEDULER
+    ARG_MODE
+    ARG_CLOCK_MODE
+)
+
+//A command for completion purposes, "args" holds the kind of each argument, the last one is repeated for the rest.
+type completion struct {
+    names []string
+    args []int
+
+    //Subcommands, their arguments replace the ones of the command.
+    subcommands []completion
+}
+
+var completions = []completion{
+    {names: []string{STEP, STEP_SHORT}},
+    {names: []string{CONTINUE, CONTINUE_SHORT}},
+    {names: []string{RUN, RUN_SHORT}},
+    {names: []string{NEXT, NEXT_SHORT}},
+    {names: []string{FINISH, FINISH_SHORT}},
+    {names: []string{UNTIL, UNTIL_SHORT}, args: []int{ARG_ADDRESS}},
+    {names: []string{BACKGROUND, BACKGROUND_SHORT}},
+    {names: []string{PAUSE}},
+    {
+        names: []string{BREAKPOINT, BREAKPOINT_SHORT},
+        subcommands: []completion{
+            {names: []string{BREAKPOINT_SET}, args: []int{ARG_ADDRESS, ARG_NONE}},
+            {names: []string{BREAKPOINT_LIST}},
+            {names: []string{BREAKPOINT_DELETE}, args: []int{ARG_ADDRESS}},
+            {names: []string{BREAKPOINT_DELETE_ALL}},
+        },
+    },
+    {
+        names: []string{REGISTER, REGISTER_SHORT},
+        subcommands: []completion{
+            {names: []string{REGISTER_SET}, args: []int{ARG_REGISTER, ARG_ADDRESS}},
+            {names: []string{REGISTER_GET}, args: []int{ARG_REGISTER}},
+        },
+    },
+    {
+        names: []string{FLAG, FLAG_SHORT},
+        subcommands: []completion{
+            {names: []string{FLAG_SET}, args: []int{ARG_FLAG}},
+            {names: []string{FLAG_CLEAR}, args: []int{ARG_FLAG}},
+        },
+    },
+    {names: []string{PC}, args: []int{ARG_ADDRESS}},
+    {
+        names: []string{SYMBOL, SYMBOL_SHORT},
+        subcommands: []completion{
+            {names: []string{SYMBOL_LOAD}, args: []int{ARG_FILE}},
+            {names: []string{SYMBOL_LIST}},
+            {names: []string{SYMBOL_ADD}, args: []int{ARG_NONE, ARG_ADDRESS}},
+            {names: []string{SYMBOL_DELETE}, args: []int{ARG_SYMBOL}},
+            {names: []string{SYMBOL_DELETE_ALL}},
+        },
+    },
+    {names: []string{LOAD}, args: []int{ARG_FILE}},
+    {names: []string{ASM}, args: []int{ARG_ADDRESS, ARG_INSTRUCTION, ARG_OPERAND}},
+    {names: []string{EXEC}, args: []int{ARG_INSTRUCTION, ARG_OPERAND}},
+    {names: []string{SOURCE}, args: []int{ARG_FILE}},
+    {
+        names: []string{CORE, CORE_SHORT},
+        subcommands: []completion{
+            {names: []string{CORE_LIST}},
+            {names: []string{CORE_SWITCH}},
+            {names: []string{CORE_COUNT}},
+            {names: []string{CORE_SCHEDULE}, args: []int{ARG_SCHEDULER, ARG_NONE}},
+        },
+    },
+    {
+        names: []string{MPU},
+        subcommands: []completion{
+            {names: []string{MPU_MAP}},
+            {names: []string{MPU_SET}, args: []int{ARG_ADDRESS, ARG_ADDRESS, ARG_NONE}},
+            {names: []string{MPU_MODE}, args: []int{ARG_MODE}},
+        },
+    },
+    {
+        names: []string{SYSTEM, SYSTEM_SHORT},
+        subcommands: []completion{
+            {names: []string{SYSTEM_LOAD}, args: []int{ARG_FILE}},
+            {names: []string{SYSTEM_USER}},
+            {names: []string{SYSTEM_OS}},
+        },
+    },
+    {
+        names: []string{CONSOLE, CONSOLE_SHORT},
+        subcommands: []completion{
+            {names: []string{CONSOLE_ATTACH}, args: []int{ARG_ADDRESS}},
+            {names: []string{CONSOLE_DETACH}},
+            {names: []string{CONSOLE_INPUT}},
+            {names: []string{CONSOLE_SHOW}},
+            {names: []string{CONSOLE_CLEAR}},
+        },
+    },
+    {
+        names: []string{DISPLAY, DISPLAY_SHORT},
+        subcommands: []completion{
+            {names: []string{DISPLAY_ATTACH}, args: []int{ARG_ADDRESS}},
+            {names: []string{DISPLAY_DETACH}},
+            {names: []string{DISPLAY_SHOW}},
+            {names: []string{DISPLAY_CLEAR}},
+        },
+    },
+    {names: []string{SCREENSHOT}, args: []int{ARG_FILE}},
+    {
+        names: []string{DISK, DISK_SHORT},
+        subcommands: []completion{
+            {names: []string{DISK_ATTACH}, args: []int{ARG_FILE, ARG_ADDRESS}},
+            {names: []string{DISK_DETACH}},
+            {names: []string{DISK_CREATE}, args: []int{ARG_FILE}},
+        },
+    },
+    {
+        names: []string{TIMER, TIMER_SHORT},
+        subcommands: []completion{
+            {names: []string{TIMER_ATTACH}, args: []int{ARG_ADDRESS}},
+            {names: []string{TIMER_DETACH}},
+            {names: []string{TIMER_SHOW}},
+        },
+    },
+    {
+        names: []string{CLOCK, CLOCK_SHORT},
+        subcommands: []completion{
+            {names: []string{CLOCK_ATTACH}, args: []int{ARG_CLOCK_MODE, ARG_ADDRESS}},
+            {names: []string{CLOCK_DETACH}},
+            {names: []string{CLOCK_SHOW}},
+        },
+    },
+    {
+        names: []string{MACHINE, MACHINE_SHORT},
+        subcommands: []completion{
+            {names: []string{MACHINE_NEW}, args: []int{ARG_NONE, ARG_FILE}},
+            {names: []string{MACHINE_CLONE}},
+            {names: []string{MACHINE_SWITCH}, args: []int{ARG_MACHINE}},
+            {names: []string{MACHINE_LIST}},
+            {names: []string{MACHINE_DIFF}, args: []int{ARG_MACHINE}},
+        },
+    },
+    {names: []string{ALIAS}, args: []int{ARG_ALIAS, ARG_NONE}},
+    {names: []string{UNALIAS}, args: []int{ARG_ALIAS}},
+    {names: []string{DEFINE}, args: []int{ARG_MACRO}},
+    {names: []string{UNDEFINE}, args: []int{ARG_MACRO}},
+    {names: []string{SET}},
+    {names: []string{ECHO}},
+    {names: []string{IF}},
+    {names: []string{ELSE}},
+    {names: []string{WHILE}},
+    {names: []string{END}},
+    {names: []string{EXIT, EXIT_SHORT}},
+    {names: []string{HELP, HELP_SHORT}},
+    {
+        names: []string{CONFIGURE, CONFIGURE_SHORT},
+        subcommands: []completion{
+            {names: []string{CONFIGURE_SET}, args: []int{ARG_SETTING, ARG_SETTING_VALUE}},
+            {names: []string{CONFIGURE_SHOW}},
+            {names: []string{CONFIGURE_SAVE}, args: []int{ARG_FILE}},
+            {names: []string{CONFIGURE_MEMORY_LIMITS}, args: []int{ARG_ADDRESS}},
+            {names: []string{CONFIGURE_STEP_LIMIT}},
+            {names: []string{CONFIGURE_TIMEOUT}},
+            {names: []string{CONFIGURE_MEMORY_VIEW}, args: []int{ARG_VIEW}},
+            {names: []string{CONFIGURE_MEMORY_COLUMNS}},
+            {names: []string{CONFIGURE_FOLLOW_PC}, args: []int{ARG_SWITCH}},
+            {names: []string{CONFIGURE_HIGHLIGHT_CHANGES}, args: []int{ARG_SWITCH}},
+            {names: []string{CONFIGURE_CHANGE_SUMMARY}, args: []int{ARG_SWITCH}},
+        },
+    },
+    {
+        names: []string{MEMORY_CONTROL, MEMORY_CONTROL_SHORT},
+        subcommands: []completion{
+            {names: []string{MEMORY_CONTROL_PEEK, MEMORY_CONTROL_PEEK_SHORT}, args: []int{ARG_ADDRESS, ARG_NONE, ARG_VIEW, ARG_NONE}},
+            {names: []string{MEMORY_CONTROL_POKE, MEMORY_CONTROL_POKE_SHORT}, args: []int{ARG_ADDRESS, ARG_NONE}},
+        },
+    },
+}
+
+func findCompletion(list []completion, name string) *completion {
+    for i := range list {
+        if slices.Contains(list[i].names, name) {
+            return &list[i]
+        }
+    }
+
+    return nil
+}
+
+func completionNames(list []completion) []string {
+    names := make([]string, 0)
+    for _, c := range list {
+        names = append(names, c.names...)
+    }
+
+    return names
+}
+
+//Returns a completion function for the line editor, it offers the words that may follow the given line in the current
+//machine.
+func completer(machines *machineList) func(string) []string {
+    return func(line string) []string {
+        _, ctrl, cfg := machines.Current()
+        words := strings.Fields(line)
+
+        //The word being typed is empty when the line ends in a space.
+        if len(words) == 0 || strings.HasSuffix(line, " ") {
+            words = append(words, "")
+        }
+        typed, words := words[len(words) - 1], words[:len(words) - 1]
+
+        list := completions
+        var cmd *completion
+
+        //Find the command or subcommand the word belongs to.
+        for len(words) > 0 {
+            if cmd != nil && cmd.subcommands == nil {
+                break
+            }
+
+            if cmd = findCompletion(list, words[0]); cmd == nil {
+                return nil
+            }
+
+            list = cmd.subcommands
+            words = words[1:]
+        }
+
+        //Aliases and macros are offered along with the commands.
+        if cmd == nil {
+            return append(completionNames(list), cfg.UserCommands()...)
+        }
+
+        if cmd.subcommands != nil {
+            return completionNames(list)
+        }
+
+        if len(cmd.args) == 0 {
+            return nil
+        }
+
+        kind := cmd.args[min(len(words), len(cmd.args) - 1)]
+        return completeArgument(ctrl, cfg, kind, typed, words)
+    }
+}
+
+//Returns the possible values of an argument, "previous" holds the arguments before it.
+func completeArgument(ctrl *interpreterControl, cfg *interpreterConfig, kind int, typed string, previous []string) []string {
+    switch kind {
+    case ARG_ADDRESS, ARG_SYMBOL:
+        return symbolNames(ctrl)
+
+    case ARG_REGISTER:
+        return append([]string{"PC"}, registerNames...)
+
+    case ARG_FLAG:
+        return []string{"N", "P", "Z"}
+
+    case ARG_FILE:
+        return completeFile(typed)
+
+    case ARG_INSTRUCTION:
+        return co.InstructionNames
+
+    case ARG_OPERAND:
+        return append(symbolNames(ctrl), registerNames...)
+
+    case ARG_SETTING:
+        keys := make([]string, len(settings))
+        for i, s := range settings {
+            keys[i] = s.key
+        }
+        return keys
+
+    case ARG_SETTING_VALUE:
+        if len(previous) == 0 {
+            return nil
+        }
+        return settingValues(previous[0])
+
+    case ARG_VIEW:
+        return memoryViews
+
+    case ARG_SWITCH:
+        return []string{CONFIGURE_ON, CONFIGURE_OFF}
+
+    case ARG_ALIAS:
+        return slices.Collect(maps.Keys(cfg.aliases))
+
+    case ARG_MACRO:
+        return slices.Collect(maps.Keys(cfg.macros))
+
+    case ARG_SCHEDULER:
+        return []string{SCHEDULE_ROUND_ROBIN, SCHEDULE_RANDOM, SCHEDULE_FIXED}
+
+    case ARG_MODE:
+        return []string{MODE_SUPERVISOR, MODE_USER}
+
+    case ARG_CLOCK_MODE:
+        return []string{CLOCK_VIRTUAL, CLOCK_HOST}
+
+    case ARG_MACHINE:
+        return sliceMap(ctrl.machines.machines, func(m *machine) string { return m.name })
+    }
+
+    return nil
+}
+
+func symbolNames(ctrl *interpreterControl) []string {
+    syms := ctrl.syms.Symbols()
+
+    names := make([]string, len(syms))
+    for i, s := range syms {
+        names[i] = s.Name
+    }
+
+    return names
+}
+
+//Returns the values a setting may take, if there is a fixed set of them.
+func settingValues(key string) []string {
+    switch key {
+    case "memory_view":
+        return memoryViews
+
+    case "pc_colour", "changed_colour":
+        names := make([]string, 0, len(colourAttributes) * 2)
+        for name := range colourAttributes {
+            names = append(names, name, "bright-" + name)
+        }
+        return names
+
+    case "colour":
+        return []string{COLOUR_AUTO, COLOUR_ALWAYS, COLOUR_NEVER}
+
+    case "follow_pc", "highlight_pc", "highlight_changes", "change_summary", "exit_on_error", "lock_core":
+        return []string{CONFIGURE_ON, CONFIGURE_OFF}
+    }
+
+    return nil
+}
+
+//Returns the files and directories in the directory of the typed path, directories end in "/".
+func completeFile(typed string) []string {
+    dir, _ := filepath.Split(typed)
+
+    readDir := dir
+    if readDir == "" {
+        readDir = "."
+    }
+
+    entries, err := os.ReadDir(readDir)
+    if err != nil {
+        return nil
+    }
+
+    names := make([]string, 0, len(entries))
+    for _, e := range entries {
+        name := dir + e.Name()
+
+        //Hidden files are only offered when asked for.
+        if strings.HasPrefix(e.Name(), ".") && !strings.HasPrefix(typed, dir + ".") {
+            continue
+        }
+
+        if e.IsDir() {
+            name += "/"
+        }
+        names = append(names, name)
+    }
+
+    return names
+}
@@ -0,0 +1,591 @@
+package cli
+
+import (
+    "bufio"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "text/tabwriter"
+    "time"
+
+    "github.com/Tinch334/Computer-one-v2/lineedit"
+    "github.com/Tinch334/Computer-one-v2/symbols"
+    "github.com/fatih/color"
+)
+
+//Configuration files, the project file is looked up in the working directory and overrides the user file.
+const (
+    userConfigDir = "computer-one"
+    userConfigFile = "config"
+    historyFile = "history"
+    ProjectConfigFile = ".computer-one"
+)
+
+//Maximum amount of lines kept in the history.
+const maxHistory = 1000
+
+//Colour modes, "auto" disables colour when NO_COLOR is set or the output is not a terminal.
+const (
+    COLOUR_AUTO = "auto"
+    COLOUR_ALWAYS = "always"
+    COLOUR_NEVER = "never"
+)
+
+//A colour along with its name, so it can be shown and saved.
+type displayColour struct {
+    name string
+    *color.Color
+}
+
+var colourAttributes = map[string]color.Attribute{
+    "black": color.FgBlack,
+    "red": color.FgRed,
+    "green": color.FgGreen,
+    "yellow": color.FgYellow,
+    "blue": color.FgBlue,
+    "magenta": color.FgMagenta,
+    "cyan": color.FgCyan,
+    "white": color.FgWhite,
+}
+
+//Returns the colour with the given name, names may be prefixed with "bright-".
+func newColour(name string) (error, *displayColour) {
+    base, bright := strings.CutPrefix(name, "bright-")
+
+    attr, ok := colourAttributes[base]
+    if !ok {
+        return fmt.Errorf("Unknown colour %q", name), nil
+    }
+
+    //The bright colours are offset from the normal ones.
+    if bright {
+        attr += color.FgHiBlack - color.FgBlack
+    }
+
+    //Colours always print, whether they are used depends on the colour mode of each machine.
+    c := color.New(attr)
+    c.EnableColor()
+
+    return nil, &displayColour{name: name, Color: c}
+}
+
+//Returns the colour with the given name, which must be valid.
+func mustColour(name string) *displayColour {
+    err, c := newColour(name)
+    if err != nil {
+        panic(err)
+    }
+
+    return c
+}
+
+func checkColourMode(mode string) error {
+    switch mode {
+    case COLOUR_AUTO, COLOUR_ALWAYS, COLOUR_NEVER:
+        return nil
+    default:
+        return fmt.Errorf("Unknown colour mode %q, valid modes are %s, %s and %s", mode, COLOUR_AUTO, COLOUR_ALWAYS, COLOUR_NEVER)
+    }
+}
+
+//Returns whether the colour mode allows colour, in "auto" mode it follows the colour package, which checks NO_COLOR
+//and the output on startup.
+func (cfg *interpreterConfig) useColour() bool {
+    switch cfg.colourMode {
+    case COLOUR_AUTO:
+        return !color.NoColor
+    case COLOUR_ALWAYS:
+        return true
+    default:
+        return false
+    }
+}
+
+func parseSwitch(value string) (error, bool) {
+    switch value {
+    case CONFIGURE_ON:
+        return nil, true
+    case CONFIGURE_OFF:
+        return nil, false
+    }
+
+    return fmt.Errorf("Expected %q or %q, got %q", CONFIGURE_ON, CONFIGURE_OFF, value), false
+}
+
+func switchStr(b bool) string {
+    if b {
+        return CONFIGURE_ON
+    }
+    return CONFIGURE_OFF
+}
+
+//A configuration setting, "set" receives the rest of the line, so it may take several values.
+type setting struct {
+    key string
+    desc string
+    get func(cfg *interpreterConfig) string
+    set func(cfg *interpreterConfig, value string, syms *symbols.Table) error
+}
+
+var settings = []setting{
+    {
+        key: "memory_limits",
+        desc: "Bounds of the printed memory cells, <lower> <upper>",
+        get: func(cfg *interpreterConfig) string {
+            return fmt.Sprintf("0x%04X 0x%04X", cfg.memoryLimitL, cfg.memoryLimitH)
+        },
+        set: func(cfg *interpreterConfig, value string, syms *symbols.Table) error {
+            bounds := strings.Fields(value)
+            if len(bounds) != 2 {
+                return errors.New("Expected a lower and an upper bound")
+            }
+
+            err, lower := parseAddr(bounds[0], syms)
+            if err != nil {
+                return err
+            }
+
+            err, higher := parseAddr(bounds[1], syms)
+            if err != nil {
+                return err
+            }
+
+            if lower >= higher {
+                return errors.New("The lower bound must be smaller than the upper bound")
+            }
+
+            cfg.SetMemoryLimits(lower, higher)
+            return nil
+        },
+    },
+    {
+        key: "memory_view",
+        desc: "Format of the printed memory cells, one of: " + strings.Join(memoryViews, ", "),
+        get: func(cfg *interpreterConfig) string {
+            return cfg.memoryView
+        },
+        set: func(cfg *interpreterConfig, value string, syms *symbols.Table) error {
+            if !validMemoryView(value) {
+                return fmt.Errorf("Unknown memory view %q", value)
+            }
+
+            cfg.memoryView = value
+            return nil
+        },
+    },
+    {
+        key: "memory_columns",
+        desc: "Amount of memory cells printed per row",
+        get: func(cfg *interpreterConfig) string {
+            return strconv.Itoa(cfg.memoryColumns)
+        },
+        set: func(cfg *interpreterConfig, value string, syms *symbols.Table) error {
+            columns, err := strconv.Atoi(value)
+            if err != nil || columns < 1 {
+                return fmt.Errorf("Invalid amount of columns %q", value)
+            }
+
+            cfg.memoryColumns = columns
+            return nil
+        },
+    },
+    {
+        key: "follow_pc",
+        desc: "Keeps the printed memory centred on the PC",
+        get: func(cfg *interpreterConfig) string {
+            return switchStr(cfg.followPC)
+        },
+        set: func(cfg *interpreterConfig, value string, syms *symbols.Table) error {
+            err, b := parseSwitch(value)
+            if err == nil {
+                cfg.followPC = b
+            }
+            return err
+        },
+    },
+    {
+        key: "highlight_pc",
+        desc: "Highlights the memory cell the PC points to",
+        get: func(cfg *interpreterConfig) string {
+            return switchStr(cfg.highlightPC)
+        },
+        set: func(cfg *interpreterConfig, value string, syms *symbols.Table) error {
+            err, b := parseSwitch(value)
+            if err == nil {
+                cfg.highlightPC = b
+            }
+            return err
+        },
+    },
+    {
+        key: "pc_colour",
+        desc: "Colour of the PC cell",
+        get: func(cfg *interpreterConfig) string {
+            return cfg.highlightPCColour.name
+        },
+        set: func(cfg *interpreterConfig, value string, syms *symbols.Table) error {
+            err, c := newColour(value)
+            if err == nil {
+                cfg.highlightPCColour = c
+            }
+            return err
+        },
+    },
+    {
+        key: "highlight_changes",
+        desc: "Highlights the registers, flags and memory cells changed by the last execution",
+        get: func(cfg *interpreterConfig) string {
+            return switchStr(cfg.highlightChanges)
+        },
+        set: func(cfg *interpreterConfig, value string, syms *symbols.Table) error {
+            err, b := parseSwitch(value)
+            if err == nil {
+                cfg.highlightChanges = b
+            }
+            return err
+        },
+    },
+    {
+        key: "changed_colour",
+        desc: "Colour of changed values",
+        get: func(cfg *interpreterConfig) string {
+            return cfg.changedColour.name
+        },
+        set: func(cfg *interpreterConfig, value string, syms *symbols.Table) error {
+            err, c := newColour(value)
+            if err == nil {
+                cfg.changedColour = c
+            }
+            return err
+        },
+    },
+    {
+        key: "change_summary",
+        desc: "Prints a line listing the changes made by the last execution",
+        get: func(cfg *interpreterConfig) string {
+            return switchStr(cfg.changeSummary)
+        },
+        set: func(cfg *interpreterConfig, value string, syms *symbols.Table) error {
+            err, b := parseSwitch(value)
+            if err == nil {
+                cfg.changeSummary = b
+            }
+            return err
+        },
+    },
+    {
+        key: "colour",
+        desc: fmt.Sprintf("When to use colour, one of: %s, %s, %s", COLOUR_AUTO, COLOUR_ALWAYS, COLOUR_NEVER),
+        get: func(cfg *interpreterConfig) string {
+            return cfg.colourMode
+        },
+        set: func(cfg *interpreterConfig, value string, syms *symbols.Table) error {
+            err := checkColourMode(value)
+            if err == nil {
+                cfg.colourMode = value
+            }
+            return err
+        },
+    },
+    {
+        key: "exit_on_error",
+        desc: "Ends the session when an instruction fails",
+        get: func(cfg *interpreterConfig) string {
+            return switchStr(cfg.exitOnError)
+        },
+        set: func(cfg *interpreterConfig, value string, syms *symbols.Table) error {
+            err, b := parseSwitch(value)
+            if err == nil {
+                cfg.exitOnError = b
+            }
+            return err
+        },
+    },
+    {
+        key: "lock_core",
+        desc: "Only the current core runs, the others are paused",
+        get: func(cfg *interpreterConfig) string {
+            return switchStr(cfg.lockCore)
+        },
+        set: func(cfg *interpreterConfig, value string, syms *symbols.Table) error {
+            err, b := parseSwitch(value)
+            if err == nil {
+                cfg.lockCore = b
+            }
+            return err
+        },
+    },
+    {
+        key: "step_limit",
+        desc: "Maximum amount of steps a continue runs for, 0 means no limit",
+        get: func(cfg *interpreterConfig) string {
+            return strconv.Itoa(cfg.stepLimit)
+        },
+        set: func(cfg *interpreterConfig, value string, syms *symbols.Table) error {
+            limit, err := strconv.Atoi(value)
+            if err != nil || limit < 0 {
+                return fmt.Errorf("Invalid step limit %q", value)
+            }
+
+            cfg.stepLimit = limit
+            return nil
+        },
+    },
+    {
+        key: "timeout",
+        desc: "Maximum time a continue runs for, like \"2s\", 0 means no limit",
+        get: func(cfg *interpreterConfig) string {
+            return cfg.timeout.String()
+        },
+        set: func(cfg *interpreterConfig, value string, syms *symbols.Table) error {
+            //A plain "0" disables the timeout, anything else must be a duration like "500ms" or "2s".
+            timeout, err := time.ParseDuration(value)
+            if err != nil || timeout < 0 {
+                return fmt.Errorf("Invalid timeout %q", value)
+            }
+
+            cfg.timeout = timeout
+            return nil
+        },
+    },
+}
+
+//Settings that can be changed directly with "cfg <shortcut> <value>".
+var configShortcuts = map[string]string{
+    CONFIGURE_MEMORY_LIMITS: "memory_limits",
+    CONFIGURE_STEP_LIMIT: "step_limit",
+    CONFIGURE_TIMEOUT: "timeout",
+    CONFIGURE_MEMORY_VIEW: "memory_view",
+    CONFIGURE_MEMORY_COLUMNS: "memory_columns",
+    CONFIGURE_FOLLOW_PC: "follow_pc",
+    CONFIGURE_HIGHLIGHT_CHANGES: "highlight_changes",
+    CONFIGURE_CHANGE_SUMMARY: "change_summary",
+}
+
+//Returns the configuration with all settings at their defaults.
+func defaultConfig() interpreterConfig {
+    return interpreterConfig {
+        memoryLimitL: 0,
+        memoryLimitH: 40,
+
+        memoryView: VIEW_HEX,
+        memoryColumns: 8,
+        followPC: false,
+
+        highlightPC: true,
+        highlightPCColour: mustColour("blue"),
+
+        highlightChanges: true,
+        changedColour: mustColour("yellow"),
+        changeSummary: false,
+
+        colourMode: COLOUR_AUTO,
+
+        exitOnError: false,
+        lockCore: false,
+
+        stepLimit: 0,
+        timeout: 0,
+
+        aliases: make(map[string]string),
+        macros: make(map[string][]string),
+    }
+}
+
+//Sets the value of the setting with the given key.
+func (cfg *interpreterConfig) Set(key string, value string, syms *symbols.Table) error {
+    for _, s := range settings {
+        if s.key == key {
+            return s.set(cfg, strings.TrimSpace(value), syms)
+        }
+    }
+
+    return fmt.Errorf("Unknown setting %q", key)
+}
+
+//Writes all settings as "key = value" lines, each one preceded by its description.
+func (cfg *interpreterConfig) Write(w io.Writer) error {
+    if _, err := fmt.Fprintf(w, "#Computer one interpreter configuration.\n"); err != nil {
+        return err
+    }
+
+    for _, s := range settings {
+        if _, err := fmt.Fprintf(w, "\n#%s.\n%s = %s\n", s.desc, s.key, s.get(cfg)); err != nil {
+            return err
+        }
+    }
+
+    for _, name := range cfg.UserCommands() {
+        var err error
+
+        if expansion, ok := cfg.aliases[name]; ok {
+            _, err = fmt.Fprintf(w, "\n%s %s %s\n", ALIAS, name, expansion)
+        } else {
+            _, err = fmt.Fprintf(w, "\n%s\n", formatMacro(name, cfg.macros[name]))
+        }
+
+        if err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
+
+//Saves all settings to the given file, creating its directory if needed.
+func (cfg *interpreterConfig) Save(path string) error {
+    if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+        return err
+    }
+
+    f, err := os.Create(path)
+    if err != nil {
+        return err
+    }
+
+    if err := cfg.Write(f); err != nil {
+        f.Close()
+        return err
+    }
+
+    return f.Close()
+}
+
+//Reads settings from a file, empty lines and lines starting with "#" are ignored. Besides settings, aliases are written
+//like the "alias" command and macros as "define" blocks. Returns false if the file doesn't exist, in which case nothing
+//is done.
+func (cfg *interpreterConfig) Load(path string, syms *symbols.Table) (error, bool) {
+    f, err := os.Open(path)
+    if errors.Is(err, os.ErrNotExist) {
+        return nil, false
+    }
+    if err != nil {
+        return err, false
+    }
+    defer f.Close()
+
+    //Macro being read, and the line it starts at.
+    var def *macroDefinition
+    defLine := 0
+
+    scanner := bufio.NewScanner(f)
+    for n := 1; scanner.Scan(); n++ {
+        line := strings.TrimSpace(scanner.Text())
+        if line == "" || strings.HasPrefix(line, COMMENT) {
+            continue
+        }
+
+        if def != nil {
+            if def.depth += blockDepthChange(line); def.depth >= 0 {
+                def.lines = append(def.lines, line)
+                continue
+            }
+
+            if err := cfg.SetMacro(def.name, def.lines); err != nil {
+                return fmt.Errorf("%s:%d: %s", path, defLine, err), true
+            }
+
+            def = nil
+            continue
+        }
+
+        keyword, rest := splitKeyword(line)
+
+        switch keyword {
+        case ALIAS:
+            name, expansion := splitKeyword(rest)
+            if expansion == "" {
+                return fmt.Errorf("%s:%d: Expected \"%s <name> <expansion>\"", path, n, ALIAS), true
+            }
+
+            if err := cfg.SetAlias(name, expansion); err != nil {
+                return fmt.Errorf("%s:%d: %s", path, n, err), true
+            }
+            continue
+
+        case DEFINE:
+            def, defLine = &macroDefinition{name: rest}, n
+            continue
+        }
+
+        key, value, ok := strings.Cut(line, "=")
+        if !ok {
+            return fmt.Errorf("%s:%d: Expected \"key = value\"", path, n), true
+        }
+
+        if err := cfg.Set(strings.TrimSpace(key), value, syms); err != nil {
+            return fmt.Errorf("%s:%d: %s", path, n, err), true
+        }
+    }
+
+    if def != nil {
+        return fmt.Errorf("%s:%d: %q without a matching %q", path, defLine, DEFINE, END), true
+    }
+
+    return scanner.Err(), true
+}
+
+//Returns the path of the user configuration file.
+func userConfigPath() (error, string) {
+    dir, err := os.UserConfigDir()
+    if err != nil {
+        return err, ""
+    }
+
+    return nil, filepath.Join(dir, userConfigDir, userConfigFile)
+}
+
+//Loads the command history from the user configuration directory, if it can't be loaded the history isn't saved.
+func loadHistory(editor *lineedit.Editor) {
+    dir, err := os.UserConfigDir()
+    if err != nil {
+        return
+    }
+
+    err, history := lineedit.LoadHistory(filepath.Join(dir, userConfigDir, historyFile), maxHistory)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Error loading history: %s\n", err)
+        return
+    }
+
+    editor.History = history
+}
+
+//Loads the user configuration file and then the project one, errors are reported but don't stop the session. "cfg save"
+//writes to the last file loaded, or to the user file if there is none.
+func loadConfig(cfg *interpreterConfig, syms *symbols.Table) {
+    paths := make([]string, 0)
+    if err, path := userConfigPath(); err == nil {
+        paths = append(paths, path)
+        cfg.path = path
+    }
+    paths = append(paths, ProjectConfigFile)
+
+    for _, path := range paths {
+        err, found := cfg.Load(path, syms)
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Error loading configuration: %s\n", err)
+        }
+
+        if found {
+            cfg.path = path
+        }
+    }
+}
+
+//Prints all settings and their values, without a trailing newline.
+func printConfig(cfg *interpreterConfig) {
+    var b strings.Builder
+    tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+
+    for _, s := range settings {
+        fmt.Fprintf(tw, "%s\t%s\t| %s\n", s.key, s.get(cfg), s.desc)
+    }
+
+    tw.Flush()
+    fmt.Printf("%s", strings.TrimSuffix(b.String(), "\n"))
+}
@@ -0,0 +1,137 @@
+package cli
+
+import (
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    "github.com/Tinch334/Computer-one-v2/symbols"
+    "github.com/fatih/color"
+)
+
+//Returns the settings as written to a configuration file.
+func configText(t *testing.T, cfg *interpreterConfig) string {
+    t.Helper()
+
+    var b strings.Builder
+    if err := cfg.Write(&b); err != nil {
+        t.Fatal(err)
+    }
+
+    return b.String()
+}
+
+func TestConfigRoundTrip(t *testing.T) {
+    syms := symbols.NewTable()
+    syms.Add(symbols.Symbol{Name: "buf", Addr: 0x100})
+
+    cfg := defaultConfig()
+    changes := map[string]string{
+        "memory_limits": "buf buf+0x20",
+        "memory_view": VIEW_SIGNED,
+        "memory_columns": "4",
+        "follow_pc": CONFIGURE_ON,
+        "pc_colour": "bright-green",
+        "highlight_changes": CONFIGURE_OFF,
+        "change_summary": CONFIGURE_ON,
+        "step_limit": "5000",
+        "timeout": "1.5s",
+    }
+
+    for key, value := range changes {
+        if err := cfg.Set(key, value, syms); err != nil {
+            t.Fatalf("setting %s to %q: %v", key, value, err)
+        }
+    }
+
+    path := filepath.Join(t.TempDir(), "dir", "config")
+    if err := cfg.Save(path); err != nil {
+        t.Fatal(err)
+    }
+
+    //Addresses are saved as numbers, so the symbols aren't needed to load them.
+    loaded := defaultConfig()
+    err, found := loaded.Load(path, nil)
+    if err != nil || !found {
+        t.Fatalf("Load returned %v, %v", err, found)
+    }
+
+    if got, want := configText(t, &loaded), configText(t, &cfg); got != want {
+        t.Errorf("loaded settings:\n%s\nwant:\n%s", got, want)
+    }
+    if loaded.memoryLimitL != 0x100 || loaded.memoryLimitH != 0x120 || loaded.memoryColumns != 4 || !loaded.followPC {
+        t.Errorf("loaded %+v", loaded)
+    }
+}
+
+func TestConfigLoad(t *testing.T) {
+    dir := t.TempDir()
+
+    cfg := defaultConfig()
+    if err, found := cfg.Load(filepath.Join(dir, "missing"), nil); err != nil || found {
+        t.Errorf("loading a missing file returned %v, %v", err, found)
+    }
+
+    tests := []struct {
+        text string
+        err string
+    }{
+        {"# Comment\n\nmemory_columns = 2\n", ""},
+        {"memory_columns = 2\nmemory_columns\n", "config:2: Expected \"key = value\""},
+        {"colour_of_things = red\n", "config:1: Unknown setting \"colour_of_things\""},
+        {"follow_pc = maybe\n", "config:1: Expected"},
+        {"memory_limits = 0x20 0x10\n", "config:1:"},
+    }
+
+    for _, tt := range tests {
+        path := filepath.Join(dir, "config")
+        if err := os.WriteFile(path, []byte(tt.text), 0644); err != nil {
+            t.Fatal(err)
+        }
+
+        cfg := defaultConfig()
+        err, found := cfg.Load(path, nil)
+
+        switch {
+        case !found:
+            t.Errorf("loading %q didn't find the file", tt.text)
+        case tt.err == "" && err != nil:
+            t.Errorf("loading %q failed: %v", tt.text, err)
+        case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+            t.Errorf("loading %q: got error %v, want one containing %q", tt.text, err, tt.err)
+        }
+    }
+}
+
+//The colour mode belongs to each machine, setting it on one doesn't change the others or the colour package.
+func TestColourMode(t *testing.T) {
+    noColor := color.NoColor
+    defer func() { color.NoColor = noColor }()
+    color.NoColor = true
+
+    cfg := defaultConfig()
+    c := cfg.Clone()
+
+    if err := c.Set("colour", COLOUR_ALWAYS, nil); err != nil {
+        t.Fatal(err)
+    }
+    if err := cfg.Set("colour", "sometimes", nil); err == nil || cfg.colourMode != COLOUR_AUTO {
+        t.Errorf("Setting an unknown mode gave %v, mode %q", err, cfg.colourMode)
+    }
+
+    if !color.NoColor || cfg.useColour() || !c.useColour() {
+        t.Errorf("Colour used: %v and %v, want false and true", cfg.useColour(), c.useColour())
+    }
+
+    c.Set("colour", COLOUR_NEVER, nil)
+    color.NoColor = false
+    if !cfg.useColour() || c.useColour() {
+        t.Errorf("Colour used: %v and %v, want true and false", cfg.useColour(), c.useColour())
+    }
+
+    //The colours print regardless of the colour package, so the machine's mode decides.
+    if got := c.highlightPCColour.Sprint("x"); got == "x" {
+        t.Error("The PC colour isn't applied")
+    }
+}
@@ -0,0 +1,183 @@
+package cli
+
+import (
+    "fmt"
+    "io"
+    "os"
+    "strconv"
+    "strings"
+    "sync"
+
+    "github.com/Tinch334/Computer-one-v2/co"
+    "github.com/Tinch334/Computer-one-v2/device"
+    "github.com/Tinch334/Computer-one-v2/system"
+)
+
+//Collects what the program prints, so the debugger can show it apart from its own output. The console writes to it
+//while the program runs in the background.
+type programOutput struct {
+    mu sync.Mutex
+    text []byte
+
+    //Length of the text already shown.
+    shown int
+}
+
+func (o *programOutput) Write(p []byte) (int, error) {
+    o.mu.Lock()
+    defer o.mu.Unlock()
+
+    o.text = append(o.text, p...)
+    return len(p), nil
+}
+
+//Returns the text printed since the last call.
+func (o *programOutput) Unseen() string {
+    o.mu.Lock()
+    defer o.mu.Unlock()
+
+    s := string(o.text[o.shown:])
+    o.shown = len(o.text)
+
+    return s
+}
+
+func (o *programOutput) All() string {
+    o.mu.Lock()
+    defer o.mu.Unlock()
+
+    o.shown = len(o.text)
+    return string(o.text)
+}
+
+func (o *programOutput) Clear() {
+    o.mu.Lock()
+    defer o.mu.Unlock()
+
+    o.text = nil
+    o.shown = 0
+}
+
+//Attaches a console at the given address. In headless runs it's connected to stdin and stdout, otherwise its output is
+//collected and input is given with "console input".
+func attachConsole(base uint16, ci *co.ComputerInfo, ctrl *interpreterControl) error {
+    if ctrl.console != nil {
+        return fmt.Errorf("A console is already attached at 0x%04x", consoleBase(ctrl))
+    }
+
+    headless := ctrl.machines != nil && ctrl.machines.headless
+
+    var out io.Writer = &ctrl.output
+    if headless {
+        out = os.Stdout
+    }
+
+    console := device.NewConsole(base, system.VECTOR_KEYBOARD, out)
+    if err := ci.Attach(console); err != nil {
+        return err
+    }
+
+    if headless {
+        go console.Feed(os.Stdin)
+    }
+
+    ctrl.console = console
+    return nil
+}
+
+func consoleBase(ctrl *interpreterControl) uint16 {
+    base, _ := ctrl.console.Registers()
+    return base
+}
+
+//Prints what the program printed since the last time, if anything.
+func printProgramOutput(ctrl *interpreterControl) {
+    if text := ctrl.output.Unseen(); text != "" {
+        fmt.Printf("Program output:\n%s\n\n", strings.TrimSuffix(text, "\n"))
+    }
+}
+
+
+/*
+    COMMANDS
+*/
+func consoleHandler(ci *co.ComputerInfo, ctrl *interpreterControl, line string, args []string) {
+    if len(args) == 0 {
+        printErrorMsg(CONSOLE)
+        return
+    }
+
+    //Every subcommand but attaching needs a console.
+    if args[0] != CONSOLE_ATTACH && ctrl.console == nil {
+        fmt.Printf("No console is attached")
+        return
+    }
+
+    switch args[0] {
+    case CONSOLE_ATTACH:
+        if len(args) > 2 {
+            printErrorMsg(CONSOLE)
+            return
+        }
+
+        base := uint16(system.CONSOLE)
+        if len(args) == 2 {
+            var err error
+            if err, base = convValidateMemoryAddr(args[1], ctrl.syms); err != nil {
+                fmt.Fprintf(os.Stderr, "%s\n", err)
+                return
+            }
+        }
+
+        if err := attachConsole(base, ci, ctrl); err != nil {
+            fmt.Fprintf(os.Stderr, "%s\n", err)
+            return
+        }
+
+        fmt.Printf("Console attached at 0x%04x", base)
+
+    case CONSOLE_DETACH:
+        if len(args) != 1 {
+            printErrorMsg(CONSOLE)
+            return
+        }
+
+        ci.Detach(ctrl.console)
+        ctrl.console = nil
+        fmt.Printf("Console detached")
+
+    case CONSOLE_INPUT:
+        //The rest of the line is the input, escape sequences are allowed and a newline is added.
+        _, rest := splitKeyword(strings.TrimSpace(line))
+        _, text := splitKeyword(rest)
+
+        unquoted, err := strconv.Unquote("\"" + strings.ReplaceAll(text, "\"", "\\\"") + "\"")
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Invalid input: %q\n", text)
+            return
+        }
+
+        ctrl.console.Input(unquoted + "\n")
+        fmt.Printf("%d characters waiting", ctrl.console.Pending())
+
+    case CONSOLE_SHOW:
+        if len(args) != 1 {
+            printErrorMsg(CONSOLE)
+            return
+        }
+
+        fmt.Printf("%s", ctrl.output.All())
+
+    case CONSOLE_CLEAR:
+        if len(args) != 1 {
+            printErrorMsg(CONSOLE)
+            return
+        }
+
+        ctrl.output.Clear()
+        fmt.Printf("Output cleared")
+
+    default:
+        printErrorMsg(CONSOLE)
+    }
+}
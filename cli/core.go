@@ -0,0 +1,185 @@
+package cli
+
+import (
+    "fmt"
+    "os"
+    "strconv"
+    "strings"
+
+    "github.com/Tinch334/Computer-one-v2/co"
+)
+
+//Parses a core index, it must be one of the cores of the machine.
+func parseCore(s string, ctrl *interpreterControl) (error, int) {
+    core, err := strconv.Atoi(s)
+    if err != nil || core < 0 || core >= ctrl.cores.Cores() {
+        return fmt.Errorf("Invalid core: %q", s), 0
+    }
+
+    return nil, core
+}
+
+//Returns the core that runs the next instruction, the current one if it's locked or it's the only one.
+func nextCore(ctrl *interpreterControl, cfg *interpreterConfig) (error, int) {
+    if cfg.lockCore || ctrl.cores.Cores() == 1 {
+        if ctrl.cores.Halted(ctrl.core) {
+            return fmt.Errorf("Core %d has halted", ctrl.core), 0
+        }
+
+        return nil, ctrl.core
+    }
+
+    return ctrl.cores.NextCore()
+}
+
+//Returns a line with the current core and the one that ran last, empty for single core machines.
+func coreStatus(ctrl *interpreterControl) string {
+    if ctrl.cores.Cores() == 1 {
+        return ""
+    }
+
+    status := fmt.Sprintf("Core %d of %d | Last ran: %d", ctrl.core, ctrl.cores.Cores(), ctrl.lastCore)
+    if ctrl.cores.Halted(ctrl.core) {
+        status += " | Halted"
+    }
+
+    return status
+}
+
+
+/*
+    COMMANDS
+*/
+func coreHandler(ctrl *interpreterControl, args []string) {
+    if len(args) == 0 {
+        printErrorMsg(CORE)
+        return
+    }
+
+    switch args[0] {
+    case CORE_LIST:
+        if len(args) != 1 {
+            printErrorMsg(CORE)
+            return
+        }
+
+        lines := make([]string, ctrl.cores.Cores())
+        for i := range lines {
+            marker := " "
+            if i == ctrl.core {
+                marker = "*"
+            }
+
+            lines[i] = fmt.Sprintf("%s %d | PC: %s", marker, i, addrWithSymbolStr(ctrl.syms)(ctrl.cores.Core(i).GetRegisters().PC))
+            if ctrl.cores.Halted(i) {
+                lines[i] += " | Halted"
+            }
+        }
+
+        fmt.Printf("%s", strings.Join(lines, "\n"))
+
+    case CORE_SWITCH:
+        if len(args) != 2 {
+            printErrorMsg(CORE)
+            return
+        }
+
+        err, core := parseCore(args[1], ctrl)
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "%s\n", err)
+            return
+        }
+
+        ctrl.core = core
+        ctrl.machines.switched = true
+        fmt.Printf("Switched to core %d", core)
+
+    case CORE_COUNT:
+        if len(args) != 2 {
+            printErrorMsg(CORE)
+            return
+        }
+
+        n, err := strconv.Atoi(args[1])
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Invalid core count: %q\n", args[1])
+            return
+        }
+
+        if err := ctrl.cores.SetCores(n); err != nil {
+            fmt.Fprintf(os.Stderr, "%s\n", err)
+            return
+        }
+
+        //The current core may have been removed.
+        if ctrl.core >= n {
+            ctrl.core = 0
+            ctrl.machines.switched = true
+        }
+        ctrl.lastCore = min(ctrl.lastCore, n - 1)
+
+        fmt.Printf("The machine has %d cores", n)
+
+    case CORE_SCHEDULE:
+        if len(args) < 2 {
+            printErrorMsg(CORE)
+            return
+        }
+
+        err, s := parseSchedule(args[1], args[2:])
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "%s\n", err)
+            return
+        }
+
+        ctrl.cores.SetScheduler(s)
+        fmt.Printf("Scheduler set to %s", strings.Join(args[1:], " "))
+
+    default:
+        printErrorMsg(CORE)
+    }
+}
+
+//Returns the scheduler with the given name, "random" takes a seed and "fixed" the order of the cores.
+func parseSchedule(name string, args []string) (error, co.Scheduler) {
+    switch name {
+    case SCHEDULE_ROUND_ROBIN:
+        if len(args) != 0 {
+            return fmt.Errorf("%q takes no arguments", name), nil
+        }
+
+        return nil, &co.RoundRobin{}
+
+    case SCHEDULE_RANDOM:
+        if len(args) != 1 {
+            return fmt.Errorf("%q takes a seed", name), nil
+        }
+
+        seed, err := strconv.ParseInt(args[0], 0, 64)
+        if err != nil {
+            return fmt.Errorf("Invalid seed: %q", args[0]), nil
+        }
+
+        return nil, co.NewRandomScheduler(seed)
+
+    case SCHEDULE_FIXED:
+        order := make([]int, len(args))
+        for i, a := range args {
+            core, err := strconv.Atoi(a)
+            if err != nil {
+                return fmt.Errorf("Invalid core: %q", a), nil
+            }
+
+            order[i] = core
+        }
+
+        err, s := co.NewFixedSchedule(order)
+        if err != nil {
+            return err, nil
+        }
+
+        return nil, s
+    }
+
+    return fmt.Errorf("Unknown scheduler: %q", name), nil
+}
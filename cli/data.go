@@ -2,16 +2,107 @@ package cli
 
 
 import (
+	"errors"
+	"os"
 	"slices"
+	"time"
 
-	"github.com/fatih/color"
+	"github.com/Tinch334/Computer-one-v2/co"
+	"github.com/Tinch334/Computer-one-v2/device"
+	"github.com/Tinch334/Computer-one-v2/link"
+	"github.com/Tinch334/Computer-one-v2/symbols"
 )
 
 
+//A breakpoint, it only stops execution in the given core, or in any core if it's ANY_CORE.
+type breakpoint struct {
+	addr uint16
+	core int
+}
+
+//Core of breakpoints that stop every core.
+const ANY_CORE = -1
+
 type interpreterControl struct {
 	running bool
 
-	breakpoints []uint16
+	//Cores of the machine, they share its memory. Commands act on the current one.
+	cores *co.Multicore
+	core int
+
+	//Core that ran the last instruction.
+	lastCore int
+
+	breakpoints []breakpoint
+
+	//Temporary breakpoint used by "until", it's removed as soon as execution stops.
+	tempBreakpoint uint16
+	hasTempBreakpoint bool
+
+	//Call depth tracking used by "next" and "finish", execution stops once the depth drops to "depthTarget".
+	trackDepth bool
+	callDepth int
+	depthTarget int
+
+	//Execution limits of the current continue, a negative step budget or a zero deadline mean no limit.
+	stepBudget int
+	deadline time.Time
+
+	//Symbols used to annotate and parse addresses.
+	syms *symbols.Table
+
+	//Loaded program, used to show source lines. Nil if none was loaded.
+	program *link.Image
+
+	//The system image, nil if none is loaded. Programs are placed after it and run in user mode.
+	system *link.Image
+
+	//The attached console, nil if there is none, and what the program printed through it.
+	console *device.Console
+	output programOutput
+
+	//The attached display, nil if there is none, and the version of its pixels last printed.
+	display *device.Framebuffer
+	displayShown uint64
+
+	//Records the display while the program runs, nil unless a capture was asked for.
+	recorder *recorder
+
+	//The attached disk, timer and clock, nil if there are none.
+	disk *device.Disk
+	timer *device.Timer
+	clock *device.Clock
+
+	//Script variables, set with "set".
+	variables map[string]int
+
+	//Amount of nested scripts currently running.
+	scriptDepth int
+
+	//Receives SIGINT, used to pause a continue.
+	interrupt chan os.Signal
+
+	//All machines of the debugger, shared by their controls.
+	machines *machineList
+
+	//Macro being defined at the prompt, nil if there is none.
+	definition *macroDefinition
+
+	//Set once instructions were executed, used to know when the state must be printed.
+	executed bool
+
+	//State before the first instruction executed since the state was last printed, used to show what changed.
+	savedState *machineState
+
+	//Runs the instructions of the cores in its own goroutine.
+	runner *co.Runner
+
+	//Set when the pending continue runs in the background, and when a background run was asked to pause.
+	background bool
+	pausing bool
+
+	//Set while the state is locked by "Locked".
+	locked bool
 
 	step bool
 	cont bool
@@ -20,10 +111,38 @@ type interpreterControl struct {
 type interpreterConfig struct {
 	memoryLimitL, memoryLimitH uint16
 
+	//Format of the printed memory cells, and the amount of cells per row. In follow PC mode the printed window is moved
+	//to keep the PC in the middle, the memory limits only set its size.
+	memoryView string
+	memoryColumns int
+	followPC bool
+
 	highlightPC bool
-	highlightPCColour *color.Color
+	highlightPCColour *displayColour
+
+	//Registers, flags and memory cells changed since the state was last printed are highlighted, and optionally listed.
+	highlightChanges bool
+	changedColour *displayColour
+	changeSummary bool
+
+	//One of the COLOUR_* modes.
+	colourMode string
 
 	exitOnError bool
+
+	//If set only the current core runs, the others are paused.
+	lockCore bool
+
+	//Default execution limits for a continue, 0 means no limit.
+	stepLimit int
+	timeout time.Duration
+
+	//User defined commands, aliases expand to a single command and macros run a script.
+	aliases map[string]string
+	macros map[string][]string
+
+	//File written by "cfg save" when no path is given.
+	path string
 }
 
 
@@ -34,6 +153,18 @@ const (
 	CONTINUE = "continue"
 	CONTINUE_SHORT = "c"
 
+	RUN = "run"
+	RUN_SHORT = "r"
+
+	NEXT = "next"
+	NEXT_SHORT = "n"
+
+	FINISH = "finish"
+	FINISH_SHORT = "f"
+
+	UNTIL = "until"
+	UNTIL_SHORT = "u"
+
 	BREAKPOINT = "breakpoint"
 	BREAKPOINT_SHORT = "br"
 
@@ -42,6 +173,64 @@ const (
 	BREAKPOINT_DELETE = "d"
 	BREAKPOINT_DELETE_ALL = "da"
 
+	REGISTER = "register"
+	REGISTER_SHORT = "reg"
+
+	REGISTER_SET = "set"
+	REGISTER_GET = "get"
+
+	FLAG = "flag"
+	FLAG_SHORT = "fl"
+
+	FLAG_SET = "set"
+	FLAG_CLEAR = "clear"
+
+	PC = "pc"
+
+	SYMBOL = "symbol"
+	SYMBOL_SHORT = "sym"
+
+	SYMBOL_LOAD = "load"
+	SYMBOL_LIST = "l"
+	SYMBOL_ADD = "a"
+	SYMBOL_DELETE = "d"
+	SYMBOL_DELETE_ALL = "da"
+
+	LOAD = "load"
+
+	ASM = "asm"
+	EXEC = "exec"
+
+	SOURCE = "source"
+
+	BACKGROUND = "background"
+	BACKGROUND_SHORT = "bg"
+
+	PAUSE = "pause"
+
+	MACHINE = "machine"
+	MACHINE_SHORT = "ma"
+
+	MACHINE_NEW = "new"
+	MACHINE_SWITCH = "switch"
+	MACHINE_LIST = "list"
+	MACHINE_CLONE = "clone"
+	MACHINE_DIFF = "diff"
+
+	ALIAS = "alias"
+	UNALIAS = "unalias"
+	DEFINE = "define"
+	UNDEFINE = "undefine"
+	SET = "set"
+	ECHO = "echo"
+
+	IF = "if"
+	ELSE = "else"
+	WHILE = "while"
+	END = "end"
+
+	COMMENT = "#"
+
 	EXIT = "exit"
 	EXIT_SHORT = "e"
 
@@ -52,6 +241,20 @@ const (
 	CONFIGURE_SHORT = "cfg"
 
 	CONFIGURE_MEMORY_LIMITS = "ml"
+	CONFIGURE_STEP_LIMIT = "sl"
+	CONFIGURE_TIMEOUT = "to"
+	CONFIGURE_MEMORY_VIEW = "mv"
+	CONFIGURE_MEMORY_COLUMNS = "mc"
+	CONFIGURE_FOLLOW_PC = "fp"
+	CONFIGURE_HIGHLIGHT_CHANGES = "hc"
+	CONFIGURE_CHANGE_SUMMARY = "cs"
+
+	CONFIGURE_SET = "set"
+	CONFIGURE_SHOW = "show"
+	CONFIGURE_SAVE = "save"
+
+	CONFIGURE_ON = "on"
+	CONFIGURE_OFF = "off"
 
 	MEMORY_CONTROL = "memory"
 	MEMORY_CONTROL_SHORT = "mem"
@@ -61,36 +264,228 @@ const (
 
 	MEMORY_CONTROL_POKE = "poke"
 	MEMORY_CONTROL_POKE_SHORT = "po"
+
+	CORE = "core"
+	CORE_SHORT = "co"
+
+	CORE_LIST = "list"
+	CORE_SWITCH = "switch"
+	CORE_COUNT = "count"
+	CORE_SCHEDULE = "schedule"
+
+	SCHEDULE_ROUND_ROBIN = "round-robin"
+	SCHEDULE_RANDOM = "random"
+	SCHEDULE_FIXED = "fixed"
+
+	MPU = "mpu"
+
+	MPU_MAP = "map"
+	MPU_SET = "set"
+	MPU_MODE = "mode"
+
+	MODE_SUPERVISOR = "supervisor"
+	MODE_USER = "user"
+
+	SYSTEM = "system"
+	SYSTEM_SHORT = "sys"
+
+	SYSTEM_LOAD = "load"
+	SYSTEM_USER = "user"
+	SYSTEM_OS = "os"
+
+	CONSOLE = "console"
+	CONSOLE_SHORT = "con"
+
+	CONSOLE_ATTACH = "attach"
+	CONSOLE_DETACH = "detach"
+	CONSOLE_INPUT = "input"
+	CONSOLE_SHOW = "show"
+	CONSOLE_CLEAR = "clear"
+
+	DISPLAY = "display"
+	DISPLAY_SHORT = "dis"
+
+	DISPLAY_ATTACH = "attach"
+	DISPLAY_DETACH = "detach"
+	DISPLAY_SHOW = "show"
+	DISPLAY_CLEAR = "clear"
+
+	SCREENSHOT = "screenshot"
+
+	DISK = "disk"
+	DISK_SHORT = "dk"
+
+	DISK_ATTACH = "attach"
+	DISK_DETACH = "detach"
+	DISK_CREATE = "create"
+
+	TIMER = "timer"
+	TIMER_SHORT = "tm"
+
+	TIMER_ATTACH = "attach"
+	TIMER_DETACH = "detach"
+	TIMER_SHOW = "show"
+
+	CLOCK = "clock"
+	CLOCK_SHORT = "clk"
+
+	CLOCK_ATTACH = "attach"
+	CLOCK_DETACH = "detach"
+	CLOCK_SHOW = "show"
+	CLOCK_HOST = "host"
+	CLOCK_VIRTUAL = "virtual"
+
+	VIEW_HEX = "hex"
+	VIEW_UNSIGNED = "udec"
+	VIEW_SIGNED = "sdec"
+	VIEW_BINARY = "bin"
+	VIEW_ASCII = "ascii"
+	VIEW_DISASSEMBLY = "disasm"
 )
 
 
-func (c *interpreterControl) AddBreakpoint(pos uint16) {
+//Returns the core commands act on.
+func (c *interpreterControl) CurrentCore() *co.ComputerInfo {
+	return c.cores.Core(c.core)
+}
+
+func (c *interpreterControl) AddBreakpoint(pos uint16, core int) {
 	//Avoid duplicate breakpoints.
-	if !slices.Contains(c.breakpoints, pos) {
-		c.breakpoints = append(c.breakpoints, pos)
+	if !slices.Contains(c.breakpoints, breakpoint{pos, core}) {
+		c.breakpoints = append(c.breakpoints, breakpoint{pos, core})
 	}
 }
 
-func (c *interpreterControl) HasBreakpoint(pos uint16) bool {
-	return slices.Contains(c.breakpoints, pos)
+//Returns true if there is a breakpoint at the given address that stops the given core.
+func (c *interpreterControl) HasBreakpoint(pos uint16, core int) bool {
+	return slices.ContainsFunc(c.breakpoints, func (b breakpoint) bool {
+		return b.addr == pos && (b.core == ANY_CORE || b.core == core)
+	})
 }
 
-func (c *interpreterControl) DeleteBreakpoint(pos uint16) {
-	del := func (e uint16) bool {
-		return e == pos
+//Deletes all breakpoints at the given address, returns false if there were none.
+func (c *interpreterControl) DeleteBreakpoint(pos uint16) bool {
+	del := func (b breakpoint) bool {
+		return b.addr == pos
 	}
 
+	n := len(c.breakpoints)
 	c.breakpoints = slices.DeleteFunc(c.breakpoints, del)
+
+	return len(c.breakpoints) != n
 }
 
 func (c *interpreterControl) ClearBreakpoints() {
-	c.breakpoints = make([]uint16, 0)
+	c.breakpoints = make([]breakpoint, 0)
 }
 
-func (c* interpreterControl) GetBreakpoints() []uint16 {
+func (c* interpreterControl) GetBreakpoints() []breakpoint {
 	return c.breakpoints
 }
 
+func (c *interpreterControl) SetTempBreakpoint(pos uint16) {
+	c.tempBreakpoint = pos
+	c.hasTempBreakpoint = true
+}
+
+func (c *interpreterControl) HasTempBreakpoint(pos uint16) bool {
+	return c.hasTempBreakpoint && c.tempBreakpoint == pos
+}
+
+//Starts tracking subroutine calls, execution stops once the call depth drops to the given target. A target of 0 steps over
+//a call, -1 runs until the current subroutine returns.
+func (c *interpreterControl) StartDepthTracking(target int) {
+	c.trackDepth = true
+	c.callDepth = 0
+	c.depthTarget = target
+}
+
+//Updates the call depth with the instruction about to be executed.
+func (c *interpreterControl) TrackCallDepth(ins uint16) {
+	if !c.trackDepth {
+		return
+	}
+
+	switch ins {
+	case co.JSR, co.TRAP:
+		c.callDepth++
+	case co.RET, co.RTT:
+		c.callDepth--
+	}
+}
+
+func (c *interpreterControl) DepthReached() bool {
+	return c.trackDepth && c.callDepth <= c.depthTarget
+}
+
+//Starts a continue, with the given step budget and timeout, 0 means no limit. The first instruction is always executed, to be
+//able to continue from a breakpoint.
+func (c *interpreterControl) StartContinue(steps int, timeout time.Duration) {
+	c.cont = true
+	c.step = true
+
+	if steps > 0 {
+		c.stepBudget = steps
+	} else {
+		c.stepBudget = -1
+	}
+
+	if timeout > 0 {
+		c.deadline = time.Now().Add(timeout)
+	} else {
+		c.deadline = time.Time{}
+	}
+
+	//Discard any interrupt received while waiting for input.
+	for len(c.interrupt) > 0 {
+		<-c.interrupt
+	}
+}
+
+//Returns true if SIGINT was received, used to stop scripts.
+func (c *interpreterControl) Interrupted() bool {
+	select {
+	case <-c.interrupt:
+		return true
+	default:
+		return false
+	}
+}
+
+//Consumes one step from the step budget.
+func (c *interpreterControl) CountStep() {
+	if c.stepBudget > 0 {
+		c.stepBudget--
+	}
+}
+
+//Returns an error if the current continue must be paused because a limit was reached.
+func (c *interpreterControl) CheckLimits() error {
+	if c.stepBudget == 0 {
+		return errors.New("Step limit reached")
+	}
+
+	if !c.deadline.IsZero() && time.Now().After(c.deadline) {
+		return errors.New("Timeout reached")
+	}
+
+	return nil
+}
+
+//Saves the state before instructions are executed, unless it was already saved since it was last printed.
+func (c *interpreterControl) SaveState(ci *co.ComputerInfo) {
+	if c.savedState == nil {
+		c.savedState = saveState(ci)
+	}
+}
+
+//Stops a continue, removing all temporary stopping conditions.
+func (c *interpreterControl) StopContinue() {
+	c.cont = false
+	c.hasTempBreakpoint = false
+	c.trackDepth = false
+}
+
 
 func (cfg *interpreterConfig) SetMemoryLimits(l, h uint16) {
 	cfg.memoryLimitL = l
@@ -0,0 +1,147 @@
+package cli
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Tinch334/Computer-one-v2/co"
+)
+
+func TestCallDepthTracking(t *testing.T) {
+	tests := []struct {
+		name string
+		target int
+		ins []uint16
+		//Instructions run when the depth is reached, 0 if it never is.
+		stop int
+	}{
+		//"next" over an instruction that isn't a call stops right after it.
+		{"next", 0, []uint16{co.ADD, co.ADD}, 1},
+		{"next over a call", 0, []uint16{co.JSR, co.ADD, co.JSR, co.RET, co.RET, co.ADD}, 5},
+		{"finish", -1, []uint16{co.ADD, co.JSR, co.RET, co.MOV, co.RET, co.ADD}, 5},
+		{"finish never returns", -1, []uint16{co.JSR, co.JMP, co.RET}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &interpreterControl{}
+			c.StartDepthTracking(tt.target)
+
+			stop := 0
+			for i, ins := range tt.ins {
+				c.TrackCallDepth(ins)
+
+				if c.DepthReached() {
+					stop = i + 1
+					break
+				}
+			}
+
+			if stop != tt.stop {
+				t.Errorf("stopped after %d instructions, want %d", stop, tt.stop)
+			}
+		})
+	}
+}
+
+func TestStopContinue(t *testing.T) {
+	c := &interpreterControl{}
+	c.SetTempBreakpoint(0x10)
+	c.StartDepthTracking(0)
+	c.TrackCallDepth(co.RET)
+
+	if !c.HasTempBreakpoint(0x10) || c.HasTempBreakpoint(0x11) || !c.DepthReached() {
+		t.Fatal("The temporary stopping conditions weren't set")
+	}
+
+	//Without tracking calls aren't counted, so the depth is never reached.
+	c.StopContinue()
+	c.TrackCallDepth(co.RET)
+
+	if c.HasTempBreakpoint(0x10) || c.DepthReached() {
+		t.Error("The temporary stopping conditions remain after the continue stopped")
+	}
+}
+
+func TestContinueLimits(t *testing.T) {
+	c := &interpreterControl{interrupt: make(chan os.Signal, 1)}
+
+	//Interrupts received before the continue started are discarded.
+	c.interrupt <- os.Interrupt
+	c.StartContinue(3, 0)
+
+	for i := 0; i < 3; i++ {
+		if err := c.CheckLimits(); err != nil {
+			t.Fatalf("paused after %d steps: %v", i, err)
+		}
+		c.CountStep()
+	}
+
+	if err := c.CheckLimits(); err == nil || err.Error() != "Step limit reached" {
+		t.Errorf("got %v after the step budget ran out", err)
+	}
+
+	if c.Interrupted() {
+		t.Error("The interrupt received before the continue wasn't discarded")
+	}
+
+	//Without a budget only timeouts pause, interrupts are handled by the runner.
+	c.StartContinue(0, 0)
+	for i := 0; i < 100; i++ {
+		c.CountStep()
+	}
+	if err := c.CheckLimits(); err != nil {
+		t.Errorf("got %v without limits", err)
+	}
+
+	c.StartContinue(0, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if err := c.CheckLimits(); err == nil || err.Error() != "Timeout reached" {
+		t.Errorf("got %v after the timeout", err)
+	}
+}
+
+func TestBreakpoints(t *testing.T) {
+	c := &interpreterControl{}
+	c.AddBreakpoint(0x10, ANY_CORE)
+	c.AddBreakpoint(0x20, 1)
+	c.AddBreakpoint(0x20, 2)
+	c.AddBreakpoint(0x10, ANY_CORE)
+
+	if n := len(c.GetBreakpoints()); n != 3 {
+		t.Errorf("%d breakpoints, want 3", n)
+	}
+
+	tests := []struct {
+		addr uint16
+		core int
+		want bool
+	}{
+		{0x10, 0, true},
+		{0x10, 3, true},
+		{0x20, 0, false},
+		{0x20, 1, true},
+		{0x20, 2, true},
+		{0x30, 1, false},
+	}
+
+	for _, tt := range tests {
+		if got := c.HasBreakpoint(tt.addr, tt.core); got != tt.want {
+			t.Errorf("HasBreakpoint(0x%X, %d) = %v, want %v", tt.addr, tt.core, got, tt.want)
+		}
+	}
+
+	//Deleting an address removes the breakpoints of every core.
+	if !c.DeleteBreakpoint(0x20) || c.DeleteBreakpoint(0x20) {
+		t.Error("DeleteBreakpoint didn't report the deleted breakpoints")
+	}
+	if c.HasBreakpoint(0x20, 1) || !c.HasBreakpoint(0x10, 1) {
+		t.Errorf("breakpoints %v after deleting 0x20", c.GetBreakpoints())
+	}
+
+	c.ClearBreakpoints()
+	if len(c.GetBreakpoints()) != 0 {
+		t.Errorf("breakpoints %v after clearing them", c.GetBreakpoints())
+	}
+}
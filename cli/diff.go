@@ -0,0 +1,123 @@
+package cli
+
+import (
+    "fmt"
+    "strings"
+
+    "github.com/Tinch334/Computer-one-v2/co"
+    "github.com/fatih/color"
+)
+
+//Maximum amount of written memory cells listed in a summary.
+const maxSummaryCells = 8
+
+//Copy of the registers, flags and memory, used to find what an execution changed.
+type machineState struct {
+    regs co.Registers
+    flags co.Flags
+    memory []uint16
+}
+
+func saveState(ci *co.ComputerInfo) *machineState {
+    _, mem := ci.GetMemory(0, co.MemorySize)
+
+    return &machineState{regs: ci.GetRegisters(), flags: ci.GetFlags(), memory: mem}
+}
+
+//Names of the general registers, in the order returned by "generalRegisters".
+var registerNames = []string{"R0", "R1", "R2", "R3", "R4", "R5", "R6", "R7"}
+
+func generalRegisters(r co.Registers) []uint16 {
+    return []uint16{r.R0, r.R1, r.R2, r.R3, r.R4, r.R5, r.R6, r.R7}
+}
+
+func flagString(f co.Flags) string {
+    return btoi(f.N) + btoi(f.P) + btoi(f.Z)
+}
+
+//Differences between a saved state and the current one. The PC is left out, since it changes with every instruction. All
+//methods accept a nil receiver, which means nothing changed.
+type stateChanges struct {
+    before *machineState
+    after *machineState
+
+    //Colour of changed values, nil if they aren't highlighted.
+    colour *color.Color
+}
+
+//Compares the saved state with the current one, returns nil if there is no saved state.
+func diffState(before *machineState, ci *co.ComputerInfo, cfg *interpreterConfig) *stateChanges {
+    if before == nil {
+        return nil
+    }
+
+    changes := &stateChanges{before: before, after: saveState(ci)}
+    if cfg.highlightChanges && cfg.useColour() {
+        changes.colour = cfg.changedColour.Color
+    }
+
+    return changes
+}
+
+func (c *stateChanges) register(n int) bool {
+    return c != nil && generalRegisters(c.before.regs)[n] != generalRegisters(c.after.regs)[n]
+}
+
+func (c *stateChanges) flag(n int) bool {
+    return c != nil && flagString(c.before.flags)[n] != flagString(c.after.flags)[n]
+}
+
+func (c *stateChanges) cell(addr uint16) bool {
+    return c != nil && int(addr) < len(c.before.memory) && c.before.memory[addr] != c.after.memory[addr]
+}
+
+//Returns the text in the changed colour if "changed" is set.
+func (c *stateChanges) highlight(changed bool, s string) string {
+    if !changed || c == nil || c.colour == nil {
+        return s
+    }
+
+    return c.colour.Sprint(s)
+}
+
+//Returns a single line listing all changes, like "R2: 0x0003 -> 0x000e, [0x0010] written".
+func (c *stateChanges) Summary() string {
+    if c == nil {
+        return "No changes"
+    }
+
+    parts := make([]string, 0)
+
+    before, after := generalRegisters(c.before.regs), generalRegisters(c.after.regs)
+    for i, name := range registerNames {
+        if before[i] != after[i] {
+            parts = append(parts, fmt.Sprintf("%s: 0x%04x -> 0x%04x", name, before[i], after[i]))
+        }
+    }
+
+    if c.before.flags != c.after.flags {
+        parts = append(parts, fmt.Sprintf("NPZ: %s -> %s", flagString(c.before.flags), flagString(c.after.flags)))
+    }
+
+    written := 0
+    for addr := range c.before.memory {
+        if !c.cell(uint16(addr)) {
+            continue
+        }
+
+        if written < maxSummaryCells {
+            parts = append(parts, fmt.Sprintf("[0x%04x] written", addr))
+        }
+        written++
+    }
+
+    if written > maxSummaryCells {
+        parts = append(parts, fmt.Sprintf("%d more cells written", written - maxSummaryCells))
+    }
+
+    if len(parts) == 0 {
+        return "No changes"
+    }
+
+    return strings.Join(parts, ", ")
+}
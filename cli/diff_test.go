@@ -0,0 +1,80 @@
+package cli
+
+import (
+    "testing"
+
+    "github.com/Tinch334/Computer-one-v2/co"
+)
+
+func TestStateChanges(t *testing.T) {
+    tests := []struct {
+        name string
+        change func(ci *co.ComputerInfo)
+        summary string
+    }{
+        {"nothing", func(ci *co.ComputerInfo) {}, "No changes"},
+        //The PC isn't a change.
+        {"PC", func(ci *co.ComputerInfo) { ci.SetRegisters(co.Registers{R2: 3, PC: 0x11}, co.Flags{P: true}) }, "No changes"},
+        {"register and flags", func(ci *co.ComputerInfo) { ci.SetRegisters(co.Registers{R2: 0xE}, co.Flags{Z: true}) },
+            "R2: 0x0003 -> 0x000e, NPZ: 010 -> 001"},
+        {"memory", func(ci *co.ComputerInfo) { ci.SetMemoryCell(0x20, 2); ci.SetMemoryCell(0x3FF, 1) }, "[0x0020] written, [0x03ff] written"},
+        {"many cells", func(ci *co.ComputerInfo) {
+            for i := uint16(0); i < 10; i++ {
+                ci.SetMemoryCell(0x100 + i, 1)
+            }
+        }, "[0x0100] written, [0x0101] written, [0x0102] written, [0x0103] written, [0x0104] written, [0x0105] written, " +
+            "[0x0106] written, [0x0107] written, 2 more cells written"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            ci := co.NewComputerInfo()
+            ci.SetRegisters(co.Registers{R2: 3, PC: 0x10}, co.Flags{P: true})
+            ci.SetMemoryCell(0x20, 1)
+
+            before := saveState(ci)
+            tt.change(ci)
+
+            if got := diffState(before, ci, &interpreterConfig{}).Summary(); got != tt.summary {
+                t.Errorf("summary %q, want %q", got, tt.summary)
+            }
+        })
+    }
+}
+
+func TestStateChangesQueries(t *testing.T) {
+    ci := co.NewComputerInfo()
+    before := saveState(ci)
+
+    ci.SetRegisters(co.Registers{R7: 1}, co.Flags{N: true})
+    ci.SetMemoryCell(0x30, 5)
+
+    c := diffState(before, ci, &interpreterConfig{})
+    if !c.register(7) || c.register(0) || !c.flag(0) || c.flag(1) || !c.cell(0x30) || c.cell(0x31) {
+        t.Errorf("wrong changes reported for %q", c.Summary())
+    }
+
+    //Without a saved state nothing changed.
+    var none *stateChanges
+    if none.register(7) || none.flag(0) || none.cell(0x30) || none.Summary() != "No changes" {
+        t.Error("A nil state reports changes")
+    }
+    if diffState(nil, ci, &interpreterConfig{}) != nil {
+        t.Error("Comparing without a saved state returned changes")
+    }
+
+    //Changed values are only coloured when highlighting is enabled.
+    colour := mustColour("red")
+
+    if got := c.highlight(true, "x"); got != "x" {
+        t.Errorf("highlighted %q without a colour", got)
+    }
+
+    c = diffState(before, ci, &interpreterConfig{highlightChanges: true, changedColour: colour, colourMode: COLOUR_ALWAYS})
+    if got := c.highlight(true, "x"); got != colour.Sprint("x") || got == "x" {
+        t.Errorf("highlighted %q", got)
+    }
+    if got := c.highlight(false, "x"); got != "x" {
+        t.Errorf("unchanged value highlighted as %q", got)
+    }
+}
@@ -0,0 +1,116 @@
+package cli
+
+import (
+    "fmt"
+    "os"
+    "strconv"
+
+    "github.com/Tinch334/Computer-one-v2/co"
+    "github.com/Tinch334/Computer-one-v2/device"
+    "github.com/Tinch334/Computer-one-v2/system"
+)
+
+//Attaches the image at the given address, sectors are transferred to and from the memory of the computer.
+func attachDisk(path string, base uint16, ci *co.ComputerInfo, ctrl *interpreterControl) error {
+    if ctrl.disk != nil {
+        return fmt.Errorf("%s is already attached, detach it first", ctrl.disk.Path())
+    }
+
+    err, disk := device.OpenDisk(path, base, system.VECTOR_DISK, ci)
+    if err != nil {
+        return err
+    }
+
+    if err := ci.Attach(disk); err != nil {
+        disk.Close()
+        return err
+    }
+
+    ctrl.disk = disk
+    return nil
+}
+
+func detachDisk(ci *co.ComputerInfo, ctrl *interpreterControl) error {
+    ci.Detach(ctrl.disk)
+
+    err := ctrl.disk.Close()
+    ctrl.disk = nil
+
+    return err
+}
+
+
+/*
+    COMMANDS
+*/
+func diskHandler(ci *co.ComputerInfo, ctrl *interpreterControl, args []string) {
+    if len(args) == 0 {
+        printErrorMsg(DISK)
+        return
+    }
+
+    switch args[0] {
+    case DISK_ATTACH:
+        if len(args) < 2 || len(args) > 3 {
+            printErrorMsg(DISK)
+            return
+        }
+
+        base := uint16(system.DISK)
+        if len(args) == 3 {
+            var err error
+            if err, base = convValidateMemoryAddr(args[2], ctrl.syms); err != nil {
+                fmt.Fprintf(os.Stderr, "%s\n", err)
+                return
+            }
+        }
+
+        if err := attachDisk(args[1], base, ci, ctrl); err != nil {
+            fmt.Fprintf(os.Stderr, "%s\n", err)
+            return
+        }
+
+        fmt.Printf("%s attached at 0x%04x, %d sectors of %d words", args[1], base, ctrl.disk.Sectors(), device.SectorWords)
+
+    case DISK_DETACH:
+        if len(args) != 1 {
+            printErrorMsg(DISK)
+            return
+        }
+
+        if ctrl.disk == nil {
+            fmt.Printf("No disk is attached")
+            return
+        }
+
+        path := ctrl.disk.Path()
+        if err := detachDisk(ci, ctrl); err != nil {
+            fmt.Fprintf(os.Stderr, "%s\n", err)
+            return
+        }
+
+        fmt.Printf("%s detached", path)
+
+    case DISK_CREATE:
+        if len(args) != 3 {
+            printErrorMsg(DISK)
+            return
+        }
+
+        sectors, err := strconv.Atoi(args[2])
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Invalid sector count: %q\n", args[2])
+            return
+        }
+
+        if err := device.CreateImage(args[1], sectors); err != nil {
+            fmt.Fprintf(os.Stderr, "%s\n", err)
+            return
+        }
+
+        fmt.Printf("Created %s, %d sectors of %d words", args[1], sectors, device.SectorWords)
+
+    default:
+        printErrorMsg(DISK)
+    }
+}
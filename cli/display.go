@@ -0,0 +1,277 @@
+package cli
+
+import (
+    "fmt"
+    "image"
+    "image/gif"
+    "image/png"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+
+    "github.com/Tinch334/Computer-one-v2/co"
+    "github.com/Tinch334/Computer-one-v2/device"
+    "github.com/Tinch334/Computer-one-v2/system"
+)
+
+//Size of a display pixel in screenshots and captures.
+const displayScale = 8
+
+//How often the display is redrawn while the program runs.
+const displayRefresh = 100 * time.Millisecond
+
+//Delay between the frames of a captured GIF, in hundredths of a second.
+const captureDelay = 5
+
+//Instructions between the frames of a capture, if none is given.
+const DefaultCaptureEvery = 1000
+
+//Attaches a display at the given address.
+func attachDisplay(base uint16, ci *co.ComputerInfo, ctrl *interpreterControl) error {
+    if ctrl.display != nil {
+        base, _ := ctrl.display.Registers()
+        return fmt.Errorf("A display is already attached at 0x%04x", base)
+    }
+
+    display := device.NewFramebuffer(base)
+    if err := ci.Attach(display); err != nil {
+        return err
+    }
+
+    ctrl.display = display
+    ctrl.displayShown = 0
+
+    return nil
+}
+
+//Prints the display if it changed since the last time.
+func printDisplay(ctrl *interpreterControl) {
+    if ctrl.display == nil {
+        return
+    }
+
+    pixels, version := ctrl.display.Snapshot()
+    if version == ctrl.displayShown {
+        return
+    }
+
+    ctrl.displayShown = version
+    fmt.Printf("%s\n\n", device.Render(&pixels))
+}
+
+//Redraws the display over the previous drawing while the program runs, "lines" is the height of the last drawing, zero
+//if nothing was drawn yet.
+func redrawDisplay(ctrl *interpreterControl, lines *int) {
+    if ctrl.display == nil || ctrl.machines == nil || ctrl.machines.headless {
+        return
+    }
+
+    pixels, version := ctrl.display.Snapshot()
+    if version == ctrl.displayShown {
+        return
+    }
+
+    if *lines > 0 {
+        fmt.Printf("\x1b[%dA\r", *lines)
+    }
+
+    frame := device.Render(&pixels)
+    fmt.Printf("%s\n", frame)
+
+    ctrl.displayShown = version
+    *lines = strings.Count(frame, "\n") + 1
+}
+
+//Writes the display to a PNG file.
+func saveScreenshot(path string, ctrl *interpreterControl) error {
+    if ctrl.display == nil {
+        return fmt.Errorf("No display is attached")
+    }
+
+    pixels, _ := ctrl.display.Snapshot()
+    return writePNG(path, device.Image(&pixels, displayScale))
+}
+
+
+/*
+    CAPTURE
+*/
+//Records the display every few instructions, frames are only kept when it changed. They are saved as an animated GIF
+//or as a sequence of PNG files in a directory.
+type recorder struct {
+    path string
+    every int
+
+    steps int
+    frames [][device.DisplayWords]uint16
+    last uint64
+}
+
+func newRecorder(path string, every int) *recorder {
+    if every <= 0 {
+        every = DefaultCaptureEvery
+    }
+
+    return &recorder{path: path, every: every}
+}
+
+//Counts an instruction, called from the goroutine that runs them.
+func (r *recorder) Tick(display *device.Framebuffer) {
+    r.steps++
+    if r.steps % r.every == 0 {
+        r.capture(display)
+    }
+}
+
+func (r *recorder) capture(display *device.Framebuffer) {
+    if display == nil {
+        return
+    }
+
+    pixels, version := display.Snapshot()
+    if len(r.frames) > 0 && version == r.last {
+        return
+    }
+
+    r.frames = append(r.frames, pixels)
+    r.last = version
+}
+
+//Captures the final state of the display and saves every frame, returns the amount saved.
+func (r *recorder) Save(display *device.Framebuffer) (error, int) {
+    r.capture(display)
+
+    if strings.EqualFold(filepath.Ext(r.path), ".gif") {
+        anim := &gif.GIF{}
+        for i := range r.frames {
+            anim.Image = append(anim.Image, device.Image(&r.frames[i], displayScale))
+            anim.Delay = append(anim.Delay, captureDelay)
+        }
+
+        f, err := os.Create(r.path)
+        if err != nil {
+            return err, 0
+        }
+
+        if err := gif.EncodeAll(f, anim); err != nil {
+            f.Close()
+            return err, 0
+        }
+
+        return f.Close(), len(r.frames)
+    }
+
+    if err := os.MkdirAll(r.path, 0755); err != nil {
+        return err, 0
+    }
+
+    for i := range r.frames {
+        if err := writePNG(filepath.Join(r.path, fmt.Sprintf("frame-%04d.png", i)), device.Image(&r.frames[i], displayScale)); err != nil {
+            return err, i
+        }
+    }
+
+    return nil, len(r.frames)
+}
+
+func writePNG(path string, img image.Image) error {
+    f, err := os.Create(path)
+    if err != nil {
+        return err
+    }
+
+    if err := png.Encode(f, img); err != nil {
+        f.Close()
+        return err
+    }
+
+    return f.Close()
+}
+
+
+/*
+    COMMANDS
+*/
+func displayHandler(ci *co.ComputerInfo, ctrl *interpreterControl, args []string) {
+    if len(args) == 0 {
+        printErrorMsg(DISPLAY)
+        return
+    }
+
+    //Every subcommand but attaching needs a display.
+    if args[0] != DISPLAY_ATTACH && ctrl.display == nil {
+        fmt.Printf("No display is attached")
+        return
+    }
+
+    switch args[0] {
+    case DISPLAY_ATTACH:
+        if len(args) > 2 {
+            printErrorMsg(DISPLAY)
+            return
+        }
+
+        base := uint16(system.DISPLAY)
+        if len(args) == 2 {
+            var err error
+            if err, base = convValidateMemoryAddr(args[1], ctrl.syms); err != nil {
+                fmt.Fprintf(os.Stderr, "%s\n", err)
+                return
+            }
+        }
+
+        if err := attachDisplay(base, ci, ctrl); err != nil {
+            fmt.Fprintf(os.Stderr, "%s\n", err)
+            return
+        }
+
+        fmt.Printf("Display attached at 0x%04x, %dx%d pixels in %d words", base, device.DISPLAY_WIDTH, device.DISPLAY_HEIGHT, device.DisplayWords)
+
+    case DISPLAY_DETACH:
+        if len(args) != 1 {
+            printErrorMsg(DISPLAY)
+            return
+        }
+
+        ci.Detach(ctrl.display)
+        ctrl.display = nil
+        fmt.Printf("Display detached")
+
+    case DISPLAY_SHOW:
+        if len(args) != 1 {
+            printErrorMsg(DISPLAY)
+            return
+        }
+
+        pixels, version := ctrl.display.Snapshot()
+        ctrl.displayShown = version
+        fmt.Printf("%s", device.Render(&pixels))
+
+    case DISPLAY_CLEAR:
+        if len(args) != 1 {
+            printErrorMsg(DISPLAY)
+            return
+        }
+
+        ctrl.display.Clear()
+        fmt.Printf("Display cleared")
+
+    default:
+        printErrorMsg(DISPLAY)
+    }
+}
+
+func screenshotHandler(ctrl *interpreterControl, args []string) {
+    if len(args) != 1 {
+        printErrorMsg(SCREENSHOT)
+        return
+    }
+
+    if err := saveScreenshot(args[0], ctrl); err != nil {
+        fmt.Fprintf(os.Stderr, "%s\n", err)
+        return
+    }
+
+    fmt.Printf("Display saved to %s", args[0])
+}
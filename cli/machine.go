@@ -0,0 +1,298 @@
+package cli
+
+import (
+    "context"
+    "fmt"
+    "maps"
+    "os"
+    "strings"
+
+    "github.com/Tinch334/Computer-one-v2/co"
+    "github.com/Tinch334/Computer-one-v2/symbols"
+)
+
+//Maximum amount of differing memory cells listed by "machine diff".
+const maxDiffCells = 16
+
+//Name of the machine the debugger starts with.
+const firstMachine = "main"
+
+//A named session, with its own computer, breakpoints, symbols, variables and configuration.
+type machine struct {
+    name string
+
+    ctrl *interpreterControl
+    cfg *interpreterConfig
+}
+
+//All machines of the debugger, commands always run on the current one.
+type machineList struct {
+    //The runners of all machines stop once it's done.
+    ctx context.Context
+
+    machines []*machine
+    current *machine
+
+    //Set when the current machine changes, so its state is printed.
+    switched bool
+
+    //Set in non-interactive sessions, consoles are connected to stdin and stdout.
+    headless bool
+}
+
+//Returns a control for a new machine with "ci" as its only core, the interrupt channel and the machine list are shared
+//by all machines.
+func newControl(ci *co.ComputerInfo, interrupt chan os.Signal, machines *machineList) *interpreterControl {
+    return &interpreterControl{
+        running: true,
+        cores: co.NewMulticore(ci),
+        interrupt: interrupt,
+        variables: make(map[string]int),
+        syms: symbols.NewTable(),
+        machines: machines,
+        step: false,
+        cont: false,
+    }
+}
+
+//Returns a copy of the configuration, aliases and macros are copied too.
+func (cfg *interpreterConfig) Clone() *interpreterConfig {
+    c := *cfg
+    c.aliases = maps.Clone(cfg.aliases)
+    c.macros = maps.Clone(cfg.macros)
+
+    return &c
+}
+
+//Returns a copy of the machine, execution state that only makes sense while a command runs is not copied.
+func (m *machine) Clone(name string) *machine {
+    ctrl := newControl(nil, m.ctrl.interrupt, m.ctrl.machines)
+    ctrl.cores = m.ctrl.cores.Clone()
+    ctrl.core = m.ctrl.core
+    ctrl.lastCore = m.ctrl.lastCore
+    ctrl.breakpoints = append([]breakpoint(nil), m.ctrl.breakpoints...)
+    ctrl.syms.Merge(m.ctrl.syms)
+    ctrl.program = m.ctrl.program
+    ctrl.system = m.ctrl.system
+    ctrl.variables = maps.Clone(m.ctrl.variables)
+
+    return &machine{name: name, ctrl: ctrl, cfg: m.cfg.Clone()}
+}
+
+func (l *machineList) Find(name string) *machine {
+    for _, m := range l.machines {
+        if m.name == name {
+            return m
+        }
+    }
+
+    return nil
+}
+
+//Adds a machine and makes it the current one, its runner is started.
+func (l *machineList) Add(m *machine) error {
+    if m.name == "" || strings.ContainsAny(m.name, " \t") {
+        return fmt.Errorf("Invalid machine name: %q", m.name)
+    }
+
+    if l.Find(m.name) != nil {
+        return fmt.Errorf("There already is a machine named %q", m.name)
+    }
+
+    m.ctrl.runner = newRunner(m.ctrl, m.cfg)
+    go m.ctrl.runner.Run(l.ctx)
+
+    l.machines = append(l.machines, m)
+    l.Switch(m)
+
+    return nil
+}
+
+func (l *machineList) Switch(m *machine) {
+    if l.current != m {
+        l.current = m
+        l.switched = true
+    }
+}
+
+//Returns the current core, the control and the configuration of the current machine.
+func (l *machineList) Current() (*co.ComputerInfo, *interpreterControl, *interpreterConfig) {
+    return l.current.ctrl.CurrentCore(), l.current.ctrl, l.current.cfg
+}
+
+//Returns the prompt, it includes the name of the current machine once there are several.
+func (l *machineList) Prompt() string {
+    if len(l.machines) > 1 {
+        return l.current.name + ">"
+    }
+
+    return ">"
+}
+
+
+/*
+    COMMANDS
+*/
+func machineHandler(ctrl *interpreterControl, args []string) {
+    machines := ctrl.machines
+
+    if len(args) == 0 {
+        printErrorMsg(MACHINE)
+        return
+    }
+
+    switch args[0] {
+    case MACHINE_NEW:
+        if len(args) != 2 && len(args) != 3 {
+            printErrorMsg(MACHINE)
+            return
+        }
+
+        //New machines start with the configuration of the current one.
+        m := &machine{
+            name: args[1],
+            ctrl: newControl(co.NewComputerInfo(), ctrl.interrupt, machines),
+            cfg: machines.current.cfg.Clone(),
+        }
+
+        if len(args) == 3 {
+            if err := loadProgram(args[2], m.ctrl.CurrentCore(), m.ctrl); err != nil {
+                fmt.Fprintf(os.Stderr, "%s\n", err)
+                return
+            }
+        }
+
+        if err := machines.Add(m); err != nil {
+            fmt.Fprintf(os.Stderr, "%s\n", err)
+            return
+        }
+
+        fmt.Printf("Created machine %q", m.name)
+
+    case MACHINE_CLONE:
+        if len(args) != 2 {
+            printErrorMsg(MACHINE)
+            return
+        }
+
+        //Clones start paused, with the state of the machine at this point.
+        if err := machines.Add(machines.current.Clone(args[1])); err != nil {
+            fmt.Fprintf(os.Stderr, "%s\n", err)
+            return
+        }
+
+        fmt.Printf("Cloned machine into %q", args[1])
+
+    case MACHINE_SWITCH:
+        if len(args) != 2 {
+            printErrorMsg(MACHINE)
+            return
+        }
+
+        m := machines.Find(args[1])
+        if m == nil {
+            fmt.Fprintf(os.Stderr, "Unknown machine: %q\n", args[1])
+            return
+        }
+
+        machines.Switch(m)
+        fmt.Printf("Switched to machine %q", m.name)
+
+    case MACHINE_LIST:
+        if len(args) != 1 {
+            printErrorMsg(MACHINE)
+            return
+        }
+
+        lines := make([]string, len(machines.machines))
+        for i, m := range machines.machines {
+            marker := " "
+            if m == machines.current {
+                marker = "*"
+            }
+
+            var pc uint16
+            m.ctrl.Locked(func() { pc = m.ctrl.CurrentCore().GetRegisters().PC })
+
+            lines[i] = fmt.Sprintf("%s %s | PC: %s", marker, m.name, addrWithSymbolStr(m.ctrl.syms)(pc))
+            if m.ctrl.runner.Running() {
+                lines[i] += " | Running"
+            }
+        }
+
+        fmt.Printf("%s", strings.Join(lines, "\n"))
+
+    case MACHINE_DIFF:
+        if len(args) != 2 && len(args) != 3 {
+            printErrorMsg(MACHINE)
+            return
+        }
+
+        //The current machine is compared if only one is given.
+        names := []string{args[1], machines.current.name}
+        if len(args) == 3 {
+            names[1] = args[2]
+        }
+
+        for _, name := range names {
+            if machines.Find(name) == nil {
+                fmt.Fprintf(os.Stderr, "Unknown machine: %q\n", name)
+                return
+            }
+        }
+
+        a, b := machines.Find(names[0]), machines.Find(names[1])
+
+        var stateA, stateB *machineState
+        a.ctrl.Locked(func() { stateA = saveState(a.ctrl.CurrentCore()) })
+        b.ctrl.Locked(func() { stateB = saveState(b.ctrl.CurrentCore()) })
+
+        fmt.Printf("%s", diffMachines(a.name, stateA, b.name, stateB))
+
+    default:
+        printErrorMsg(MACHINE)
+    }
+}
+
+//Returns the registers, flags and memory cells that differ between the states of two machines, one per line. The
+//registers and flags are the ones of their current cores.
+func diffMachines(nameA string, stateA *machineState, nameB string, stateB *machineState) string {
+    lines := []string{fmt.Sprintf("Comparing %q and %q:", nameA, nameB)}
+
+    if stateA.regs.PC != stateB.regs.PC {
+        lines = append(lines, fmt.Sprintf("PC: 0x%04x | 0x%04x", stateA.regs.PC, stateB.regs.PC))
+    }
+
+    regsA, regsB := generalRegisters(stateA.regs), generalRegisters(stateB.regs)
+    for i, name := range registerNames {
+        if regsA[i] != regsB[i] {
+            lines = append(lines, fmt.Sprintf("%s: 0x%04x | 0x%04x", name, regsA[i], regsB[i]))
+        }
+    }
+
+    if stateA.flags != stateB.flags {
+        lines = append(lines, fmt.Sprintf("NPZ: %s | %s", flagString(stateA.flags), flagString(stateB.flags)))
+    }
+
+    cells := 0
+    for addr := range stateA.memory {
+        if stateA.memory[addr] == stateB.memory[addr] {
+            continue
+        }
+
+        if cells < maxDiffCells {
+            lines = append(lines, fmt.Sprintf("[0x%04x]: 0x%04x | 0x%04x", addr, stateA.memory[addr], stateB.memory[addr]))
+        }
+        cells++
+    }
+
+    if cells > maxDiffCells {
+        lines = append(lines, fmt.Sprintf("%d more memory cells differ", cells - maxDiffCells))
+    }
+
+    if len(lines) == 1 {
+        return fmt.Sprintf("Machines %q and %q are identical", nameA, nameB)
+    }
+
+    return strings.Join(lines, "\n")
+}
@@ -0,0 +1,106 @@
+package cli
+
+import (
+    "context"
+    "testing"
+
+    "github.com/Tinch334/Computer-one-v2/co"
+    "github.com/Tinch334/Computer-one-v2/symbols"
+)
+
+func newTestMachine(name string, machines *machineList) *machine {
+    cfg := defaultConfig()
+    return &machine{name: name, ctrl: newControl(co.NewComputerInfo(), nil, machines), cfg: &cfg}
+}
+
+func TestMachineClone(t *testing.T) {
+    l := &machineList{}
+    m := newTestMachine(firstMachine, l)
+    m.ctrl.CurrentCore().SetMemoryCell(0x10, 5)
+    m.ctrl.AddBreakpoint(0x20, ANY_CORE)
+    m.ctrl.variables["i"] = 1
+    m.ctrl.syms.Add(symbols.Symbol{Name: "main", Addr: 0x10})
+    m.cfg.SetAlias("s1", "step")
+
+    c := m.Clone("copy")
+
+    //Changing the copy leaves the original as it was.
+    c.ctrl.CurrentCore().SetMemoryCell(0x10, 6)
+    c.ctrl.AddBreakpoint(0x30, ANY_CORE)
+    c.ctrl.variables["i"] = 2
+    c.ctrl.syms.Clear()
+    c.cfg.SetAlias("s1", "step 2")
+
+    if m.ctrl.CurrentCore().GetMemoryCell(0x10) != 5 || m.ctrl.HasBreakpoint(0x30, 0) || m.ctrl.variables["i"] != 1 || m.cfg.aliases["s1"] != "step" {
+        t.Error("Changing the copy changed the original")
+    }
+    if _, ok := m.ctrl.syms.Lookup("main"); !ok {
+        t.Error("Clearing the copy's symbols cleared the original's")
+    }
+    if !c.ctrl.HasBreakpoint(0x20, 0) {
+        t.Error("The breakpoints weren't copied")
+    }
+
+    //Every core is copied, and the copies share their own memory.
+    if err := m.ctrl.cores.SetCores(2); err != nil {
+        t.Fatal(err)
+    }
+
+    c = m.Clone("copy")
+    c.ctrl.cores.Core(1).SetMemoryCell(0x10, 7)
+
+    if c.ctrl.cores.Cores() != 2 || c.ctrl.cores.Core(0).GetMemoryCell(0x10) != 7 || m.ctrl.cores.Core(1).GetMemoryCell(0x10) != 5 {
+        t.Error("The cores weren't copied")
+    }
+}
+
+func TestMachineList(t *testing.T) {
+    //The runners of the added machines stop when the test ends.
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+
+    l := &machineList{ctx: ctx}
+    first := newTestMachine(firstMachine, l)
+
+    if err := l.Add(first); err != nil {
+        t.Fatal(err)
+    }
+    if l.Prompt() != ">" {
+        t.Errorf("prompt %q with a single machine", l.Prompt())
+    }
+
+    l.switched = false
+    if err := l.Add(first.Clone("b")); err != nil {
+        t.Fatal(err)
+    }
+    if !l.switched || l.current.name != "b" || l.Prompt() != "b>" {
+        t.Errorf("current machine %q, prompt %q after adding one", l.current.name, l.Prompt())
+    }
+
+    for _, name := range []string{"b", "", "a b"} {
+        if err := l.Add(first.Clone(name)); err == nil {
+            t.Errorf("machine %q was added", name)
+        }
+    }
+
+    if l.Find("main") != first || l.Find("c") != nil {
+        t.Error("Find returned the wrong machines")
+    }
+}
+
+func TestDiffMachines(t *testing.T) {
+    a := newTestMachine("a", nil)
+    b := a.Clone("b")
+
+    if got := diffMachines(a.name, saveState(a.ctrl.CurrentCore()), b.name, saveState(b.ctrl.CurrentCore())); got != `Machines "a" and "b" are identical` {
+        t.Errorf("identical machines: %q", got)
+    }
+
+    b.ctrl.CurrentCore().SetRegisters(co.Registers{PC: 2, R3: 1}, co.Flags{Z: true})
+    b.ctrl.CurrentCore().SetMemoryCell(0x3FF, 0xABCD)
+
+    want := "Comparing \"a\" and \"b\":\nPC: 0x0000 | 0x0002\nR3: 0x0000 | 0x0001\nNPZ: 000 | 001\n[0x03ff]: 0x0000 | 0xabcd"
+    if got := diffMachines(a.name, saveState(a.ctrl.CurrentCore()), b.name, saveState(b.ctrl.CurrentCore())); got != want {
+        t.Errorf("diff:\n%s\nwant:\n%s", got, want)
+    }
+}
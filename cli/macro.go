@@ -0,0 +1,310 @@
+package cli
+
+import (
+    "errors"
+    "fmt"
+    "os"
+    "regexp"
+    "slices"
+    "strconv"
+    "strings"
+
+    "github.com/Tinch334/Computer-one-v2/co"
+    "github.com/Tinch334/Computer-one-v2/expr"
+)
+
+//Positional parameters of aliases and macros, "$1" to "$9" are single arguments, "$*" all of them.
+var parameterRegex = regexp.MustCompile(`\$([1-9*])`)
+
+//Macro being defined at the prompt, lines are collected until its "end".
+type macroDefinition struct {
+    name string
+    lines []string
+
+    //Amount of blocks opened inside the macro.
+    depth int
+}
+
+//Returns the change in block nesting caused by a line, blocks are opened by "if", "while" and "define".
+func blockDepthChange(line string) int {
+    switch keyword, _ := splitKeyword(strings.TrimSpace(line)); keyword {
+    case IF, WHILE, DEFINE:
+        return 1
+    case END:
+        return -1
+    }
+
+    return 0
+}
+
+//Replaces the positional parameters in the text with the arguments.
+func substituteParameters(text string, name string, args []string) (error, string) {
+    var err error
+
+    text = parameterRegex.ReplaceAllStringFunc(text, func(p string) string {
+        if p == "$*" {
+            return strings.Join(args, " ")
+        }
+
+        n, _ := strconv.Atoi(p[1:])
+        if n > len(args) {
+            err = fmt.Errorf("Missing argument %s for %q", p, name)
+            return p
+        }
+
+        return args[n - 1]
+    })
+
+    return err, text
+}
+
+//Returns an error if the name can't be used for an alias or macro.
+func validateCommandName(name string) error {
+    if name == "" {
+        return errors.New("A name is required")
+    }
+
+    for i := 0; i < len(name); i++ {
+        if !expr.IsIdentChar(name[i], i == 0) || name[i] == '$' || name[i] == '.' {
+            return fmt.Errorf("Invalid name: %q", name)
+        }
+    }
+
+    if findCompletion(completions, name) != nil {
+        return fmt.Errorf("%q is a built-in command", name)
+    }
+
+    return nil
+}
+
+//Sets an alias, replacing any macro with the same name.
+func (cfg *interpreterConfig) SetAlias(name string, expansion string) error {
+    if err := validateCommandName(name); err != nil {
+        return err
+    }
+
+    delete(cfg.macros, name)
+    cfg.aliases[name] = expansion
+
+    return nil
+}
+
+//Sets a macro, replacing any alias with the same name. The body is checked to be a valid script.
+func (cfg *interpreterConfig) SetMacro(name string, lines []string) error {
+    if err := validateCommandName(name); err != nil {
+        return err
+    }
+
+    if err, _ := parseScript(name, strings.Join(lines, "\n")); err != nil {
+        return err
+    }
+
+    delete(cfg.aliases, name)
+    cfg.macros[name] = lines
+
+    return nil
+}
+
+//Returns the names of all aliases and macros, sorted.
+func (cfg *interpreterConfig) UserCommands() []string {
+    names := make([]string, 0, len(cfg.aliases) + len(cfg.macros))
+    for name := range cfg.aliases {
+        names = append(names, name)
+    }
+    for name := range cfg.macros {
+        names = append(names, name)
+    }
+
+    slices.Sort(names)
+    return names
+}
+
+//Writes a macro as a "define" block, the body is indented.
+func formatMacro(name string, lines []string) string {
+    var b strings.Builder
+
+    b.WriteString(DEFINE + " " + name + "\n")
+    for _, l := range lines {
+        b.WriteString("    " + strings.TrimSpace(l) + "\n")
+    }
+    b.WriteString(END)
+
+    return b.String()
+}
+
+
+/*
+    EXECUTION
+*/
+//Runs an alias or macro if there is one with the given name, returns false otherwise.
+func runUserCommand(command string, args []string, ci *co.ComputerInfo, ctrl *interpreterControl, cfg *interpreterConfig) bool {
+    expansion, isAlias := cfg.aliases[command]
+    lines, isMacro := cfg.macros[command]
+
+    if !isAlias && !isMacro {
+        return false
+    }
+
+    //Aliases may refer to other aliases and macros, so recursion must be limited.
+    if ctrl.scriptDepth >= maxScriptDepth {
+        fmt.Fprintf(os.Stderr, "%s: too many nested scripts\n", command)
+        return true
+    }
+
+    ctrl.scriptDepth++
+    defer func() { ctrl.scriptDepth-- }()
+
+    if isAlias {
+        //Arguments are appended if the expansion doesn't use them, like in a shell.
+        if !parameterRegex.MatchString(expansion) && len(args) > 0 {
+            expansion += " " + strings.Join(args, " ")
+        }
+
+        err, line := substituteParameters(expansion, command, args)
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "%s\n", err)
+            return true
+        }
+
+        runCommand(line, ci, ctrl, cfg)
+        return true
+    }
+
+    err, body := substituteParameters(strings.Join(lines, "\n"), command, args)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "%s\n", err)
+        return true
+    }
+
+    err, nodes := parseScript(command, body)
+    if err == nil {
+        err = runScriptNodes(command, nodes, ci, ctrl, cfg)
+    }
+
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "%s\n", err)
+    }
+
+    return true
+}
+
+//Adds a line to the macro being defined at the prompt, the macro is stored once its "end" is reached.
+func addDefinitionLine(line string, ctrl *interpreterControl, cfg *interpreterConfig) {
+    def := ctrl.definition
+    def.depth += blockDepthChange(line)
+
+    if def.depth >= 0 {
+        def.lines = append(def.lines, strings.TrimSpace(line))
+        return
+    }
+
+    ctrl.definition = nil
+
+    if err := cfg.SetMacro(def.name, def.lines); err != nil {
+        fmt.Fprintf(os.Stderr, "%s\n", err)
+        return
+    }
+
+    fmt.Printf("Macro %q defined", def.name)
+}
+
+
+/*
+    COMMANDS
+*/
+//Handles "alias" to list aliases, "alias <name>" to show one and "alias <name> <expansion>" to set one.
+func aliasHandler(line string, cfg *interpreterConfig) {
+    _, rest := splitKeyword(line)
+    name, expansion := splitKeyword(rest)
+
+    if name == "" {
+        if len(cfg.aliases) == 0 {
+            fmt.Printf("No aliases defined")
+            return
+        }
+
+        aliases := make([]string, 0, len(cfg.aliases))
+        for _, n := range cfg.UserCommands() {
+            if e, ok := cfg.aliases[n]; ok {
+                aliases = append(aliases, fmt.Sprintf("%s = %s", n, e))
+            }
+        }
+
+        fmt.Printf("%s", strings.Join(aliases, "\n"))
+        return
+    }
+
+    if expansion == "" {
+        e, ok := cfg.aliases[name]
+        if !ok {
+            fmt.Fprintf(os.Stderr, "Unknown alias: %q\n", name)
+            return
+        }
+
+        fmt.Printf("%s = %s", name, e)
+        return
+    }
+
+    if err := cfg.SetAlias(name, expansion); err != nil {
+        fmt.Fprintf(os.Stderr, "%s\n", err)
+    }
+}
+
+//Handles "define" to list macros and "define <name>" to start defining one.
+func defineHandler(ctrl *interpreterControl, cfg *interpreterConfig, args []string) {
+    switch len(args) {
+    case 0:
+        if len(cfg.macros) == 0 {
+            fmt.Printf("No macros defined")
+            return
+        }
+
+        macros := make([]string, 0, len(cfg.macros))
+        for _, n := range cfg.UserCommands() {
+            if lines, ok := cfg.macros[n]; ok {
+                macros = append(macros, formatMacro(n, lines))
+            }
+        }
+
+        fmt.Printf("%s", strings.Join(macros, "\n\n"))
+
+    case 1:
+        if err := validateCommandName(args[0]); err != nil {
+            fmt.Fprintf(os.Stderr, "%s\n", err)
+            return
+        }
+
+        ctrl.definition = &macroDefinition{name: args[0]}
+        fmt.Printf("Enter the commands of %q, followed by %q", args[0], END)
+
+    default:
+        printErrorMsg(DEFINE)
+    }
+}
+
+//Deletes an alias or macro, "unalias" and "undefine" only delete their kind.
+func deleteUserCommand(command string, cfg *interpreterConfig, args []string) {
+    if len(args) != 1 {
+        printErrorMsg(command)
+        return
+    }
+
+    name := args[0]
+
+    if command == UNDEFINE {
+        if _, ok := cfg.macros[name]; !ok {
+            fmt.Fprintf(os.Stderr, "Unknown macro: %q\n", name)
+            return
+        }
+
+        delete(cfg.macros, name)
+        return
+    }
+
+    if _, ok := cfg.aliases[name]; !ok {
+        fmt.Fprintf(os.Stderr, "Unknown alias: %q\n", name)
+        return
+    }
+
+    delete(cfg.aliases, name)
+}
@@ -0,0 +1,84 @@
+package cli
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestSubstituteParameters(t *testing.T) {
+    args := []string{"R1", "0x10", "x y"}
+
+    tests := []struct {
+        text string
+        want string
+        err string
+    }{
+        {"set $1 = $2", "set R1 = 0x10", ""},
+        {"print $*", "print R1 0x10 x y", ""},
+        {"$3$1", "x yR1", ""},
+        {"no parameters $ $0", "no parameters $ $0", ""},
+        {"step $4", "", "Missing argument $4 for \"m\""},
+    }
+
+    for _, tt := range tests {
+        err, got := substituteParameters(tt.text, "m", args)
+
+        if tt.err != "" {
+            if err == nil || err.Error() != tt.err {
+                t.Errorf("substituting %q: got error %v, want %q", tt.text, err, tt.err)
+            }
+            continue
+        }
+
+        if err != nil || got != tt.want {
+            t.Errorf("substituting %q gave %q, %v, want %q", tt.text, got, err, tt.want)
+        }
+    }
+}
+
+func TestBlockDepthChange(t *testing.T) {
+    tests := map[string]int{"if R1": 1, "  while 1": 1, "define m": 1, "end": -1, "step": 0, "endless": 0}
+
+    for line, want := range tests {
+        if got := blockDepthChange(line); got != want {
+            t.Errorf("blockDepthChange(%q) = %d, want %d", line, got, want)
+        }
+    }
+}
+
+func TestUserCommands(t *testing.T) {
+    cfg := defaultConfig()
+
+    if err := cfg.SetAlias("s2", "step 2"); err != nil {
+        t.Fatal(err)
+    }
+    if err := cfg.SetMacro("twice", []string{"$*", "$*"}); err != nil {
+        t.Fatal(err)
+    }
+
+    //A macro replaces an alias with the same name and the other way around.
+    if err := cfg.SetMacro("s2", []string{"step", "step"}); err != nil {
+        t.Fatal(err)
+    }
+    if _, ok := cfg.aliases["s2"]; ok {
+        t.Error("The alias remains after defining a macro with its name")
+    }
+
+    if got := strings.Join(cfg.UserCommands(), " "); got != "s2 twice" {
+        t.Errorf("user commands %q", got)
+    }
+
+    for _, name := range []string{"", "1st", "a.b", "a$", "step"} {
+        if err := cfg.SetAlias(name, "step"); err == nil {
+            t.Errorf("alias %q was accepted", name)
+        }
+    }
+
+    if err := cfg.SetMacro("broken", []string{"if 1"}); err == nil {
+        t.Error("A macro with an unterminated block was accepted")
+    }
+
+    if got := formatMacro("m", []string{"step", "  print R1"}); got != "define m\n    step\n    print R1\nend" {
+        t.Errorf("formatMacro gave %q", got)
+    }
+}
@@ -0,0 +1,148 @@
+package cli
+
+import (
+    "fmt"
+    "os"
+    "strings"
+
+    "github.com/Tinch334/Computer-one-v2/co"
+)
+
+//Returns the name of the mode the core is in.
+func modeName(ci *co.ComputerInfo) string {
+    if ci.Supervisor() {
+        return MODE_SUPERVISOR
+    }
+
+    return MODE_USER
+}
+
+//Parses permissions written as any combination of "r", "w" and "x", dashes are ignored so "r-x" is valid.
+func parsePermissions(s string) (error, co.Permission) {
+    var p co.Permission
+
+    for _, c := range strings.ToLower(s) {
+        switch c {
+        case 'r':
+            p |= co.PERM_READ
+        case 'w':
+            p |= co.PERM_WRITE
+        case 'x':
+            p |= co.PERM_EXECUTE
+        case '-':
+        default:
+            return fmt.Errorf("Invalid permissions: %q, expected a combination of r, w and x", s), 0
+        }
+    }
+
+    return nil, p
+}
+
+//Returns the lines of the region map, consecutive pages with the same permissions form a region. The region the PC is in
+//is marked.
+func regionMap(ci *co.ComputerInfo) []string {
+    lines := make([]string, 0)
+    pc := co.PageOf(ci.GetRegisters().PC)
+
+    for start := uint16(0); start < co.Pages; {
+        perm := ci.PagePermissions(start)
+
+        end := start
+        for end + 1 < co.Pages && ci.PagePermissions(end + 1) == perm {
+            end++
+        }
+
+        marker := " "
+        if pc >= start && pc <= end {
+            marker = "*"
+        }
+
+        lines = append(lines, fmt.Sprintf("%s 0x%04x-0x%04x | %s | Pages %d-%d", marker, start * co.PageSize,
+            (end + 1) * co.PageSize - 1, perm, start, end))
+        start = end + 1
+    }
+
+    return lines
+}
+
+
+/*
+    COMMANDS
+*/
+func mpuHandler(ci *co.ComputerInfo, ctrl *interpreterControl, args []string) {
+    if len(args) == 0 {
+        printErrorMsg(MPU)
+        return
+    }
+
+    switch args[0] {
+    case MPU_MAP:
+        if len(args) != 1 {
+            printErrorMsg(MPU)
+            return
+        }
+
+        fmt.Printf("Mode: %s\n%s", modeName(ci), strings.Join(regionMap(ci), "\n"))
+
+    case MPU_SET:
+        if len(args) != 4 {
+            printErrorMsg(MPU)
+            return
+        }
+
+        err, start := convValidateMemoryAddr(args[1], ctrl.syms)
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "%s\n", err)
+            return
+        }
+
+        err, end := convValidateMemoryAddr(args[2], ctrl.syms)
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "%s\n", err)
+            return
+        }
+
+        if start > end {
+            fmt.Fprintf(os.Stderr, "The start address must not be after the end address\n")
+            return
+        }
+
+        err, perm := parsePermissions(args[3])
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "%s\n", err)
+            return
+        }
+
+        //Every page the range touches is changed.
+        for page := co.PageOf(start); page <= co.PageOf(end); page++ {
+            ci.SetPagePermissions(page, perm)
+        }
+
+        fmt.Printf("Pages %d-%d set to %s", co.PageOf(start), co.PageOf(end), perm)
+
+    case MPU_MODE:
+        switch len(args) {
+        case 1:
+            fmt.Printf("Mode: %s", modeName(ci))
+
+        case 2:
+            switch args[1] {
+            case MODE_SUPERVISOR:
+                ci.SetSupervisor(true)
+            case MODE_USER:
+                ci.SetSupervisor(false)
+            default:
+                printErrorMsg(MPU)
+                return
+            }
+
+            fmt.Printf("Core %d is in %s mode", ctrl.core, modeName(ci))
+
+        default:
+            printErrorMsg(MPU)
+        }
+
+    default:
+        printErrorMsg(MPU)
+    }
+}
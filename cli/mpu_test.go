@@ -0,0 +1,51 @@
+package cli
+
+import (
+    "strings"
+    "testing"
+
+    "github.com/Tinch334/Computer-one-v2/co"
+)
+
+func TestParsePermissions(t *testing.T) {
+    tests := []struct {
+        s string
+        want co.Permission
+        ok bool
+    }{
+        {"rwx", co.PERM_ALL, true},
+        {"r-x", co.PERM_READ | co.PERM_EXECUTE, true},
+        {"W", co.PERM_WRITE, true},
+        {"xr", co.PERM_READ | co.PERM_EXECUTE, true},
+        {"---", 0, true},
+        {"", 0, true},
+        {"rwz", 0, false},
+        {"read", 0, false},
+    }
+
+    for _, tt := range tests {
+        err, got := parsePermissions(tt.s)
+        if (err == nil) != tt.ok || got != tt.want {
+            t.Errorf("parsePermissions(%q) = %v, %s, want ok %v and %s", tt.s, err, got, tt.ok, tt.want)
+        }
+    }
+}
+
+func TestRegionMap(t *testing.T) {
+    ci := co.NewComputerInfo()
+    ci.SetPagePermissions(2, co.PERM_READ)
+    ci.SetPagePermissions(3, co.PERM_READ)
+    ci.SetPagePermissions(co.Pages - 1, 0)
+    ci.SetRegisters(co.Registers{PC: 0xA0}, co.Flags{})
+
+    want := []string{
+        "  0x0000-0x007f | rwx | Pages 0-1",
+        "* 0x0080-0x00ff | r-- | Pages 2-3",
+        "  0x0100-0x03bf | rwx | Pages 4-14",
+        "  0x03c0-0x03ff | --- | Pages 15-15",
+    }
+
+    if got := regionMap(ci); strings.Join(got, "\n") != strings.Join(want, "\n") {
+        t.Errorf("region map:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+    }
+}
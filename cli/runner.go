@@ -0,0 +1,236 @@
+package cli
+
+import (
+    "fmt"
+    "os"
+    "slices"
+    "time"
+
+    "github.com/Tinch334/Computer-one-v2/co"
+)
+
+//Commands that start execution, they can't be used while the program runs in the background.
+var executionCommands = []string{
+    STEP, STEP_SHORT,
+    CONTINUE, CONTINUE_SHORT,
+    RUN, RUN_SHORT,
+    NEXT, NEXT_SHORT,
+    FINISH, FINISH_SHORT,
+    UNTIL, UNTIL_SHORT,
+    BACKGROUND, BACKGROUND_SHORT,
+}
+
+//Returns a runner for the cores of the machine, it stops execution as the control and configuration ask for.
+func newRunner(ctrl *interpreterControl, cfg *interpreterConfig) *co.Runner {
+    r := co.NewRunner(ctrl.cores)
+
+    r.Pick = func() (error, int) {
+        return nextCore(ctrl, cfg)
+    }
+
+    r.Before = func(core int) {
+        //Calls are only tracked in the current core.
+        if core == ctrl.core {
+            ctrl.TrackCallDepth(ctrl.cores.Core(core).GetCurrentInstruction())
+        }
+
+        ctrl.CountStep()
+        ctrl.lastCore = core
+
+        if ctrl.recorder != nil {
+            ctrl.recorder.Tick(ctrl.display)
+        }
+    }
+
+    //Breakpoints only stop a continue, "until" only applies to the current core.
+    r.Breakpoint = func(core int, pc uint16) bool {
+        return ctrl.cont && (ctrl.HasBreakpoint(pc, core) || (core == ctrl.core && ctrl.HasTempBreakpoint(pc)))
+    }
+
+    r.Check = func(core int) (bool, error) {
+        //Check if a "next" or "finish" is done.
+        if ctrl.DepthReached() {
+            return true, nil
+        }
+
+        if !ctrl.cont {
+            return false, nil
+        }
+
+        if err := ctrl.CheckLimits(); err != nil {
+            return true, err
+        }
+
+        return false, nil
+    }
+
+    return r
+}
+
+//Calls "fn" with the state of the machine locked if the program runs in the background, so commands can inspect it.
+//Calls may be nested, scripts lock each of their commands.
+func (c *interpreterControl) Locked(fn func()) {
+    if c.locked || !c.runner.Running() {
+        fn()
+        return
+    }
+
+    c.runner.Do(func(*co.Multicore) {
+        c.locked = true
+        defer func() { c.locked = false }()
+
+        fn()
+    })
+}
+
+//Starts the pending step or continue, returns once execution stops unless it runs in the background.
+func execute(ci *co.ComputerInfo, ctrl *interpreterControl, cfg *interpreterConfig) {
+    ctrl.step = false
+
+    background := ctrl.background
+    ctrl.background = false
+
+    if ctrl.runner.Running() {
+        fmt.Fprintf(os.Stderr, "The program is running, use %q to pause it\n", PAUSE)
+        return
+    }
+
+    ctrl.SaveState(ci)
+
+    if ctrl.cont {
+        ctrl.runner.Resume()
+    } else {
+        ctrl.runner.StepN(1)
+    }
+
+    if background {
+        fmt.Printf("Running in the background, use %q to pause\n", PAUSE)
+        return
+    }
+
+    waitForStop(ctrl, cfg)
+}
+
+//Handles events until execution stops, SIGINT pauses it. The display is redrawn in place as it changes.
+func waitForStop(ctrl *interpreterControl, cfg *interpreterConfig) {
+    refresh := time.NewTicker(displayRefresh)
+    defer refresh.Stop()
+
+    lines := 0
+
+    for {
+        select {
+        case e := <-ctrl.runner.Events():
+            redrawDisplay(ctrl, &lines)
+            handleEvent(e, ctrl, cfg)
+
+            if e.Stopped() {
+                return
+            }
+
+        case <-refresh.C:
+            redrawDisplay(ctrl, &lines)
+
+        case <-ctrl.interrupt:
+            ctrl.runner.Pause()
+        }
+    }
+}
+
+//Handles the events of a program running in the background, returns true if it stopped.
+func pollEvents(ctrl *interpreterControl, cfg *interpreterConfig) bool {
+    stopped := false
+
+    for {
+        select {
+        case e := <-ctrl.runner.Events():
+            handleEvent(e, ctrl, cfg)
+            stopped = stopped || e.Stopped()
+
+        default:
+            return stopped
+        }
+    }
+}
+
+//Reports an event, once execution stops the continue is over.
+func handleEvent(e co.Event, ctrl *interpreterControl, cfg *interpreterConfig) {
+    //What the program printed comes before what stopped it.
+    printProgramOutput(ctrl)
+
+    switch e.Kind {
+    case co.EVENT_CORE_HALTED:
+        fmt.Printf("Core %d halted\n", e.Core)
+        return
+
+    case co.EVENT_HALTED:
+        ctrl.running = false
+        fmt.Printf("Program halted\n")
+
+    case co.EVENT_FAULT:
+        if cfg.exitOnError {
+            ctrl.running = false
+        } else {
+            fmt.Printf("An error occurred during execution: %s\n", e.Err)
+        }
+
+    case co.EVENT_BREAKPOINT:
+        //Show the core that stopped.
+        if e.Core != ctrl.core {
+            ctrl.core = e.Core
+            ctrl.savedState = nil
+            fmt.Printf("Core %d stopped at a breakpoint\n", e.Core)
+        }
+
+    case co.EVENT_PAUSED:
+        if e.Err == co.ErrPaused {
+            fmt.Printf("Execution paused\n")
+        } else if e.Err != nil {
+            fmt.Printf("%s, execution paused\n", e.Err)
+        }
+    }
+
+    ctrl.executed = true
+    ctrl.StopContinue()
+}
+
+
+/*
+    COMMANDS
+*/
+//Returns true if the command can't be used now because the program runs in the background.
+func refuseWhileRunning(command string, ctrl *interpreterControl) bool {
+    if !ctrl.runner.Running() || !slices.Contains(executionCommands, command) {
+        return false
+    }
+
+    fmt.Fprintf(os.Stderr, "The program is running, use %q to pause it\n", PAUSE)
+    return true
+}
+
+//Continues execution in the background, the prompt can be used while the program runs.
+func backgroundHandler(ctrl *interpreterControl, cfg *interpreterConfig, args []string) {
+    if len(args) != 0 {
+        printErrorMsg(BACKGROUND)
+        return
+    }
+
+    ctrl.StartContinue(cfg.stepLimit, cfg.timeout)
+    ctrl.background = true
+}
+
+func pauseHandler(ctrl *interpreterControl, args []string) {
+    if len(args) != 0 {
+        printErrorMsg(PAUSE)
+        return
+    }
+
+    if !ctrl.runner.Running() {
+        fmt.Printf("The program isn't running")
+        return
+    }
+
+    //The runner can't stop while the command runs, the pause is waited for afterwards.
+    ctrl.runner.Pause()
+    ctrl.pausing = true
+}
@@ -0,0 +1,409 @@
+package cli
+
+import (
+    "errors"
+    "fmt"
+    "os"
+    "regexp"
+    "strconv"
+    "strings"
+
+    "github.com/Tinch334/Computer-one-v2/co"
+    "github.com/Tinch334/Computer-one-v2/expr"
+)
+
+//Maximum amount of nested "source" commands, avoids infinite recursion.
+const maxScriptDepth = 16
+
+//A parsed script line, "if" and "while" lines contain the lines of their block.
+type scriptNode struct {
+    line int
+    text string
+
+    //Set to "IF", "WHILE" or "DEFINE" for blocks, empty for commands. For "DEFINE" the condition is the macro's name.
+    kind string
+    cond string
+
+    body []scriptNode
+    elseBody []scriptNode
+
+    //Lines of a macro's body, they are kept as text since parameters are replaced before parsing.
+    source []string
+}
+
+var variableRegex = regexp.MustCompile(`\$[A-Za-z_][A-Za-z0-9_]*`)
+var echoExprRegex = regexp.MustCompile(`\{([^{}]*)\}`)
+
+
+/*
+    SCRIPT PARSING
+*/
+//Splits a line into its keyword and the rest of the line.
+func splitKeyword(line string) (string, string) {
+    fields := strings.SplitN(line, " ", 2)
+
+    if len(fields) == 1 {
+        return fields[0], ""
+    }
+    return fields[0], strings.TrimSpace(fields[1])
+}
+
+//Parses lines into nodes until the end of the input or a block terminator, the terminator found is returned.
+func parseScriptBlock(path string, lines []string, pos *int) (error, []scriptNode, string) {
+    nodes := make([]scriptNode, 0)
+
+    for *pos < len(lines) {
+        lineNum := *pos + 1
+        line := strings.TrimSpace(lines[*pos])
+        *pos++
+
+        if line == "" || strings.HasPrefix(line, COMMENT) {
+            continue
+        }
+
+        keyword, rest := splitKeyword(line)
+
+        switch keyword {
+        case ELSE, END:
+            return nil, nodes, keyword
+
+        case IF, WHILE:
+            if rest == "" {
+                return fmt.Errorf("%s:%d: %q requires a condition", path, lineNum, keyword), nil, ""
+            }
+
+            node := scriptNode{line: lineNum, text: line, kind: keyword, cond: rest}
+
+            err, body, term := parseScriptBlock(path, lines, pos)
+            if err != nil {
+                return err, nil, ""
+            }
+
+            node.body = body
+
+            if term == ELSE {
+                if keyword != IF {
+                    return fmt.Errorf("%s:%d: %q without a matching %q", path, lineNum, ELSE, IF), nil, ""
+                }
+
+                err, body, term = parseScriptBlock(path, lines, pos)
+                if err != nil {
+                    return err, nil, ""
+                }
+
+                node.elseBody = body
+            }
+
+            if term != END {
+                return fmt.Errorf("%s:%d: %q without a matching %q", path, lineNum, keyword, END), nil, ""
+            }
+
+            nodes = append(nodes, node)
+
+        case DEFINE:
+            if rest == "" {
+                return fmt.Errorf("%s:%d: %q requires a name", path, lineNum, keyword), nil, ""
+            }
+
+            start := *pos
+
+            //The body is parsed to find its end and check it.
+            err, _, term := parseScriptBlock(path, lines, pos)
+            if err != nil {
+                return err, nil, ""
+            }
+
+            if term != END {
+                return fmt.Errorf("%s:%d: %q without a matching %q", path, lineNum, keyword, END), nil, ""
+            }
+
+            source := make([]string, 0)
+            for _, l := range lines[start:*pos - 1] {
+                if l = strings.TrimSpace(l); l != "" && !strings.HasPrefix(l, COMMENT) {
+                    source = append(source, l)
+                }
+            }
+
+            nodes = append(nodes, scriptNode{line: lineNum, text: line, kind: keyword, cond: rest, source: source})
+
+        default:
+            nodes = append(nodes, scriptNode{line: lineNum, text: line})
+        }
+    }
+
+    return nil, nodes, ""
+}
+
+func parseScript(path string, contents string) (error, []scriptNode) {
+    lines := strings.Split(contents, "\n")
+    pos := 0
+
+    err, nodes, term := parseScriptBlock(path, lines, &pos)
+    if err != nil {
+        return err, nil
+    }
+
+    if term != "" {
+        return fmt.Errorf("%s:%d: %q without a matching block", path, pos, term), nil
+    }
+
+    return nil, nodes
+}
+
+
+/*
+    SCRIPT EXECUTION
+*/
+func runScriptFile(path string, ci *co.ComputerInfo, ctrl *interpreterControl, cfg *interpreterConfig) error {
+    if ctrl.scriptDepth >= maxScriptDepth {
+        return fmt.Errorf("%s: too many nested scripts", path)
+    }
+
+    contents, err := os.ReadFile(path)
+    if err != nil {
+        return err
+    }
+
+    err, nodes := parseScript(path, string(contents))
+    if err != nil {
+        return err
+    }
+
+    ctrl.scriptDepth++
+    defer func() { ctrl.scriptDepth-- }()
+
+    return runScriptNodes(path, nodes, ci, ctrl, cfg)
+}
+
+func runScriptNodes(path string, nodes []scriptNode, ci *co.ComputerInfo, ctrl *interpreterControl, cfg *interpreterConfig) error {
+    for _, n := range nodes {
+        //Commands run on the machine and core previous commands switched to, if any.
+        if ctrl.machines != nil {
+            ci, ctrl, cfg = ctrl.machines.Current()
+        }
+
+        if !ctrl.running {
+            return nil
+        }
+
+        if ctrl.Interrupted() {
+            return fmt.Errorf("%s:%d: script interrupted", path, n.line)
+        }
+
+        switch n.kind {
+        case IF:
+            err, cond := evalDebuggerExpr(n.cond, ci, ctrl)
+            if err != nil {
+                return fmt.Errorf("%s:%d: %s", path, n.line, err)
+            }
+
+            body := n.elseBody
+            if cond != 0 {
+                body = n.body
+            }
+
+            if err := runScriptNodes(path, body, ci, ctrl, cfg); err != nil {
+                return err
+            }
+
+        case WHILE:
+            for ctrl.running {
+                //A loop with an empty body never reaches the check above.
+                if ctrl.Interrupted() {
+                    return fmt.Errorf("%s:%d: script interrupted", path, n.line)
+                }
+
+                err, cond := evalDebuggerExpr(n.cond, ci, ctrl)
+                if err != nil {
+                    return fmt.Errorf("%s:%d: %s", path, n.line, err)
+                }
+
+                if cond == 0 {
+                    break
+                }
+
+                if err := runScriptNodes(path, n.body, ci, ctrl, cfg); err != nil {
+                    return err
+                }
+            }
+
+        case DEFINE:
+            if err := cfg.SetMacro(n.cond, n.source); err != nil {
+                return fmt.Errorf("%s:%d: %s", path, n.line, err)
+            }
+
+        default:
+            ctrl.Locked(func() { runCommand(n.text, ci, ctrl, cfg) })
+
+            //Command messages are not newline terminated, "set" and "echo" print nothing or a full line.
+            keyword, _ := splitKeyword(n.text)
+
+            if ctrl.step {
+                execute(ci, ctrl, cfg)
+            } else if keyword != SET && keyword != ECHO {
+                fmt.Printf("\n")
+            }
+        }
+    }
+
+    return nil
+}
+
+
+/*
+    COMMANDS
+*/
+func sourceHandler(ci *co.ComputerInfo, ctrl *interpreterControl, cfg *interpreterConfig, args []string) {
+    if len(args) != 1 {
+        printErrorMsg(SOURCE)
+        return
+    }
+
+    if err := runScriptFile(args[0], ci, ctrl, cfg); err != nil {
+        fmt.Fprintf(os.Stderr, "%s\n", err)
+    }
+}
+
+//Handles "set <name> = <expression>", the name may be written with or without the leading "$".
+func setHandler(line string, ci *co.ComputerInfo, ctrl *interpreterControl) {
+    _, rest := splitKeyword(line)
+
+    name, exprStr, found := strings.Cut(rest, "=")
+    name = strings.TrimPrefix(strings.TrimSpace(name), "$")
+
+    if !found || name == "" || strings.ContainsAny(name, " \t") {
+        printErrorMsg(SET)
+        return
+    }
+
+    for i := 0; i < len(name); i++ {
+        if !expr.IsIdentChar(name[i], i == 0) || name[i] == '$' || name[i] == '.' {
+            fmt.Fprintf(os.Stderr, "Invalid variable name: %q\n", name)
+            return
+        }
+    }
+
+    err, value := evalDebuggerExpr(exprStr, ci, ctrl)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "%s\n", err)
+        return
+    }
+
+    ctrl.variables[name] = value
+}
+
+//Prints the rest of the line, "{expr}" is replaced by the value of the expression, "{expr:x}" prints it in hex.
+func echoHandler(line string, ci *co.ComputerInfo, ctrl *interpreterControl) {
+    _, text := splitKeyword(line)
+
+    var evalErr error
+
+    text = echoExprRegex.ReplaceAllStringFunc(text, func(m string) string {
+        inner := m[1 : len(m) - 1]
+        hex := false
+
+        if before, found := strings.CutSuffix(inner, ":x"); found {
+            inner = before
+            hex = true
+        }
+
+        err, value := evalDebuggerExpr(inner, ci, ctrl)
+        if err != nil {
+            evalErr = err
+            return m
+        }
+
+        if hex {
+            return fmt.Sprintf("0x%04X", uint16(value))
+        }
+        return strconv.Itoa(value)
+    })
+
+    if evalErr != nil {
+        fmt.Fprintf(os.Stderr, "%s\n", evalErr)
+        return
+    }
+
+    err, expanded := expandVariables([]string{text}, ctrl)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "%s\n", err)
+        return
+    }
+
+    fmt.Printf("%s\n", expanded[0])
+}
+
+
+/*
+    EXPRESSIONS
+*/
+//Replaces every "$name" in the arguments with the value of the variable.
+func expandVariables(args []string, ctrl *interpreterControl) (error, []string) {
+    var err error
+
+    expanded := sliceMap(args, func(arg string) string {
+        return variableRegex.ReplaceAllStringFunc(arg, func(v string) string {
+            value, ok := ctrl.variables[v[1:]]
+            if !ok {
+                err = fmt.Errorf("Unknown variable: %q", v)
+                return v
+            }
+
+            return strconv.Itoa(value)
+        })
+    })
+
+    return err, expanded
+}
+
+//Returns the environment for debugger expressions, identifiers are "$" variables, symbols, registers and flags, in that
+//order, "[addr]" reads memory.
+func debuggerEnv(ci *co.ComputerInfo, ctrl *interpreterControl) expr.Env {
+    lookup := func(name string) (int, bool) {
+        if strings.HasPrefix(name, "$") {
+            v, ok := ctrl.variables[name[1:]]
+            return v, ok
+        }
+
+        //Symbols come first, so names a program uses, like "n", aren't hidden by registers or flags.
+        if s, ok := ctrl.syms.Lookup(name); ok {
+            return int(s.Addr), true
+        }
+
+        regs := ci.GetRegisters()
+        flags := ci.GetFlags()
+
+        //Flags evaluate to 1 when set and 0 otherwise.
+        flagValue := map[string]bool{"N": flags.N, "P": flags.P, "Z": flags.Z}
+        if f, ok := flagValue[strings.ToUpper(name)]; ok {
+            if f {
+                return 1, true
+            }
+            return 0, true
+        }
+
+        if err, reg := getRegisterByName(&regs, name); err == nil {
+            return int(*reg), true
+        }
+
+        return 0, false
+    }
+
+    deref := func(addr int) (int, bool) {
+        if addr < 0 || addr >= co.MemorySize {
+            return 0, false
+        }
+
+        return int(ci.GetMemoryCell(uint16(addr))), true
+    }
+
+    return expr.Env{Lookup: lookup, Deref: deref}
+}
+
+func evalDebuggerExpr(s string, ci *co.ComputerInfo, ctrl *interpreterControl) (error, int) {
+    if strings.TrimSpace(s) == "" {
+        return errors.New("Empty expression"), 0
+    }
+
+    return expr.Eval(s, debuggerEnv(ci, ctrl))
+}
@@ -0,0 +1,186 @@
+package cli
+
+import (
+    "fmt"
+    "os"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/Tinch334/Computer-one-v2/co"
+    "github.com/Tinch334/Computer-one-v2/symbols"
+)
+
+//Returns the nodes in one line, blocks are written as "kind cond {body} else {body}" and commands as "line:text".
+func outline(nodes []scriptNode) string {
+    parts := make([]string, 0)
+
+    for _, n := range nodes {
+        switch n.kind {
+        case "":
+            parts = append(parts, fmt.Sprintf("%d:%s", n.line, n.text))
+        default:
+            s := fmt.Sprintf("%s %s {%s}", n.kind, n.cond, outline(n.body))
+            if n.elseBody != nil {
+                s += fmt.Sprintf(" else {%s}", outline(n.elseBody))
+            }
+            parts = append(parts, s)
+        }
+    }
+
+    return strings.Join(parts, "; ")
+}
+
+func TestParseScript(t *testing.T) {
+    tests := []struct {
+        src string
+        want string
+    }{
+        {"", ""},
+        {"step\n\n  # A comment\n  continue  ", "1:step; 4:continue"},
+        {"if R1 == 2\n  step\nend\nstep", "if R1 == 2 {2:step}; 4:step"},
+        {"if Z\n  step\nelse\n  continue\nend", "if Z {2:step} else {4:continue}"},
+        {"while $i < 3\n  if $i\n    step\n  end\n  set i = $i + 1\nend", "while $i < 3 {if $i {3:step}; 5:set i = $i + 1}"},
+    }
+
+    for _, tt := range tests {
+        err, nodes := parseScript("test", tt.src)
+        if err != nil {
+            t.Errorf("parseScript(%q) failed: %v", tt.src, err)
+            continue
+        }
+
+        if got := outline(nodes); got != tt.want {
+            t.Errorf("parseScript(%q) = %q, want %q", tt.src, got, tt.want)
+        }
+    }
+}
+
+func TestParseScriptErrors(t *testing.T) {
+    tests := []struct {
+        src string
+        err string
+    }{
+        {"if\nend", "test:1: \"if\" requires a condition"},
+        {"step\nwhile 1\nstep", "test:2: \"while\" without a matching \"end\""},
+        {"while 1\nelse\nend", "test:1: \"else\" without a matching \"if\""},
+        {"step\nend", "test:2: \"end\" without a matching block"},
+        {"if 1\nelse\nelse\nend", "\"if\" without a matching \"end\""},
+        {"define\nend", "test:1: \"define\" requires a name"},
+        {"define m\n  step", "test:1: \"define\" without a matching \"end\""},
+    }
+
+    for _, tt := range tests {
+        err, _ := parseScript("test", tt.src)
+        if err == nil || !strings.Contains(err.Error(), tt.err) {
+            t.Errorf("parseScript(%q): got error %v, want one containing %q", tt.src, err, tt.err)
+        }
+    }
+}
+
+func TestParseDefine(t *testing.T) {
+    err, nodes := parseScript("test", "define m\n  step $1\n\n  # Comment\n  if 1\n    step\n  end\nend\nstep")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if got := outline(nodes); got != "define m {}; 9:step" {
+        t.Fatalf("parsed as %q", got)
+    }
+
+    //The body is kept as source, without empty lines and comments, to be parsed again when the macro runs.
+    want := []string{"step $1", "if 1", "step", "end"}
+    if strings.Join(nodes[0].source, "|") != strings.Join(want, "|") {
+        t.Errorf("source %q, want %q", nodes[0].source, want)
+    }
+}
+
+func TestExpandVariables(t *testing.T) {
+    ctrl := &interpreterControl{variables: map[string]int{"a": 5, "addr": 0x10, "neg": -1}}
+
+    err, got := expandVariables([]string{"$a", "R$a", "$addr+$a", "$neg", "plain", "$"}, ctrl)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    //The longest name is taken, so "$addr" isn't "$a" followed by "ddr".
+    want := []string{"5", "R5", "16+5", "-1", "plain", "$"}
+    if strings.Join(got, " ") != strings.Join(want, " ") {
+        t.Errorf("expanded to %q, want %q", got, want)
+    }
+
+    if err, _ := expandVariables([]string{"$a", "$b"}, ctrl); err == nil || err.Error() != "Unknown variable: \"$b\"" {
+        t.Errorf("got error %v for an unknown variable", err)
+    }
+}
+
+func TestEvalDebuggerExpr(t *testing.T) {
+    ci := co.NewComputerInfo()
+    ci.SetRegisters(co.Registers{PC: 0x20, R1: 3}, co.Flags{Z: true})
+    ci.SetMemoryCell(0x20, 7)
+
+    ctrl := &interpreterControl{variables: map[string]int{"i": 2}, syms: symbols.NewTable()}
+    ctrl.syms.Add(symbols.Symbol{Name: "main", Addr: 0x20})
+    //Symbols named like flags or registers hide them.
+    ctrl.syms.Add(symbols.Symbol{Name: "p", Addr: 0x30})
+    ctrl.syms.Add(symbols.Symbol{Name: "r2", Addr: 0x40})
+
+    tests := []struct {
+        src string
+        want int
+    }{
+        {"R1 + $i", 5},
+        {"r1 * 2", 6},
+        {"Z + n", 1},
+        {"[PC] + 1", 8},
+        {"main + 1", 0x21},
+        {"[main]", 7},
+        {"p", 0x30},
+        {"P", 0},
+        {"r2", 0x40},
+        {"R2", 0},
+    }
+
+    for _, tt := range tests {
+        err, got := evalDebuggerExpr(tt.src, ci, ctrl)
+        if err != nil || got != tt.want {
+            t.Errorf("evalDebuggerExpr(%q) = %v, %d, want %d", tt.src, err, got, tt.want)
+        }
+    }
+
+    for _, src := range []string{"", "  ", "$j", "R8", "[0x400]", "loop"} {
+        if err, _ := evalDebuggerExpr(src, ci, ctrl); err == nil {
+            t.Errorf("evalDebuggerExpr(%q) succeeded", src)
+        }
+    }
+}
+
+//An interrupt stops a loop with an empty body.
+func TestInterruptEmptyLoop(t *testing.T) {
+    err, nodes := parseScript("test", "while 1\nend")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    ci := co.NewComputerInfo()
+    ctrl := &interpreterControl{running: true, interrupt: make(chan os.Signal, 1), variables: map[string]int{}, syms: symbols.NewTable()}
+    cfg := defaultConfig()
+
+    done := make(chan error)
+    go func() {
+        done <- runScriptNodes("test", nodes, ci, ctrl, &cfg)
+    }()
+
+    //Sent once the loop runs, the check before the loop would take it otherwise.
+    time.Sleep(10 * time.Millisecond)
+    ctrl.interrupt <- os.Interrupt
+
+    select {
+    case err := <-done:
+        if err == nil || err.Error() != "test:1: script interrupted" {
+            t.Errorf("got error %v", err)
+        }
+    case <-time.After(5 * time.Second):
+        t.Fatal("The loop wasn't interrupted")
+    }
+}
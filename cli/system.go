@@ -0,0 +1,108 @@
+package cli
+
+import (
+    "fmt"
+    "os"
+
+    "github.com/Tinch334/Computer-one-v2/co"
+    "github.com/Tinch334/Computer-one-v2/link"
+    "github.com/Tinch334/Computer-one-v2/system"
+)
+
+//Prints the disassembly of the segments of an image, the trap vector table is listed as the addresses it holds.
+func printImage(ci *co.ComputerInfo, ctrl *interpreterControl, cfg *interpreterConfig, img *link.Image) {
+    first := true
+    separate := func() {
+        if !first {
+            fmt.Printf("\n\n")
+        }
+        first = false
+    }
+
+    for _, seg := range img.Segments {
+        start, end := seg.Addr, seg.Addr + uint16(len(seg.Words))
+
+        if start < co.TrapTable + co.TrapVectors && end > co.TrapTable {
+            separate()
+            fmt.Printf("Trap vectors:")
+
+            //Consecutive vectors with the same routine are shown as a range.
+            last := min(end, co.TrapTable + co.TrapVectors)
+            for v := max(start, co.TrapTable); v < last; {
+                target := ci.GetMemoryCell(v)
+
+                to := v
+                for to + 1 < last && ci.GetMemoryCell(to + 1) == target {
+                    to++
+                }
+
+                vectors := fmt.Sprintf("0x%02x", v - co.TrapTable)
+                if to != v {
+                    vectors += fmt.Sprintf("-0x%02x", to - co.TrapTable)
+                }
+
+                fmt.Printf("\n%s -> %s", vectors, addrWithSymbolStr(ctrl.syms)(target))
+                v = to + 1
+            }
+
+            start = max(start, co.TrapTable + co.TrapVectors)
+        }
+
+        if start < end {
+            separate()
+            printMemoryView(ci, ctrl.syms, cfg, start, end, VIEW_DISASSEMBLY, nil)
+        }
+    }
+}
+
+
+/*
+    COMMANDS
+*/
+func systemHandler(ci *co.ComputerInfo, ctrl *interpreterControl, cfg *interpreterConfig, args []string) {
+    if len(args) == 0 {
+        printErrorMsg(SYSTEM)
+        return
+    }
+
+    switch args[0] {
+    case SYSTEM_LOAD:
+        if len(args) > 2 {
+            printErrorMsg(SYSTEM)
+            return
+        }
+
+        path := ""
+        if len(args) == 2 {
+            path = args[1]
+        }
+
+        if err := loadSystem(path, ci, ctrl); err != nil {
+            fmt.Fprintf(os.Stderr, "%s\n", err)
+            return
+        }
+
+        fmt.Printf("System loaded, programs are placed from 0x%04x", system.End)
+
+    case SYSTEM_USER, SYSTEM_OS:
+        if len(args) != 1 {
+            printErrorMsg(SYSTEM)
+            return
+        }
+
+        img, what := ctrl.program, "program"
+        if args[0] == SYSTEM_OS {
+            img, what = ctrl.system, "system"
+        }
+
+        if img == nil {
+            fmt.Printf("No %s is loaded", what)
+            return
+        }
+
+        printImage(ci, ctrl, cfg, img)
+
+    default:
+        printErrorMsg(SYSTEM)
+    }
+}
@@ -0,0 +1,189 @@
+package cli
+
+import (
+    "fmt"
+    "os"
+    "strings"
+    "time"
+
+    "github.com/Tinch334/Computer-one-v2/co"
+    "github.com/Tinch334/Computer-one-v2/device"
+    "github.com/Tinch334/Computer-one-v2/system"
+)
+
+//Parses the optional address of an attach command, "def" if it's missing.
+func parseDeviceAddr(args []string, def uint16, ctrl *interpreterControl) (error, uint16) {
+    if len(args) == 0 {
+        return nil, def
+    }
+
+    return convValidateMemoryAddr(args[0], ctrl.syms)
+}
+
+
+/*
+    COMMANDS
+*/
+func timerHandler(ci *co.ComputerInfo, ctrl *interpreterControl, args []string) {
+    if len(args) == 0 {
+        printErrorMsg(TIMER)
+        return
+    }
+
+    //Every subcommand but attaching needs a timer.
+    if args[0] != TIMER_ATTACH && ctrl.timer == nil {
+        fmt.Printf("No timer is attached")
+        return
+    }
+
+    switch args[0] {
+    case TIMER_ATTACH:
+        if len(args) > 2 {
+            printErrorMsg(TIMER)
+            return
+        }
+
+        if ctrl.timer != nil {
+            base, _ := ctrl.timer.Registers()
+            fmt.Fprintf(os.Stderr, "A timer is already attached at 0x%04x\n", base)
+            return
+        }
+
+        err, base := parseDeviceAddr(args[1:], system.TIMER, ctrl)
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "%s\n", err)
+            return
+        }
+
+        timer := device.NewTimer(base, system.VECTOR_TIMER)
+        if err := ci.Attach(timer); err != nil {
+            fmt.Fprintf(os.Stderr, "%s\n", err)
+            return
+        }
+
+        ctrl.timer = timer
+        fmt.Printf("Timer attached at 0x%04x", base)
+
+    case TIMER_DETACH:
+        if len(args) != 1 {
+            printErrorMsg(TIMER)
+            return
+        }
+
+        ci.Detach(ctrl.timer)
+        ctrl.timer = nil
+        fmt.Printf("Timer detached")
+
+    case TIMER_SHOW:
+        if len(args) != 1 {
+            printErrorMsg(TIMER)
+            return
+        }
+
+        control := ctrl.timer.Peek(device.TIMER_CONTROL)
+
+        var state []string
+        for _, f := range []struct{bit uint16; name string}{
+            {device.TIMER_ENABLE, "enabled"},
+            {device.TIMER_PERIODIC, "periodic"},
+            {device.STATUS_INTERRUPT, "interrupts"},
+            {device.TIMER_EXPIRED, "expired"},
+        } {
+            if control & f.bit != 0 {
+                state = append(state, f.name)
+            }
+        }
+        if len(state) == 0 {
+            state = append(state, "stopped")
+        }
+
+        fmt.Printf("Timer: %s | Count: %d | Reload: %d", strings.Join(state, ", "), ctrl.timer.Peek(device.TIMER_COUNT), ctrl.timer.Peek(device.TIMER_RELOAD))
+
+    default:
+        printErrorMsg(TIMER)
+    }
+}
+
+func clockHandler(ci *co.ComputerInfo, ctrl *interpreterControl, args []string) {
+    if len(args) == 0 {
+        printErrorMsg(CLOCK)
+        return
+    }
+
+    //Every subcommand but attaching needs a clock.
+    if args[0] != CLOCK_ATTACH && ctrl.clock == nil {
+        fmt.Printf("No clock is attached")
+        return
+    }
+
+    switch args[0] {
+    case CLOCK_ATTACH:
+        if len(args) > 3 {
+            printErrorMsg(CLOCK)
+            return
+        }
+
+        if ctrl.clock != nil {
+            base, _ := ctrl.clock.Registers()
+            fmt.Fprintf(os.Stderr, "A clock is already attached at 0x%04x\n", base)
+            return
+        }
+
+        //Virtual time by default, so runs are reproducible.
+        host := false
+        rest := args[1:]
+        if len(rest) > 0 && (rest[0] == CLOCK_HOST || rest[0] == CLOCK_VIRTUAL) {
+            host = rest[0] == CLOCK_HOST
+            rest = rest[1:]
+        }
+
+        if len(rest) > 1 {
+            printErrorMsg(CLOCK)
+            return
+        }
+
+        err, base := parseDeviceAddr(rest, system.CLOCK, ctrl)
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "%s\n", err)
+            return
+        }
+
+        clock := device.NewClock(base, host)
+        if err := ci.Attach(clock); err != nil {
+            fmt.Fprintf(os.Stderr, "%s\n", err)
+            return
+        }
+
+        ctrl.clock = clock
+        fmt.Printf("Clock attached at 0x%04x, showing %s time", base, clockMode(clock))
+
+    case CLOCK_DETACH:
+        if len(args) != 1 {
+            printErrorMsg(CLOCK)
+            return
+        }
+
+        ci.Detach(ctrl.clock)
+        ctrl.clock = nil
+        fmt.Printf("Clock detached")
+
+    case CLOCK_SHOW:
+        if len(args) != 1 {
+            printErrorMsg(CLOCK)
+            return
+        }
+
+        fmt.Printf("Clock: %s (%s time)", ctrl.clock.Now().Format(time.DateTime + ".000"), clockMode(ctrl.clock))
+
+    default:
+        printErrorMsg(CLOCK)
+    }
+}
+
+func clockMode(c *device.Clock) string {
+    if c.Host() {
+        return CLOCK_HOST
+    }
+
+    return CLOCK_VIRTUAL
+}
@@ -0,0 +1,161 @@
+package cli
+
+import (
+    "fmt"
+    "os"
+    "slices"
+    "strings"
+
+    "github.com/Tinch334/Computer-one-v2/asm"
+    "github.com/Tinch334/Computer-one-v2/co"
+    "github.com/Tinch334/Computer-one-v2/symbols"
+)
+
+var memoryViews = []string{VIEW_HEX, VIEW_UNSIGNED, VIEW_SIGNED, VIEW_BINARY, VIEW_ASCII, VIEW_DISASSEMBLY}
+
+func validMemoryView(view string) bool {
+    return slices.Contains(memoryViews, view)
+}
+
+//Formats a memory cell, all cells of a view have the same width.
+func formatCell(value uint16, view string) string {
+    switch view {
+    case VIEW_UNSIGNED:
+        return fmt.Sprintf("%5d", value)
+    case VIEW_SIGNED:
+        return fmt.Sprintf("%6d", int16(value))
+    case VIEW_BINARY:
+        return fmt.Sprintf("%016b", value)
+    case VIEW_ASCII:
+        //Both bytes are shown, strings with one character per word have a zero high byte, which is shown as a space.
+        return asciiByte(byte(value >> 8)) + asciiByte(byte(value))
+    }
+
+    return fmt.Sprintf("0x%04x", value)
+}
+
+func asciiByte(b byte) string {
+    switch {
+    case b == 0:
+        return " "
+    case b >= 0x20 && b < 0x7F:
+        return string(rune(b))
+    }
+
+    return "."
+}
+
+//Returns the window of memory that is printed, in follow PC mode it's moved to keep the PC in the middle.
+func memoryWindow(pc uint16, cfg *interpreterConfig) (uint16, uint16) {
+    start, end := cfg.memoryLimitL, cfg.memoryLimitH
+    if !cfg.followPC {
+        return start, end
+    }
+
+    size := int(end - start)
+    columns := cfg.memoryColumns
+
+    //Keep rows aligned to the amount of columns.
+    s := int(pc) - size / 2
+    s -= s % columns
+    s = max(0, min(s, co.MemorySize - size))
+
+    return uint16(s), uint16(s + size)
+}
+
+//Prints the memory cells in [start, end) in the given view, without a newline after the last row, cells in "changes"
+//are highlighted, it may be nil. Rows are annotated with the symbol nearest to their first cell, note that "tabwriter"
+//cannot be used because ANSI escape codes are used for colour, and they get counted by the package.
+func printMemoryView(ci *co.ComputerInfo, syms *symbols.Table, cfg *interpreterConfig, start uint16, end uint16, view string,
+    changes *stateChanges) {
+    pc := ci.GetRegisters().PC
+
+    //Get appropriate memory cells to print.
+    err, mem := ci.GetMemory(start, end)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "%s\n", err)
+        return
+    }
+
+    //Each row is a run of cells, in disassembly there is one instruction per row.
+    type row struct {
+        addr uint16
+        size int
+        text string
+    }
+
+    rows := make([]row, 0)
+
+    if view == VIEW_DISASSEMBLY {
+        for i := 0; i < len(mem); {
+            addr := start + uint16(i)
+            next := ci.GetMemoryCell(addr + 1)
+            size := min(int(co.InstructionSize(mem[i])), len(mem) - i)
+
+            rows = append(rows, row{addr: addr, size: size, text: asm.Disassemble(mem[i], next, syms.Describe)})
+            i += size
+        }
+    } else {
+        for i := 0; i < len(mem); i += cfg.memoryColumns {
+            rows = append(rows, row{addr: start + uint16(i), size: min(cfg.memoryColumns, len(mem) - i)})
+        }
+    }
+
+    //Symbol annotations, padded to the same width to keep the rows aligned.
+    labels := make([]string, len(rows))
+    labelWidth := 0
+
+    for i, r := range rows {
+        if desc := syms.Describe(r.addr); desc != "" {
+            labels[i] = "<" + desc + ">"
+        }
+
+        labelWidth = max(labelWidth, len(labels[i]))
+    }
+
+    for i, r := range rows {
+        if i != 0 {
+            fmt.Printf("\n")
+        }
+
+        fmt.Printf("0x%04x ", r.addr)
+
+        if labelWidth > 0 {
+            fmt.Printf("%-*s ", labelWidth, labels[i])
+        }
+
+        fmt.Printf(": ")
+
+        cells := make([]string, r.size)
+        for j := range cells {
+            addr := r.addr + uint16(j)
+            cellView := view
+
+            //Disassembly also shows the words of each instruction.
+            if view == VIEW_DISASSEMBLY {
+                cellView = VIEW_HEX
+            }
+
+            cell := formatCell(mem[int(addr - start)], cellView)
+
+            //The PC takes precedence over changed cells.
+            if addr == pc && cfg.highlightPC {
+                if cfg.useColour() {
+                    cell = cfg.highlightPCColour.Sprint(cell)
+                }
+            } else {
+                cell = changes.highlight(changes.cell(addr), cell)
+            }
+
+            cells[j] = cell
+        }
+
+        if view == VIEW_DISASSEMBLY {
+            //Pad single word instructions so the text lines up.
+            fmt.Printf("%s%s  %s", strings.Join(cells, " "), strings.Repeat(" ", 7 * (2 - r.size)), r.text)
+            continue
+        }
+
+        fmt.Printf("%s", strings.Join(cells, "  "))
+    }
+}
@@ -0,0 +1,54 @@
+package cli
+
+import (
+    "testing"
+)
+
+func TestMemoryWindow(t *testing.T) {
+    tests := []struct {
+        name string
+        pc uint16
+        followPC bool
+        start, end uint16
+    }{
+        {"fixed", 0x200, false, 0x10, 0x30},
+        //The PC is kept in the middle, with rows aligned to the columns.
+        {"follow", 0x100, true, 0xF0, 0x110},
+        {"follow unaligned", 0x105, true, 0xF0, 0x110},
+        //The window doesn't move past either end of memory.
+        {"start of memory", 0x4, true, 0, 0x20},
+        {"end of memory", 0x3FE, true, 0x3E0, 0x400},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg := &interpreterConfig{memoryLimitL: 0x10, memoryLimitH: 0x30, memoryColumns: 8, followPC: tt.followPC}
+
+            start, end := memoryWindow(tt.pc, cfg)
+            if start != tt.start || end != tt.end {
+                t.Errorf("window [0x%X, 0x%X), want [0x%X, 0x%X)", start, end, tt.start, tt.end)
+            }
+        })
+    }
+}
+
+func TestFormatCell(t *testing.T) {
+    tests := []struct {
+        value uint16
+        view string
+        want string
+    }{
+        {0x1F, VIEW_HEX, "0x001f"},
+        {0xFFFF, VIEW_UNSIGNED, "65535"},
+        {0xFFFF, VIEW_SIGNED, "    -1"},
+        {5, VIEW_BINARY, "0000000000000101"},
+        {'h', VIEW_ASCII, " h"},
+        {0x4101, VIEW_ASCII, "A."},
+    }
+
+    for _, tt := range tests {
+        if got := formatCell(tt.value, tt.view); got != tt.want {
+            t.Errorf("formatCell(0x%X, %s) = %q, want %q", tt.value, tt.view, got, tt.want)
+        }
+    }
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Tinch334/Computer-one-v2/asm"
+)
+
+
+//Assembles a source file into a relocatable object, to be linked with "colink".
+func main() {
+	out := flag.String("o", "", "Output object file, defaults to the source name with a \".o\" extension")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] <file.asm>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	src := flag.Arg(0)
+	if *out == "" {
+		*out = strings.TrimSuffix(src, filepath.Ext(src)) + ".o"
+	}
+
+	err, o := asm.AssembleObjectFile(src)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+
+	if err := o.WriteFile(*out); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+}
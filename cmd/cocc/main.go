@@ -0,0 +1,144 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Tinch334/Computer-one-v2/asm"
+	"github.com/Tinch334/Computer-one-v2/compiler"
+	"github.com/Tinch334/Computer-one-v2/link"
+	"github.com/Tinch334/Computer-one-v2/obj"
+)
+
+
+//Compiles source files and links them, together with assembly files and objects, into a flat image. The symbol map and
+//source map are written next to it.
+func main() {
+	asmOnly := flag.Bool("S", false, "Only compile, writing the generated assembly")
+	objOnly := flag.Bool("c", false, "Only compile or assemble, writing objects")
+	out := flag.String("o", "", "Output file, only allowed with a single input when used with -S or -c")
+	layoutPath := flag.String("layout", "", "Layout file describing where sections are placed")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] <file%s|file.asm|file.o>...\n", os.Args[0], compiler.SourceExt)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 || (*asmOnly && *objOnly) {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if (*asmOnly || *objOnly) && *out != "" && flag.NArg() > 1 {
+		fail(fmt.Errorf("-o can't be used with several inputs when only compiling"))
+	}
+
+	objs := make([]*obj.Object, 0, flag.NArg())
+
+	for _, path := range flag.Args() {
+		ext := strings.ToLower(filepath.Ext(path))
+		base := strings.TrimSuffix(path, filepath.Ext(path))
+
+		if *asmOnly {
+			if ext != compiler.SourceExt {
+				fail(fmt.Errorf("%s: only %s files can be compiled to assembly", path, compiler.SourceExt))
+			}
+
+			src, err := os.ReadFile(path)
+			if err != nil {
+				fail(err)
+			}
+
+			err, text := compiler.CompileString(path, string(src))
+			if err != nil {
+				fail(err)
+			}
+
+			if err := os.WriteFile(outputPath(*out, base + ".s"), []byte(text), 0644); err != nil {
+				fail(err)
+			}
+			continue
+		}
+
+		var err error
+		var o *obj.Object
+
+		switch ext {
+		case compiler.SourceExt:
+			err, o = compiler.CompileObjectFile(path)
+		case ".asm", ".s":
+			err, o = asm.AssembleObjectFile(path)
+		default:
+			err, o = obj.ReadFile(path)
+		}
+
+		if err != nil {
+			fail(err)
+		}
+
+		if *objOnly {
+			if ext != ".o" {
+				if err := o.WriteFile(outputPath(*out, base + ".o")); err != nil {
+					fail(err)
+				}
+			}
+			continue
+		}
+
+		objs = append(objs, o)
+	}
+
+	if *asmOnly || *objOnly {
+		return
+	}
+
+	linkImage(objs, outputPath(*out, "a.bin"), *layoutPath)
+}
+
+func outputPath(out string, def string) string {
+	if out != "" {
+		return out
+	}
+	return def
+}
+
+//Links the objects, writing the image, its symbol map and its source map.
+func linkImage(objs []*obj.Object, out string, layoutPath string) {
+	var layout *link.Layout
+	if layoutPath != "" {
+		var err error
+		err, layout = link.ReadLayoutFile(layoutPath)
+		if err != nil {
+			fail(err)
+		}
+	}
+
+	err, img := link.Link(objs, layout)
+	if err != nil {
+		fail(err)
+	}
+
+	base := strings.TrimSuffix(out, filepath.Ext(out))
+
+	if err := img.WriteFlatFile(out); err != nil {
+		fail(err)
+	}
+
+	if err := img.WriteSymbolMapFile(base + ".sym"); err != nil {
+		fail(err)
+	}
+
+	if err := img.WriteSourceMapFile(base + ".map"); err != nil {
+		fail(err)
+	}
+
+	fmt.Printf("%s: %d words, entry 0x%04X\n", out, img.Size(), img.Entry)
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "%s\n", err)
+	os.Exit(1)
+}
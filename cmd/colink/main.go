@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Tinch334/Computer-one-v2/link"
+	"github.com/Tinch334/Computer-one-v2/obj"
+)
+
+
+//Links object files into a flat image, a symbol map and a source map, all loadable by the debugger.
+func main() {
+	out := flag.String("o", "a.bin", "Output flat image")
+	symPath := flag.String("sym", "", "Output symbol map, defaults to the image name with a \".sym\" extension")
+	mapPath := flag.String("map", "", "Output source map, defaults to the image name with a \".map\" extension")
+	layoutPath := flag.String("layout", "", "Layout file describing where sections are placed")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] <file.o>...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	base := strings.TrimSuffix(*out, filepath.Ext(*out))
+	if *symPath == "" {
+		*symPath = base + ".sym"
+	}
+	if *mapPath == "" {
+		*mapPath = base + ".map"
+	}
+
+	var layout *link.Layout
+	if *layoutPath != "" {
+		var err error
+		err, layout = link.ReadLayoutFile(*layoutPath)
+		if err != nil {
+			fail(err)
+		}
+	}
+
+	objs := make([]*obj.Object, 0, flag.NArg())
+	for _, path := range flag.Args() {
+		err, o := obj.ReadFile(path)
+		if err != nil {
+			fail(err)
+		}
+
+		objs = append(objs, o)
+	}
+
+	err, img := link.Link(objs, layout)
+	if err != nil {
+		fail(err)
+	}
+
+	if err := img.WriteFlatFile(*out); err != nil {
+		fail(err)
+	}
+
+	if err := img.WriteSymbolMapFile(*symPath); err != nil {
+		fail(err)
+	}
+
+	if err := img.WriteSourceMapFile(*mapPath); err != nil {
+		fail(err)
+	}
+
+	fmt.Printf("%s: %d words, entry 0x%04X\n", *out, img.Size(), img.Entry)
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "%s\n", err)
+	os.Exit(1)
+}
@@ -0,0 +1,143 @@
+package co
+
+import (
+	"fmt"
+	"time"
+)
+
+//A program to measure execution speed, it's loaded at address 0 of a new computer and starts at "Entry".
+type Benchmark struct {
+	Name string
+	Program []uint16
+	Entry uint16
+}
+
+//Result of running a benchmark with both execution paths.
+type BenchResult struct {
+	Name string
+
+	//Instructions run, the same for both paths.
+	Instructions int
+
+	//Time taken decoding every instruction, and with predecoded instructions.
+	Decoding time.Duration
+	Predecoded time.Duration
+}
+
+//Returns the simulated instructions per second of a run.
+func PerSecond(instructions int, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+
+	return float64(instructions) / d.Seconds()
+}
+
+//Returns the benchmark suite, its programs loop forever.
+func Benchmarks() []Benchmark {
+	return []Benchmark{
+		{Name: "arithmetic", Program: program(
+			Instruction{Opcode: MOV, Reg: 1, Operand: 0x7F},
+			Instruction{Opcode: ADD, Reg: 2, RegisterMode: true, Operand: 1},
+			Instruction{Opcode: MUL, Reg: 3, Operand: 3},
+			Instruction{Opcode: AND, Reg: 3, RegisterMode: true, Operand: 2},
+			Instruction{Opcode: SHL, Reg: 4, Operand: 1},
+			Instruction{Opcode: OR, Reg: 4, RegisterMode: true, Operand: 3},
+			Instruction{Opcode: ADD, Reg: 1, DoubleMode: true, Operand: 0xFFFF},
+			Instruction{Opcode: JMP, Reg: COND_P, Operand: 1},
+			Instruction{Opcode: JMP, Reg: COND_ALL, Operand: 0},
+		)},
+
+		//Copies blocks of 128 words.
+		{Name: "memory", Program: program(
+			Instruction{Opcode: MOV, Reg: 1, DoubleMode: true, Operand: 0x200},
+			Instruction{Opcode: MOV, Reg: 2, DoubleMode: true, Operand: 0x300},
+			Instruction{Opcode: LD, Reg: 3, RegisterMode: true, Operand: 1},
+			Instruction{Opcode: ST, Reg: 3, RegisterMode: true, Operand: 2},
+			Instruction{Opcode: ADD, Reg: 1, Operand: 1},
+			Instruction{Opcode: ADD, Reg: 2, Operand: 1},
+			Instruction{Opcode: MOV, Reg: 4, RegisterMode: true, Operand: 1},
+			Instruction{Opcode: AND, Reg: 4, Operand: 0x7F},
+			Instruction{Opcode: JMP, Reg: COND_N | COND_P, Operand: 4},
+			Instruction{Opcode: JMP, Reg: COND_ALL, Operand: 0},
+		)},
+
+		{Name: "calls", Program: program(
+			Instruction{Opcode: JSR, Operand: 4},
+			Instruction{Opcode: ADD, Reg: 1, Operand: 1},
+			Instruction{Opcode: JMP, Reg: COND_ALL, Operand: 0},
+			Instruction{Opcode: NOP},
+			Instruction{Opcode: ADD, Reg: 2, Operand: 1},
+			Instruction{Opcode: RET},
+		)},
+
+		//Rewrites one of its own instructions every iteration, so it's decoded again each time.
+		{Name: "self-modifying", Program: program(
+			Instruction{Opcode: MOV, Reg: 3, DoubleMode: true, Operand: Instruction{Opcode: ADD, Reg: 1, Operand: 1}.Encode()[0]},
+			Instruction{Opcode: ST, Reg: 3, Operand: 6},
+			Instruction{Opcode: ADD, Reg: 2, Operand: 1},
+			Instruction{Opcode: NOP},
+			Instruction{Opcode: NOP},
+			Instruction{Opcode: NOP},
+			Instruction{Opcode: JMP, Reg: COND_ALL, Operand: 0},
+		)},
+	}
+}
+
+//Returns the machine code of the given instructions.
+func program(ins ...Instruction) []uint16 {
+	words := make([]uint16, 0, len(ins))
+	for _, i := range ins {
+		words = append(words, i.Encode()...)
+	}
+
+	return words
+}
+
+//Runs "n" instructions of the benchmark with each execution path, or until the program halts. Fails if the paths end
+//in different states, or the program fails.
+func RunBenchmark(b Benchmark, n int) (error, BenchResult) {
+	res := BenchResult{Name: b.Name}
+
+	decoding := NewComputerInfo()
+	predecoded := NewComputerInfo()
+
+	for _, ci := range []*ComputerInfo{decoding, predecoded} {
+		if err := ci.SetMemoryBlock(0, b.Program); err != nil {
+			return err, res
+		}
+
+		ci.regs.PC = b.Entry
+	}
+
+	start := time.Now()
+	ranDecoding := 0
+	for ranDecoding < n {
+		ranDecoding++
+
+		err, running := decoding.stepDecoding()
+		if err != nil {
+			return fmt.Errorf("%s: %w", b.Name, err), res
+		}
+		if !running {
+			break
+		}
+	}
+	res.Decoding = time.Since(start)
+
+	start = time.Now()
+	err, ran, _ := predecoded.Run(n)
+	res.Predecoded = time.Since(start)
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", b.Name, err), res
+	}
+
+	if ran != ranDecoding || decoding.regs != predecoded.regs || decoding.flags != predecoded.flags ||
+		decoding.user != predecoded.user || *decoding.memory != *predecoded.memory {
+		return fmt.Errorf("%s: The execution paths disagree", b.Name), res
+	}
+
+	res.Instructions = ran
+	return nil, res
+}
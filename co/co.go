@@ -4,6 +4,13 @@ import (
 	"errors"
 )
 
+var (
+	errInvalidJMP = errors.New("Invalid operand for JMP")
+	errInvalidJSR = errors.New("Invalid operand for JSR")
+	errInvalidUSR = errors.New("Invalid operand for USR")
+	errInvalidTRAP = errors.New("Invalid operand for TRAP")
+)
+
 /*
 	INTERNAL INSTRUCTION PROCESSING
 */
@@ -13,32 +20,30 @@ func getBit(ins uint16, pos int) bool {
 }
 
 //Returns a pointer to the appropriate general register, if the argument is invalid the first register is returned.
-func (ci *ComputerInfo) getRegisterPtr(arg uint16) *uint16 {
+func (regs *Registers) general(arg uint16) *uint16 {
 	var retAddr *uint16
 
 	switch(arg) {
 	case 0:
-		retAddr = &(ci.regs.R0)
+		retAddr = &(regs.R0)
 	case 1:
-		retAddr = &(ci.regs.R1)
+		retAddr = &(regs.R1)
 	case 2:
-		retAddr = &(ci.regs.R2)
+		retAddr = &(regs.R2)
 	case 3:
-		retAddr = &(ci.regs.R3)
+		retAddr = &(regs.R3)
 	case 4:
-		retAddr = &(ci.regs.R4)
+		retAddr = &(regs.R4)
 	case 5:
-		retAddr = &(ci.regs.R5)
+		retAddr = &(regs.R5)
 	case 6:
-		retAddr = &(ci.regs.R6)
+		retAddr = &(regs.R6)
 	case 7:
-		retAddr = &(ci.regs.R7)
+		retAddr = &(regs.R7)
 	default: //Avoid returning an error.
-		retAddr = &(ci.regs.R0)
+		retAddr = &(regs.R0)
 	}
 
-	ci.setFlags(*retAddr)
-
 	return retAddr
 }
 
@@ -53,158 +58,94 @@ func rightShift(value uint16, amount uint16) uint16 {
 }
 
 
-/*
-	INTERPRETER
-*/
-func (ci *ComputerInfo) Step() (error, bool) {
-	word := ci.memory[int(ci.regs.PC)]
-	ins := getInstruction(word)
-	firstRegPtr := ci.getRegisterPtr(getFirstRegister(word))
-
-	pcModified := false
-
-	//The PC must increment by at least one every tick.
-	ci.addPCinc()
-
-	switch(ins) {
-	//Load/store.
-	case LD:
-		b, regPtr, opr := ci.getRegisterOrImmediate(word)
-
-		if b {
-			*firstRegPtr = ci.GetMemoryCell(*regPtr)
-		} else {
-			*firstRegPtr = ci.GetMemoryCell(opr)
-		}
-	case ST:
-		b, regPtr, opr := ci.getRegisterOrImmediate(word)
+//Returns true if a JMP with the given conditions is taken.
+func jumpTaken(cond uint16, f Flags) bool {
+	return cond == COND_ALL || (cond & COND_N != 0 && f.N) || (cond & COND_P != 0 && f.P) || (cond & COND_Z != 0 && f.Z)
+}
 
-		if b {
-			ci.SetMemoryCell(*regPtr, *firstRegPtr)
-		} else {
-			ci.SetMemoryCell(opr, *firstRegPtr)
-		}
+//Returns true for instructions that write their result to the first register, and so update the flags.
+func writesFirstRegister(ins uint16) bool {
+	switch ins {
+	case LD, MOV, ADD, MUL, AND, NOT, OR, SHL, SHR, TAS, GPP:
+		return true
+	}
 
-	case MOV:
-		b, regPtr, opr := ci.getRegisterOrImmediate(word)
+	return false
+}
 
-		if b {
-			*firstRegPtr = *regPtr
-		} else {
-			*firstRegPtr = opr
-		}
-	
-	//Arithmetic operations.
-	case ADD:
-		b, regPtr, opr := ci.getRegisterOrImmediate(word)
-
-		if b {
-			*firstRegPtr += *regPtr
-		} else {
-			*firstRegPtr += opr
-		}
-	
-	case MUL:
-		b, regPtr, opr := ci.getRegisterOrImmediate(word)
-
-		if b {
-			*firstRegPtr *= *regPtr
-		} else {
-			*firstRegPtr *= opr
-		}
-		
-	//Logic operations.
-	case AND:
-		b, regPtr, opr := ci.getRegisterOrImmediate(word)
-
-		if b {
-			*firstRegPtr &= *regPtr
-		} else {
-			*firstRegPtr &= opr
-		}
 
-	case NOT:
-		*firstRegPtr = ^(*firstRegPtr)
-		
-	case OR:
-		b, regPtr, opr := ci.getRegisterOrImmediate(word)
+/*
+	INTERPRETER
+*/
+//Runs the instruction at the PC, for a computer used on its own. Devices are ticked after each instruction that doesn't
+//fail or halt, an interrupt they request is taken before the next one. Cores of a Multicore are stepped by it instead,
+//so devices are ticked once per step of the whole system.
+func (ci *ComputerInfo) Step() (error, bool) {
+	err, running := ci.step()
 
-		if b {
-			*firstRegPtr |= *regPtr
-		} else {
-			*firstRegPtr |= opr
+	if err == nil && running {
+		if request, vector := ci.bus.tick(); request && !ci.interrupted {
+			ci.interrupt(vector)
 		}
+	}
 
-	case SHL:
-		b, regPtr, opr := ci.getRegisterOrImmediate(word)
+	return err, running
+}
 
-		if b {
-			*firstRegPtr *= *firstRegPtr << *regPtr
-		} else {
-			*firstRegPtr *= *firstRegPtr << opr
-		}
-	
-	case SHR:
-		b, regPtr, opr := ci.getRegisterOrImmediate(word)
-
-		if b {
-			*firstRegPtr *= *firstRegPtr >> *regPtr
-		} else {
-			*firstRegPtr *= *firstRegPtr >> opr
-		}
+//Runs the instruction at the PC without ticking the devices. Instructions are predecoded and dispatched through
+//"handlers", with hooks they are decoded each time so every access can be reported, but run by the same handlers.
+func (ci *ComputerInfo) step() (error, bool) {
+	if ci.hooks == nil {
+		return ci.stepCached()
+	}
 
-    //Flow control.
-	case JMP:
-		b, _, operand := ci.getRegisterOrImmediate(word)
+	return ci.stepDecoding()
+}
 
-		//Invalid operand, do nothing.
-		if b {
-			return errors.New("Invalid operand for JMP"), true
-		}
+//Decodes and runs the instruction at the PC without using the cache.
+func (ci *ComputerInfo) stepDecoding() (error, bool) {
+	addr := ci.regs.PC % MemorySize
+	ins := Decode(ci.memory[addr], ci.memory[(addr + 1) % MemorySize])
+	d := decode(ins, addr)
 
-		f := ci.flags
-
-		//Check jump flags.
-		if (getBit(word, 2) && f.N) {
-			ci.regs.PC = operand
-			pcModified = true
-		} else if (getBit(word, 1) && f.P) {
-			ci.regs.PC = operand
-			pcModified = true
-		} else if (getBit(word, 0) && f.Z) {
-			ci.regs.PC = operand
-			pcModified = true
-		}
+	return ci.execute(&d, ins)
+}
 
-	case JSR:
-		b, _, operand := ci.getRegisterOrImmediate(word)
+//Executes an instruction that is not in memory, as if it was at the PC. The PC only changes if the instruction jumps, and
+//JSR returns to the PC, so the instruction there is executed next.
+func (ci *ComputerInfo) Execute(words []uint16) (error, bool) {
+	if len(words) == 0 || int(InstructionSize(words[0])) > len(words) {
+		return errors.New("Incomplete instruction"), true
+	}
 
-		//Invalid operand, do nothing.
-		if b {
-			return errors.New("Invalid operand for JSR"), true
-		}
+	next := uint16(0)
+	if len(words) > 1 {
+		next = words[1]
+	}
 
-		ci.regs.R7 = (ci.regs.PC + 1) % MemorySize
-		ci.regs.PC = operand
-		pcModified = true
+	ins := Decode(words[0], next)
+	//Instructions that are not in memory aren't fetched, but privileged ones still fault in user mode.
+	d := decode(ins, ci.regs.PC)
+	d.next = ci.regs.PC
+	d.size = 0
 
-	case RET:
-		ci.regs.PC = ci.regs.R7
-		pcModified = true
+	return ci.execute(&d, ins)
+}
 
-	case NOP:
-		
-	case HLT:
-		return nil, false
+//Runs a decoded instruction, reporting it to the hooks if there are any. "ins" is the instruction it was decoded from.
+func (ci *ComputerInfo) execute(d *decoded, ins Instruction) (error, bool) {
+	if ci.hooks == nil {
+		return ci.runDecoded(d)
 	}
 
-	//Increment PC only if the instruction did not explicitly change it.
-	if !pcModified {
-		//Increment PC and check for overflow, reset increment counter.
-		ci.regs.PC += ci.pcIncs
-		ci.regs.PC = ci.regs.PC % MemorySize
-		ci.pcIncs = 0
+	return ci.runHooked(d, ins)
+}
+
+//Checks that the instruction can be fetched from the PC and runs it.
+func (ci *ComputerInfo) runDecoded(d *decoded) (error, bool) {
+	if err := ci.checkFetch(ci.regs.PC, d.size, d.opcode); err != nil {
+		return err, true
 	}
 
-	return nil, true
-}
\ No newline at end of file
+	return d.exec(ci, d)
+}
@@ -0,0 +1,615 @@
+package co
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//Shorthands for the instructions of test programs.
+func imm(op uint16, reg uint16, operand uint16) Instruction {
+	return Instruction{Opcode: op, Reg: reg, Operand: operand}
+}
+
+func reg(op uint16, reg uint16, src uint16) Instruction {
+	return Instruction{Opcode: op, Reg: reg, RegisterMode: true, Operand: src}
+}
+
+func word(op uint16, reg uint16, operand uint16) Instruction {
+	return Instruction{Opcode: op, Reg: reg, DoubleMode: true, Operand: operand}
+}
+
+//Loads the blocks at their addresses and runs from "entry" until the computer halts.
+func runBlocks(t *testing.T, blocks map[uint16][]uint16, entry uint16) *ComputerInfo {
+	t.Helper()
+
+	ci := NewComputerInfo()
+	for addr, words := range blocks {
+		for i, w := range words {
+			ci.SetMemoryCell(addr + uint16(i), w)
+		}
+	}
+	ci.SetRegisters(Registers{PC: entry}, Flags{})
+
+	for i := 0; ; i++ {
+		if i == 100 {
+			t.Fatal("The program didn't halt")
+		}
+
+		err, running := ci.Step()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !running {
+			return ci
+		}
+	}
+}
+
+func TestInterpreter(t *testing.T) {
+	tests := []struct {
+		name string
+		blocks map[uint16][]uint16
+		entry uint16
+		regs Registers
+	}{
+		{"shifts", map[uint16][]uint16{0: program(
+			imm(MOV, 1, 3),
+			imm(SHL, 1, 2),
+			imm(MOV, 2, 0x70),
+			imm(MOV, 3, 4),
+			reg(SHR, 2, 3),
+			imm(HLT, 0, 0),
+		)}, 0, Registers{R1: 12, R2: 7, R3: 4, PC: 5}},
+
+		//Register mode reaches all eight registers.
+		{"high registers", map[uint16][]uint16{0: program(
+			imm(MOV, 5, 9),
+			reg(MOV, 2, 5),
+			reg(ADD, 7, 2),
+			imm(HLT, 0, 0),
+		)}, 0, Registers{R2: 9, R5: 9, R7: 9, PC: 3}},
+
+		//The instruction a jump lands on isn't skipped.
+		{"taken jump", map[uint16][]uint16{
+			0: program(imm(MOV, 1, 0), imm(JMP, COND_Z, 7)),
+			7: program(imm(MOV, 1, 1), imm(HLT, 0, 0)),
+		}, 0, Registers{R1: 1, PC: 8}},
+
+		//Subroutines return after the operand word.
+		{"JSR in double mode", map[uint16][]uint16{
+			0x10: program(word(JSR, 0, 0x20), imm(HLT, 0, 0)),
+			0x20: program(imm(MOV, 1, 2), imm(RET, 0, 0)),
+		}, 0x10, Registers{R1: 2, R7: 0x12, PC: 0x12}},
+
+		//The operand of the last cell is the first one.
+		{"double mode at the end of memory", map[uint16][]uint16{
+			0: append([]uint16{0x1234}, program(imm(HLT, 0, 0))...),
+			MemorySize - 1: program(word(MOV, 1, 0))[:1],
+		}, MemorySize - 1, Registers{R1: 0x1234, PC: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ci := runBlocks(t, tt.blocks, tt.entry)
+
+			if regs := ci.GetRegisters(); regs != tt.regs {
+				t.Errorf("registers %+v, want %+v", regs, tt.regs)
+			}
+		})
+	}
+}
+
+func TestConditionalJumps(t *testing.T) {
+	//Values that set each flag.
+	values := map[string]uint16{"N": 0xFFFF, "P": 1, "Z": 0}
+
+	tests := []struct {
+		cond uint16
+		taken string
+	}{
+		{COND_N, "N"},
+		{COND_P, "P"},
+		{COND_Z, "Z"},
+		{COND_N | COND_Z, "NZ"},
+		{COND_P | COND_Z, "PZ"},
+		{COND_ALL, "NPZ"},
+		{0, ""},
+	}
+
+	for _, tt := range tests {
+		for flag, value := range values {
+			//The flags come from the value loaded into R1, the jump's condition field doesn't select a register.
+			ci := runBlocks(t, map[uint16][]uint16{
+				0: program(word(MOV, 1, value), imm(JMP, tt.cond, 0x10), imm(HLT, 0, 0)),
+				0x10: program(imm(MOV, 2, 1), imm(HLT, 0, 0)),
+			}, 0)
+
+			taken := ci.GetRegisters().R2 == 1
+			if want := strings.Contains(tt.taken, flag); taken != want {
+				t.Errorf("JMP with conditions %03b after loading 0x%04X: taken %v, want %v", tt.cond, value, taken, want)
+			}
+		}
+	}
+
+	//A jump with every condition is taken even before any instruction sets the flags.
+	ci := runBlocks(t, map[uint16][]uint16{
+		0: program(imm(JMP, COND_ALL, 0x10), imm(HLT, 0, 0)),
+		0x10: program(imm(MOV, 2, 1), imm(HLT, 0, 0)),
+	}, 0)
+
+	if ci.GetRegisters().R2 != 1 {
+		t.Errorf("JMP with every condition wasn't taken without flags")
+	}
+}
+
+func TestFlagsFromResults(t *testing.T) {
+	tests := []struct {
+		name string
+		prog []uint16
+		flags Flags
+	}{
+		{"ADD to zero", program(imm(MOV, 1, 1), word(ADD, 1, 0xFFFF), imm(HLT, 0, 0)), Flags{Z: true}},
+		{"NOT", program(imm(NOT, 3, 0), imm(HLT, 0, 0)), Flags{N: true}},
+		//Stores and jumps leave the flags of the last result.
+		{"ST", program(imm(MOV, 1, 5), imm(ST, 2, 0x20), imm(HLT, 0, 0)), Flags{P: true}},
+		{"JMP", program(word(MOV, 1, 0x8000), imm(JMP, COND_Z, 0x20), imm(HLT, 0, 0)), Flags{N: true}},
+		//The source register doesn't change them.
+		{"register source", program(imm(MOV, 1, 0), imm(MOV, 2, 4), reg(MUL, 1, 2), imm(HLT, 0, 0)), Flags{Z: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ci := runBlocks(t, map[uint16][]uint16{0: tt.prog}, 0)
+
+			if f := ci.GetFlags(); f != tt.flags {
+				t.Errorf("flags %+v, want %+v", f, tt.flags)
+			}
+		})
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	tests := []struct {
+		ins Instruction
+		words []uint16
+	}{
+		{imm(MOV, 1, 0x7F), []uint16{0x117F}},
+		{reg(ADD, 7, 6), []uint16{0x1F86}},
+		{word(LD, 2, 0x1234), []uint16{0x02FF, 0x1234}},
+		{imm(JMP, COND_N | COND_Z, 0x10), []uint16{0x5510}},
+		{imm(HLT, 0, 0), []uint16{0x7000}},
+	}
+
+	for _, tt := range tests {
+		words := tt.ins.Encode()
+		if !reflect.DeepEqual(words, tt.words) {
+			t.Errorf("%+v encodes to %04X, want %04X", tt.ins, words, tt.words)
+		}
+
+		next := uint16(0)
+		if len(words) > 1 {
+			next = words[1]
+		}
+
+		if got := Decode(words[0], next); got != tt.ins {
+			t.Errorf("%04X decodes to %+v, want %+v", words, got, tt.ins)
+		}
+		if tt.ins.Size() != uint16(len(words)) || InstructionSize(words[0]) != uint16(len(words)) {
+			t.Errorf("size of %+v is %d and %d, want %d", tt.ins, tt.ins.Size(), InstructionSize(words[0]), len(words))
+		}
+	}
+}
+
+//Instructions without an operand take a single word, even if their low byte marks double mode.
+func TestInstructionSize(t *testing.T) {
+	tests := []struct {
+		op uint16
+		size uint16
+	}{
+		{LD, 2},
+		{JMP, 2},
+		{TRAP, 2},
+		{NOT, 1},
+		{RET, 1},
+		{NOP, 1},
+		{HLT, 1},
+		{RTT, 1},
+		{RTI, 1},
+	}
+
+	for _, tt := range tests {
+		ins := Instruction{Opcode: tt.op, DoubleMode: true}
+		w := ins.Encode()[0]
+
+		if ins.Size() != tt.size || InstructionSize(w) != tt.size {
+			t.Errorf("size of %s in double mode is %d and %d, want %d", InstructionNames[tt.op], ins.Size(), InstructionSize(w), tt.size)
+		}
+	}
+
+	//The word after a NOP in double mode is the next instruction, on both execution paths.
+	for _, hooked := range []bool{false, true} {
+		ci := NewComputerInfo()
+		if hooked {
+			ci.AddHook(&NoHook{})
+		}
+
+		ci.SetMemoryBlock(0x40, append(Instruction{Opcode: NOP, DoubleMode: true}.Encode()[:1], program(imm(MOV, 1, 5))...))
+		ci.SetRegisters(Registers{PC: 0x40}, Flags{})
+		ci.Step()
+		ci.Step()
+
+		if r := ci.GetRegisters(); r.R1 != 5 || r.PC != 0x42 {
+			t.Errorf("hooked=%v: registers %+v after a NOP in double mode", hooked, r)
+		}
+	}
+}
+
+//A test program, its blocks are loaded at their addresses and it starts at "entry".
+type testProgram struct {
+	name string
+	blocks map[uint16][]uint16
+	entry uint16
+}
+
+func (p testProgram) load(t testing.TB) *ComputerInfo {
+	t.Helper()
+
+	ci := NewComputerInfo()
+	for addr, words := range p.blocks {
+		if err := ci.SetMemoryBlock(addr, words); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ci.regs.PC = p.entry
+
+	return ci
+}
+
+func testPrograms() []testProgram {
+	var programs []testProgram
+	for _, b := range Benchmarks() {
+		programs = append(programs, testProgram{name: b.Name, blocks: map[uint16][]uint16{0: b.Program}, entry: b.Entry})
+	}
+
+	return append(programs,
+		testProgram{name: "traps", entry: 0x10, blocks: map[uint16][]uint16{
+			//Vector 0.
+			0x00: {0x40},
+			0x10: program(
+				imm(MOV, 1, 3),
+				imm(USR, 0, 0x20),
+			),
+			0x20: program(
+				imm(ADD, 1, 1),
+				imm(TRAP, 0, 0),
+				reg(ADD, 2, 1),
+				imm(HLT, 0, 0),
+			),
+			0x40: program(
+				imm(MUL, 1, 2),
+				imm(RTT, 0, 0),
+			),
+		}},
+
+		testProgram{name: "atomic", entry: 0x10, blocks: map[uint16][]uint16{
+			0x10: program(
+				imm(MOV, 0, 0),
+				imm(MOV, 1, 7),
+				imm(CAS, 1, 0x50),
+				imm(TAS, 2, 0x51),
+				imm(TAS, 3, 0x51),
+				imm(CAS, 1, 0x51),
+				word(LD, 4, 0x50),
+				imm(HLT, 0, 0),
+			),
+		}},
+
+		//A subroutine that modifies its own code, the cached instruction must be replaced.
+		testProgram{name: "self-modifying", entry: 0, blocks: map[uint16][]uint16{
+			0: program(
+				imm(JSR, 0, 0x20),
+				word(MOV, 1, imm(ADD, 2, 5).Encode()[0]),
+				imm(ST, 1, 0x20),
+				imm(JSR, 0, 0x20),
+				imm(HLT, 0, 0),
+			),
+			0x20: program(
+				imm(ADD, 2, 1),
+				imm(RET, 0, 0),
+			),
+		}},
+
+		//Writes to a read only page in user mode.
+		testProgram{name: "protection", entry: 0x10, blocks: map[uint16][]uint16{
+			0x10: program(
+				imm(MOV, 1, uint16(PERM_READ)),
+				imm(SPP, 1, 2),
+				imm(USR, 0, 0x20),
+			),
+			0x20: program(
+				word(LD, 2, 0x80),
+				word(ST, 2, 0x81),
+				imm(HLT, 0, 0),
+			),
+			0x80: {0x1234},
+		}},
+
+		//A privileged instruction in user mode.
+		testProgram{name: "privileged", entry: 0x10, blocks: map[uint16][]uint16{
+			0x10: program(
+				imm(USR, 0, 0x20),
+			),
+			0x20: program(
+				imm(JSR, 0, 0x30),
+				imm(HLT, 0, 0),
+			),
+			0x30: program(
+				imm(GPP, 1, 0),
+				imm(RET, 0, 0),
+			),
+		}},
+
+		//Register mode jumps are invalid.
+		testProgram{name: "invalid jump", entry: 0, blocks: map[uint16][]uint16{
+			0: program(
+				imm(JMP, COND_ALL, 2),
+				imm(HLT, 0, 0),
+				reg(JMP, COND_ALL, 1),
+			),
+		}},
+	)
+}
+
+//Runs up to "n" instructions one at a time, returns the error that stopped the computer.
+func stepWith(ci *ComputerInfo, step func() (error, bool), n int) (error, int) {
+	for i := 0; i < n; i++ {
+		err, running := step()
+		if err != nil || !running {
+			return err, i + 1
+		}
+	}
+
+	return nil, n
+}
+
+//Returns the state both execution paths must agree on.
+func state(ci *ComputerInfo) string {
+	return fmt.Sprintf("%+v %+v user=%v memory=%v", ci.regs, ci.flags, ci.user, *ci.memory)
+}
+
+func TestExecutionPathsAgree(t *testing.T) {
+	for _, p := range testPrograms() {
+		t.Run(p.name, func(t *testing.T) {
+			cached := p.load(t)
+			decoding := p.load(t)
+			hooked := p.load(t)
+			hooked.AddHook(&NoHook{})
+
+			errCached, ranCached := stepWith(cached, cached.stepCached, 5000)
+			errDecoding, ranDecoding := stepWith(decoding, decoding.stepDecoding, 5000)
+			errHooked, ranHooked := stepWith(hooked, hooked.Step, 5000)
+
+			if fmt.Sprint(errCached) != fmt.Sprint(errDecoding) || fmt.Sprint(errCached) != fmt.Sprint(errHooked) {
+				t.Errorf("errors differ: cached %v, decoding %v, hooked %v", errCached, errDecoding, errHooked)
+			}
+			if ranCached != ranDecoding || ranCached != ranHooked {
+				t.Errorf("instructions run differ: cached %d, decoding %d, hooked %d", ranCached, ranDecoding, ranHooked)
+			}
+
+			if state(cached) != state(decoding) {
+				t.Errorf("decoding path ended in a different state\ncached:   %.200s\ndecoding: %.200s", state(cached), state(decoding))
+			}
+			if state(cached) != state(hooked) {
+				t.Errorf("hooked path ended in a different state\ncached: %.200s\nhooked: %.200s", state(cached), state(hooked))
+			}
+		})
+	}
+}
+
+func TestPrograms(t *testing.T) {
+	tests := []struct {
+		name string
+		err string
+		regs Registers
+		user bool
+	}{
+		{"traps", "", Registers{R1: 8, R2: 8, R7: 0x22 | TRAP_USER_BIT, PC: 0x23}, true},
+		{"atomic", "", Registers{R0: 1, R1: 7, R3: 1, R4: 7, PC: 0x18}, false},
+		{"self-modifying", "", Registers{R1: imm(ADD, 2, 5).Encode()[0], R2: 6, R7: 5, PC: 5}, false},
+		{"protection", "Protection fault: write to 0x0081 in user mode", Registers{R1: uint16(PERM_READ), R2: 0x1234, PC: 0x22}, true},
+		{"privileged", "Protection fault: privileged instruction at 0x0030 in user mode", Registers{R7: 0x21, PC: 0x30}, true},
+		{"invalid jump", errInvalidJMP.Error(), Registers{PC: 2}, false},
+	}
+
+	programs := map[string]testProgram{}
+	for _, p := range testPrograms() {
+		programs[p.name] = p
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ci := programs[tt.name].load(t)
+
+			err, _, running := ci.Run(100)
+
+			got := ""
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tt.err {
+				t.Errorf("got error %q, want %q", got, tt.err)
+			}
+			if err == nil && running {
+				t.Error("The program didn't halt")
+			}
+
+			if ci.regs != tt.regs {
+				t.Errorf("registers %+v, want %+v", ci.regs, tt.regs)
+			}
+			if ci.user != tt.user {
+				t.Errorf("user mode %v, want %v", ci.user, tt.user)
+			}
+		})
+	}
+}
+
+func TestExecute(t *testing.T) {
+	for _, hooked := range []bool{false, true} {
+		ci := NewComputerInfo()
+		if hooked {
+			ci.AddHook(&NoHook{})
+		}
+		ci.regs.PC = 0x10
+
+		//Instructions that don't jump leave the PC alone, JSR returns to it.
+		if err, _ := ci.Execute(word(MOV, 1, 0x1234).Encode()); err != nil {
+			t.Fatal(err)
+		}
+		if err, _ := ci.Execute(imm(JSR, 0, 0x30).Encode()); err != nil {
+			t.Fatal(err)
+		}
+
+		want := Registers{R1: 0x1234, R7: 0x10, PC: 0x30}
+		if ci.regs != want {
+			t.Errorf("hooked=%v: registers %+v, want %+v", hooked, ci.regs, want)
+		}
+
+		if err, _ := ci.Execute([]uint16{word(MOV, 1, 0).Encode()[0]}); err == nil {
+			t.Errorf("hooked=%v: executing half an instruction succeeded", hooked)
+		}
+
+		ci.user = true
+		err, _ := ci.Execute(imm(SPP, 1, 0).Encode())
+		if _, ok := err.(*ProtectionFault); !ok {
+			t.Errorf("hooked=%v: SPP in user mode returned %v, want a protection fault", hooked, err)
+		}
+	}
+}
+
+//Records the calls it receives.
+type recorder struct {
+	events []string
+}
+
+func (r *recorder) BeforeInstruction(ci *ComputerInfo, pc uint16, ins Instruction) {
+	r.events = append(r.events, fmt.Sprintf("before 0x%02X %s", pc, InstructionNames[ins.Opcode]))
+}
+
+func (r *recorder) AfterInstruction(ci *ComputerInfo, pc uint16, ins Instruction) {
+	r.events = append(r.events, fmt.Sprintf("after 0x%02X", pc))
+}
+
+func (r *recorder) MemoryRead(ci *ComputerInfo, addr uint16, value uint16) {
+	r.events = append(r.events, fmt.Sprintf("read 0x%02X = %d", addr, value))
+}
+
+func (r *recorder) MemoryWrite(ci *ComputerInfo, addr uint16, old uint16, new uint16) {
+	r.events = append(r.events, fmt.Sprintf("write 0x%02X %d -> %d", addr, old, new))
+}
+
+func (r *recorder) RegisterWrite(ci *ComputerInfo, reg uint16, old uint16, new uint16) {
+	r.events = append(r.events, fmt.Sprintf("R%d %d -> %d", reg, old, new))
+}
+
+func (r *recorder) Halt(ci *ComputerInfo, pc uint16) {
+	r.events = append(r.events, fmt.Sprintf("halt 0x%02X", pc))
+}
+
+func (r *recorder) Fault(ci *ComputerInfo, pc uint16, err error) {
+	r.events = append(r.events, fmt.Sprintf("fault 0x%02X %v", pc, err))
+}
+
+func TestHooks(t *testing.T) {
+	ci := NewComputerInfo()
+	ci.SetMemoryBlock(0, program(
+		imm(LD, 1, 0x50),
+		imm(ST, 1, 0x51),
+		word(JSR, 0, 0x10),
+	))
+	ci.SetMemoryBlock(0x10, program(reg(JMP, COND_ALL, 0)))
+	ci.SetMemoryBlock(0x50, []uint16{5, 6})
+
+	r := &recorder{}
+	ci.AddHook(r)
+
+	for i := 0; i < 3; i++ {
+		if err, _ := ci.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err, _ := ci.Step(); err == nil {
+		t.Fatal("JMP with a register operand didn't fault")
+	}
+
+	want := []string{
+		"before 0x00 LD", "read 0x50 = 5", "R1 0 -> 5", "after 0x00",
+		"before 0x01 ST", "write 0x51 6 -> 5", "after 0x01",
+		"before 0x02 JSR", "R7 0 -> 4", "after 0x02",
+		"before 0x10 JMP", "fault 0x10 Invalid operand for JMP",
+	}
+	if !reflect.DeepEqual(r.events, want) {
+		t.Errorf("events\n%q\nwant\n%q", r.events, want)
+	}
+
+	//Removed hooks aren't called again, the halt is only seen by the remaining ones.
+	other := &recorder{}
+	ci.AddHook(other)
+	ci.RemoveHook(r)
+	ci.SetMemoryCell(0x10, imm(HLT, 0, 0).Encode()[0])
+
+	if err, running := ci.Step(); err != nil || running {
+		t.Errorf("got %v, running %v at the halt", err, running)
+	}
+	if len(r.events) != len(want) {
+		t.Error("A removed hook was called")
+	}
+	if want := []string{"before 0x10 HLT", "after 0x10", "halt 0x10"}; !reflect.DeepEqual(other.events, want) {
+		t.Errorf("events %q, want %q", other.events, want)
+	}
+}
+
+func BenchmarkStep(b *testing.B) {
+	for _, bench := range Benchmarks() {
+		p := testProgram{blocks: map[uint16][]uint16{0: bench.Program}, entry: bench.Entry}
+
+		paths := []struct {
+			name string
+			step func(ci *ComputerInfo) (error, bool)
+			hook bool
+		}{
+			{"cached", (*ComputerInfo).stepCached, false},
+			{"decoding", (*ComputerInfo).stepDecoding, false},
+			{"hooked", (*ComputerInfo).Step, true},
+		}
+
+		for _, path := range paths {
+			b.Run(bench.Name + "/" + path.name, func(b *testing.B) {
+				ci := p.load(b)
+				if path.hook {
+					ci.AddHook(&NoHook{})
+				}
+
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if err, _ := path.step(ci); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkRunBenchmark(b *testing.B) {
+	for _, bench := range Benchmarks() {
+		b.Run(bench.Name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err, _ := RunBenchmark(bench, 1000); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
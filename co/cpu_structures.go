@@ -25,11 +25,30 @@ type ComputerInfo struct {
 	//Status flags.
 	flags Flags
 
-	//How many times the PC must be incremented in the next tick.
-	pcIncs uint16
+	//Array representing memory, cores of a multicore system share it.
+	memory *[MemorySize]uint16
 
-	//Array representing memory.
-	memory [MemorySize]uint16
+	//Instructions decoded from memory, shared like it.
+	cache *instructionCache
+
+	//Pointers to the general registers, indexed by number.
+	gpr [8]*uint16
+
+	//Set in user mode, where the protection applies and privileged instructions fault.
+	user bool
+
+	//Permissions of the pages of memory, shared like it.
+	protection *protectionTable
+
+	//Devices mapped into memory, shared like it.
+	bus *bus
+
+	//Set while an interrupt is handled, "saved" holds what RTI restores.
+	interrupted bool
+	saved interruptState
+
+	//Observers of the execution, nil if there are none.
+	hooks []Hook
 }
 
 const (
@@ -48,20 +67,81 @@ const (
 	RET
 	NOP
 	HLT
+	CAS
+	TAS
+	SPP
+	GPP
+	USR
+	TRAP
+	RTT
+	RTI
 )
 
+//Mnemonics of all instructions, indexed by opcode.
+var InstructionNames = []string{"LD", "ST", "MOV", "ADD", "MUL", "AND", "NOT", "OR", "SHL", "SHR", "JMP", "JSR", "RET", "NOP", "HLT", "CAS", "TAS", "SPP", "GPP", "USR", "TRAP", "RTT", "RTI"}
+
+//JMP condition flags, stored in the first register field, a jump is taken if any of the selected flags is set. A jump
+//with all of them is always taken, even before any instruction set the flags.
+const (
+	COND_Z = 1 << iota
+	COND_P
+	COND_N
+
+	COND_ALL = COND_N | COND_P | COND_Z
+)
+
+//Marks an operand as stored in the word following the instruction.
+const DOUBLE_MODE = 0xFF
+
+//Set in register mode, the second register is stored in the lowest bits.
+const REGISTER_MODE = 0x80
+
+//Largest value that fits in the immediate field.
+const MaxImmediate = 0x7F
+
 
 func NewComputerInfo() *ComputerInfo {
 	ci := ComputerInfo{
 		regs: Registers{},
 		flags: Flags{},
-		pcIncs: 0,
-		memory: [MemorySize]uint16{},
+		memory: &[MemorySize]uint16{},
+		cache: &instructionCache{},
+		protection: newProtectionTable(),
+		bus: &bus{},
 	}
+	ci.gpr = ci.registerTable()
 
 	return &ci
 }
 
+//Returns an independent copy of the computer, with the same registers, flags, mode, memory and protection. Hooks and
+//devices aren't copied.
+func (ci *ComputerInfo) Clone() *ComputerInfo {
+	c := *ci
+	mem := *ci.memory
+	c.memory = &mem
+	c.cache = &instructionCache{}
+	protection := *ci.protection
+	c.protection = &protection
+	c.bus = &bus{}
+	c.gpr = c.registerTable()
+	c.hooks = nil
+
+	return &c
+}
+
+//Returns a new core that shares its memory, protection and devices with this one, its registers and flags are cleared and
+//it starts in supervisor mode.
+func (ci *ComputerInfo) NewCore() *ComputerInfo {
+	c := NewComputerInfo()
+	c.memory = ci.memory
+	c.cache = ci.cache
+	c.protection = ci.protection
+	c.bus = ci.bus
+
+	return c
+}
+
 /*
 	OUTPUT FUNCTIONS
 */
@@ -73,6 +153,11 @@ func (ci *ComputerInfo) GetFlags() Flags {
 	return ci.flags
 }
 
+//Returns the opcode of the instruction the PC currently points to.
+func (ci *ComputerInfo) GetCurrentInstruction() uint16 {
+	return getInstruction(ci.memory[ci.regs.PC % MemorySize])
+}
+
 func (ci *ComputerInfo) GetMemory(start uint16, end uint16) (error, []uint16) {
 	if start >= end {
 		return errors.New("Invalid memory slice: start must be < end"), nil
@@ -83,8 +168,8 @@ func (ci *ComputerInfo) GetMemory(start uint16, end uint16) (error, []uint16) {
 
 	returnedMemory := make([]uint16, end - start)
 
-	for i := start; i < end; i++ {
-		returnedMemory[i] = ci.GetMemoryCell(i + start)
+	for i := range returnedMemory {
+		returnedMemory[i] = ci.GetMemoryCell(start + uint16(i))
 	}
 
 	return nil, returnedMemory
@@ -109,9 +194,16 @@ func (ci *ComputerInfo) SetMemoryBlock(start uint16, mem []uint16) error {
 
 func (ci *ComputerInfo) SetMemoryCell(addr uint16, value uint16) {
 	ci.memory[addr % MemorySize] = value
+	ci.cache.invalidate(addr)
 }
 
+//Returns the value of a memory cell, for device registers their current value, without the side effects of a read.
 func (ci *ComputerInfo) GetMemoryCell(addr uint16) uint16 {
+	if d := ci.bus.mapped[addr % MemorySize]; d != nil {
+		base, _ := d.Registers()
+		return d.Peek(addr % MemorySize - base)
+	}
+
 	return ci.memory[addr % MemorySize]
 }
 
@@ -133,32 +225,6 @@ func (ci *ComputerInfo) SetRegisters(regs Registers, flags Flags) {
 	ci.flags = flags
 }
 
-//Takes an instruction, if it's in immediate mode returns the value and "false", otherwise "true" and a pointer to the appropriate register.
-func (ci *ComputerInfo) getRegisterOrImmediate(ins uint16) (bool, *uint16, uint16) {
-	//Check if double mode is enabled, if so load data from next memory cell.
-	if getLowerByte(ins) == 0xFF {
-		ci.addPCinc()
-		return false, nil, ci.memory[ci.regs.PC + 1]
-	}
-
-	//Check immediate flag.
-	if getBit(ins, 7) {
-		regNum := getSecondRegister(ins)
-		reg := ci.getRegisterPtr(regNum)
-
-		return true, reg, 0
-	}
-
-	imm := getImmediate(ins)
-
-	return false, nil, imm
-}
-
-//Adds one increment to the PC in the next tick.
-func (ci *ComputerInfo) addPCinc() {
-	ci.pcIncs += 1
-}
-
 /*
 	INSTRUCTION INFORMATION
 */
@@ -171,7 +237,7 @@ func getFirstRegister(ins uint16) uint16 {
 }
 
 func getSecondRegister(ins uint16) uint16 {
-	return ins & 0x0003
+	return ins & 0x0007
 }
 
 func getImmediate(ins uint16) uint16 {
@@ -0,0 +1,140 @@
+package co
+
+import (
+	"errors"
+	"fmt"
+)
+
+var errNotInterrupted = errors.New("RTI outside of an interrupt handler")
+
+//A device mapped into memory, instructions that access its registers reach it instead of memory. Devices are called in
+//the goroutine that executes instructions.
+type Device interface {
+	Name() string
+
+	//First address of the registers and how many there are.
+	Registers() (base uint16, size uint16)
+
+	//Reads and writes a register, "reg" is relative to the base. Reads may have side effects, "Peek" doesn't.
+	Read(reg uint16) uint16
+	Write(reg uint16, value uint16)
+	Peek(reg uint16) uint16
+
+	//Called once per step of the system. Returns true and a trap vector to request an interrupt, requests are repeated
+	//until the interrupt is taken.
+	Tick() (bool, uint16)
+}
+
+//Devices of a system, its cores share them like memory.
+type bus struct {
+	devices []Device
+
+	//Device at each address, nil for memory.
+	mapped [MemorySize]Device
+}
+
+//State saved when an interrupt is taken, RTI restores it.
+type interruptState struct {
+	pc uint16
+	user bool
+	flags Flags
+}
+
+
+/*
+	DEVICES
+*/
+//Maps a device into memory, its registers must not overlap those of another device.
+func (ci *ComputerInfo) Attach(d Device) error {
+	base, size := d.Registers()
+	if size == 0 || int(base) + int(size) > MemorySize {
+		return fmt.Errorf("The registers of %s don't fit in memory", d.Name())
+	}
+
+	for addr := base; addr < base + size; addr++ {
+		if other := ci.bus.mapped[addr]; other != nil {
+			return fmt.Errorf("The registers of %s overlap those of %s at 0x%04X", d.Name(), other.Name(), addr)
+		}
+	}
+
+	for addr := base; addr < base + size; addr++ {
+		ci.bus.mapped[addr] = d
+	}
+	ci.bus.devices = append(ci.bus.devices, d)
+
+	return nil
+}
+
+//Removes a device, returns false if it isn't attached.
+func (ci *ComputerInfo) Detach(d Device) bool {
+	for i, e := range ci.bus.devices {
+		if e != d {
+			continue
+		}
+
+		base, size := d.Registers()
+		for addr := base; addr < base + size; addr++ {
+			ci.bus.mapped[addr] = nil
+		}
+		ci.bus.devices = append(ci.bus.devices[:i], ci.bus.devices[i + 1:]...)
+
+		return true
+	}
+
+	return false
+}
+
+//Returns the attached devices, in the order they were attached.
+func (ci *ComputerInfo) Devices() []Device {
+	return append([]Device(nil), ci.bus.devices...)
+}
+
+//Returns the device mapped at the address, nil if it's memory.
+func (ci *ComputerInfo) DeviceAt(addr uint16) Device {
+	return ci.bus.mapped[addr % MemorySize]
+}
+
+
+/*
+	INTERRUPTS
+*/
+//Returns true while an interrupt is being handled, no other interrupt is taken until RTI.
+func (ci *ComputerInfo) Interrupted() bool {
+	return ci.interrupted
+}
+
+//Ticks every device once, returns the vector of the first request in the order they were attached.
+func (b *bus) tick() (bool, uint16) {
+	request, vector := false, uint16(0)
+
+	for _, d := range b.devices {
+		if r, v := d.Tick(); r && !request {
+			request, vector = true, v
+		}
+	}
+
+	return request, vector
+}
+
+//Enters the handler of the vector in supervisor mode, the PC, mode and flags are saved for RTI.
+func (ci *ComputerInfo) interrupt(vector uint16) {
+	ci.saved = interruptState{pc: ci.regs.PC, user: ci.user, flags: ci.flags}
+	ci.interrupted = true
+
+	ci.user = false
+	ci.regs.PC = ci.memory[TrapTable + vector % TrapVectors]
+}
+
+//Returns from an interrupt handler, fails if no interrupt is being handled.
+func (ci *ComputerInfo) returnFromInterrupt() error {
+	if !ci.interrupted {
+		return errNotInterrupted
+	}
+
+	ci.regs.PC = ci.saved.pc
+	ci.user = ci.saved.user
+	ci.flags = ci.saved.flags
+	ci.interrupted = false
+
+	return nil
+}
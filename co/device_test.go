@@ -0,0 +1,289 @@
+package co
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//A device with one register that requests an interrupt on the given tick, and keeps requesting it until "ack" is
+//written.
+type testDevice struct {
+	base uint16
+	value uint16
+	reads int
+
+	ticks int
+	at int
+	vector uint16
+	ack bool
+}
+
+func (d *testDevice) Name() string {
+	return "test"
+}
+
+func (d *testDevice) Registers() (uint16, uint16) {
+	return d.base, 1
+}
+
+func (d *testDevice) Read(reg uint16) uint16 {
+	d.reads++
+	return d.value
+}
+
+func (d *testDevice) Write(reg uint16, value uint16) {
+	d.value = value
+	d.ack = true
+}
+
+func (d *testDevice) Peek(reg uint16) uint16 {
+	return d.value
+}
+
+func (d *testDevice) Tick() (bool, uint16) {
+	d.ticks++
+	return d.at > 0 && d.ticks >= d.at && !d.ack, d.vector
+}
+
+func TestDeviceRegisters(t *testing.T) {
+	for _, hooked := range []bool{false, true} {
+		ci := NewComputerInfo()
+		if hooked {
+			ci.AddHook(&NoHook{})
+		}
+
+		d := &testDevice{base: 0x100, value: 7}
+		if err := ci.Attach(d); err != nil {
+			t.Fatal(err)
+		}
+
+		ci.SetMemoryBlock(0x40, program(word(LD, 1, 0x100), imm(ADD, 1, 1), word(ST, 1, 0x100), imm(HLT, 0, 0)))
+		ci.SetRegisters(Registers{PC: 0x40}, Flags{})
+
+		if err, _, _ := ci.Run(10); err != nil {
+			t.Fatal(err)
+		}
+
+		//Peeking doesn't count as a read.
+		if d.value != 8 || d.reads != 1 || ci.GetMemoryCell(0x100) != 8 || d.reads != 1 {
+			t.Errorf("hooked=%v: device value %d after %d reads, want 8 after 1", hooked, d.value, d.reads)
+		}
+
+		//Instructions that halt aren't followed by a tick.
+		if d.ticks != 3 {
+			t.Errorf("hooked=%v: %d ticks, want 3", hooked, d.ticks)
+		}
+	}
+}
+
+func TestAttach(t *testing.T) {
+	ci := NewComputerInfo()
+	a := &testDevice{base: 0x100}
+
+	if err := ci.Attach(a); err != nil {
+		t.Fatal(err)
+	}
+	if err := ci.Attach(&testDevice{base: 0x100}); err == nil || !strings.Contains(err.Error(), "overlap") {
+		t.Errorf("got error %v attaching an overlapping device", err)
+	}
+	if err := ci.Attach(&testDevice{base: MemorySize}); err == nil || !strings.Contains(err.Error(), "don't fit") {
+		t.Errorf("got error %v attaching a device outside of memory", err)
+	}
+
+	if ci.DeviceAt(0x100) != a || ci.DeviceAt(0x101) != nil {
+		t.Errorf("the device isn't mapped at 0x0100 only")
+	}
+
+	if !ci.Detach(a) || ci.Detach(a) || ci.DeviceAt(0x100) != nil || len(ci.Devices()) != 0 {
+		t.Errorf("the device wasn't detached once")
+	}
+}
+
+func TestInterrupt(t *testing.T) {
+	for _, hooked := range []bool{false, true} {
+		ci := NewComputerInfo()
+		if hooked {
+			ci.AddHook(&NoHook{})
+		}
+
+		//Requests an interrupt after the second instruction, the handler acknowledges it.
+		d := &testDevice{base: 0x100, at: 2, vector: 3}
+		ci.Attach(d)
+
+		ci.SetMemoryCell(TrapTable + 3, 0x20)
+		ci.SetMemoryBlock(0x20, program(word(ST, 0, 0x100), imm(MOV, 2, 9), imm(RTI, 0, 0)))
+		ci.SetMemoryBlock(0x40, program(imm(MOV, 1, 0), imm(NOT, 3, 0), imm(ADD, 1, 1), imm(HLT, 0, 0)))
+		ci.SetRegisters(Registers{PC: 0x40}, Flags{})
+		ci.SetSupervisor(false)
+
+		ci.Step()
+		if r := ci.GetRegisters(); r.PC != 0x41 || ci.Interrupted() {
+			t.Fatalf("hooked=%v: interrupted after the first instruction, PC 0x%04X", hooked, r.PC)
+		}
+
+		//The interrupt is taken once the second instruction completes, in supervisor mode.
+		ci.Step()
+		if r := ci.GetRegisters(); r.PC != 0x20 || !ci.Interrupted() || !ci.Supervisor() {
+			t.Fatalf("hooked=%v: PC 0x%04X, interrupted %v, supervisor %v after the request", hooked, r.PC, ci.Interrupted(), ci.Supervisor())
+		}
+
+		//The handler changes the flags, RTI restores those of the interrupted program, its mode and PC.
+		for i := 0; i < 3; i++ {
+			if err, _ := ci.Step(); err != nil {
+				t.Fatalf("hooked=%v: %v", hooked, err)
+			}
+		}
+
+		r := ci.GetRegisters()
+		if r.PC != 0x42 || r.R2 != 9 || ci.Interrupted() || ci.Supervisor() {
+			t.Errorf("hooked=%v: registers %+v, interrupted %v, supervisor %v after RTI", hooked, r, ci.Interrupted(), ci.Supervisor())
+		}
+		if f := ci.GetFlags(); !f.N || f.P || f.Z {
+			t.Errorf("hooked=%v: flags %+v after RTI, want those set by NOT", hooked, f)
+		}
+
+		if err, _, _ := ci.Run(10); err != nil || ci.GetRegisters().R1 != 1 {
+			t.Errorf("hooked=%v: got %v and registers %+v after the program", hooked, err, ci.GetRegisters())
+		}
+	}
+}
+
+//While a handler runs further requests wait, they are taken after RTI.
+func TestPendingInterrupt(t *testing.T) {
+	ci := NewComputerInfo()
+
+	d := &testDevice{base: 0x100, at: 1, vector: 1}
+	ci.Attach(d)
+
+	ci.SetMemoryCell(TrapTable + 1, 0x20)
+	ci.SetMemoryBlock(0x20, program(imm(ADD, 2, 1), imm(NOP, 0, 0), imm(RTI, 0, 0)))
+	ci.SetMemoryBlock(0x40, program(imm(NOP, 0, 0), imm(NOP, 0, 0)))
+	ci.SetRegisters(Registers{PC: 0x40}, Flags{})
+
+	for i := 0; i < 4; i++ {
+		ci.Step()
+	}
+
+	//RTI returned to 0x41, but the device still requests the interrupt.
+	if r := ci.GetRegisters(); r.PC != 0x20 || r.R2 != 1 || !ci.Interrupted() {
+		t.Errorf("registers %+v, interrupted %v", r, ci.Interrupted())
+	}
+}
+
+func TestRTIWithoutInterrupt(t *testing.T) {
+	for _, hooked := range []bool{false, true} {
+		ci := NewComputerInfo()
+		if hooked {
+			ci.AddHook(&NoHook{})
+		}
+
+		ci.SetMemoryBlock(0x40, program(imm(RTI, 0, 0)))
+		ci.SetRegisters(Registers{PC: 0x40, R1: 3}, Flags{Z: true})
+
+		if err, _ := ci.Step(); err != errNotInterrupted {
+			t.Errorf("hooked=%v: got %v, want %v", hooked, err, errNotInterrupted)
+		}
+
+		if r := ci.GetRegisters(); r.PC != 0x40 || r.R1 != 3 || !ci.GetFlags().Z || !ci.Supervisor() {
+			t.Errorf("hooked=%v: state changed to %+v", hooked, r)
+		}
+	}
+}
+
+//Devices are ticked once per step of a system, not once per core, and interrupts go to the first core that can take
+//them whichever core ran the instruction.
+func TestMulticoreInterrupts(t *testing.T) {
+	tests := []struct {
+		name string
+		order []int
+		//Cores halted or handling an interrupt before the request.
+		halted []int
+		interrupted []int
+		want int
+	}{
+		{"first core", []int{0, 1, 2}, nil, nil, 0},
+		{"requested after another core", []int{1, 2, 1}, nil, nil, 0},
+		{"first core halted", []int{1, 2, 1}, []int{0}, nil, 1},
+		{"first core interrupted", []int{0, 1, 2}, nil, []int{0}, 1},
+		{"every core busy", []int{0, 1, 0}, []int{2}, []int{0, 1}, -1},
+	}
+
+	for _, tt := range tests {
+		ci := NewComputerInfo()
+		d := &testDevice{base: 0x100, at: 3, vector: 2}
+		ci.Attach(d)
+
+		ci.SetMemoryCell(TrapTable + 2, 0x20)
+		ci.SetMemoryBlock(0x40, program(imm(NOP, 0, 0), imm(NOP, 0, 0), imm(NOP, 0, 0)))
+
+		m := NewMulticore(ci)
+		m.SetCores(3)
+		for i := 0; i < 3; i++ {
+			m.Core(i).SetRegisters(Registers{PC: 0x40}, Flags{})
+		}
+		for _, i := range tt.halted {
+			m.halted[i] = true
+		}
+		for _, i := range tt.interrupted {
+			m.Core(i).interrupted = true
+		}
+
+		for _, i := range tt.order {
+			if err, _ := m.StepCore(i); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+		}
+
+		if d.ticks != 3 {
+			t.Errorf("%s: %d ticks after 3 steps", tt.name, d.ticks)
+		}
+
+		for i := 0; i < 3; i++ {
+			taken := m.Core(i).GetRegisters().PC == 0x20
+			if want := i == tt.want; taken != want {
+				t.Errorf("%s: core %d took the interrupt: %v, want %v", tt.name, i, taken, want)
+			}
+		}
+	}
+}
+
+//A single core system behaves as the core stepped on its own.
+func TestMulticoreTicksLikeStep(t *testing.T) {
+	var pcs [2][]uint16
+
+	for n, multicore := range []bool{false, true} {
+		ci := NewComputerInfo()
+		d := &testDevice{base: 0x100, at: 4, vector: 1}
+		ci.Attach(d)
+
+		ci.SetMemoryCell(TrapTable + 1, 0x20)
+		ci.SetMemoryBlock(0x20, program(word(ST, 0, 0x100), imm(RTI, 0, 0)))
+		ci.SetMemoryBlock(0x40, program(imm(NOP, 0, 0), imm(NOP, 0, 0), imm(NOP, 0, 0), imm(NOP, 0, 0), imm(NOP, 0, 0), imm(HLT, 0, 0)))
+		ci.SetRegisters(Registers{PC: 0x40}, Flags{})
+
+		m := NewMulticore(ci)
+		for i := 0; i < 10; i++ {
+			var err error
+			var running bool
+
+			if multicore {
+				err, _, running = m.Step()
+			} else {
+				err, running = ci.Step()
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			pcs[n] = append(pcs[n], ci.GetRegisters().PC)
+			if !running {
+				break
+			}
+		}
+	}
+
+	if !reflect.DeepEqual(pcs[0], pcs[1]) {
+		t.Errorf("PCs %04X stepping the core, %04X stepping the system", pcs[0], pcs[1])
+	}
+}
@@ -0,0 +1,147 @@
+package co
+
+import (
+	"slices"
+)
+
+//Observes the execution of a computer, hooks are registered with "AddHook". Methods are called in the goroutine that
+//executes the instruction, and must not execute instructions themselves. Embed "NoHook" to implement only some of them.
+type Hook interface {
+	//Called before and after each instruction, with the address it's at and its decoded form. Instructions executed from
+	//outside memory are reported at the PC.
+	BeforeInstruction(ci *ComputerInfo, pc uint16, ins Instruction)
+	AfterInstruction(ci *ComputerInfo, pc uint16, ins Instruction)
+
+	//Called when an instruction reads or writes a memory cell, instruction fetches aren't reported.
+	MemoryRead(ci *ComputerInfo, addr uint16, value uint16)
+	MemoryWrite(ci *ComputerInfo, addr uint16, old uint16, new uint16)
+
+	//Called when an instruction writes a general register, "reg" is its number.
+	RegisterWrite(ci *ComputerInfo, reg uint16, old uint16, new uint16)
+
+	//Called when the computer halts, and when an instruction fails.
+	Halt(ci *ComputerInfo, pc uint16)
+	Fault(ci *ComputerInfo, pc uint16, err error)
+}
+
+//A hook that ignores everything.
+type NoHook struct{}
+
+func (NoHook) BeforeInstruction(ci *ComputerInfo, pc uint16, ins Instruction) {}
+func (NoHook) AfterInstruction(ci *ComputerInfo, pc uint16, ins Instruction) {}
+func (NoHook) MemoryRead(ci *ComputerInfo, addr uint16, value uint16) {}
+func (NoHook) MemoryWrite(ci *ComputerInfo, addr uint16, old uint16, new uint16) {}
+func (NoHook) RegisterWrite(ci *ComputerInfo, reg uint16, old uint16, new uint16) {}
+func (NoHook) Halt(ci *ComputerInfo, pc uint16) {}
+func (NoHook) Fault(ci *ComputerInfo, pc uint16, err error) {}
+
+//Registers a hook, hooks are called in the order they were added.
+func (ci *ComputerInfo) AddHook(h Hook) {
+	ci.hooks = append(ci.hooks, h)
+}
+
+//Removes a hook, does nothing if it isn't registered. Hooks are compared with "==", so they should be pointers.
+func (ci *ComputerInfo) RemoveHook(h Hook) {
+	ci.hooks = slices.DeleteFunc(ci.hooks, func(e Hook) bool { return e == h })
+
+	//Without hooks execution takes the fast path again.
+	if len(ci.hooks) == 0 {
+		ci.hooks = nil
+	}
+}
+
+
+/*
+	HOOKED EXECUTION
+*/
+//Runs a decoded instruction through its handler, and reports it to the hooks.
+func (ci *ComputerInfo) runHooked(d *decoded, ins Instruction) (error, bool) {
+	pc := ci.regs.PC
+	before := ci.regs
+
+	for _, h := range ci.hooks {
+		h.BeforeInstruction(ci, pc, ins)
+	}
+
+	err, running := ci.runDecoded(d)
+	if err != nil {
+		for _, h := range ci.hooks {
+			h.Fault(ci, pc, err)
+		}
+
+		return err, running
+	}
+
+	for _, reg := range writtenRegisters(ins) {
+		old, new := *before.general(reg), *ci.regs.general(reg)
+
+		for _, h := range ci.hooks {
+			h.RegisterWrite(ci, reg, old, new)
+		}
+	}
+
+	for _, h := range ci.hooks {
+		h.AfterInstruction(ci, pc, ins)
+	}
+
+	if !running {
+		for _, h := range ci.hooks {
+			h.Halt(ci, pc)
+		}
+	}
+
+	return nil, running
+}
+
+//Returns the general registers an instruction writes.
+func writtenRegisters(ins Instruction) []uint16 {
+	switch {
+	case writesFirstRegister(ins.Opcode):
+		return []uint16{ins.Reg}
+	case ins.Opcode == JSR || ins.Opcode == TRAP:
+		return []uint16{7}
+	case ins.Opcode == CAS:
+		return []uint16{0}
+	}
+
+	return nil
+}
+
+//Reads a memory cell or device register for an instruction, fails if the protection doesn't allow it.
+func (ci *ComputerInfo) readMemory(addr uint16) (error, uint16) {
+	if err := ci.checkAccess(addr, ACCESS_READ); err != nil {
+		return err, 0
+	}
+
+	value := ci.memory[addr % MemorySize]
+	if d := ci.bus.mapped[addr % MemorySize]; d != nil {
+		base, _ := d.Registers()
+		value = d.Read(addr % MemorySize - base)
+	}
+
+	for _, h := range ci.hooks {
+		h.MemoryRead(ci, addr % MemorySize, value)
+	}
+
+	return nil, value
+}
+
+//Writes a memory cell or device register for an instruction, fails if the protection doesn't allow it.
+func (ci *ComputerInfo) writeMemory(addr uint16, value uint16) error {
+	if err := ci.checkAccess(addr, ACCESS_WRITE); err != nil {
+		return err
+	}
+
+	for _, h := range ci.hooks {
+		h.MemoryWrite(ci, addr % MemorySize, ci.GetMemoryCell(addr), value)
+	}
+
+	if d := ci.bus.mapped[addr % MemorySize]; d != nil {
+		base, _ := d.Registers()
+		d.Write(addr % MemorySize - base, value)
+		return nil
+	}
+
+	ci.SetMemoryCell(addr, value)
+	return nil
+}
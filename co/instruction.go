@@ -0,0 +1,73 @@
+package co
+
+//A decoded instruction, used by tools that need to inspect or generate machine code.
+type Instruction struct {
+	Opcode uint16
+
+	//First register, for JMP the condition flags.
+	Reg uint16
+
+	//Set if the operand is the register in "Operand".
+	RegisterMode bool
+
+	//Set if the operand is stored in the word following the instruction.
+	DoubleMode bool
+
+	Operand uint16
+}
+
+//Decodes the given word, "next" is the word following it, only used in double mode.
+func Decode(word uint16, next uint16) Instruction {
+	ins := Instruction{
+		Opcode: getInstruction(word),
+		Reg: getFirstRegister(word),
+	}
+
+	switch {
+	case getLowerByte(word) == DOUBLE_MODE:
+		ins.DoubleMode = true
+		ins.Operand = next
+	case getBit(word, 7):
+		ins.RegisterMode = true
+		ins.Operand = getSecondRegister(word)
+	default:
+		ins.Operand = getImmediate(word)
+	}
+
+	return ins
+}
+
+//Returns the instruction as machine code, one or two words long.
+func (ins Instruction) Encode() []uint16 {
+	word := (ins.Opcode << 11) & 0xF800 | (ins.Reg << 8) & 0x0700
+
+	switch {
+	case ins.DoubleMode:
+		return []uint16{word | DOUBLE_MODE, ins.Operand}
+	case ins.RegisterMode:
+		return []uint16{word | REGISTER_MODE | (ins.Operand & 0x0007)}
+	}
+
+	return []uint16{word | (ins.Operand & MaxImmediate)}
+}
+
+//Returns the amount of words the instruction takes, only instructions that take an operand use the following word.
+func (ins Instruction) Size() uint16 {
+	if ins.DoubleMode && takesOperand(ins.Opcode) {
+		return 2
+	}
+	return 1
+}
+
+//Returns the amount of words the instruction in the given word takes.
+func InstructionSize(word uint16) uint16 {
+	if getLowerByte(word) == DOUBLE_MODE && takesOperand(getInstruction(word)) {
+		return 2
+	}
+	return 1
+}
+
+//Returns true if the opcode exists.
+func ValidOpcode(op uint16) bool {
+	return int(op) < len(InstructionNames)
+}
@@ -0,0 +1,147 @@
+package co
+
+import (
+	"fmt"
+)
+
+//Memory is protected in pages of this many words.
+const PageSize = 64
+
+const Pages = MemorySize / PageSize
+
+//Access permissions of a page, a combination of PERM_READ, PERM_WRITE and PERM_EXECUTE.
+type Permission uint16
+
+const (
+	PERM_READ Permission = 1 << iota
+	PERM_WRITE
+	PERM_EXECUTE
+
+	PERM_ALL = PERM_READ | PERM_WRITE | PERM_EXECUTE
+)
+
+//Returns the permissions in "rwx" form, with a dash for each missing one.
+func (p Permission) String() string {
+	s := []byte("---")
+	for i, c := range "rwx" {
+		if p & (1 << i) != 0 {
+			s[i] = byte(c)
+		}
+	}
+
+	return string(s)
+}
+
+//Permissions of every page, the cores of a system share them like memory. Only user mode is restricted, supervisor
+//mode may access any page.
+type protectionTable [Pages]Permission
+
+//Returns a table that allows everything, so programs that don't use protection aren't affected by it.
+func newProtectionTable() *protectionTable {
+	t := &protectionTable{}
+	for i := range t {
+		t[i] = PERM_ALL
+	}
+
+	return t
+}
+
+//Returns the page the address is in.
+func PageOf(addr uint16) uint16 {
+	return (addr % MemorySize) / PageSize
+}
+
+//Kind of access that caused a protection fault.
+type AccessKind int
+
+const (
+	ACCESS_READ AccessKind = iota
+	ACCESS_WRITE
+	ACCESS_EXECUTE
+	//A privileged instruction in user mode, the address is the instruction's.
+	ACCESS_PRIVILEGED
+)
+
+//Returned by "Step" when an instruction breaks the protection in user mode. The instruction has no effect and the PC
+//stays at it.
+type ProtectionFault struct {
+	Addr uint16
+	Access AccessKind
+}
+
+func (f *ProtectionFault) Error() string {
+	switch f.Access {
+	case ACCESS_READ:
+		return fmt.Sprintf("Protection fault: read from 0x%04X in user mode", f.Addr)
+	case ACCESS_WRITE:
+		return fmt.Sprintf("Protection fault: write to 0x%04X in user mode", f.Addr)
+	case ACCESS_EXECUTE:
+		return fmt.Sprintf("Protection fault: execution at 0x%04X in user mode", f.Addr)
+	}
+
+	return fmt.Sprintf("Protection fault: privileged instruction at 0x%04X in user mode", f.Addr)
+}
+
+//Returns true for instructions that can only run in supervisor mode.
+func privileged(ins uint16) bool {
+	switch ins {
+	case SPP, GPP, USR, RTT, RTI:
+		return true
+	}
+
+	return false
+}
+
+
+/*
+	MODE AND PERMISSIONS
+*/
+//Returns true in supervisor mode, computers start in it.
+func (ci *ComputerInfo) Supervisor() bool {
+	return !ci.user
+}
+
+func (ci *ComputerInfo) SetSupervisor(supervisor bool) {
+	ci.user = !supervisor
+}
+
+func (ci *ComputerInfo) PagePermissions(page uint16) Permission {
+	return ci.protection[page % Pages]
+}
+
+func (ci *ComputerInfo) SetPagePermissions(page uint16, p Permission) {
+	ci.protection[page % Pages] = p & PERM_ALL
+}
+
+//Returns a fault if the current mode can't access the address in the given way.
+func (ci *ComputerInfo) checkAccess(addr uint16, access AccessKind) error {
+	if !ci.user {
+		return nil
+	}
+
+	need := []Permission{ACCESS_READ: PERM_READ, ACCESS_WRITE: PERM_WRITE, ACCESS_EXECUTE: PERM_EXECUTE}[access]
+	if ci.protection[PageOf(addr)] & need == 0 {
+		return &ProtectionFault{Addr: addr % MemorySize, Access: access}
+	}
+
+	return nil
+}
+
+//Returns a fault if the instruction at "pc", "size" words long, can't run in the current mode.
+func (ci *ComputerInfo) checkFetch(pc uint16, size uint16, ins uint16) error {
+	if !ci.user {
+		return nil
+	}
+
+	for i := uint16(0); i < size; i++ {
+		if err := ci.checkAccess(pc + i, ACCESS_EXECUTE); err != nil {
+			return err
+		}
+	}
+
+	if privileged(ins) {
+		return &ProtectionFault{Addr: pc % MemorySize, Access: ACCESS_PRIVILEGED}
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package co
+
+import (
+	"testing"
+)
+
+func TestProtectionFaults(t *testing.T) {
+	tests := []struct {
+		name string
+		//Permissions of pages 1, where the code is, and 2, where the data is.
+		code, data Permission
+		//Instruction at "pc".
+		pc uint16
+		ins Instruction
+		addr uint16
+		access AccessKind
+	}{
+		{"read", PERM_ALL, PERM_WRITE, 0x40, word(LD, 1, 0x80), 0x80, ACCESS_READ},
+		{"read through a register", PERM_ALL, PERM_WRITE | PERM_EXECUTE, 0x40, reg(LD, 1, 3), 0x83, ACCESS_READ},
+		{"write", PERM_ALL, PERM_READ, 0x40, word(ST, 1, 0x81), 0x81, ACCESS_WRITE},
+		//TAS reads the cell before writing it, neither takes place.
+		{"TAS write", PERM_ALL, PERM_READ, 0x40, reg(TAS, 1, 3), 0x83, ACCESS_WRITE},
+		{"CAS read", PERM_ALL, PERM_WRITE, 0x40, reg(CAS, 1, 3), 0x83, ACCESS_READ},
+		{"execute", PERM_READ | PERM_WRITE, PERM_ALL, 0x40, imm(NOP, 0, 0), 0x40, ACCESS_EXECUTE},
+		//The operand word is fetched too.
+		{"execute operand", PERM_ALL, PERM_READ, 0x7F, word(MOV, 1, 5), 0x80, ACCESS_EXECUTE},
+		{"SPP", PERM_ALL, PERM_ALL, 0x40, imm(SPP, 1, 2), 0x40, ACCESS_PRIVILEGED},
+		{"GPP", PERM_ALL, PERM_ALL, 0x40, imm(GPP, 1, 2), 0x40, ACCESS_PRIVILEGED},
+		{"USR", PERM_ALL, PERM_ALL, 0x40, imm(USR, 0, 0x50), 0x40, ACCESS_PRIVILEGED},
+		{"RTT", PERM_ALL, PERM_ALL, 0x40, imm(RTT, 0, 0), 0x40, ACCESS_PRIVILEGED},
+		{"RTI", PERM_ALL, PERM_ALL, 0x40, imm(RTI, 0, 0), 0x40, ACCESS_PRIVILEGED},
+	}
+
+	for _, tt := range tests {
+		for _, hooked := range []bool{false, true} {
+			ci := NewComputerInfo()
+			if hooked {
+				ci.AddHook(&NoHook{})
+			}
+
+			ci.SetMemoryBlock(tt.pc, tt.ins.Encode())
+			ci.SetMemoryBlock(0x80, []uint16{0x10, 0x11, 0x12, 0x13})
+			ci.SetPagePermissions(1, tt.code)
+			ci.SetPagePermissions(2, tt.data)
+
+			regs := Registers{R0: 0x13, R1: 0x1111, R3: 0x83, PC: tt.pc}
+			ci.SetRegisters(regs, Flags{P: true})
+			ci.SetSupervisor(false)
+			_, mem := ci.GetMemory(0, MemorySize)
+
+			err, running := ci.Step()
+
+			f, ok := err.(*ProtectionFault)
+			if !ok || !running {
+				t.Errorf("%s, hooked=%v: got %v, running %v, want a protection fault", tt.name, hooked, err, running)
+				continue
+			}
+			if f.Addr != tt.addr || f.Access != tt.access {
+				t.Errorf("%s, hooked=%v: fault %+v, want address 0x%04X and access %d", tt.name, hooked, f, tt.addr, tt.access)
+			}
+
+			//The instruction has no effect.
+			_, after := ci.GetMemory(0, MemorySize)
+			if ci.GetRegisters() != regs || ci.GetFlags() != (Flags{P: true}) || ci.Supervisor() {
+				t.Errorf("%s, hooked=%v: state changed to %+v %+v", tt.name, hooked, ci.GetRegisters(), ci.GetFlags())
+			}
+			for i := range mem {
+				if mem[i] != after[i] {
+					t.Errorf("%s, hooked=%v: memory at 0x%04X changed", tt.name, hooked, i)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestSupervisorIgnoresProtection(t *testing.T) {
+	ci := NewComputerInfo()
+	ci.SetMemoryBlock(0, program(
+		word(LD, 1, 0x80),
+		word(ST, 1, 0x81),
+		imm(MOV, 2, uint16(PERM_READ)),
+		imm(SPP, 2, 3),
+		imm(GPP, 3, 3),
+		imm(HLT, 0, 0),
+	))
+	ci.SetMemoryCell(0x80, 7)
+
+	for page := uint16(0); page < Pages; page++ {
+		ci.SetPagePermissions(page, 0)
+	}
+
+	err, _, running := ci.Run(10)
+	if err != nil || running {
+		t.Fatalf("got %v, running %v", err, running)
+	}
+
+	if r := ci.GetRegisters(); r.R1 != 7 || r.R3 != uint16(PERM_READ) || ci.GetMemoryCell(0x81) != 7 {
+		t.Errorf("registers %+v, memory 0x%04X", r, ci.GetMemoryCell(0x81))
+	}
+	if p := ci.PagePermissions(3); p != PERM_READ {
+		t.Errorf("page 3 has permissions %s", p)
+	}
+}
+
+func TestPermissionString(t *testing.T) {
+	tests := map[Permission]string{0: "---", PERM_READ: "r--", PERM_READ | PERM_EXECUTE: "r-x", PERM_ALL: "rwx"}
+
+	for p, want := range tests {
+		if p.String() != want {
+			t.Errorf("%d is %q, want %q", p, p.String(), want)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package co
+
+import (
+	"errors"
+	"fmt"
+)
+
+//Maximum amount of cores in a system.
+const MaxCores = 16
+
+//Picks the core that runs the next instruction. "runnable" holds the indexes of the cores that haven't halted, in
+//increasing order, it's never empty.
+type Scheduler interface {
+	Next(runnable []int) int
+
+	//Returns a copy that continues from the same point of the interleaving.
+	Clone() Scheduler
+}
+
+//A system of cores sharing one memory, the scheduler interleaves them one instruction at a time.
+type Multicore struct {
+	cores []*ComputerInfo
+	halted []bool
+
+	scheduler Scheduler
+}
+
+//Returns a system with a single core, "ci".
+func NewMulticore(ci *ComputerInfo) *Multicore {
+	return &Multicore{
+		cores: []*ComputerInfo{ci},
+		halted: []bool{false},
+		scheduler: &RoundRobin{},
+	}
+}
+
+//Returns an independent copy of the system, its cores share a copy of the memory and protection.
+func (m *Multicore) Clone() *Multicore {
+	first := m.cores[0].Clone()
+	c := &Multicore{cores: []*ComputerInfo{first}, halted: append([]bool(nil), m.halted...), scheduler: m.scheduler.Clone()}
+
+	for _, core := range m.cores[1:] {
+		clone := core.Clone()
+		clone.memory = first.memory
+		clone.cache = first.cache
+		clone.protection = first.protection
+		clone.bus = first.bus
+		c.cores = append(c.cores, clone)
+	}
+
+	return c
+}
+
+/*
+	CORES
+*/
+func (m *Multicore) Cores() int {
+	return len(m.cores)
+}
+
+//Returns the core with the given index, which must be valid.
+func (m *Multicore) Core(i int) *ComputerInfo {
+	return m.cores[i]
+}
+
+//Adds or removes cores until there are "n", new cores start with cleared registers and flags.
+func (m *Multicore) SetCores(n int) error {
+	if n < 1 || n > MaxCores {
+		return fmt.Errorf("The amount of cores must be between 1 and %d", MaxCores)
+	}
+
+	for len(m.cores) < n {
+		m.cores = append(m.cores, m.cores[0].NewCore())
+		m.halted = append(m.halted, false)
+	}
+
+	m.cores = m.cores[:n]
+	m.halted = m.halted[:n]
+
+	return nil
+}
+
+func (m *Multicore) Halted(i int) bool {
+	return m.halted[i]
+}
+
+//Returns true once every core has halted.
+func (m *Multicore) AllHalted() bool {
+	return len(m.runnable()) == 0
+}
+
+//Returns the indexes of the cores that haven't halted.
+func (m *Multicore) runnable() []int {
+	runnable := make([]int, 0, len(m.cores))
+	for i, h := range m.halted {
+		if !h {
+			runnable = append(runnable, i)
+		}
+	}
+
+	return runnable
+}
+
+
+/*
+	EXECUTION
+*/
+func (m *Multicore) SetScheduler(s Scheduler) {
+	m.scheduler = s
+}
+
+//Returns the core that runs the next instruction, or an error if every core halted.
+func (m *Multicore) NextCore() (error, int) {
+	runnable := m.runnable()
+	if len(runnable) == 0 {
+		return errors.New("Every core has halted"), 0
+	}
+
+	return nil, m.scheduler.Next(runnable)
+}
+
+//Runs an instruction in the core chosen by the scheduler. Returns the core and false once every core has halted.
+func (m *Multicore) Step() (error, int, bool) {
+	err, core := m.NextCore()
+	if err != nil {
+		return err, 0, false
+	}
+
+	err, _ = m.StepCore(core)
+	return err, core, !m.AllHalted()
+}
+
+//Runs an instruction in the given core, returns false if the core halted. Unless it fails or every core has halted the
+//devices are ticked afterwards, whichever core ran it.
+func (m *Multicore) StepCore(i int) (error, bool) {
+	if m.halted[i] {
+		return fmt.Errorf("Core %d has halted", i), false
+	}
+
+	err, run := m.cores[i].step()
+	m.halted[i] = !run
+
+	if err == nil && (run || !m.AllHalted()) {
+		m.tickDevices()
+	}
+
+	return err, run
+}
+
+//Ticks the devices, an interrupt they request is taken by the first core that is running and not handling another
+//one. Requests no core can take are repeated by the devices.
+func (m *Multicore) tickDevices() {
+	request, vector := m.cores[0].bus.tick()
+	if !request {
+		return
+	}
+
+	for i, core := range m.cores {
+		if !m.halted[i] && !core.interrupted {
+			core.interrupt(vector)
+			return
+		}
+	}
+}
+
+
+/*
+	SCHEDULERS
+*/
+//Runs the cores in turns, starting with the first one.
+type RoundRobin struct {
+	next int
+}
+
+func (s *RoundRobin) Next(runnable []int) int {
+	core := runnable[0]
+	for _, i := range runnable {
+		if i >= s.next {
+			core = i
+			break
+		}
+	}
+
+	s.next = core + 1
+	return core
+}
+
+func (s *RoundRobin) Clone() Scheduler {
+	c := *s
+	return &c
+}
+
+//Picks a core at random, the same seed always gives the same interleaving. Numbers come from SplitMix64, its whole state
+//is a single value so copies continue the same sequence.
+type RandomScheduler struct {
+	state uint64
+}
+
+func NewRandomScheduler(seed int64) *RandomScheduler {
+	return &RandomScheduler{state: uint64(seed)}
+}
+
+func (s *RandomScheduler) Next(runnable []int) int {
+	s.state += 0x9E3779B97F4A7C15
+
+	z := s.state
+	z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+	z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+	z ^= z >> 31
+
+	return runnable[z % uint64(len(runnable))]
+}
+
+func (s *RandomScheduler) Clone() Scheduler {
+	c := *s
+	return &c
+}
+
+//Runs the cores in the given order, which is repeated once it ends. Halted cores are skipped.
+type FixedSchedule struct {
+	order []int
+	pos int
+}
+
+func NewFixedSchedule(order []int) (error, *FixedSchedule) {
+	if len(order) == 0 {
+		return errors.New("The schedule is empty"), nil
+	}
+
+	for _, i := range order {
+		if i < 0 || i >= MaxCores {
+			return fmt.Errorf("Invalid core %d in the schedule", i), nil
+		}
+	}
+
+	//Copied, so the caller can reuse its slice.
+	return nil, &FixedSchedule{order: append([]int(nil), order...)}
+}
+
+func (s *FixedSchedule) Next(runnable []int) int {
+	for range s.order {
+		i := s.order[s.pos]
+		s.pos = (s.pos + 1) % len(s.order)
+
+		for _, r := range runnable {
+			if r == i {
+				return i
+			}
+		}
+	}
+
+	//None of the cores in the schedule can run.
+	return runnable[0]
+}
+
+func (s *FixedSchedule) Clone() Scheduler {
+	c := *s
+	return &c
+}
@@ -0,0 +1,152 @@
+package co
+
+import (
+	"reflect"
+	"testing"
+)
+
+//Address of the counter the programs increment, and of the lock protecting it.
+const (
+	counterAddr = 0x50
+	lockAddr = 0x51
+)
+
+var (
+	//Increments the counter without synchronization.
+	racyIncrement = program(
+		imm(LD, 1, counterAddr),
+		imm(ADD, 1, 1),
+		imm(ST, 1, counterAddr),
+		imm(HLT, 0, 0),
+	)
+
+	//Retries until CAS replaces the value it read.
+	casIncrement = program(
+		imm(LD, 0, counterAddr),
+		reg(MOV, 1, 0),
+		imm(ADD, 1, 1),
+		imm(CAS, 1, counterAddr),
+		imm(JMP, COND_N | COND_P, 0),
+		imm(HLT, 0, 0),
+	)
+
+	//Takes a spinlock with TAS around the increment.
+	tasIncrement = program(
+		imm(TAS, 2, lockAddr),
+		imm(JMP, COND_N | COND_P, 0),
+		imm(LD, 1, counterAddr),
+		imm(ADD, 1, 1),
+		imm(ST, 1, counterAddr),
+		imm(MOV, 2, 0),
+		imm(ST, 2, lockAddr),
+		imm(HLT, 0, 0),
+	)
+)
+
+//Runs the program on two cores with the given order until both halt. Returns the counter and the order the cores ran in.
+func runCores(t *testing.T, prog []uint16, order []int) (uint16, []int) {
+	t.Helper()
+
+	ci := NewComputerInfo()
+	if err := ci.SetMemoryBlock(0, prog); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewMulticore(ci)
+	if err := m.SetCores(2); err != nil {
+		t.Fatal(err)
+	}
+
+	err, s := NewFixedSchedule(order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SetScheduler(s)
+
+	var ran []int
+	for !m.AllHalted() {
+		if len(ran) > 1000 {
+			t.Fatal("The cores didn't halt")
+		}
+
+		err, core, _ := m.Step()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ran = append(ran, core)
+	}
+
+	return ci.GetMemoryCell(counterAddr), ran
+}
+
+func TestFixedScheduleAtomics(t *testing.T) {
+	tests := []struct {
+		name string
+		prog []uint16
+		order []int
+		want uint16
+		steps [2]int
+	}{
+		//Both cores load the counter before either stores it, so an increment is lost.
+		{"racy", racyIncrement, []int{0, 1}, 1, [2]int{4, 4}},
+		//One core at a time, nothing to race with.
+		{"racy sequential", racyIncrement, []int{0, 0, 0, 0, 1}, 2, [2]int{4, 4}},
+		//The second CAS fails once, and core 1 retries the whole loop.
+		{"cas", casIncrement, []int{0, 1}, 2, [2]int{6, 11}},
+		//Core 1 spins on the lock until core 0 releases it.
+		{"tas", tasIncrement, []int{0, 1}, 2, [2]int{8, 14}},
+		{"tas core 1 first", tasIncrement, []int{1, 0}, 2, [2]int{14, 8}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter, ran := runCores(t, tt.prog, tt.order)
+			if counter != tt.want {
+				t.Errorf("counter %d, want %d", counter, tt.want)
+			}
+
+			var steps [2]int
+			for _, core := range ran {
+				steps[core]++
+			}
+			if steps != tt.steps {
+				t.Errorf("cores ran %v instructions, want %v", steps, tt.steps)
+			}
+
+			//The same schedule always gives the same interleaving.
+			_, again := runCores(t, tt.prog, tt.order)
+			if !reflect.DeepEqual(ran, again) {
+				t.Errorf("interleaving changed between runs:\n%v\n%v", ran, again)
+			}
+		})
+	}
+}
+
+func TestFixedScheduleSkipsHaltedCores(t *testing.T) {
+	_, ran := runCores(t, racyIncrement, []int{1})
+
+	//Core 0 only runs once core 1 halted.
+	want := []int{1, 1, 1, 1, 0, 0, 0, 0}
+	if !reflect.DeepEqual(ran, want) {
+		t.Errorf("cores ran in order %v, want %v", ran, want)
+	}
+}
+
+func TestNewFixedScheduleErrors(t *testing.T) {
+	for _, order := range [][]int{nil, {0, -1}, {MaxCores}} {
+		if err, _ := NewFixedSchedule(order); err == nil {
+			t.Errorf("NewFixedSchedule(%v) succeeded", order)
+		}
+	}
+}
+
+//Changing the slice given to NewFixedSchedule doesn't change the schedule.
+func TestFixedScheduleCopiesOrder(t *testing.T) {
+	order := []int{0, 1}
+	_, s := NewFixedSchedule(order)
+	order[0] = 1
+
+	if got := []int{s.Next([]int{0, 1}), s.Next([]int{0, 1})}; !reflect.DeepEqual(got, []int{0, 1}) {
+		t.Errorf("cores %v, want [0 1]", got)
+	}
+}
@@ -0,0 +1,327 @@
+package co
+
+//An instruction decoded ahead of time. Entries are shared by the cores of a system, so registers are kept as numbers.
+type decoded struct {
+	valid bool
+
+	//Handler of the opcode, from "handlers".
+	exec func(ci *ComputerInfo, d *decoded) (error, bool)
+
+	//First register, for JMP the condition flags.
+	reg uint16
+
+	//Set if the operand is the register in "operand".
+	regMode bool
+	operand uint16
+
+	//Address of the following instruction.
+	next uint16
+
+	//Words taken by the instruction and its opcode, checked before running it in user mode.
+	size uint16
+	opcode uint16
+}
+
+//Decoded instructions, indexed by address. Writing a cell invalidates the instruction there and the one before it, which
+//may use the cell as its operand.
+type instructionCache [MemorySize]decoded
+
+//Handlers indexed by opcode, both execution paths run instructions through them. Invalid opcodes do nothing.
+var handlers = [32]func(ci *ComputerInfo, d *decoded) (error, bool){
+	LD: execLD,
+	ST: execST,
+	MOV: execMOV,
+	ADD: execADD,
+	MUL: execMUL,
+	AND: execAND,
+	NOT: execNOT,
+	OR: execOR,
+	SHL: execSHL,
+	SHR: execSHR,
+	JMP: execJMP,
+	JSR: execJSR,
+	RET: execRET,
+	NOP: execNOP,
+	HLT: execHLT,
+	CAS: execCAS,
+	TAS: execTAS,
+	SPP: execSPP,
+	GPP: execGPP,
+	USR: execUSR,
+	TRAP: execTRAP,
+	RTT: execRTT,
+	RTI: execRTI,
+}
+
+//Returns true for instructions that take an operand, only those use the word following them in double mode.
+func takesOperand(ins uint16) bool {
+	switch ins {
+	case NOT, RET, NOP, HLT, RTT, RTI:
+		return false
+	}
+
+	return ValidOpcode(ins)
+}
+
+//Invalidates the cached instructions that depend on the given cell.
+func (c *instructionCache) invalidate(addr uint16) {
+	c[addr % MemorySize].valid = false
+	c[(addr + MemorySize - 1) % MemorySize].valid = false
+}
+
+//Decodes the instruction at the given address into the cache.
+func (ci *ComputerInfo) predecode(addr uint16) *decoded {
+	d := &ci.cache[addr]
+	*d = decode(Decode(ci.memory[addr], ci.memory[(addr + 1) % MemorySize]), addr)
+
+	return d
+}
+
+//Returns the decoded form of an instruction at the given address.
+func decode(ins Instruction, addr uint16) decoded {
+	d := decoded{
+		valid: true,
+		exec: handlers[ins.Opcode],
+		reg: ins.Reg,
+		regMode: ins.RegisterMode,
+		operand: ins.Operand,
+		next: (addr + 1) % MemorySize,
+		size: 1,
+		opcode: ins.Opcode,
+	}
+
+	if d.exec == nil {
+		d.exec = execNOP
+	}
+
+	if takesOperand(ins.Opcode) && ins.DoubleMode {
+		d.next = (addr + 2) % MemorySize
+		d.size = 2
+	}
+
+	return d
+}
+
+//Runs the instruction at the PC from the cache.
+func (ci *ComputerInfo) stepCached() (error, bool) {
+	addr := ci.regs.PC % MemorySize
+
+	d := &ci.cache[addr]
+	if !d.valid {
+		d = ci.predecode(addr)
+	}
+
+	if ci.user {
+		if err := ci.checkFetch(addr, d.size, d.opcode); err != nil {
+			return err, true
+		}
+	}
+
+	return d.exec(ci, d)
+}
+
+//Runs up to "n" instructions, stopping early if the computer halts or an instruction fails. Returns the amount of
+//instructions run, a halt counts as one.
+func (ci *ComputerInfo) Run(n int) (error, int, bool) {
+	for i := 0; i < n; i++ {
+		err, running := ci.Step()
+		if err != nil || !running {
+			return err, i + 1, running
+		}
+	}
+
+	return nil, n, true
+}
+
+//Returns the register table of the computer, pointers to its general registers indexed by number.
+func (ci *ComputerInfo) registerTable() [8]*uint16 {
+	r := &ci.regs
+	return [8]*uint16{&r.R0, &r.R1, &r.R2, &r.R3, &r.R4, &r.R5, &r.R6, &r.R7}
+}
+
+//Returns the value of the operand.
+func (ci *ComputerInfo) operand(d *decoded) uint16 {
+	if d.regMode {
+		return *ci.gpr[d.operand]
+	}
+
+	return d.operand
+}
+
+
+/*
+	HANDLERS
+*/
+//Writes the first register and sets the flags from it, then moves to the next instruction.
+func (ci *ComputerInfo) result(d *decoded, value uint16) (error, bool) {
+	*ci.gpr[d.reg] = value
+	ci.setFlags(value)
+	ci.regs.PC = d.next
+
+	return nil, true
+}
+
+func execLD(ci *ComputerInfo, d *decoded) (error, bool) {
+	err, value := ci.readMemory(ci.operand(d))
+	if err != nil {
+		return err, true
+	}
+
+	return ci.result(d, value)
+}
+
+func execST(ci *ComputerInfo, d *decoded) (error, bool) {
+	if err := ci.writeMemory(ci.operand(d), *ci.gpr[d.reg]); err != nil {
+		return err, true
+	}
+	ci.regs.PC = d.next
+
+	return nil, true
+}
+
+func execMOV(ci *ComputerInfo, d *decoded) (error, bool) {
+	return ci.result(d, ci.operand(d))
+}
+
+func execADD(ci *ComputerInfo, d *decoded) (error, bool) {
+	return ci.result(d, *ci.gpr[d.reg] + ci.operand(d))
+}
+
+func execMUL(ci *ComputerInfo, d *decoded) (error, bool) {
+	return ci.result(d, *ci.gpr[d.reg] * ci.operand(d))
+}
+
+func execAND(ci *ComputerInfo, d *decoded) (error, bool) {
+	return ci.result(d, *ci.gpr[d.reg] & ci.operand(d))
+}
+
+func execNOT(ci *ComputerInfo, d *decoded) (error, bool) {
+	return ci.result(d, ^*ci.gpr[d.reg])
+}
+
+func execOR(ci *ComputerInfo, d *decoded) (error, bool) {
+	return ci.result(d, *ci.gpr[d.reg] | ci.operand(d))
+}
+
+func execSHL(ci *ComputerInfo, d *decoded) (error, bool) {
+	return ci.result(d, leftShift(*ci.gpr[d.reg], ci.operand(d)))
+}
+
+func execSHR(ci *ComputerInfo, d *decoded) (error, bool) {
+	return ci.result(d, rightShift(*ci.gpr[d.reg], ci.operand(d)))
+}
+
+func execJMP(ci *ComputerInfo, d *decoded) (error, bool) {
+	if d.regMode {
+		return errInvalidJMP, true
+	}
+
+	if jumpTaken(d.reg, ci.flags) {
+		ci.regs.PC = d.operand
+	} else {
+		ci.regs.PC = d.next
+	}
+
+	return nil, true
+}
+
+func execJSR(ci *ComputerInfo, d *decoded) (error, bool) {
+	if d.regMode {
+		return errInvalidJSR, true
+	}
+
+	ci.regs.R7 = d.next
+	ci.regs.PC = d.operand
+
+	return nil, true
+}
+
+func execRET(ci *ComputerInfo, d *decoded) (error, bool) {
+	ci.regs.PC = ci.regs.R7
+	return nil, true
+}
+
+func execNOP(ci *ComputerInfo, d *decoded) (error, bool) {
+	ci.regs.PC = d.next
+	return nil, true
+}
+
+func execHLT(ci *ComputerInfo, d *decoded) (error, bool) {
+	return nil, false
+}
+
+func execCAS(ci *ComputerInfo, d *decoded) (error, bool) {
+	addr := ci.operand(d)
+
+	err, old := ci.readMemory(addr)
+	if err != nil {
+		return err, true
+	}
+	expected := ci.regs.R0
+
+	if old == expected {
+		if err := ci.writeMemory(addr, *ci.gpr[d.reg]); err != nil {
+			return err, true
+		}
+	}
+
+	ci.regs.R0 = old
+	ci.setFlags(old - expected)
+	ci.regs.PC = d.next
+
+	return nil, true
+}
+
+func execTAS(ci *ComputerInfo, d *decoded) (error, bool) {
+	addr := ci.operand(d)
+
+	err, old := ci.readMemory(addr)
+	if err != nil {
+		return err, true
+	}
+
+	if err := ci.writeMemory(addr, 1); err != nil {
+		return err, true
+	}
+
+	return ci.result(d, old)
+}
+
+func execSPP(ci *ComputerInfo, d *decoded) (error, bool) {
+	ci.SetPagePermissions(ci.operand(d), Permission(*ci.gpr[d.reg]))
+	ci.regs.PC = d.next
+
+	return nil, true
+}
+
+func execGPP(ci *ComputerInfo, d *decoded) (error, bool) {
+	return ci.result(d, uint16(ci.PagePermissions(ci.operand(d))))
+}
+
+func execUSR(ci *ComputerInfo, d *decoded) (error, bool) {
+	if d.regMode {
+		return errInvalidUSR, true
+	}
+
+	ci.user = true
+	ci.regs.PC = d.operand
+
+	return nil, true
+}
+
+func execTRAP(ci *ComputerInfo, d *decoded) (error, bool) {
+	if d.regMode {
+		return errInvalidTRAP, true
+	}
+
+	return ci.trap(d.operand, d.next), true
+}
+
+func execRTT(ci *ComputerInfo, d *decoded) (error, bool) {
+	ci.returnFromTrap()
+	return nil, true
+}
+
+func execRTI(ci *ComputerInfo, d *decoded) (error, bool) {
+	return ci.returnFromInterrupt(), true
+}
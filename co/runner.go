@@ -0,0 +1,276 @@
+package co
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+//Maximum amount of instructions run while the state is locked, requests to access it wait at most this long.
+const runnerBatch = 1024
+
+//Size of the event channel, the runner waits when it's full.
+const runnerEvents = 64
+
+//Reason of the EVENT_PAUSED sent when "Pause" is called.
+var ErrPaused = errors.New("Paused")
+
+type EventKind int
+
+const (
+	//Execution paused, because of "Pause", because "StepN" finished, or because "Check" asked for it.
+	EVENT_PAUSED EventKind = iota
+	//A core reached a breakpoint.
+	EVENT_BREAKPOINT
+	//Every core halted.
+	EVENT_HALTED
+	//A core halted while others keep running, execution continues.
+	EVENT_CORE_HALTED
+	//An instruction failed.
+	EVENT_FAULT
+)
+
+//Sent by the runner when execution stops, and when a core halts.
+type Event struct {
+	Kind EventKind
+
+	//Core that ran the last instruction and its PC.
+	Core int
+	PC uint16
+
+	//Error of a fault, or the reason for a pause, may be nil.
+	Err error
+}
+
+//Returns true for the events that stop execution.
+func (e Event) Stopped() bool {
+	return e.Kind != EVENT_CORE_HALTED
+}
+
+//Runs a system in its own goroutine, execution is started with "Resume" or "StepN" and reported through "Events". The
+//state of the system must only be accessed through "Do" while the runner is running.
+//
+//The callbacks are optional and must be set before "Run" is called, they run in the runner's goroutine with the state
+//locked.
+type Runner struct {
+	cores *Multicore
+
+	//Picks the core that runs the next instruction, by default the scheduler of the system does. An error pauses
+	//execution with it as the reason, as does picking a core that doesn't exist or halted.
+	Pick func() (error, int)
+
+	//Called before each instruction with the core that runs it.
+	Before func(core int)
+
+	//Returns true if "pc" is a breakpoint for the core, checked after each instruction.
+	Breakpoint func(core int, pc uint16) bool
+
+	//Called after each instruction, returns true to pause execution, with an optional reason.
+	Check func(core int) (bool, error)
+
+	//Held while instructions run.
+	state sync.Mutex
+
+	//Guards "running", "steps" is only used by the runner's goroutine while running.
+	ctl sync.Mutex
+	wake *sync.Cond
+	running bool
+	steps int
+
+	pause atomic.Bool
+
+	events chan Event
+}
+
+func NewRunner(cores *Multicore) *Runner {
+	r := &Runner{cores: cores, events: make(chan Event, runnerEvents)}
+	r.wake = sync.NewCond(&r.ctl)
+
+	return r
+}
+
+//Returns the channel events are sent to, it must be drained for execution to go on.
+func (r *Runner) Events() <-chan Event {
+	return r.events
+}
+
+//Calls "fn" with the state locked, instructions don't run until it returns.
+func (r *Runner) Do(fn func(cores *Multicore)) {
+	r.state.Lock()
+	defer r.state.Unlock()
+
+	fn(r.cores)
+}
+
+func (r *Runner) Running() bool {
+	r.ctl.Lock()
+	defer r.ctl.Unlock()
+
+	return r.running
+}
+
+
+/*
+	CONTROL
+*/
+//Runs until a breakpoint, a halt, a fault or a pause.
+func (r *Runner) Resume() error {
+	return r.start(-1)
+}
+
+//Runs "n" instructions, execution may stop earlier like with "Resume".
+func (r *Runner) StepN(n int) error {
+	if n <= 0 {
+		return errors.New("The amount of steps must be positive")
+	}
+
+	return r.start(n)
+}
+
+func (r *Runner) start(steps int) error {
+	r.ctl.Lock()
+	defer r.ctl.Unlock()
+
+	if r.running {
+		return errors.New("Already running")
+	}
+
+	r.pause.Store(false)
+	r.steps = steps
+	r.running = true
+	r.wake.Broadcast()
+
+	return nil
+}
+
+//Asks the runner to pause, an EVENT_PAUSED is sent once it does. Does nothing if it isn't running.
+func (r *Runner) Pause() {
+	r.pause.Store(true)
+}
+
+
+/*
+	EXECUTION
+*/
+//Runs instructions as asked by "Resume" and "StepN" until the context is done, it's meant to run in its own goroutine.
+func (r *Runner) Run(ctx context.Context) error {
+	stop := context.AfterFunc(ctx, func() {
+		r.ctl.Lock()
+		r.wake.Broadcast()
+		r.ctl.Unlock()
+	})
+	defer stop()
+
+	for {
+		r.ctl.Lock()
+		for !r.running && ctx.Err() == nil {
+			r.wake.Wait()
+		}
+		r.ctl.Unlock()
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		//Events are sent with the state unlocked, so whoever receives them may access it.
+		for _, e := range r.runBatch() {
+			r.events <- e
+		}
+	}
+}
+
+//Runs instructions until execution stops or the batch ends, returns the events produced.
+func (r *Runner) runBatch() []Event {
+	r.state.Lock()
+	defer r.state.Unlock()
+
+	events := make([]Event, 0)
+
+	stop := func(e Event) []Event {
+		r.ctl.Lock()
+		r.running = false
+		r.ctl.Unlock()
+
+		return append(events, e)
+	}
+
+	for range runnerBatch {
+		if r.pause.Swap(false) {
+			return stop(Event{Kind: EVENT_PAUSED, Err: ErrPaused})
+		}
+
+		err, core := r.pick()
+		if err == nil {
+			err = r.checkPicked(core)
+		}
+		if err != nil {
+			return stop(Event{Kind: EVENT_PAUSED, Err: err})
+		}
+
+		if r.Before != nil {
+			r.Before(core)
+		}
+
+		err, run := r.cores.StepCore(core)
+		e := Event{Core: core, PC: r.cores.Core(core).GetRegisters().PC, Err: err}
+
+		switch {
+		case err != nil:
+			e.Kind = EVENT_FAULT
+			return stop(e)
+
+		case !run && r.cores.AllHalted():
+			e.Kind = EVENT_HALTED
+			return stop(e)
+
+		case !run:
+			events = append(events, Event{Kind: EVENT_CORE_HALTED, Core: core, PC: e.PC})
+		}
+
+		//Halted cores don't stop at breakpoints.
+		if run && r.Breakpoint != nil && r.Breakpoint(core, e.PC) {
+			e.Kind = EVENT_BREAKPOINT
+			return stop(e)
+		}
+
+		if r.Check != nil {
+			if pause, reason := r.Check(core); pause {
+				e.Kind, e.Err = EVENT_PAUSED, reason
+				return stop(e)
+			}
+		}
+
+		if r.steps > 0 {
+			r.steps--
+
+			if r.steps == 0 {
+				e.Kind = EVENT_PAUSED
+				return stop(e)
+			}
+		}
+	}
+
+	return events
+}
+
+func (r *Runner) pick() (error, int) {
+	if r.Pick != nil {
+		return r.Pick()
+	}
+
+	return r.cores.NextCore()
+}
+
+//Returns an error if the picked core can't run, because it doesn't exist or halted.
+func (r *Runner) checkPicked(core int) error {
+	if core < 0 || core >= r.cores.Cores() {
+		return fmt.Errorf("Invalid core %d", core)
+	}
+	if r.cores.Halted(core) {
+		return fmt.Errorf("Core %d has halted", core)
+	}
+
+	return nil
+}
@@ -0,0 +1,270 @@
+package co
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+//Counts in R1 forever.
+var countForever = program(
+	imm(ADD, 1, 1),
+	imm(JMP, COND_ALL, 0),
+)
+
+//Returns a runner for a system with the program loaded on "n" cores.
+func startRunner(t *testing.T, prog []uint16, n int) *Runner {
+	t.Helper()
+
+	ci := NewComputerInfo()
+	if err := ci.SetMemoryBlock(0, prog); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewMulticore(ci)
+	if err := m.SetCores(n); err != nil {
+		t.Fatal(err)
+	}
+
+	return NewRunner(m)
+}
+
+//Runs the runner in its own goroutine until the test ends.
+func run(t *testing.T, r *Runner) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+
+	go func() {
+		done <- r.Run(ctx)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; !errors.Is(err, context.Canceled) {
+			t.Errorf("Run returned %v, want context.Canceled", err)
+		}
+	})
+}
+
+//Waits for the next event.
+func nextEvent(t *testing.T, r *Runner) Event {
+	t.Helper()
+
+	select {
+	case e := <-r.Events():
+		return e
+	case <-time.After(10 * time.Second):
+		t.Fatal("No event received")
+	}
+
+	return Event{}
+}
+
+func TestRunnerStepN(t *testing.T) {
+	r := startRunner(t, countForever, 1)
+	run(t, r)
+
+	if err := r.StepN(0); err == nil {
+		t.Error("StepN(0) succeeded")
+	}
+
+	for i := 1; i <= 3; i++ {
+		if err := r.StepN(5); err != nil {
+			t.Fatal(err)
+		}
+
+		if e := nextEvent(t, r); e.Kind != EVENT_PAUSED || e.Err != nil {
+			t.Fatalf("got event %+v, want a pause", e)
+		}
+
+		r.Do(func(m *Multicore) {
+			//Every other instruction is the ADD.
+			if got, want := m.Core(0).GetRegisters().R1, uint16(5 * i + 1) / 2; got != want {
+				t.Errorf("R1 = %d after %d steps, want %d", got, 5 * i, want)
+			}
+		})
+	}
+}
+
+func TestRunnerPauseResume(t *testing.T) {
+	r := startRunner(t, countForever, 1)
+
+	//Only accessed with the state locked.
+	ran := 0
+	r.Before = func(core int) { ran++ }
+	run(t, r)
+
+	//Pausing a stopped runner does nothing.
+	r.Pause()
+
+	last := 0
+	for range 5 {
+		if err := r.Resume(); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Resume(); err == nil {
+			t.Error("Resuming a running runner succeeded")
+		}
+
+		//The state may be accessed, and changed, while running.
+		var wg sync.WaitGroup
+		for range 4 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				for range 50 {
+					r.Do(func(m *Multicore) {
+						m.Core(0).SetMemoryCell(0x100, m.Core(0).GetRegisters().R1)
+					})
+					r.Running()
+				}
+			}()
+		}
+		wg.Wait()
+
+		r.Pause()
+
+		e := nextEvent(t, r)
+		if e.Kind != EVENT_PAUSED || e.Err != ErrPaused {
+			t.Fatalf("got event %+v, want a pause", e)
+		}
+		if r.Running() {
+			t.Error("The runner is running after pausing")
+		}
+
+		//Execution goes on from where it paused.
+		r.Do(func(m *Multicore) {
+			if ran < last {
+				t.Errorf("instructions run went back from %d to %d", last, ran)
+			}
+			last = ran
+
+			//The ADD runs before the jump.
+			if r1, pc := m.Core(0).GetRegisters().R1, m.Core(0).GetRegisters().PC; r1 != uint16((ran + 1) / 2) || pc != uint16(ran % 2) {
+				t.Errorf("R1 = %d and PC = %d after %d instructions", r1, pc, ran)
+			}
+		})
+	}
+}
+
+func TestRunnerStops(t *testing.T) {
+	tests := []struct {
+		name string
+		prog []uint16
+		cores int
+		setup func(r *Runner)
+		want []EventKind
+		pc uint16
+	}{
+		{"halt", program(imm(NOP, 0, 0), imm(HLT, 0, 0)), 1, nil, []EventKind{EVENT_HALTED}, 1},
+		{"halt two cores", program(imm(NOP, 0, 0), imm(HLT, 0, 0)), 2, nil, []EventKind{EVENT_CORE_HALTED, EVENT_HALTED}, 1},
+		{"fault", program(imm(NOP, 0, 0), reg(JMP, COND_ALL, 0)), 1, nil, []EventKind{EVENT_FAULT}, 1},
+		{"breakpoint", countForever, 1, func(r *Runner) {
+			r.Breakpoint = func(core int, pc uint16) bool { return pc == 1 }
+		}, []EventKind{EVENT_BREAKPOINT}, 1},
+		{"check", countForever, 1, func(r *Runner) {
+			r.Check = func(core int) (bool, error) { return true, nil }
+		}, []EventKind{EVENT_PAUSED}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := startRunner(t, tt.prog, tt.cores)
+			if tt.setup != nil {
+				tt.setup(r)
+			}
+			run(t, r)
+
+			if err := r.Resume(); err != nil {
+				t.Fatal(err)
+			}
+
+			var e Event
+			for _, kind := range tt.want {
+				e = nextEvent(t, r)
+				if e.Kind != kind {
+					t.Fatalf("got event %+v, want kind %d", e, kind)
+				}
+			}
+
+			if !e.Stopped() || e.PC != tt.pc {
+				t.Errorf("last event %+v, want a stop at 0x%X", e, tt.pc)
+			}
+			if r.Running() {
+				t.Error("The runner is still running")
+			}
+		})
+	}
+}
+
+func TestRunnerPick(t *testing.T) {
+	r := startRunner(t, countForever, 2)
+
+	picked := 0
+	r.Pick = func() (error, int) {
+		if picked == 3 {
+			return errors.New("Done"), 0
+		}
+
+		picked++
+		return nil, 1
+	}
+	run(t, r)
+
+	if err := r.Resume(); err != nil {
+		t.Fatal(err)
+	}
+
+	e := nextEvent(t, r)
+	if e.Kind != EVENT_PAUSED || e.Err == nil || e.Err.Error() != "Done" {
+		t.Fatalf("got event %+v, want a pause with the error from Pick", e)
+	}
+
+	r.Do(func(m *Multicore) {
+		if pc0, pc1 := m.Core(0).GetRegisters().PC, m.Core(1).GetRegisters().PC; pc0 != 0 || pc1 != 1 {
+			t.Errorf("PCs 0x%X and 0x%X, want only core 1 to run", pc0, pc1)
+		}
+	})
+}
+
+//Picking a core that can't run pauses like an error from Pick, the core isn't stepped.
+func TestRunnerPickInvalidCore(t *testing.T) {
+	tests := []struct {
+		name string
+		core int
+		err string
+	}{
+		{"halted", 1, "Core 1 has halted"},
+		{"out of range", 2, "Invalid core 2"},
+		{"negative", -1, "Invalid core -1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := startRunner(t, countForever, 2)
+			r.Do(func(m *Multicore) {
+				m.halted[1] = true
+			})
+
+			r.Pick = func() (error, int) {
+				return nil, tt.core
+			}
+			run(t, r)
+
+			if err := r.Resume(); err != nil {
+				t.Fatal(err)
+			}
+
+			e := nextEvent(t, r)
+			if e.Kind != EVENT_PAUSED || e.Err == nil || e.Err.Error() != tt.err {
+				t.Fatalf("got event %+v, want a pause with %q", e, tt.err)
+			}
+			if r.Running() {
+				t.Error("The runner is still running")
+			}
+		})
+	}
+}
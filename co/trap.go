@@ -0,0 +1,38 @@
+package co
+
+import (
+	"fmt"
+)
+
+//Trap vectors are stored from this address on, "TRAP n" jumps to the address in word "TrapTable + n".
+const TrapTable = 0x0000
+
+const TrapVectors = 32
+
+//Set in the return address TRAP leaves in R7 if the trap came from user mode, RTT restores the mode from it. Addresses
+//never use this bit, so service routines that save R7 can make further calls and traps.
+const TRAP_USER_BIT = 0x8000
+
+//Enters the service routine of the vector in supervisor mode, "ret" is the address RTT returns to. The vector table is
+//read by the processor, so it's neither protected nor reported to hooks.
+func (ci *ComputerInfo) trap(vector uint16, ret uint16) error {
+	if vector >= TrapVectors {
+		return fmt.Errorf("Invalid trap vector: 0x%X", vector)
+	}
+
+	if ci.user {
+		ret |= TRAP_USER_BIT
+	}
+
+	ci.regs.R7 = ret
+	ci.user = false
+	ci.regs.PC = ci.memory[TrapTable + vector]
+
+	return nil
+}
+
+//Returns from a service routine to the address in R7, in the mode the trap came from.
+func (ci *ComputerInfo) returnFromTrap() {
+	ci.user = ci.regs.R7 & TRAP_USER_BIT != 0
+	ci.regs.PC = ci.regs.R7 &^ TRAP_USER_BIT
+}
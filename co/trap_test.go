@@ -0,0 +1,108 @@
+package co
+
+import (
+	"testing"
+)
+
+func TestTrap(t *testing.T) {
+	tests := []struct {
+		name string
+		user bool
+		ins Instruction
+		//R7 in the service routine.
+		ret uint16
+	}{
+		{"supervisor", false, imm(TRAP, 0, 2), 0x41},
+		{"user", true, imm(TRAP, 0, 2), 0x41 | TRAP_USER_BIT},
+		//The return address is after the operand word.
+		{"double mode", true, word(TRAP, 0, 2), 0x42 | TRAP_USER_BIT},
+	}
+
+	for _, tt := range tests {
+		for _, hooked := range []bool{false, true} {
+			ci := NewComputerInfo()
+			if hooked {
+				ci.AddHook(&NoHook{})
+			}
+
+			ci.SetMemoryCell(TrapTable + 2, 0x20)
+			ci.SetMemoryBlock(0x20, program(imm(MOV, 1, 5), imm(RTT, 0, 0)))
+			ci.SetMemoryBlock(0x40, append(tt.ins.Encode(), program(imm(HLT, 0, 0))...))
+			ci.SetRegisters(Registers{PC: 0x40}, Flags{})
+			ci.SetSupervisor(!tt.user)
+
+			if err, _ := ci.Step(); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+
+			if r := ci.GetRegisters(); r.PC != 0x20 || r.R7 != tt.ret || !ci.Supervisor() {
+				t.Errorf("%s, hooked=%v: registers %+v, supervisor %v after the trap", tt.name, hooked, r, ci.Supervisor())
+			}
+
+			//RTT returns after the TRAP in the mode it came from.
+			if err, _ := ci.Step(); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			if err, _ := ci.Step(); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+
+			if r := ci.GetRegisters(); r.PC != tt.ret &^ TRAP_USER_BIT || r.R1 != 5 || ci.Supervisor() == tt.user {
+				t.Errorf("%s, hooked=%v: registers %+v, supervisor %v after RTT", tt.name, hooked, r, ci.Supervisor())
+			}
+		}
+	}
+}
+
+//A service routine that saves R7 can make further calls, and RTT still restores user mode.
+func TestNestedCallInTrap(t *testing.T) {
+	ci := NewComputerInfo()
+	ci.SetMemoryCell(TrapTable + 1, 0x20)
+	ci.SetMemoryBlock(0x20, program(
+		word(ST, 7, 0x60),
+		imm(JSR, 0, 0x30),
+		word(LD, 7, 0x60),
+		imm(RTT, 0, 0),
+	))
+	ci.SetMemoryBlock(0x30, program(imm(ADD, 1, 1), imm(RET, 0, 0)))
+	ci.SetMemoryBlock(0x40, program(imm(TRAP, 0, 1), imm(NOT, 2, 0), imm(SPP, 0, 0)))
+	ci.SetRegisters(Registers{PC: 0x40}, Flags{})
+	ci.SetSupervisor(false)
+
+	//Back in user mode, the privileged instruction after the trap faults.
+	err, _, _ := ci.Run(20)
+	if f, ok := err.(*ProtectionFault); !ok || f.Access != ACCESS_PRIVILEGED || f.Addr != 0x42 {
+		t.Fatalf("got %v, want a privileged instruction fault at 0x0042", err)
+	}
+
+	if r := ci.GetRegisters(); r.R1 != 1 || r.R2 != 0xFFFF || r.R7 != 0x41 | TRAP_USER_BIT {
+		t.Errorf("registers %+v", r)
+	}
+}
+
+func TestTrapErrors(t *testing.T) {
+	tests := []struct {
+		ins Instruction
+		err string
+	}{
+		{imm(TRAP, 0, TrapVectors), "Invalid trap vector: 0x20"},
+		{reg(TRAP, 0, 1), errInvalidTRAP.Error()},
+	}
+
+	for _, tt := range tests {
+		ci := NewComputerInfo()
+		ci.SetMemoryBlock(0x40, tt.ins.Encode())
+		ci.SetRegisters(Registers{R7: 3, PC: 0x40}, Flags{})
+		ci.SetSupervisor(false)
+
+		err, running := ci.Step()
+		if err == nil || err.Error() != tt.err || !running {
+			t.Errorf("%+v: got %v, running %v, want %q", tt.ins, err, running, tt.err)
+		}
+
+		//The trap isn't taken.
+		if r := ci.GetRegisters(); r.PC != 0x40 || r.R7 != 3 || ci.Supervisor() {
+			t.Errorf("%+v: registers %+v, supervisor %v after the error", tt.ins, r, ci.Supervisor())
+		}
+	}
+}
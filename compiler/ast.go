@@ -0,0 +1,173 @@
+package compiler
+
+/*
+	EXPRESSIONS
+*/
+type Expr interface {
+	Position() Pos
+}
+
+type NumberExpr struct {
+	Pos Pos
+	Value int
+}
+
+//Evaluates to the address of the string, stored one character per word and zero terminated.
+type StringExpr struct {
+	Pos Pos
+	Value string
+}
+
+//A variable, arrays evaluate to their address.
+type VarExpr struct {
+	Pos Pos
+	Name string
+}
+
+type IndexExpr struct {
+	Pos Pos
+	Name string
+	Index Expr
+}
+
+type CallExpr struct {
+	Pos Pos
+	Name string
+	Args []Expr
+}
+
+type UnaryExpr struct {
+	Pos Pos
+	Op string
+	X Expr
+}
+
+type BinaryExpr struct {
+	Pos Pos
+	Op string
+	X, Y Expr
+}
+
+func (e *NumberExpr) Position() Pos { return e.Pos }
+func (e *StringExpr) Position() Pos { return e.Pos }
+func (e *VarExpr) Position() Pos { return e.Pos }
+func (e *IndexExpr) Position() Pos { return e.Pos }
+func (e *CallExpr) Position() Pos { return e.Pos }
+func (e *UnaryExpr) Position() Pos { return e.Pos }
+func (e *BinaryExpr) Position() Pos { return e.Pos }
+
+
+/*
+	STATEMENTS
+*/
+type Stmt interface {
+	Position() Pos
+}
+
+//Declares a local variable, "Size" is 0 for scalars.
+type VarDecl struct {
+	Pos Pos
+	Name string
+	Size int
+	Init Expr
+}
+
+//Assigns to a variable or an array element, "Target" is a "VarExpr" or an "IndexExpr".
+type AssignStmt struct {
+	Pos Pos
+	Target Expr
+	Value Expr
+}
+
+type ExprStmt struct {
+	Pos Pos
+	X Expr
+}
+
+type IfStmt struct {
+	Pos Pos
+	Cond Expr
+	Then Stmt
+	//Nil if there is no "else".
+	Else Stmt
+}
+
+type WhileStmt struct {
+	Pos Pos
+	Cond Expr
+	Body Stmt
+}
+
+type ReturnStmt struct {
+	Pos Pos
+	//Nil in functions returning void.
+	Value Expr
+}
+
+type BreakStmt struct {
+	Pos Pos
+}
+
+type ContinueStmt struct {
+	Pos Pos
+}
+
+type BlockStmt struct {
+	Pos Pos
+	Stmts []Stmt
+
+	//Position of the closing brace.
+	End Pos
+}
+
+func (s *VarDecl) Position() Pos { return s.Pos }
+func (s *AssignStmt) Position() Pos { return s.Pos }
+func (s *ExprStmt) Position() Pos { return s.Pos }
+func (s *IfStmt) Position() Pos { return s.Pos }
+func (s *WhileStmt) Position() Pos { return s.Pos }
+func (s *ReturnStmt) Position() Pos { return s.Pos }
+func (s *BreakStmt) Position() Pos { return s.Pos }
+func (s *ContinueStmt) Position() Pos { return s.Pos }
+func (s *BlockStmt) Position() Pos { return s.Pos }
+
+
+/*
+	DECLARATIONS
+*/
+//A global variable, arrays may be initialized with a list of constants or a string.
+type Global struct {
+	Pos Pos
+	Name string
+
+	IsArray bool
+	Size int
+	Init []int
+
+	Extern bool
+
+	//Static variables are not visible to other modules.
+	Static bool
+}
+
+type Param struct {
+	Name string
+	IsArray bool
+}
+
+type Function struct {
+	Pos Pos
+	Name string
+	Params []Param
+	Void bool
+
+	//Nil for declarations.
+	Body *BlockStmt
+
+	//Static functions are not visible to other modules.
+	Static bool
+}
+
+type Program struct {
+	Globals []*Global
+	Functions []*Function
+}
@@ -0,0 +1,970 @@
+package compiler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Tinch334/Computer-one-v2/asm"
+	"github.com/Tinch334/Computer-one-v2/co"
+)
+
+/*
+	Registers R0 to R4 hold temporaries, expressions are evaluated into R0 and deeper subexpressions use the following
+	registers. R5 is the frame pointer, R6 the stack pointer and R7 the return address. The stack grows down and the
+	stack pointer points to the last word pushed.
+
+	Arguments are pushed right to left and removed by the caller, the result is returned in R0. A function's frame looks
+	like this, from the frame pointer up:
+		locals			"frameSize" words
+		saved R5
+		saved R7
+		arguments		in order
+*/
+const (
+	maxTemps = 5
+	framePointer = "R5"
+	stackPointer = "R6"
+)
+
+//Generated labels are temporary, so they don't end up in the symbol map.
+const labelPrefix = asm.TemporaryPrefix
+
+//Symbol the startup code is placed at, it sets up the stack and calls "main".
+const startSymbol = "start"
+
+//A line of generated assembly and the source position it comes from.
+type asmLine struct {
+	text string
+	pos Pos
+
+	//Function the line belongs to, if any.
+	fn string
+}
+
+//Storage of a variable.
+const (
+	STORAGE_GLOBAL = iota
+	STORAGE_LOCAL
+)
+
+type variable struct {
+	name string
+	storage int
+
+	//Arrays evaluate to their address, array parameters hold the address of an array.
+	isArray bool
+	isParam bool
+
+	//Set for globals defined in other modules.
+	isExtern bool
+
+	//Offset from the frame pointer, for locals and parameters.
+	offset int
+}
+
+type loop struct {
+	breakLabel string
+	continueLabel string
+}
+
+//State for the function being generated.
+type funcState struct {
+	f *Function
+
+	scopes []map[string]*variable
+	loops []loop
+
+	frameSize int
+	nextOffset int
+
+	retLabel string
+}
+
+type generator struct {
+	prog *Program
+
+	globals map[string]*variable
+	funcs map[string]*Function
+
+	lines []asmLine
+	data []asmLine
+	pos Pos
+
+	labels int
+	fn *funcState
+
+	//Set when a runtime function is called.
+	usesRuntime bool
+
+	errs []error
+}
+
+//Reports an error, compiling continues so that several errors can be reported at once.
+func (g *generator) errorf(pos Pos, format string, args ...any) {
+	if len(g.errs) < maxErrors {
+		g.errs = append(g.errs, fmt.Errorf("%s: %s", pos, fmt.Sprintf(format, args...)))
+	}
+}
+
+func (g *generator) emit(format string, args ...any) {
+	line := asmLine{text: "\t" + fmt.Sprintf(format, args...), pos: g.pos}
+	if g.fn != nil {
+		line.fn = g.fn.f.Name
+	}
+
+	g.lines = append(g.lines, line)
+}
+
+//Places a label, a jump to it right before it is removed.
+func (g *generator) label(name string) {
+	if n := len(g.lines); n > 0 && g.lines[n - 1].text == "\tJMP " + name {
+		g.lines = g.lines[:n - 1]
+	}
+
+	g.lines = append(g.lines, asmLine{text: name + ":", pos: g.pos})
+}
+
+func (g *generator) newLabel() string {
+	g.labels++
+	return fmt.Sprintf("%s%d", labelPrefix, g.labels)
+}
+
+func reg(d int) string {
+	return fmt.Sprintf("R%d", d)
+}
+
+//Formats a value as the 16 bit word the instruction will use.
+func word(v int) string {
+	return fmt.Sprintf("0x%X", uint16(v))
+}
+
+func (g *generator) push(r string) {
+	g.emit("ADD %s, -1", stackPointer)
+	g.emit("ST %s, %s", r, stackPointer)
+}
+
+func (g *generator) pop(r string) {
+	g.emit("LD %s, %s", r, stackPointer)
+	g.emit("ADD %s, 1", stackPointer)
+}
+
+
+/*
+	DECLARATIONS
+*/
+//Generates the assembly for a program.
+func generate(prog *Program) (error, []asmLine) {
+	g := &generator{
+		prog: &Program{Globals: prog.Globals, Functions: prog.Functions},
+		globals: make(map[string]*variable),
+		funcs: make(map[string]*Function),
+	}
+
+	//The runtime is always declared, but only generated if it's used.
+	rt := runtimeProgram()
+	g.declare(prog)
+	g.declare(rt)
+
+	if len(g.errs) > 0 {
+		return errors.Join(g.errs...), nil
+	}
+
+	g.lines = append(g.lines, asmLine{text: ".section text"})
+
+	if main, ok := g.funcs["main"]; ok && main.Body != nil {
+		g.startup(main)
+	}
+
+	for _, f := range prog.Functions {
+		if f.Body != nil {
+			g.function(f)
+		}
+	}
+
+	if g.usesRuntime {
+		for _, f := range rt.Functions {
+			g.function(f)
+		}
+
+		g.prog.Globals = append(g.prog.Globals, rt.Globals...)
+		g.prog.Functions = append(g.prog.Functions, rt.Functions...)
+	}
+
+	g.globalData()
+
+	if len(g.errs) > 0 {
+		return errors.Join(g.errs...), nil
+	}
+
+	return nil, append(g.lines, g.data...)
+}
+
+//Returns an error if a global name can't be used as a symbol.
+func checkGlobalName(name string) error {
+	if len(name) == 2 && (name[0] == 'R' || name[0] == 'r') && name[1] >= '0' && name[1] <= '7' {
+		return fmt.Errorf("%s is a register name", name)
+	}
+
+	if name == startSymbol {
+		return fmt.Errorf("%s is reserved for the startup code", name)
+	}
+
+	return nil
+}
+
+//Collects all global variables and functions, so they may be used before they are defined.
+func (g *generator) declare(prog *Program) {
+	for _, v := range prog.Globals {
+		if err := checkGlobalName(v.Name); err != nil {
+			g.errorf(v.Pos, "%s", err)
+			continue
+		}
+
+		if _, ok := g.funcs[v.Name]; ok {
+			g.errorf(v.Pos, "%s is already declared as a function", v.Name)
+			continue
+		}
+
+		//A variable may be declared extern and defined in the same module.
+		if prev, ok := g.globals[v.Name]; ok {
+			if prev.isArray != v.IsArray || !(prev.isExtern || v.Extern) {
+				g.errorf(v.Pos, "%s is already declared", v.Name)
+			}
+
+			prev.isExtern = prev.isExtern && v.Extern
+			continue
+		}
+
+		g.globals[v.Name] = &variable{name: v.Name, storage: STORAGE_GLOBAL, isArray: v.IsArray, isExtern: v.Extern}
+	}
+
+	for _, f := range prog.Functions {
+		if err := checkGlobalName(f.Name); err != nil {
+			g.errorf(f.Pos, "%s", err)
+			continue
+		}
+
+		if _, ok := g.globals[f.Name]; ok {
+			g.errorf(f.Pos, "%s is already declared as a variable", f.Name)
+			continue
+		}
+
+		prev, ok := g.funcs[f.Name]
+		if !ok {
+			g.funcs[f.Name] = f
+			continue
+		}
+
+		if prev.Body != nil && f.Body != nil {
+			g.errorf(f.Pos, "function %s is already defined", f.Name)
+			continue
+		}
+
+		if len(prev.Params) != len(f.Params) || prev.Void != f.Void {
+			g.errorf(f.Pos, "declaration of %s doesn't match the previous one", f.Name)
+			continue
+		}
+
+		//Keep the definition, if there is one.
+		if f.Body != nil {
+			g.funcs[f.Name] = f
+		}
+	}
+}
+
+//Emits the code run at the entry point, it sets up the stack and calls "main".
+func (g *generator) startup(main *Function) {
+	g.pos = main.Pos
+
+	if len(main.Params) > 0 {
+		g.errorf(main.Pos, "main can't take parameters")
+	}
+
+	g.lines = append(g.lines, asmLine{text: ".global " + startSymbol})
+	g.lines = append(g.lines, asmLine{text: startSymbol + ":", pos: g.pos})
+	g.emit("MOV %s, %s", stackPointer, word(co.MemorySize))
+	g.emit("JSR main")
+	g.emit("HLT")
+}
+
+//Emits global variables to the data section, together with the import and export directives.
+func (g *generator) globalData() {
+	directives := make([]asmLine, 0)
+
+	for _, v := range g.prog.Globals {
+		if v.Extern {
+			continue
+		}
+
+		if !v.Static {
+			directives = append(directives, asmLine{text: ".global " + v.Name})
+		}
+		g.pos = v.Pos
+
+		words := make([]string, len(v.Init))
+		for i, w := range v.Init {
+			words[i] = word(w)
+		}
+
+		size := max(v.Size, 1)
+
+		if len(words) == 0 {
+			g.dataLine(v.Name + ": .fill " + strconv.Itoa(size))
+			continue
+		}
+
+		//Elements without an initializer are 0.
+		for len(words) < size {
+			words = append(words, "0")
+		}
+		g.dataLine(v.Name + ": .word " + strings.Join(words, ", "))
+	}
+
+	imported := make(map[string]bool)
+
+	for _, v := range g.prog.Globals {
+		if g.globals[v.Name].isExtern && !imported[v.Name] {
+			directives = append(directives, asmLine{text: ".extern " + v.Name})
+			imported[v.Name] = true
+		}
+	}
+
+	for _, f := range g.prog.Functions {
+		switch {
+		case f.Body != nil && !f.Static:
+			directives = append(directives, asmLine{text: ".global " + f.Name})
+
+		//Functions that are declared but not defined come from other modules.
+		case g.funcs[f.Name].Body == nil && !imported[f.Name]:
+			directives = append(directives, asmLine{text: ".extern " + f.Name})
+			imported[f.Name] = true
+		}
+	}
+
+	g.lines = append(directives, g.lines...)
+}
+
+func (g *generator) dataLine(text string) {
+	if len(g.data) == 0 {
+		g.data = append(g.data, asmLine{text: ".section data"})
+	}
+
+	g.data = append(g.data, asmLine{text: text, pos: g.pos})
+}
+
+
+/*
+	FUNCTIONS
+*/
+func (g *generator) function(f *Function) {
+	g.fn = &funcState{f: f, retLabel: g.newLabel()}
+	g.fn.frameSize = localsSize(f.Body)
+
+	params := make(map[string]*variable)
+	for i, p := range f.Params {
+		if _, ok := params[p.Name]; ok {
+			g.errorf(f.Pos, "parameter %s is repeated", p.Name)
+		}
+
+		params[p.Name] = &variable{
+			name: p.Name,
+			storage: STORAGE_LOCAL,
+			isArray: p.IsArray,
+			isParam: true,
+			offset: g.fn.frameSize + 2 + i,
+		}
+	}
+	g.fn.scopes = []map[string]*variable{params}
+
+	g.pos = f.Pos
+	g.lines = append(g.lines, asmLine{text: f.Name + ":", pos: g.pos})
+
+	//Prologue.
+	g.push("R7")
+	g.push(framePointer)
+	if g.fn.frameSize > 0 {
+		g.emit("ADD %s, %s", stackPointer, word(-g.fn.frameSize))
+	}
+	g.emit("MOV %s, %s", framePointer, stackPointer)
+
+	g.block(f.Body)
+
+	//Epilogue, it's attributed to the closing brace of the function.
+	g.pos = f.Body.End
+	g.label(g.fn.retLabel)
+	g.emit("MOV %s, %s", stackPointer, framePointer)
+	if g.fn.frameSize > 0 {
+		g.emit("ADD %s, %d", stackPointer, g.fn.frameSize)
+	}
+	g.pop(framePointer)
+	g.pop("R7")
+	g.emit("RET")
+
+	g.fn = nil
+}
+
+//Returns the amount of words used by all the local variables of a function, each variable gets its own slot.
+func localsSize(s Stmt) int {
+	switch s := s.(type) {
+	case *VarDecl:
+		return max(s.Size, 1)
+	case *BlockStmt:
+		size := 0
+		for _, st := range s.Stmts {
+			size += localsSize(st)
+		}
+		return size
+	case *IfStmt:
+		size := localsSize(s.Then)
+		if s.Else != nil {
+			size += localsSize(s.Else)
+		}
+		return size
+	case *WhileStmt:
+		return localsSize(s.Body)
+	}
+
+	return 0
+}
+
+func (g *generator) lookup(pos Pos, name string) *variable {
+	for i := len(g.fn.scopes) - 1; i >= 0; i-- {
+		if v, ok := g.fn.scopes[i][name]; ok {
+			return v
+		}
+	}
+
+	if v, ok := g.globals[name]; ok {
+		return v
+	}
+
+	if _, ok := g.funcs[name]; ok {
+		g.errorf(pos, "function %s used as a variable", name)
+	} else {
+		g.errorf(pos, "undefined variable %s", name)
+	}
+
+	return nil
+}
+
+
+/*
+	STATEMENTS
+*/
+func (g *generator) block(b *BlockStmt) {
+	g.fn.scopes = append(g.fn.scopes, make(map[string]*variable))
+
+	for _, s := range b.Stmts {
+		g.statement(s)
+	}
+
+	g.fn.scopes = g.fn.scopes[:len(g.fn.scopes) - 1]
+}
+
+func (g *generator) statement(s Stmt) {
+	g.pos = s.Position()
+
+	switch s := s.(type) {
+	case *BlockStmt:
+		g.block(s)
+
+	case *VarDecl:
+		scope := g.fn.scopes[len(g.fn.scopes) - 1]
+		if _, ok := scope[s.Name]; ok {
+			g.errorf(s.Pos, "%s is already declared in this block", s.Name)
+			return
+		}
+
+		v := &variable{name: s.Name, storage: STORAGE_LOCAL, isArray: s.Size > 0, offset: g.fn.nextOffset}
+		g.fn.nextOffset += max(s.Size, 1)
+		scope[s.Name] = v
+
+		if s.Init != nil {
+			g.expr(s.Init, 0)
+			g.store(v, 0)
+		}
+
+	case *AssignStmt:
+		g.expr(s.Value, 0)
+
+		switch target := s.Target.(type) {
+		case *VarExpr:
+			v := g.lookup(target.Pos, target.Name)
+			if v == nil {
+				return
+			}
+
+			if v.isArray && !v.isParam {
+				g.errorf(target.Pos, "can't assign to array %s", v.name)
+				return
+			}
+
+			g.store(v, 0)
+
+		case *IndexExpr:
+			g.elementAddr(target, 1)
+			g.emit("ST R0, R1")
+		}
+
+	case *ExprStmt:
+		//The result of a call may be discarded, even for functions returning void.
+		if call, ok := s.X.(*CallExpr); ok {
+			g.call(call, 0)
+		} else {
+			g.expr(s.X, 0)
+		}
+
+	case *IfStmt:
+		elseLabel := g.newLabel()
+		g.cond(s.Cond, 0, elseLabel, false)
+		g.statement(s.Then)
+
+		if s.Else == nil {
+			g.label(elseLabel)
+			return
+		}
+
+		endLabel := g.newLabel()
+		g.emit("JMP %s", endLabel)
+
+		g.pos = s.Else.Position()
+		g.label(elseLabel)
+		g.statement(s.Else)
+		g.label(endLabel)
+
+	case *WhileStmt:
+		l := loop{breakLabel: g.newLabel(), continueLabel: g.newLabel()}
+
+		g.label(l.continueLabel)
+		g.cond(s.Cond, 0, l.breakLabel, false)
+
+		g.fn.loops = append(g.fn.loops, l)
+		g.statement(s.Body)
+		g.fn.loops = g.fn.loops[:len(g.fn.loops) - 1]
+
+		g.pos = s.Pos
+		g.emit("JMP %s", l.continueLabel)
+		g.label(l.breakLabel)
+
+	case *ReturnStmt:
+		switch {
+		case s.Value != nil && g.fn.f.Void:
+			g.errorf(s.Pos, "void function %s can't return a value", g.fn.f.Name)
+		case s.Value == nil && !g.fn.f.Void:
+			g.errorf(s.Pos, "function %s must return a value", g.fn.f.Name)
+		case s.Value != nil:
+			g.expr(s.Value, 0)
+		}
+
+		g.emit("JMP %s", g.fn.retLabel)
+
+	case *BreakStmt:
+		if len(g.fn.loops) == 0 {
+			g.errorf(s.Pos, "break outside of a loop")
+			return
+		}
+
+		g.emit("JMP %s", g.fn.loops[len(g.fn.loops) - 1].breakLabel)
+
+	case *ContinueStmt:
+		if len(g.fn.loops) == 0 {
+			g.errorf(s.Pos, "continue outside of a loop")
+			return
+		}
+
+		g.emit("JMP %s", g.fn.loops[len(g.fn.loops) - 1].continueLabel)
+	}
+}
+
+//Stores the value in the given register into a scalar variable, the next register is used for the address.
+func (g *generator) store(v *variable, d int) {
+	if v.storage == STORAGE_GLOBAL {
+		g.emit("ST %s, %s", reg(d), v.name)
+		return
+	}
+
+	if v.offset == 0 {
+		g.emit("ST %s, %s", reg(d), framePointer)
+		return
+	}
+
+	g.localAddr(v, d + 1)
+	g.emit("ST %s, %s", reg(d), reg(d + 1))
+}
+
+
+/*
+	EXPRESSIONS
+*/
+//Returns false if the register can't be used, the error is reported at the given position.
+func (g *generator) checkDepth(pos Pos, d int) bool {
+	if d >= maxTemps {
+		g.errorf(pos, "expression too complex, split it using variables")
+		return false
+	}
+	return true
+}
+
+//Loads the address of a local variable.
+func (g *generator) localAddr(v *variable, d int) {
+	g.emit("MOV %s, %s", reg(d), framePointer)
+	if v.offset != 0 {
+		g.emit("ADD %s, %d", reg(d), v.offset)
+	}
+}
+
+//Loads the address of an array element.
+func (g *generator) elementAddr(e *IndexExpr, d int) {
+	if !g.checkDepth(e.Pos, d) {
+		return
+	}
+
+	v := g.lookup(e.Pos, e.Name)
+	if v == nil {
+		return
+	}
+
+	if !v.isArray {
+		g.errorf(e.Pos, "%s is not an array", e.Name)
+		return
+	}
+
+	g.load(v, d)
+
+	if err, index := constValue(e.Index); err == nil {
+		if index != 0 {
+			g.emit("ADD %s, %s", reg(d), word(index))
+		}
+		return
+	}
+
+	if g.checkDepth(e.Pos, d + 1) {
+		g.expr(e.Index, d + 1)
+		g.emit("ADD %s, %s", reg(d), reg(d + 1))
+	}
+}
+
+//Loads the value of a variable, arrays load their address.
+func (g *generator) load(v *variable, d int) {
+	switch {
+	case v.storage == STORAGE_GLOBAL && v.isArray:
+		g.emit("MOV %s, %s", reg(d), v.name)
+
+	case v.storage == STORAGE_GLOBAL:
+		g.emit("LD %s, %s", reg(d), v.name)
+
+	case v.isArray && !v.isParam:
+		g.localAddr(v, d)
+
+	case v.offset == 0:
+		g.emit("LD %s, %s", reg(d), framePointer)
+
+	default:
+		g.localAddr(v, d)
+		g.emit("LD %s, %s", reg(d), reg(d))
+	}
+}
+
+//Evaluates an expression into the given register. Returns true if the flags reflect the value when it's done.
+func (g *generator) expr(e Expr, d int) bool {
+	if !g.checkDepth(e.Position(), d) {
+		return false
+	}
+
+	if err, v := constValue(e); err == nil {
+		g.emit("MOV %s, %s", reg(d), word(v))
+		return true
+	}
+
+	switch e := e.(type) {
+	case *StringExpr:
+		label := g.newLabel()
+		g.dataLine(label + ": .string " + strconv.Quote(e.Value))
+		g.emit("MOV %s, %s", reg(d), label)
+
+	case *VarExpr:
+		if v := g.lookup(e.Pos, e.Name); v != nil {
+			g.load(v, d)
+		}
+
+	case *IndexExpr:
+		g.elementAddr(e, d)
+		g.emit("LD %s, %s", reg(d), reg(d))
+
+	case *CallExpr:
+		if f, ok := g.funcs[e.Name]; ok && f.Void {
+			g.errorf(e.Pos, "function %s doesn't return a value", e.Name)
+			return false
+		}
+
+		g.call(e, d)
+		return false
+
+	case *UnaryExpr:
+		switch e.Op {
+		case "-":
+			g.expr(e.X, d)
+			g.emit("NOT %s", reg(d))
+			g.emit("ADD %s, 1", reg(d))
+		case "~":
+			g.expr(e.X, d)
+			g.emit("NOT %s", reg(d))
+		case "!":
+			g.boolValue(e, d)
+		}
+
+	case *BinaryExpr:
+		switch e.Op {
+		case "==", "!=", "<", "<=", ">", ">=", "&&", "||":
+			g.boolValue(e, d)
+
+		case "/", "%":
+			name := divFunction
+			if e.Op == "%" {
+				name = modFunction
+			}
+
+			g.usesRuntime = true
+			g.call(&CallExpr{Pos: e.Pos, Name: name, Args: []Expr{e.X, e.Y}}, d)
+			return false
+
+		case "^":
+			//There's no XOR instruction, "x ^ y" is "(x | y) & ~(x & y)".
+			g.expr(e.X, d)
+			if g.checkDepth(e.Pos, d + 2) {
+				g.expr(e.Y, d + 1)
+				g.emit("MOV %s, %s", reg(d + 2), reg(d))
+				g.emit("AND %s, %s", reg(d + 2), reg(d + 1))
+				g.emit("NOT %s", reg(d + 2))
+				g.emit("OR %s, %s", reg(d), reg(d + 1))
+				g.emit("AND %s, %s", reg(d), reg(d + 2))
+			}
+
+		default:
+			g.arithmetic(e, d)
+		}
+	}
+
+	return true
+}
+
+var arithmeticInstructions = map[string]string{
+	"+": "ADD",
+	"*": "MUL",
+	"&": "AND",
+	"|": "OR",
+	"<<": "SHL",
+	">>": "SHR",
+}
+
+func (g *generator) arithmetic(e *BinaryExpr, d int) {
+	g.expr(e.X, d)
+
+	//Constants are used directly as operands.
+	if err, y := constValue(e.Y); err == nil {
+		if e.Op == "-" {
+			g.emit("ADD %s, %s", reg(d), word(-y))
+		} else {
+			g.emit("%s %s, %s", arithmeticInstructions[e.Op], reg(d), word(y))
+		}
+		return
+	}
+
+	if !g.checkDepth(e.Pos, d + 1) {
+		return
+	}
+
+	g.expr(e.Y, d + 1)
+
+	if e.Op == "-" {
+		//There's no subtraction, "x - y" is "x + ~y + 1".
+		g.emit("NOT %s", reg(d + 1))
+		g.emit("ADD %s, 1", reg(d + 1))
+		g.emit("ADD %s, %s", reg(d), reg(d + 1))
+		return
+	}
+
+	g.emit("%s %s, %s", arithmeticInstructions[e.Op], reg(d), reg(d + 1))
+}
+
+//Calls a function, registers in use are saved on the stack.
+func (g *generator) call(e *CallExpr, d int) {
+	f, ok := g.funcs[e.Name]
+	if !ok {
+		if _, isVar := g.globals[e.Name]; isVar {
+			g.errorf(e.Pos, "%s is not a function", e.Name)
+		} else {
+			g.errorf(e.Pos, "undefined function %s", e.Name)
+		}
+		return
+	}
+
+	if len(e.Args) != len(f.Params) {
+		g.errorf(e.Pos, "function %s expects %d arguments, got %d", e.Name, len(f.Params), len(e.Args))
+		return
+	}
+
+	for i := 0; i < d; i++ {
+		g.push(reg(i))
+	}
+
+	for i := len(e.Args) - 1; i >= 0; i-- {
+		g.expr(e.Args[i], 0)
+		g.push("R0")
+	}
+
+	g.emit("JSR %s", e.Name)
+
+	if len(e.Args) > 0 {
+		g.emit("ADD %s, %d", stackPointer, len(e.Args))
+	}
+
+	if d > 0 {
+		g.emit("MOV %s, R0", reg(d))
+	}
+
+	for i := d - 1; i >= 0; i-- {
+		g.pop(reg(i))
+	}
+}
+
+//Value of a condition, 1 if true and 0 otherwise.
+func (g *generator) boolValue(e Expr, d int) {
+	falseLabel := g.newLabel()
+	endLabel := g.newLabel()
+
+	g.cond(e, d, falseLabel, false)
+	g.emit("MOV %s, 1", reg(d))
+	g.emit("JMP %s", endLabel)
+	g.label(falseLabel)
+	g.emit("MOV %s, 0", reg(d))
+	g.label(endLabel)
+}
+
+//Jump conditions for each comparison, when it's true and when it's false. Comparisons subtract their operands, the
+//flags then reflect the difference. Ordered comparisons only subtract operands with the same sign, see "compare".
+var comparisonConds = map[string][2]string{
+	"==": {"Z", "NP"},
+	"!=": {"NP", "Z"},
+	"<": {"N", "PZ"},
+	"<=": {"NZ", "P"},
+	">": {"P", "NZ"},
+	">=": {"PZ", "N"},
+}
+
+//Jumps to the label if the condition's truth is "jumpIf", otherwise execution continues after the generated code.
+func (g *generator) cond(e Expr, d int, target string, jumpIf bool) {
+	if err, v := constValue(e); err == nil {
+		if (v != 0) == jumpIf {
+			g.emit("JMP %s", target)
+		}
+		return
+	}
+
+	switch e := e.(type) {
+	case *UnaryExpr:
+		if e.Op == "!" {
+			g.cond(e.X, d, target, !jumpIf)
+			return
+		}
+
+	case *BinaryExpr:
+		switch e.Op {
+		case "&&", "||":
+			//Jumping when "x && y" is true or "x || y" is false needs both operands.
+			if (e.Op == "&&") == jumpIf {
+				skip := g.newLabel()
+				g.cond(e.X, d, skip, !jumpIf)
+				g.cond(e.Y, d, target, jumpIf)
+				g.label(skip)
+			} else {
+				g.cond(e.X, d, target, jumpIf)
+				g.cond(e.Y, d, target, jumpIf)
+			}
+			return
+
+		case "==", "!=", "<", "<=", ">", ">=":
+			//Comparing with zero only needs the flags. Equality doesn't care if the difference overflows.
+			if err, y := constValue(e.Y); err == nil && y == 0 {
+				g.test(e.X, d)
+			} else if e.Op == "==" || e.Op == "!=" {
+				g.arithmetic(&BinaryExpr{Pos: e.Pos, Op: "-", X: e.X, Y: e.Y}, d)
+			} else {
+				g.compare(e, d, target, jumpIf)
+				return
+			}
+
+			conds := comparisonConds[e.Op]
+			if jumpIf {
+				g.emit("JMP %s, %s", conds[0], target)
+			} else {
+				g.emit("JMP %s, %s", conds[1], target)
+			}
+			return
+		}
+	}
+
+	g.test(e, d)
+	if jumpIf {
+		g.emit("JMP NP, %s", target)
+	} else {
+		g.emit("JMP Z, %s", target)
+	}
+}
+
+//Jumps to the label if the ordered comparison's truth is "jumpIf". The difference of operands with different signs may
+//not fit in 16 bits, but then the negative one is the smaller, so the signs are checked first and only operands with the
+//same sign are subtracted.
+func (g *generator) compare(e *BinaryExpr, d int, target string, jumpIf bool) {
+	g.expr(e.X, d)
+	if !g.checkDepth(e.Pos, d + 1) {
+		return
+	}
+	g.expr(e.Y, d + 1)
+
+	xNegative := g.newLabel()
+	subtract := g.newLabel()
+	end := g.newLabel()
+
+	//Where to go when the signs decide, x is less than y if it's the negative one.
+	less, greater := end, end
+	if (e.Op == "<" || e.Op == "<=") == jumpIf {
+		less = target
+	} else {
+		greater = target
+	}
+
+	g.emit("OR %s, 0", reg(d))
+	g.emit("JMP N, %s", xNegative)
+	g.emit("OR %s, 0", reg(d + 1))
+	g.emit("JMP N, %s", greater)
+	g.emit("JMP %s", subtract)
+
+	g.label(xNegative)
+	g.emit("OR %s, 0", reg(d + 1))
+	g.emit("JMP N, %s", subtract)
+	g.emit("JMP %s", less)
+
+	g.label(subtract)
+	g.emit("NOT %s", reg(d + 1))
+	g.emit("ADD %s, 1", reg(d + 1))
+	g.emit("ADD %s, %s", reg(d), reg(d + 1))
+
+	conds := comparisonConds[e.Op]
+	if jumpIf {
+		g.emit("JMP %s, %s", conds[0], target)
+	} else {
+		g.emit("JMP %s, %s", conds[1], target)
+	}
+
+	g.label(end)
+}
+
+//Evaluates an expression and makes sure the flags reflect its value.
+func (g *generator) test(e Expr, d int) {
+	if !g.expr(e, d) {
+		g.emit("OR %s, 0", reg(d))
+	}
+}
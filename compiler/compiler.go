@@ -0,0 +1,181 @@
+//Compiles a small C like language to the computer's instruction set.
+//
+//Programs are made of global variables and functions. The only type is the 16 bit integer, arrays of integers may be
+//declared with a constant size, array parameters are written "int a[]" and receive the array's address. Statements
+//are blocks, declarations, assignments, "if", "while", "break", "continue", "return" and function calls. Expressions
+//support the C arithmetic, bitwise, comparison and logical operators, with the same precedence. Division and modulo call
+//a runtime routine, that is added to the program only if it's needed.
+//
+//Comparisons are signed, right shifts are logical. Division rounds towards zero, dividing by zero doesn't fault: "x / 0"
+//is -1 for x >= 0 and 1 for x < 0, and "x % 0" is x. "-32768 / -1" is -32768.
+//
+//If "main" is defined, startup code is placed at "start", it sets up the stack and halts once "main" returns.
+package compiler
+
+import (
+	"os"
+	"strings"
+
+	"github.com/Tinch334/Computer-one-v2/asm"
+	"github.com/Tinch334/Computer-one-v2/link"
+	"github.com/Tinch334/Computer-one-v2/obj"
+	"github.com/Tinch334/Computer-one-v2/symbols"
+)
+
+//Extension of source files.
+const SourceExt = ".c1"
+
+//Maximum amount of errors reported before giving up.
+const maxErrors = 20
+
+//Returns the generated lines, and the source of every file they refer to.
+func compile(name string, src string) (error, []asmLine, map[string][]string) {
+	err, prog := parse(name, src)
+	if err != nil {
+		return err, nil, nil
+	}
+
+	err, lines := generate(prog)
+	if err != nil {
+		return err, nil, nil
+	}
+
+	sources := map[string][]string{
+		name: strings.Split(src, "\n"),
+		runtimeFile: strings.Split(runtimeSource, "\n"),
+	}
+
+	return nil, lines, sources
+}
+
+//Renders the generated lines as assembly, each source line is added as a comment before the code generated for it.
+//Returns the text and the generated line each line of the text comes from, -1 for comments.
+func render(lines []asmLine, sources map[string][]string) (string, []int) {
+	var b strings.Builder
+	origins := make([]int, 0, len(lines))
+	last := Pos{}
+
+	for i, l := range lines {
+		if l.pos.Line > 0 && (l.pos.File != last.File || l.pos.Line != last.Line) {
+			last = l.pos
+			b.WriteString("\n; " + sourceText(sources, l.pos) + "\n")
+			origins = append(origins, -1, -1)
+		}
+
+		b.WriteString(l.text + "\n")
+		origins = append(origins, i)
+	}
+
+	return b.String(), origins
+}
+
+//Returns the source line at the given position, without surrounding spaces.
+func sourceText(sources map[string][]string, p Pos) string {
+	lines := sources[p.File]
+	if p.Line < 1 || p.Line > len(lines) {
+		return ""
+	}
+
+	return strings.TrimSpace(lines[p.Line - 1])
+}
+
+//Compiles source code into assembly, "name" is used in error messages.
+func CompileString(name string, src string) (error, string) {
+	err, lines, sources := compile(name, src)
+	if err != nil {
+		return err, ""
+	}
+
+	text, _ := render(lines, sources)
+	return nil, text
+}
+
+//Compiles the given file into a relocatable object.
+func CompileObjectFile(path string) (error, *obj.Object) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return err, nil
+	}
+
+	return CompileObjectString(path, string(src))
+}
+
+//Compiles source code into a relocatable object, its line records point to the source instead of the generated
+//assembly, so they work as a source map.
+func CompileObjectString(name string, src string) (error, *obj.Object) {
+	err, lines, sources := compile(name, src)
+	if err != nil {
+		return err, nil
+	}
+
+	text, origins := render(lines, sources)
+
+	err, o := asm.AssembleObjectString(name, text)
+	if err != nil {
+		return err, nil
+	}
+
+	markFunctions(o, lines, origins)
+	o.Lines = mapLines(o.Lines, lines, origins, sources)
+
+	return nil, o
+}
+
+//Compiles and links a single file with the default layout.
+func CompileFile(path string) (error, *link.Image) {
+	err, o := CompileObjectFile(path)
+	if err != nil {
+		return err, nil
+	}
+
+	return link.Link([]*obj.Object{o}, nil)
+}
+
+//Replaces the assembly line records with the source lines they were generated from, merging consecutive records of
+//the same line.
+func mapLines(asmLines []obj.Line, lines []asmLine, origins []int, sources map[string][]string) []obj.Line {
+	mapped := make([]obj.Line, 0, len(asmLines))
+
+	for _, l := range asmLines {
+		pos := lines[origins[l.Line - 1]].pos
+
+		if n := len(mapped); n > 0 {
+			prev := &mapped[n - 1]
+
+			if prev.Section == l.Section && prev.File == pos.File && prev.Line == pos.Line && prev.Offset + prev.Size == l.Offset {
+				prev.Size += l.Size
+				continue
+			}
+		}
+
+		mapped = append(mapped, obj.Line{
+			Section: l.Section,
+			Offset: l.Offset,
+			Size: l.Size,
+			File: pos.File,
+			Line: pos.Line,
+			Text: sourceText(sources, pos),
+		})
+	}
+
+	return mapped
+}
+
+//Marks functions as such and sets their size, the assembler only knows about labels. Must be called before the line
+//records are mapped to the source.
+func markFunctions(o *obj.Object, lines []asmLine, origins []int) {
+	sizes := make(map[string]uint16)
+
+	for _, l := range o.Lines {
+		if fn := lines[origins[l.Line - 1]].fn; fn != "" {
+			sizes[fn] += l.Size
+		}
+	}
+
+	for i, s := range o.Symbols {
+		if size, ok := sizes[s.Name]; ok {
+			o.Symbols[i].Kind = symbols.KIND_FUNC
+			o.Symbols[i].Size = size
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Tinch334/Computer-one-v2/co"
+	"github.com/Tinch334/Computer-one-v2/link"
+	"github.com/Tinch334/Computer-one-v2/obj"
+)
+
+//Compiles and runs a program until it halts, returns the computer and the image.
+func runProgram(t *testing.T, src string) (*co.ComputerInfo, *link.Image) {
+	t.Helper()
+
+	err, o := CompileObjectString("test.c1", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err, img := link.Link([]*obj.Object{o}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ci := co.NewComputerInfo()
+	if err := img.Load(ci); err != nil {
+		t.Fatal(err)
+	}
+
+	regs := ci.GetRegisters()
+	regs.PC = img.Entry
+	ci.SetRegisters(regs, ci.GetFlags())
+
+	err, _, running := ci.Run(1000000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if running {
+		t.Fatal("The program didn't halt")
+	}
+
+	return ci, img
+}
+
+//Returns "n" words of memory starting at the symbol.
+func readArray(t *testing.T, ci *co.ComputerInfo, img *link.Image, name string, n int) []int16 {
+	t.Helper()
+
+	s, ok := img.Symbols.Lookup(name)
+	if !ok {
+		t.Fatalf("Symbol %s not found", name)
+	}
+
+	values := make([]int16, n)
+	for i := range values {
+		values[i] = int16(ci.GetMemoryCell(s.Addr + uint16(i)))
+	}
+
+	return values
+}
+
+func list(values []int) string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = fmt.Sprint(v)
+	}
+
+	return strings.Join(s, ", ")
+}
+
+func TestProgram(t *testing.T) {
+	src := `
+int table[5] = {1, 2, 3};
+int result[6];
+
+int fact(int n) {
+	if (n <= 1)
+		return 1;
+	return n * fact(n - 1);
+}
+
+int sum(int a[], int n) {
+	int s = 0, i = 0;
+	while (i < n) {
+		s = s + a[i];
+		i = i + 1;
+	}
+	return s;
+}
+
+int main() {
+	int x = fact(5);
+	result[0] = x;
+	result[1] = sum(table, 5);
+	result[2] = x ^ 0xFF;
+	result[3] = (x > 100 && x < 200) + (x == 120) * 2 + !(x != 120) * 4;
+	result[4] = -x >> 12;
+	result[5] = ~x << 2;
+	return 0;
+}
+`
+	ci, img := runProgram(t, src)
+
+	want := []int16{120, 6, 120 ^ 0xFF, 7, int16(uint16(0x10000 - 120) >> 12), ^120 << 2}
+	got := readArray(t, ci, img, "result", len(want))
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("result[%d] = %d, want %d", i, got[i], want[i])
+		}
+	}
+}
+
+func TestSignedComparisons(t *testing.T) {
+	values := []int{-32767, -30000, -1, 0, 1, 30000, 32767}
+
+	var xs, ys []int
+	for _, x := range values {
+		for _, y := range values {
+			xs = append(xs, x)
+			ys = append(ys, y)
+		}
+	}
+	n := len(xs)
+
+	ops := []string{"<", "<=", ">", ">=", "==", "!="}
+
+	//Every comparison is used as a value, in the low byte of the result, and as a condition, in the high byte.
+	var body strings.Builder
+	for i, op := range ops {
+		fmt.Fprintf(&body, "\t\tr = r | ((xs[i] %s ys[i]) << %d);\n", op, i)
+		fmt.Fprintf(&body, "\t\tif (xs[i] %s ys[i]) r = r | %d;\n", op, 0x100 << i)
+	}
+
+	src := fmt.Sprintf(`
+int xs[%[1]d] = {%[2]s};
+int ys[%[1]d] = {%[3]s};
+int result[%[1]d];
+
+int main() {
+	int i = 0, r = 0;
+	while (i < %[1]d) {
+		r = 0;
+%[4]s		result[i] = r;
+		i = i + 1;
+	}
+	return 0;
+}
+`, n, list(xs), list(ys), body.String())
+
+	ci, img := runProgram(t, src)
+	result := readArray(t, ci, img, "result", n)
+
+	compare := map[string]func(x, y int) bool{
+		"<": func(x, y int) bool { return x < y },
+		"<=": func(x, y int) bool { return x <= y },
+		">": func(x, y int) bool { return x > y },
+		">=": func(x, y int) bool { return x >= y },
+		"==": func(x, y int) bool { return x == y },
+		"!=": func(x, y int) bool { return x != y },
+	}
+
+	for j := 0; j < n; j++ {
+		for i, op := range ops {
+			want := compare[op](xs[j], ys[j])
+
+			if (result[j] >> i & 1 != 0) != want {
+				t.Errorf("%d %s %d = %v, want %v", xs[j], op, ys[j], !want, want)
+			}
+			if (result[j] >> (8 + i) & 1 != 0) != want {
+				t.Errorf("if (%d %s %d) took the wrong branch", xs[j], op, ys[j])
+			}
+		}
+	}
+}
+
+func TestConstantComparisons(t *testing.T) {
+	src := `
+int result[4];
+
+int main() {
+	int x = -20000;
+	result[0] = x < 20000;
+	result[1] = 30000 > x;
+	result[2] = x >= 0;
+	result[3] = x > -32767;
+	return 0;
+}
+`
+	ci, img := runProgram(t, src)
+
+	want := []int16{1, 1, 0, 1}
+	got := readArray(t, ci, img, "result", len(want))
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("result[%d] = %d, want %d", i, got[i], want[i])
+		}
+	}
+}
+
+func TestDivision(t *testing.T) {
+	tests := []struct {
+		x, y int
+		q, r int16
+	}{
+		{100, 7, 14, 2},
+		{-100, 7, -14, -2},
+		{100, -7, -14, 2},
+		{-100, -7, 14, -2},
+		{32767, 1, 32767, 0},
+		{-32767, 32767, -1, 0},
+		{5, -32767, 0, 5},
+		//Division by zero and the quotient that doesn't fit, as documented.
+		{7, 0, -1, 7},
+		{-7, 0, 1, -7},
+		{0, 0, -1, 0},
+	}
+
+	var xs, ys []int
+	for _, tt := range tests {
+		xs = append(xs, tt.x)
+		ys = append(ys, tt.y)
+	}
+
+	src := fmt.Sprintf(`
+int xs[%[1]d] = {%[2]s};
+int ys[%[1]d] = {%[3]s};
+int q[%[1]d];
+int r[%[1]d];
+
+int main() {
+	int i = 0;
+	while (i < %[1]d) {
+		q[i] = xs[i] / ys[i];
+		r[i] = xs[i] %% ys[i];
+		i = i + 1;
+	}
+	return 0;
+}
+`, len(tests), list(xs), list(ys))
+
+	ci, img := runProgram(t, src)
+	q := readArray(t, ci, img, "q", len(tests))
+	r := readArray(t, ci, img, "r", len(tests))
+
+	for i, tt := range tests {
+		if q[i] != tt.q || r[i] != tt.r {
+			t.Errorf("%d / %d = %d rem %d, want %d rem %d", tt.x, tt.y, q[i], r[i], tt.q, tt.r)
+		}
+	}
+}
+
+func TestDivisionOfMinimum(t *testing.T) {
+	src := `
+int result[4];
+
+int main() {
+	int min = -32767 - 1;
+	result[0] = min / 1;
+	result[1] = min / -1;
+	result[2] = min / min;
+	result[3] = 1000 / min;
+	return 0;
+}
+`
+	ci, img := runProgram(t, src)
+
+	want := []int16{-32768, -32768, 1, 0}
+	got := readArray(t, ci, img, "result", len(want))
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("result[%d] = %d, want %d", i, got[i], want[i])
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		err string
+	}{
+		{"int main() { return x; }", "x"},
+		{"int main() { f(); return 0; }", "undefined function f"},
+		{"int f(int a) { return a; } int main() { return f(); }", "expects 1 arguments"},
+	}
+
+	for _, tt := range tests {
+		err, _ := CompileString("test.c1", tt.src)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("compiling %q: got error %v, want one containing %q", tt.src, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package compiler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//Position in a source file, lines and columns start at 1.
+type Pos struct {
+	File string
+	Line int
+	Col int
+}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Col)
+}
+
+//Token kinds.
+const (
+	TOKEN_EOF = iota
+	TOKEN_IDENT
+	TOKEN_NUMBER
+	TOKEN_STRING
+	TOKEN_KEYWORD
+	TOKEN_PUNCT
+)
+
+type token struct {
+	kind int
+	text string
+	pos Pos
+
+	//Value of numbers and character literals, contents of strings.
+	value int
+	str string
+}
+
+func (t token) String() string {
+	if t.kind == TOKEN_EOF {
+		return "end of file"
+	}
+	return strconv.Quote(t.text)
+}
+
+var keywords = map[string]bool{
+	"int": true,
+	"void": true,
+	"if": true,
+	"else": true,
+	"while": true,
+	"return": true,
+	"break": true,
+	"continue": true,
+	"extern": true,
+}
+
+//Punctuation, longest first so that "<<" is not read as two "<".
+var punctuation = []string{
+	"<<", ">>", "<=", ">=", "==", "!=", "&&", "||",
+	"(", ")", "{", "}", "[", "]", ";", ",", "=", "+", "-", "*", "/", "%", "&", "|", "^", "~", "!", "<", ">",
+}
+
+type lexer struct {
+	src string
+	file string
+
+	offset int
+	line int
+	col int
+}
+
+//Splits the source into tokens, the last token is always TOKEN_EOF.
+func tokenize(file string, src string) (error, []token) {
+	l := &lexer{src: src, file: file, line: 1, col: 1}
+	tokens := make([]token, 0)
+
+	for {
+		err, t := l.next()
+		if err != nil {
+			return err, nil
+		}
+
+		tokens = append(tokens, t)
+		if t.kind == TOKEN_EOF {
+			return nil, tokens
+		}
+	}
+}
+
+func (l *lexer) pos() Pos {
+	return Pos{File: l.file, Line: l.line, Col: l.col}
+}
+
+func (l *lexer) errorf(p Pos, format string, args ...any) error {
+	return fmt.Errorf("%s: %s", p, fmt.Sprintf(format, args...))
+}
+
+func (l *lexer) advance(n int) {
+	for i := 0; i < n && l.offset < len(l.src); i++ {
+		if l.src[l.offset] == '\n' {
+			l.line++
+			l.col = 1
+		} else {
+			l.col++
+		}
+
+		l.offset++
+	}
+}
+
+//Skips spaces and comments.
+func (l *lexer) skip() error {
+	for l.offset < len(l.src) {
+		rest := l.src[l.offset:]
+
+		switch {
+		case rest[0] == ' ' || rest[0] == '\t' || rest[0] == '\r' || rest[0] == '\n':
+			l.advance(1)
+
+		case strings.HasPrefix(rest, "//"):
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest)
+			}
+			l.advance(end)
+
+		case strings.HasPrefix(rest, "/*"):
+			p := l.pos()
+			end := strings.Index(rest[2:], "*/")
+			if end < 0 {
+				return l.errorf(p, "unterminated comment")
+			}
+			l.advance(end + 4)
+
+		default:
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentChar(c byte, first bool) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (!first && isDigit(c))
+}
+
+func (l *lexer) next() (error, token) {
+	if err := l.skip(); err != nil {
+		return err, token{}
+	}
+
+	p := l.pos()
+	if l.offset >= len(l.src) {
+		return nil, token{kind: TOKEN_EOF, pos: p}
+	}
+
+	rest := l.src[l.offset:]
+	c := rest[0]
+
+	switch {
+	case isIdentChar(c, true):
+		n := 1
+		for n < len(rest) && isIdentChar(rest[n], false) {
+			n++
+		}
+		l.advance(n)
+
+		kind := TOKEN_IDENT
+		if keywords[rest[:n]] {
+			kind = TOKEN_KEYWORD
+		}
+
+		return nil, token{kind: kind, text: rest[:n], pos: p}
+
+	case isDigit(c):
+		n := 1
+		for n < len(rest) && (isIdentChar(rest[n], false)) {
+			n++
+		}
+		l.advance(n)
+
+		//Using base "0" automatically detects the base based on the string.
+		v, err := strconv.ParseInt(rest[:n], 0, 32)
+		if err != nil || v > 0xFFFF {
+			return l.errorf(p, "invalid number %q", rest[:n]), token{}
+		}
+
+		return nil, token{kind: TOKEN_NUMBER, text: rest[:n], pos: p, value: int(v)}
+
+	case c == '\'' || c == '"':
+		quoted, err := strconv.QuotedPrefix(rest)
+		if err != nil && c == '"' {
+			return l.errorf(p, "invalid string literal"), token{}
+		} else if err != nil {
+			return l.errorf(p, "invalid character literal"), token{}
+		}
+		l.advance(len(quoted))
+
+		if c == '"' {
+			s, _ := strconv.Unquote(quoted)
+			return nil, token{kind: TOKEN_STRING, text: quoted, pos: p, str: s}
+		}
+
+		r, _, tail, err := strconv.UnquoteChar(quoted[1:], '\'')
+		if err != nil || tail != "'" || r > 0xFF {
+			return l.errorf(p, "invalid character literal %s", quoted), token{}
+		}
+
+		return nil, token{kind: TOKEN_NUMBER, text: quoted, pos: p, value: int(r)}
+	}
+
+	for _, punct := range punctuation {
+		if strings.HasPrefix(rest, punct) {
+			l.advance(len(punct))
+			return nil, token{kind: TOKEN_PUNCT, text: punct, pos: p}
+		}
+	}
+
+	return l.errorf(p, "unexpected character %q", c), token{}
+}
@@ -0,0 +1,576 @@
+package compiler
+
+import (
+	"fmt"
+)
+
+type parser struct {
+	tokens []token
+	current int
+}
+
+//Used to abort parsing on the first error, recovered in "parse".
+type parseError struct {
+	err error
+}
+
+//Parses a source file into a program.
+func parse(file string, src string) (err error, prog *Program) {
+	err, tokens := tokenize(file, src)
+	if err != nil {
+		return err, nil
+	}
+
+	p := &parser{tokens: tokens}
+
+	defer func() {
+		if r := recover(); r != nil {
+			pe, ok := r.(parseError)
+			if !ok {
+				panic(r)
+			}
+
+			err, prog = pe.err, nil
+		}
+	}()
+
+	return nil, p.program()
+}
+
+func (p *parser) errorf(pos Pos, format string, args ...any) {
+	panic(parseError{fmt.Errorf("%s: %s", pos, fmt.Sprintf(format, args...))})
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.current]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.current]
+	if t.kind != TOKEN_EOF {
+		p.current++
+	}
+	return t
+}
+
+//Returns true if the next token is the given keyword or punctuation.
+func (p *parser) is(text string) bool {
+	t := p.peek()
+	return (t.kind == TOKEN_KEYWORD || t.kind == TOKEN_PUNCT) && t.text == text
+}
+
+//Consumes the next token if it's the given keyword or punctuation.
+func (p *parser) accept(text string) bool {
+	if p.is(text) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) token {
+	if !p.is(text) {
+		p.errorf(p.peek().pos, "expected %q, found %s", text, p.peek())
+	}
+	return p.next()
+}
+
+func (p *parser) ident() token {
+	t := p.next()
+	if t.kind != TOKEN_IDENT {
+		p.errorf(t.pos, "expected a name, found %s", t)
+	}
+	return t
+}
+
+
+/*
+	DECLARATIONS
+*/
+func (p *parser) program() *Program {
+	prog := &Program{}
+
+	for p.peek().kind != TOKEN_EOF {
+		start := p.peek()
+		extern := p.accept("extern")
+
+		void := p.accept("void")
+		if !void {
+			p.expect("int")
+		}
+
+		name := p.ident()
+
+		if p.is("(") {
+			f := p.function(name)
+			f.Void = void
+
+			if extern && f.Body != nil {
+				p.errorf(start.pos, "extern function %s can't have a body", f.Name)
+			}
+
+			prog.Functions = append(prog.Functions, f)
+			continue
+		}
+
+		if void {
+			p.errorf(name.pos, "variable %s can't be void", name.text)
+		}
+
+		for {
+			prog.Globals = append(prog.Globals, p.global(name, extern))
+
+			if !p.accept(",") {
+				break
+			}
+			name = p.ident()
+		}
+
+		p.expect(";")
+	}
+
+	return prog
+}
+
+func (p *parser) function(name token) *Function {
+	f := &Function{Pos: name.pos, Name: name.text, Params: make([]Param, 0)}
+	p.expect("(")
+
+	//"f(void)" is the same as "f()".
+	if p.is("void") && p.tokens[p.current + 1].text == ")" {
+		p.next()
+	}
+
+	for !p.is(")") {
+		if len(f.Params) > 0 {
+			p.expect(",")
+		}
+
+		p.expect("int")
+		param := Param{Name: p.ident().text}
+
+		if p.accept("[") {
+			p.expect("]")
+			param.IsArray = true
+		}
+
+		f.Params = append(f.Params, param)
+	}
+	p.expect(")")
+
+	if !p.accept(";") {
+		f.Body = p.block()
+	}
+
+	return f
+}
+
+func (p *parser) global(name token, extern bool) *Global {
+	g := &Global{Pos: name.pos, Name: name.text, Extern: extern}
+
+	if p.accept("[") {
+		g.IsArray = true
+		g.Size = -1
+
+		if !p.is("]") {
+			g.Size = p.constant(p.expr())
+			if g.Size <= 0 {
+				p.errorf(name.pos, "array %s must have a positive size", g.Name)
+			}
+		}
+		p.expect("]")
+	}
+
+	if !p.accept("=") {
+		if g.Size < 0 && !extern {
+			p.errorf(name.pos, "array %s needs a size or an initializer", g.Name)
+		}
+		return g
+	}
+
+	if extern {
+		p.errorf(name.pos, "extern variable %s can't be initialized", g.Name)
+	}
+
+	switch {
+	case !g.IsArray:
+		g.Init = []int{p.constant(p.expr())}
+
+	case p.peek().kind == TOKEN_STRING:
+		for _, c := range []byte(p.next().str) {
+			g.Init = append(g.Init, int(c))
+		}
+		g.Init = append(g.Init, 0)
+
+	default:
+		p.expect("{")
+		for !p.is("}") {
+			g.Init = append(g.Init, p.constant(p.expr()))
+
+			if !p.accept(",") {
+				break
+			}
+		}
+		p.expect("}")
+	}
+
+	if g.IsArray {
+		if g.Size < 0 {
+			g.Size = len(g.Init)
+		}
+
+		if len(g.Init) > g.Size {
+			p.errorf(name.pos, "too many initializers for array %s", g.Name)
+		}
+	}
+
+	return g
+}
+
+//Returns the value of a constant expression.
+func (p *parser) constant(e Expr) int {
+	err, v := constValue(e)
+	if err != nil {
+		p.errorf(e.Position(), "%s", err)
+	}
+	return v
+}
+
+
+/*
+	STATEMENTS
+*/
+func (p *parser) block() *BlockStmt {
+	b := &BlockStmt{Pos: p.expect("{").pos, Stmts: make([]Stmt, 0)}
+
+	for !p.is("}") {
+		if p.peek().kind == TOKEN_EOF {
+			p.errorf(b.Pos, "block is never closed")
+		}
+
+		b.Stmts = append(b.Stmts, p.statement()...)
+	}
+	b.End = p.next().pos
+
+	return b
+}
+
+//Parses a statement, declarations of several variables return one statement per variable.
+func (p *parser) statement() []Stmt {
+	t := p.peek()
+
+	switch {
+	case p.is("{"):
+		return []Stmt{p.block()}
+
+	case p.accept(";"):
+		return []Stmt{&BlockStmt{Pos: t.pos}}
+
+	case p.accept("int"):
+		decls := make([]Stmt, 0)
+
+		for {
+			decls = append(decls, p.local())
+
+			if !p.accept(",") {
+				break
+			}
+		}
+
+		p.expect(";")
+		return decls
+
+	case p.accept("if"):
+		s := &IfStmt{Pos: t.pos}
+
+		p.expect("(")
+		s.Cond = p.expr()
+		p.expect(")")
+
+		s.Then = p.single()
+		if p.accept("else") {
+			s.Else = p.single()
+		}
+
+		return []Stmt{s}
+
+	case p.accept("while"):
+		s := &WhileStmt{Pos: t.pos}
+
+		p.expect("(")
+		s.Cond = p.expr()
+		p.expect(")")
+
+		s.Body = p.single()
+		return []Stmt{s}
+
+	case p.accept("return"):
+		s := &ReturnStmt{Pos: t.pos}
+		if !p.is(";") {
+			s.Value = p.expr()
+		}
+
+		p.expect(";")
+		return []Stmt{s}
+
+	case p.accept("break"):
+		p.expect(";")
+		return []Stmt{&BreakStmt{Pos: t.pos}}
+
+	case p.accept("continue"):
+		p.expect(";")
+		return []Stmt{&ContinueStmt{Pos: t.pos}}
+	}
+
+	x := p.expr()
+
+	if p.accept("=") {
+		switch x.(type) {
+		case *VarExpr, *IndexExpr:
+		default:
+			p.errorf(x.Position(), "can only assign to variables and array elements")
+		}
+
+		s := &AssignStmt{Pos: t.pos, Target: x, Value: p.expr()}
+		p.expect(";")
+		return []Stmt{s}
+	}
+
+	p.expect(";")
+	return []Stmt{&ExprStmt{Pos: t.pos, X: x}}
+}
+
+//Parses the body of an "if" or "while", declarations are only allowed inside blocks.
+func (p *parser) single() Stmt {
+	if p.is("int") {
+		p.errorf(p.peek().pos, "declarations must be inside a block")
+	}
+
+	return p.statement()[0]
+}
+
+func (p *parser) local() Stmt {
+	name := p.ident()
+	d := &VarDecl{Pos: name.pos, Name: name.text}
+
+	if p.accept("[") {
+		d.Size = p.constant(p.expr())
+		p.expect("]")
+
+		if d.Size <= 0 {
+			p.errorf(name.pos, "array %s must have a positive size", d.Name)
+		}
+	}
+
+	if p.accept("=") {
+		if d.Size > 0 {
+			p.errorf(name.pos, "local array %s can't be initialized", d.Name)
+		}
+
+		d.Init = p.expr()
+	}
+
+	return d
+}
+
+
+/*
+	EXPRESSIONS
+*/
+//Binary operators by precedence, lowest first.
+var binaryLevels = [][]string{
+	{"||"},
+	{"&&"},
+	{"|"},
+	{"^"},
+	{"&"},
+	{"==", "!="},
+	{"<", "<=", ">", ">="},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *parser) expr() Expr {
+	return p.binary(0)
+}
+
+func (p *parser) binary(level int) Expr {
+	if level == len(binaryLevels) {
+		return p.unary()
+	}
+
+	x := p.binary(level + 1)
+
+	for {
+		t := p.peek()
+		matched := false
+
+		for _, op := range binaryLevels[level] {
+			if t.kind == TOKEN_PUNCT && t.text == op {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			return x
+		}
+
+		p.next()
+		x = &BinaryExpr{Pos: t.pos, Op: t.text, X: x, Y: p.binary(level + 1)}
+	}
+}
+
+func (p *parser) unary() Expr {
+	t := p.peek()
+
+	if p.accept("-") || p.accept("~") || p.accept("!") {
+		return &UnaryExpr{Pos: t.pos, Op: t.text, X: p.unary()}
+	}
+
+	return p.primary()
+}
+
+func (p *parser) primary() Expr {
+	t := p.next()
+
+	switch t.kind {
+	case TOKEN_NUMBER:
+		return &NumberExpr{Pos: t.pos, Value: t.value}
+
+	case TOKEN_STRING:
+		return &StringExpr{Pos: t.pos, Value: t.str}
+
+	case TOKEN_IDENT:
+		switch {
+		case p.accept("("):
+			call := &CallExpr{Pos: t.pos, Name: t.text, Args: make([]Expr, 0)}
+
+			for !p.accept(")") {
+				if len(call.Args) > 0 {
+					p.expect(",")
+				}
+				call.Args = append(call.Args, p.expr())
+			}
+
+			return call
+
+		case p.accept("["):
+			index := &IndexExpr{Pos: t.pos, Name: t.text, Index: p.expr()}
+			p.expect("]")
+
+			return index
+		}
+
+		return &VarExpr{Pos: t.pos, Name: t.text}
+
+	case TOKEN_PUNCT:
+		if t.text == "(" {
+			x := p.expr()
+			p.expect(")")
+
+			return x
+		}
+	}
+
+	p.errorf(t.pos, "expected an expression, found %s", t)
+	return nil
+}
+
+
+/*
+	CONSTANT EXPRESSIONS
+*/
+//Converts a value to a signed 16 bit integer.
+func toInt16(v int) int {
+	return int(int16(uint16(v)))
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+//Evaluates an expression made only of constants, with the same 16 bit semantics used at run time.
+func constValue(e Expr) (error, int) {
+	switch e := e.(type) {
+	case *NumberExpr:
+		return nil, toInt16(e.Value)
+
+	case *UnaryExpr:
+		err, x := constValue(e.X)
+		if err != nil {
+			return err, 0
+		}
+
+		switch e.Op {
+		case "-":
+			return nil, toInt16(-x)
+		case "~":
+			return nil, toInt16(^x)
+		case "!":
+			return nil, btoi(x == 0)
+		}
+
+	case *BinaryExpr:
+		err, x := constValue(e.X)
+		if err != nil {
+			return err, 0
+		}
+
+		err, y := constValue(e.Y)
+		if err != nil {
+			return err, 0
+		}
+
+		switch e.Op {
+		case "+":
+			return nil, toInt16(x + y)
+		case "-":
+			return nil, toInt16(x - y)
+		case "*":
+			return nil, toInt16(x * y)
+		case "/", "%":
+			if y == 0 {
+				return fmt.Errorf("division by zero"), 0
+			}
+
+			if e.Op == "/" {
+				return nil, int(int16(x) / int16(y))
+			}
+			return nil, int(int16(x) % int16(y))
+		case "&":
+			return nil, x & y
+		case "|":
+			return nil, x | y
+		case "^":
+			return nil, x ^ y
+		case "<<":
+			return nil, toInt16(int(uint16(x) << uint16(y)))
+		case ">>":
+			return nil, toInt16(int(uint16(x) >> uint16(y)))
+		case "==":
+			return nil, btoi(x == y)
+		case "!=":
+			return nil, btoi(x != y)
+		//Comparisons are done by subtracting, like the generated code does.
+		case "<":
+			return nil, btoi(toInt16(x - y) < 0)
+		case "<=":
+			return nil, btoi(toInt16(x - y) <= 0)
+		case ">":
+			return nil, btoi(toInt16(x - y) > 0)
+		case ">=":
+			return nil, btoi(toInt16(x - y) >= 0)
+		case "&&":
+			return nil, btoi(x != 0 && y != 0)
+		case "||":
+			return nil, btoi(x != 0 || y != 0)
+		}
+	}
+
+	return fmt.Errorf("expected a constant expression"), 0
+}
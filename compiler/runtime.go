@@ -0,0 +1,82 @@
+package compiler
+
+//Name of the runtime source, used in errors and the source map.
+const runtimeFile = "<runtime>"
+
+//Runtime functions, called for operators that have no instruction.
+const (
+	divFunction = "__div"
+	modFunction = "__mod"
+)
+
+//Runtime support, only included in programs that use it. Division works on the magnitudes, one bit at a time, and
+//rounds towards zero. The magnitudes are unsigned, -32768 has 0x8000, so the partial remainder and the divisor are
+//compared by testing the sign of their difference, which fits in 16 bits because the remainder is always less than
+//twice the divisor.
+//
+//Dividing by zero doesn't fault: "x / 0" is -1 for x >= 0 and 1 for x < 0, and "x % 0" is x. "-32768 / -1" is -32768,
+//the quotient doesn't fit in 16 bits.
+const runtimeSource = `
+int __rem;
+
+int __div(int a, int b) {
+	int neg = 0;
+	if (a < 0) {
+		a = -a;
+		neg = 1;
+	}
+
+	int remNeg = neg;
+	if (b < 0) {
+		b = -b;
+		neg = !neg;
+	}
+
+	int q = 0;
+	int r = 0;
+	int i = 16;
+	while (i) {
+		r = (r << 1) | (a >> 15);
+		a = a << 1;
+		q = q << 1;
+
+		if (r - b >= 0) {
+			r = r - b;
+			q = q | 1;
+		}
+
+		i = i - 1;
+	}
+
+	if (remNeg)
+		r = -r;
+	__rem = r;
+
+	if (neg)
+		q = -q;
+	return q;
+}
+
+int __mod(int a, int b) {
+	__div(a, b);
+	return __rem;
+}
+`
+
+//Parses the runtime, its symbols are local to every module that uses it.
+func runtimeProgram() *Program {
+	err, prog := parse(runtimeFile, runtimeSource)
+	if err != nil {
+		panic("Invalid runtime: " + err.Error())
+	}
+
+	for _, g := range prog.Globals {
+		g.Static = true
+	}
+
+	for _, f := range prog.Functions {
+		f.Static = true
+	}
+
+	return prog
+}
@@ -0,0 +1,113 @@
+package device
+
+import (
+	"time"
+)
+
+//Instructions in a second of virtual time, a step counts as a microsecond.
+const ClockRate = 1000000
+
+//Time the virtual clock starts from.
+var ClockEpoch = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+//Registers of the clock, relative to its base. They can't be written.
+const (
+	//Reading the year latches the time, the other registers return the latched time so they are consistent.
+	CLOCK_YEAR = iota
+	CLOCK_MONTH
+	CLOCK_DAY
+	CLOCK_HOURS
+	CLOCK_MINUTES
+	CLOCK_SECONDS
+	CLOCK_MILLISECONDS
+
+	clockRegisters
+)
+
+//A real time clock. Virtual clocks count the computer's steps from ClockEpoch, so runs are reproducible, host clocks
+//show the time of the host in UTC.
+type Clock struct {
+	base uint16
+	host bool
+
+	//Steps counted by a virtual clock.
+	steps int64
+
+	latched time.Time
+}
+
+func NewClock(base uint16, host bool) *Clock {
+	c := &Clock{base: base, host: host}
+	c.latched = c.Now()
+
+	return c
+}
+
+//Returns true if the clock shows the time of the host.
+func (c *Clock) Host() bool {
+	return c.host
+}
+
+//Returns the current time of the clock.
+func (c *Clock) Now() time.Time {
+	if c.host {
+		return time.Now().UTC()
+	}
+
+	return ClockEpoch.Add(time.Duration(c.steps) * (time.Second / ClockRate))
+}
+
+//Returns the register of the given time.
+func clockField(t time.Time, reg uint16) uint16 {
+	switch reg {
+	case CLOCK_YEAR:
+		return uint16(t.Year())
+	case CLOCK_MONTH:
+		return uint16(t.Month())
+	case CLOCK_DAY:
+		return uint16(t.Day())
+	case CLOCK_HOURS:
+		return uint16(t.Hour())
+	case CLOCK_MINUTES:
+		return uint16(t.Minute())
+	case CLOCK_SECONDS:
+		return uint16(t.Second())
+	case CLOCK_MILLISECONDS:
+		return uint16(t.Nanosecond() / int(time.Millisecond))
+	}
+
+	return 0
+}
+
+
+/*
+	DEVICE
+*/
+func (c *Clock) Name() string {
+	return "clock"
+}
+
+func (c *Clock) Registers() (uint16, uint16) {
+	return c.base, clockRegisters
+}
+
+func (c *Clock) Read(reg uint16) uint16 {
+	if reg == CLOCK_YEAR {
+		c.latched = c.Now()
+	}
+
+	return clockField(c.latched, reg)
+}
+
+//Shows the current time, not the latched one.
+func (c *Clock) Peek(reg uint16) uint16 {
+	return clockField(c.Now(), reg)
+}
+
+func (c *Clock) Write(reg uint16, value uint16) {
+}
+
+func (c *Clock) Tick() (bool, uint16) {
+	c.steps++
+	return false, 0
+}
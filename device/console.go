@@ -0,0 +1,146 @@
+//Package device holds the devices that can be mapped into the memory of a computer.
+package device
+
+import (
+	"io"
+	"sync"
+)
+
+//Registers of the console, relative to its base.
+const (
+	//Keyboard status, STATUS_READY is set while there is input, STATUS_INTERRUPT enables its interrupt.
+	CONSOLE_KBSR = iota
+	//Keyboard data, reading it takes the next character of the input.
+	CONSOLE_KBDR
+	//Display status, the display is always ready.
+	CONSOLE_DSR
+	//Display data, writing it prints the character in the low byte.
+	CONSOLE_DDR
+
+	consoleRegisters
+)
+
+//Bits of the status registers.
+const (
+	STATUS_READY = 0x8000
+	STATUS_INTERRUPT = 0x4000
+)
+
+//A character console, output goes to a writer and input is queued with "Input". The keyboard may interrupt when a
+//character is ready.
+type Console struct {
+	base uint16
+	vector uint16
+	out io.Writer
+
+	//Guards the input, which is queued from other goroutines.
+	mu sync.Mutex
+	input []byte
+
+	interrupts bool
+}
+
+func NewConsole(base uint16, vector uint16, out io.Writer) *Console {
+	return &Console{base: base, vector: vector, out: out}
+}
+
+//Queues keyboard input, it's safe to call while the computer runs.
+func (c *Console) Input(s string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.input = append(c.input, s...)
+}
+
+//Returns the amount of characters waiting to be read.
+func (c *Console) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.input)
+}
+
+//Queues everything read from "r" until it ends, meant to run in its own goroutine.
+func (c *Console) Feed(r io.Reader) {
+	buf := make([]byte, 256)
+
+	for {
+		n, err := r.Read(buf)
+		c.Input(string(buf[:n]))
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+
+/*
+	DEVICE
+*/
+func (c *Console) Name() string {
+	return "console"
+}
+
+func (c *Console) Registers() (uint16, uint16) {
+	return c.base, consoleRegisters
+}
+
+func (c *Console) Read(reg uint16) uint16 {
+	value := c.Peek(reg)
+
+	if reg == CONSOLE_KBDR {
+		c.mu.Lock()
+		if len(c.input) > 0 {
+			c.input = c.input[1:]
+		}
+		c.mu.Unlock()
+	}
+
+	return value
+}
+
+func (c *Console) Peek(reg uint16) uint16 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch reg {
+	case CONSOLE_KBSR:
+		status := uint16(0)
+		if len(c.input) > 0 {
+			status |= STATUS_READY
+		}
+		if c.interrupts {
+			status |= STATUS_INTERRUPT
+		}
+		return status
+
+	case CONSOLE_KBDR:
+		if len(c.input) > 0 {
+			return uint16(c.input[0])
+		}
+
+	case CONSOLE_DSR:
+		return STATUS_READY
+	}
+
+	return 0
+}
+
+func (c *Console) Write(reg uint16, value uint16) {
+	switch reg {
+	case CONSOLE_KBSR:
+		c.interrupts = value & STATUS_INTERRUPT != 0
+
+	case CONSOLE_DDR:
+		c.out.Write([]byte{byte(value)})
+	}
+}
+
+func (c *Console) Tick() (bool, uint16) {
+	if !c.interrupts {
+		return false, 0
+	}
+
+	return c.Pending() > 0, c.vector
+}
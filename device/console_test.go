@@ -0,0 +1,86 @@
+package device
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestConsole(t *testing.T) {
+	var out bytes.Buffer
+	c := NewConsole(0x200, 4, &out)
+
+	if base, size := c.Registers(); base != 0x200 || size != 4 {
+		t.Errorf("registers at 0x%04X, %d of them", base, size)
+	}
+
+	c.Input("ab")
+
+	tests := []struct {
+		name string
+		reg uint16
+		peek bool
+		want uint16
+		pending int
+	}{
+		{"status", CONSOLE_KBSR, false, STATUS_READY, 2},
+		//Peeking doesn't take the character.
+		{"peek data", CONSOLE_KBDR, true, 'a', 2},
+		{"data", CONSOLE_KBDR, false, 'a', 1},
+		{"next data", CONSOLE_KBDR, false, 'b', 0},
+		{"empty status", CONSOLE_KBSR, false, 0, 0},
+		{"empty data", CONSOLE_KBDR, false, 0, 0},
+		{"display status", CONSOLE_DSR, false, STATUS_READY, 0},
+	}
+
+	for _, tt := range tests {
+		var got uint16
+		if tt.peek {
+			got = c.Peek(tt.reg)
+		} else {
+			got = c.Read(tt.reg)
+		}
+
+		if got != tt.want || c.Pending() != tt.pending {
+			t.Errorf("%s: read 0x%04X with %d pending, want 0x%04X with %d", tt.name, got, c.Pending(), tt.want, tt.pending)
+		}
+	}
+
+	//Only the low byte is printed.
+	c.Write(CONSOLE_DDR, 0x1268)
+	c.Write(CONSOLE_DDR, 'i')
+	if out.String() != "hi" {
+		t.Errorf("printed %q, want \"hi\"", out.String())
+	}
+}
+
+func TestConsoleInterrupt(t *testing.T) {
+	c := NewConsole(0x200, 4, &bytes.Buffer{})
+
+	c.Input("x")
+	if request, _ := c.Tick(); request {
+		t.Errorf("requested an interrupt with interrupts disabled")
+	}
+
+	c.Write(CONSOLE_KBSR, STATUS_INTERRUPT)
+	if c.Peek(CONSOLE_KBSR) != STATUS_READY | STATUS_INTERRUPT {
+		t.Errorf("status 0x%04X", c.Peek(CONSOLE_KBSR))
+	}
+	if request, vector := c.Tick(); !request || vector != 4 {
+		t.Errorf("Tick() = %v, %d with input waiting", request, vector)
+	}
+
+	c.Read(CONSOLE_KBDR)
+	if request, _ := c.Tick(); request {
+		t.Errorf("requested an interrupt without input")
+	}
+}
+
+func TestConsoleFeed(t *testing.T) {
+	c := NewConsole(0x200, 4, &bytes.Buffer{})
+	c.Feed(strings.NewReader("hello"))
+
+	if c.Pending() != 5 || c.Peek(CONSOLE_KBDR) != 'h' {
+		t.Errorf("%d characters pending after feeding 5", c.Pending())
+	}
+}
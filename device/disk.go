@@ -0,0 +1,240 @@
+package device
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+//Words in a sector, images store them as little endian 16 bit values.
+const SectorWords = 256
+
+const sectorBytes = SectorWords * 2
+
+//Instructions run between a command and its completion.
+const DiskLatency = 100
+
+//Registers of the disk, relative to its base.
+const (
+	//Writing a command starts it, reads return the last one.
+	DISK_COMMAND = iota
+	//Sector the next command transfers.
+	DISK_SECTOR
+	//Memory address the sector is transferred from or to.
+	DISK_ADDRESS
+	//STATUS_READY is set while no command runs, STATUS_INTERRUPT enables the completion interrupt and DISK_ERROR is
+	//set if the last command failed. Reading it acknowledges a completion.
+	DISK_STATUS
+
+	diskRegisters
+)
+
+//Commands of the disk.
+const (
+	DISK_READ = 1
+	DISK_WRITE = 2
+)
+
+const DISK_ERROR = 0x0001
+
+//Memory the disk transfers sectors from and to.
+type Memory interface {
+	GetMemoryCell(addr uint16) uint16
+	SetMemoryCell(addr uint16, value uint16)
+}
+
+//A block device backed by an image file. Commands complete DiskLatency instructions after they are given, and may
+//interrupt once they do until the status is read.
+type Disk struct {
+	base uint16
+	vector uint16
+	mem Memory
+
+	file *os.File
+	sectors int
+
+	command uint16
+	sector uint16
+	address uint16
+
+	//Instructions left until the running command completes, zero if none runs.
+	busy int
+	failed bool
+
+	//Set when a command completes, until the status is read.
+	done bool
+	interrupts bool
+}
+
+//Creates a blank image with the given amount of sectors, an existing file is overwritten.
+func CreateImage(path string, sectors int) error {
+	if sectors <= 0 || sectors > 0x10000 {
+		return fmt.Errorf("Invalid amount of sectors %d, it must be between 1 and %d", sectors, 0x10000)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := f.Truncate(int64(sectors) * sectorBytes); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+//Opens an image, its size must be a whole amount of sectors. The disk transfers sectors from and to "mem".
+func OpenDisk(path string, base uint16, vector uint16, mem Memory) (error, *Disk) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err, nil
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err, nil
+	}
+
+	if info.Size() == 0 || info.Size() % sectorBytes != 0 || info.Size() / sectorBytes > 0x10000 {
+		f.Close()
+		return fmt.Errorf("%s is not a disk image, its size must be a whole amount of %d byte sectors", path, sectorBytes), nil
+	}
+
+	return nil, &Disk{base: base, vector: vector, mem: mem, file: f, sectors: int(info.Size() / sectorBytes)}
+}
+
+func (d *Disk) Path() string {
+	return d.file.Name()
+}
+
+func (d *Disk) Sectors() int {
+	return d.sectors
+}
+
+//Closes the image, the disk must be detached first.
+func (d *Disk) Close() error {
+	return d.file.Close()
+}
+
+//Runs the current command, returns false if it fails.
+func (d *Disk) transfer() bool {
+	if int(d.sector) >= d.sectors {
+		return false
+	}
+
+	buf := make([]byte, sectorBytes)
+	offset := int64(d.sector) * sectorBytes
+
+	switch d.command {
+	case DISK_READ:
+		if _, err := d.file.ReadAt(buf, offset); err != nil {
+			return false
+		}
+
+		for i := uint16(0); i < SectorWords; i++ {
+			d.mem.SetMemoryCell(d.address + i, binary.LittleEndian.Uint16(buf[i * 2:]))
+		}
+
+	case DISK_WRITE:
+		for i := uint16(0); i < SectorWords; i++ {
+			binary.LittleEndian.PutUint16(buf[i * 2:], d.mem.GetMemoryCell(d.address + i))
+		}
+
+		if _, err := d.file.WriteAt(buf, offset); err != nil {
+			return false
+		}
+
+	default:
+		return false
+	}
+
+	return true
+}
+
+
+/*
+	DEVICE
+*/
+func (d *Disk) Name() string {
+	return "disk"
+}
+
+func (d *Disk) Registers() (uint16, uint16) {
+	return d.base, diskRegisters
+}
+
+func (d *Disk) Read(reg uint16) uint16 {
+	value := d.Peek(reg)
+
+	if reg == DISK_STATUS {
+		d.done = false
+	}
+
+	return value
+}
+
+func (d *Disk) Peek(reg uint16) uint16 {
+	switch reg {
+	case DISK_COMMAND:
+		return d.command
+
+	case DISK_SECTOR:
+		return d.sector
+
+	case DISK_ADDRESS:
+		return d.address
+
+	case DISK_STATUS:
+		status := uint16(0)
+		if d.busy == 0 {
+			status |= STATUS_READY
+		}
+		if d.interrupts {
+			status |= STATUS_INTERRUPT
+		}
+		if d.failed {
+			status |= DISK_ERROR
+		}
+		return status
+	}
+
+	return 0
+}
+
+func (d *Disk) Write(reg uint16, value uint16) {
+	switch reg {
+	case DISK_COMMAND:
+		//Commands given while another runs are ignored.
+		if d.busy == 0 {
+			d.command = value
+			d.busy = DiskLatency
+			d.failed = false
+			d.done = false
+		}
+
+	case DISK_SECTOR:
+		d.sector = value
+
+	case DISK_ADDRESS:
+		d.address = value
+
+	case DISK_STATUS:
+		d.interrupts = value & STATUS_INTERRUPT != 0
+	}
+}
+
+func (d *Disk) Tick() (bool, uint16) {
+	if d.busy > 0 {
+		d.busy--
+
+		if d.busy == 0 {
+			d.failed = !d.transfer()
+			d.done = true
+		}
+	}
+
+	return d.interrupts && d.done, d.vector
+}
@@ -0,0 +1,148 @@
+package device
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type testMemory map[uint16]uint16
+
+func (m testMemory) GetMemoryCell(addr uint16) uint16 {
+	return m[addr]
+}
+
+func (m testMemory) SetMemoryCell(addr uint16, value uint16) {
+	m[addr] = value
+}
+
+func openTestDisk(t *testing.T, sectors int, mem Memory) *Disk {
+	path := filepath.Join(t.TempDir(), "disk.img")
+	if err := CreateImage(path, sectors); err != nil {
+		t.Fatal(err)
+	}
+
+	err, d := OpenDisk(path, 0x400, 5, mem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Close() })
+
+	return d
+}
+
+//Gives a command and ticks until it completes, returns the status.
+func runCommand(d *Disk, command uint16, sector uint16, address uint16) uint16 {
+	d.Write(DISK_SECTOR, sector)
+	d.Write(DISK_ADDRESS, address)
+	d.Write(DISK_COMMAND, command)
+
+	for i := 0; i < DiskLatency; i++ {
+		d.Tick()
+	}
+
+	return d.Read(DISK_STATUS)
+}
+
+func TestDiskTransfer(t *testing.T) {
+	mem := testMemory{}
+	d := openTestDisk(t, 4, mem)
+
+	if base, size := d.Registers(); base != 0x400 || size != 4 || d.Sectors() != 4 {
+		t.Errorf("registers at 0x%04X, %d of them, %d sectors", base, size, d.Sectors())
+	}
+
+	mem[0x1000] = 0x1234
+	mem[0x10FF] = 0xABCD
+
+	if status := runCommand(d, DISK_WRITE, 3, 0x1000); status != STATUS_READY {
+		t.Fatalf("status 0x%04X after the write", status)
+	}
+	if status := runCommand(d, DISK_READ, 3, 0x2000); status != STATUS_READY {
+		t.Fatalf("status 0x%04X after the read", status)
+	}
+
+	if mem[0x2000] != 0x1234 || mem[0x20FF] != 0xABCD || mem[0x2100] != 0 {
+		t.Errorf("read 0x%04X, 0x%04X and 0x%04X", mem[0x2000], mem[0x20FF], mem[0x2100])
+	}
+
+	//The registers keep the last command.
+	if d.Peek(DISK_COMMAND) != DISK_READ || d.Peek(DISK_SECTOR) != 3 || d.Peek(DISK_ADDRESS) != 0x2000 {
+		t.Errorf("registers %d, %d, 0x%04X", d.Peek(DISK_COMMAND), d.Peek(DISK_SECTOR), d.Peek(DISK_ADDRESS))
+	}
+}
+
+func TestDiskErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		command uint16
+		sector uint16
+	}{
+		{"read out of range", DISK_READ, 4},
+		{"write out of range", DISK_WRITE, 0xFFFF},
+		{"unknown command", 7, 0},
+	}
+
+	for _, tt := range tests {
+		mem := testMemory{0x1000: 1}
+		d := openTestDisk(t, 4, mem)
+
+		if status := runCommand(d, tt.command, tt.sector, 0x1000); status != STATUS_READY | DISK_ERROR {
+			t.Errorf("%s: status 0x%04X, want 0x%04X", tt.name, status, STATUS_READY | DISK_ERROR)
+		}
+		if len(mem) != 1 || mem[0x1000] != 1 {
+			t.Errorf("%s: memory changed", tt.name)
+		}
+
+		//A new command clears the error.
+		if status := runCommand(d, DISK_READ, 0, 0x1000); status != STATUS_READY {
+			t.Errorf("%s: status 0x%04X after a valid command", tt.name, status)
+		}
+	}
+}
+
+func TestDiskTiming(t *testing.T) {
+	d := openTestDisk(t, 1, testMemory{})
+	d.Write(DISK_STATUS, STATUS_INTERRUPT)
+	d.Write(DISK_COMMAND, DISK_READ)
+
+	for i := 1; i < DiskLatency; i++ {
+		if request, _ := d.Tick(); request || d.Peek(DISK_STATUS) & STATUS_READY != 0 {
+			t.Fatalf("completed after %d ticks", i)
+		}
+
+		//Commands given while busy are ignored.
+		d.Write(DISK_COMMAND, DISK_WRITE)
+	}
+
+	if request, vector := d.Tick(); !request || vector != 5 {
+		t.Fatalf("Tick() = %v, %d on completion", request, vector)
+	}
+	if d.Peek(DISK_COMMAND) != DISK_READ {
+		t.Errorf("the command changed while busy")
+	}
+
+	//The interrupt is requested until the status is read.
+	if request, _ := d.Tick(); !request {
+		t.Errorf("the request stopped before the status was read")
+	}
+	d.Read(DISK_STATUS)
+	if request, _ := d.Tick(); request {
+		t.Errorf("the request continued after the status was read")
+	}
+}
+
+func TestDiskImages(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := CreateImage(filepath.Join(dir, "a.img"), 0); err == nil {
+		t.Errorf("created an image without sectors")
+	}
+
+	path := filepath.Join(dir, "b.img")
+	os.WriteFile(path, make([]byte, sectorBytes + 1), 0644)
+	if err, _ := OpenDisk(path, 0, 0, testMemory{}); err == nil || !strings.Contains(err.Error(), "not a disk image") {
+		t.Errorf("got error %v opening an image of partial sectors", err)
+	}
+}
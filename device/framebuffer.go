@@ -0,0 +1,145 @@
+package device
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"sync"
+)
+
+//Size of the display in pixels, each word holds 16 pixels of a row with the leftmost one in bit 15.
+const (
+	DISPLAY_WIDTH = 64
+	DISPLAY_HEIGHT = 32
+
+	DisplayWords = DISPLAY_WIDTH * DISPLAY_HEIGHT / 16
+	wordsPerRow = DISPLAY_WIDTH / 16
+)
+
+//Colors of the pixels in images, off and on.
+var DisplayPalette = color.Palette{color.Gray{0x10}, color.Gray{0xE0}}
+
+//A monochrome framebuffer, every register is a word of pixels. Rows are stored one after the other, so pixel (x, y) is
+//bit 15 - x % 16 of the register y * 4 + x / 16.
+type Framebuffer struct {
+	base uint16
+
+	//Guards the pixels, which are rendered from other goroutines while the computer runs.
+	mu sync.Mutex
+	pixels [DisplayWords]uint16
+
+	//Incremented by every write that changes a pixel.
+	version uint64
+}
+
+func NewFramebuffer(base uint16) *Framebuffer {
+	return &Framebuffer{base: base}
+}
+
+//Returns a copy of the pixels and their version, it's safe to call while the computer runs.
+func (f *Framebuffer) Snapshot() ([DisplayWords]uint16, uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.pixels, f.version
+}
+
+//Returns the version of the pixels, it changes whenever they do.
+func (f *Framebuffer) Version() uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.version
+}
+
+func (f *Framebuffer) Clear() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.pixels = [DisplayWords]uint16{}
+	f.version++
+}
+
+//Returns true if the pixel is on.
+func Pixel(pixels *[DisplayWords]uint16, x int, y int) bool {
+	return pixels[y * wordsPerRow + x / 16] & (0x8000 >> (x % 16)) != 0
+}
+
+//Returns the pixels drawn with block characters in a frame, every character holds two rows.
+func Render(pixels *[DisplayWords]uint16) string {
+	blocks := []string{" ", "▀", "▄", "█"}
+
+	var b strings.Builder
+	b.WriteString("┌" + strings.Repeat("─", DISPLAY_WIDTH) + "┐\n")
+
+	for y := 0; y < DISPLAY_HEIGHT; y += 2 {
+		b.WriteString("│")
+		for x := 0; x < DISPLAY_WIDTH; x++ {
+			i := 0
+			if Pixel(pixels, x, y) {
+				i |= 1
+			}
+			if Pixel(pixels, x, y + 1) {
+				i |= 2
+			}
+			b.WriteString(blocks[i])
+		}
+		b.WriteString("│\n")
+	}
+
+	b.WriteString("└" + strings.Repeat("─", DISPLAY_WIDTH) + "┘")
+
+	return b.String()
+}
+
+//Returns an image of the pixels, each one a square of "scale" by "scale".
+func Image(pixels *[DisplayWords]uint16, scale int) *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, DISPLAY_WIDTH * scale, DISPLAY_HEIGHT * scale), DisplayPalette)
+
+	for y := 0; y < DISPLAY_HEIGHT * scale; y++ {
+		for x := 0; x < DISPLAY_WIDTH * scale; x++ {
+			if Pixel(pixels, x / scale, y / scale) {
+				img.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+
+	return img
+}
+
+
+/*
+	DEVICE
+*/
+func (f *Framebuffer) Name() string {
+	return "display"
+}
+
+func (f *Framebuffer) Registers() (uint16, uint16) {
+	return f.base, DisplayWords
+}
+
+func (f *Framebuffer) Read(reg uint16) uint16 {
+	return f.Peek(reg)
+}
+
+func (f *Framebuffer) Peek(reg uint16) uint16 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.pixels[reg]
+}
+
+func (f *Framebuffer) Write(reg uint16, value uint16) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.pixels[reg] != value {
+		f.pixels[reg] = value
+		f.version++
+	}
+}
+
+func (f *Framebuffer) Tick() (bool, uint16) {
+	return false, 0
+}
@@ -0,0 +1,99 @@
+package device
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFramebuffer(t *testing.T) {
+	f := NewFramebuffer(0x300)
+
+	if base, size := f.Registers(); base != 0x300 || size != DisplayWords {
+		t.Errorf("registers at 0x%04X, %d of them", base, size)
+	}
+
+	tests := []struct {
+		name string
+		reg uint16
+		value uint16
+		//Version after the write.
+		version uint64
+	}{
+		{"first word", 0, 0x8001, 1},
+		//Writing the same value doesn't change the version.
+		{"same value", 0, 0x8001, 1},
+		{"last word", DisplayWords - 1, 0x0001, 2},
+		{"clear word", 0, 0, 3},
+	}
+
+	for _, tt := range tests {
+		f.Write(tt.reg, tt.value)
+
+		if f.Read(tt.reg) != tt.value || f.Peek(tt.reg) != tt.value || f.Version() != tt.version {
+			t.Errorf("%s: read 0x%04X at version %d, want 0x%04X at %d", tt.name, f.Read(tt.reg), f.Version(), tt.value, tt.version)
+		}
+		if request, _ := f.Tick(); request {
+			t.Errorf("%s: the display requested an interrupt", tt.name)
+		}
+	}
+
+	f.Clear()
+	if pixels, version := f.Snapshot(); pixels != [DisplayWords]uint16{} || version != 4 {
+		t.Errorf("pixels not cleared, version %d", version)
+	}
+}
+
+func TestPixel(t *testing.T) {
+	var pixels [DisplayWords]uint16
+	pixels[0] = 0x8000
+	pixels[wordsPerRow + 1] = 0x0001
+	pixels[DisplayWords - 1] = 0x0001
+
+	tests := []struct {
+		x, y int
+		on bool
+	}{
+		{0, 0, true},
+		{1, 0, false},
+		{31, 1, true},
+		{16, 1, false},
+		{DISPLAY_WIDTH - 1, DISPLAY_HEIGHT - 1, true},
+		{DISPLAY_WIDTH - 1, DISPLAY_HEIGHT - 2, false},
+	}
+
+	for _, tt := range tests {
+		if Pixel(&pixels, tt.x, tt.y) != tt.on {
+			t.Errorf("pixel (%d, %d) is %v, want %v", tt.x, tt.y, !tt.on, tt.on)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	var pixels [DisplayWords]uint16
+	//Pixel (0, 0) and both pixels of the second column of the first character row.
+	pixels[0] = 0xC000
+	pixels[wordsPerRow] = 0x4000
+
+	lines := strings.Split(Render(&pixels), "\n")
+	if len(lines) != DISPLAY_HEIGHT / 2 + 2 {
+		t.Fatalf("%d lines, want %d", len(lines), DISPLAY_HEIGHT / 2 + 2)
+	}
+
+	if want := "│▀█" + strings.Repeat(" ", DISPLAY_WIDTH - 2) + "│"; lines[1] != want {
+		t.Errorf("first row %q, want %q", lines[1], want)
+	}
+}
+
+func TestImage(t *testing.T) {
+	var pixels [DisplayWords]uint16
+	pixels[0] = 0x8000
+
+	img := Image(&pixels, 2)
+	if b := img.Bounds(); b.Dx() != DISPLAY_WIDTH * 2 || b.Dy() != DISPLAY_HEIGHT * 2 {
+		t.Fatalf("image bounds %v", b)
+	}
+
+	if img.ColorIndexAt(1, 1) != 1 || img.ColorIndexAt(2, 0) != 0 {
+		t.Errorf("pixel (0, 0) isn't a 2 by 2 square")
+	}
+}
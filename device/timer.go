@@ -0,0 +1,117 @@
+package device
+
+//Registers of the timer, relative to its base.
+const (
+	//TIMER_ENABLE, TIMER_PERIODIC, STATUS_INTERRUPT to interrupt on expiry and TIMER_EXPIRED, set when the count
+	//reaches zero. Reading it acknowledges an expiry.
+	TIMER_CONTROL = iota
+	//Value the count starts from.
+	TIMER_RELOAD
+	//Instructions left until the timer expires.
+	TIMER_COUNT
+
+	timerRegisters
+)
+
+//Bits of the control register.
+const (
+	TIMER_ENABLE = 0x0001
+	//Once expired the count starts again from the reload value, otherwise the timer stops.
+	TIMER_PERIODIC = 0x0002
+	TIMER_EXPIRED = 0x8000
+)
+
+//An interval timer that counts instructions, it's driven by the computer's steps so runs are reproducible. Enabling it
+//loads the count from the reload value, a reload of zero never expires.
+type Timer struct {
+	base uint16
+	vector uint16
+
+	control uint16
+	reload uint16
+	count uint16
+
+	//Set when the count reaches zero, until the control is read.
+	expired bool
+}
+
+func NewTimer(base uint16, vector uint16) *Timer {
+	return &Timer{base: base, vector: vector}
+}
+
+
+/*
+	DEVICE
+*/
+func (t *Timer) Name() string {
+	return "timer"
+}
+
+func (t *Timer) Registers() (uint16, uint16) {
+	return t.base, timerRegisters
+}
+
+func (t *Timer) Read(reg uint16) uint16 {
+	value := t.Peek(reg)
+
+	if reg == TIMER_CONTROL {
+		t.expired = false
+	}
+
+	return value
+}
+
+func (t *Timer) Peek(reg uint16) uint16 {
+	switch reg {
+	case TIMER_CONTROL:
+		if t.expired {
+			return t.control | TIMER_EXPIRED
+		}
+		return t.control
+
+	case TIMER_RELOAD:
+		return t.reload
+
+	case TIMER_COUNT:
+		return t.count
+	}
+
+	return 0
+}
+
+func (t *Timer) Write(reg uint16, value uint16) {
+	switch reg {
+	case TIMER_CONTROL:
+		value &= TIMER_ENABLE | TIMER_PERIODIC | STATUS_INTERRUPT
+
+		//Starting the timer loads the count.
+		if value & TIMER_ENABLE != 0 && t.control & TIMER_ENABLE == 0 {
+			t.count = t.reload
+		}
+		t.control = value
+
+	case TIMER_RELOAD:
+		t.reload = value
+
+	case TIMER_COUNT:
+		t.count = value
+	}
+}
+
+func (t *Timer) Tick() (bool, uint16) {
+	if t.control & TIMER_ENABLE != 0 && t.count > 0 {
+		t.count--
+
+		if t.count == 0 {
+			t.expired = true
+
+			if t.control & TIMER_PERIODIC != 0 {
+				t.count = t.reload
+			} else {
+				t.control &^= TIMER_ENABLE
+			}
+		}
+	}
+
+	return t.control & STATUS_INTERRUPT != 0 && t.expired, t.vector
+}
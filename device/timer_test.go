@@ -0,0 +1,166 @@
+package device
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+//Ticks the timer "n" times, returns the ticks on which it requested an interrupt.
+func tickTimer(t *Timer, n int) []int {
+	var requests []int
+
+	for i := 1; i <= n; i++ {
+		if request, _ := t.Tick(); request {
+			requests = append(requests, i)
+			//Acknowledges the expiry.
+			t.Read(TIMER_CONTROL)
+		}
+	}
+
+	return requests
+}
+
+func TestTimer(t *testing.T) {
+	tests := []struct {
+		name string
+		reload uint16
+		control uint16
+		requests []int
+		//Count and control after the ticks.
+		count uint16
+		after uint16
+	}{
+		{"one shot", 3, TIMER_ENABLE | STATUS_INTERRUPT, []int{3}, 0, STATUS_INTERRUPT},
+		{"periodic", 3, TIMER_ENABLE | TIMER_PERIODIC | STATUS_INTERRUPT, []int{3, 6, 9}, 2, TIMER_ENABLE | TIMER_PERIODIC | STATUS_INTERRUPT},
+		{"no interrupt", 3, TIMER_ENABLE | TIMER_PERIODIC, nil, 2, TIMER_ENABLE | TIMER_PERIODIC},
+		{"disabled", 3, STATUS_INTERRUPT, nil, 0, STATUS_INTERRUPT},
+		{"zero reload", 0, TIMER_ENABLE | STATUS_INTERRUPT, nil, 0, TIMER_ENABLE | STATUS_INTERRUPT},
+		//The expired bit can't be written.
+		{"expired bit", 3, TIMER_ENABLE | TIMER_EXPIRED, nil, 0, 0},
+	}
+
+	for _, tt := range tests {
+		timer := NewTimer(0x500, 6)
+		timer.Write(TIMER_RELOAD, tt.reload)
+		timer.Write(TIMER_CONTROL, tt.control)
+
+		if requests := tickTimer(timer, 10); !reflect.DeepEqual(requests, tt.requests) {
+			t.Errorf("%s: requests on ticks %v, want %v", tt.name, requests, tt.requests)
+		}
+
+		if timer.Peek(TIMER_COUNT) != tt.count || timer.Peek(TIMER_CONTROL) &^ TIMER_EXPIRED != tt.after {
+			t.Errorf("%s: count %d and control 0x%04X, want %d and 0x%04X", tt.name, timer.Peek(TIMER_COUNT), timer.Peek(TIMER_CONTROL), tt.count, tt.after)
+		}
+	}
+}
+
+func TestTimerExpiry(t *testing.T) {
+	timer := NewTimer(0x500, 6)
+	timer.Write(TIMER_RELOAD, 2)
+	timer.Write(TIMER_CONTROL, TIMER_ENABLE | STATUS_INTERRUPT)
+
+	timer.Tick()
+	if request, vector := timer.Tick(); !request || vector != 6 {
+		t.Fatalf("Tick() = %v, %d on expiry", request, vector)
+	}
+
+	//The request is repeated until the control is read, peeking doesn't acknowledge it.
+	if timer.Peek(TIMER_CONTROL) & TIMER_EXPIRED == 0 {
+		t.Errorf("the expired bit isn't set")
+	}
+	if request, _ := timer.Tick(); !request {
+		t.Errorf("the request stopped before the control was read")
+	}
+
+	timer.Read(TIMER_CONTROL)
+	if request, _ := timer.Tick(); request || timer.Peek(TIMER_CONTROL) & TIMER_EXPIRED != 0 {
+		t.Errorf("the expiry wasn't acknowledged")
+	}
+
+	//Enabling the timer again restarts the count.
+	timer.Write(TIMER_CONTROL, TIMER_ENABLE)
+	if timer.Peek(TIMER_COUNT) != 2 {
+		t.Errorf("count %d after enabling, want 2", timer.Peek(TIMER_COUNT))
+	}
+}
+
+//Two timers given the same writes and ticks expire on the same ticks.
+func TestTimerDeterminism(t *testing.T) {
+	var runs [][]int
+
+	for i := 0; i < 2; i++ {
+		timer := NewTimer(0x500, 6)
+		timer.Write(TIMER_RELOAD, 7)
+		timer.Write(TIMER_CONTROL, TIMER_ENABLE | TIMER_PERIODIC | STATUS_INTERRUPT)
+
+		requests := tickTimer(timer, 50)
+		timer.Write(TIMER_COUNT, 2)
+		runs = append(runs, append(requests, tickTimer(timer, 10)...))
+	}
+
+	want := []int{7, 14, 21, 28, 35, 42, 49, 2, 9}
+	for _, r := range runs {
+		if !reflect.DeepEqual(r, want) {
+			t.Errorf("requests on ticks %v, want %v", r, want)
+		}
+	}
+}
+
+func TestVirtualClock(t *testing.T) {
+	c := NewClock(0x600, false)
+
+	if c.Host() || !c.Now().Equal(ClockEpoch) {
+		t.Fatalf("the clock starts at %v", c.Now())
+	}
+
+	//A second and a half of steps, plus a day.
+	steps := ClockRate * 3 / 2
+	for i := 0; i < steps; i++ {
+		if request, _ := c.Tick(); request {
+			t.Fatal("the clock requested an interrupt")
+		}
+	}
+	c.steps += int64(ClockRate) * 60 * 60 * 24
+
+	tests := []struct {
+		reg uint16
+		want uint16
+	}{
+		{CLOCK_YEAR, 2000},
+		{CLOCK_MONTH, 1},
+		{CLOCK_DAY, 2},
+		{CLOCK_HOURS, 0},
+		{CLOCK_MINUTES, 0},
+		{CLOCK_SECONDS, 1},
+		{CLOCK_MILLISECONDS, 500},
+	}
+
+	for _, tt := range tests {
+		if got := c.Read(tt.reg); got != tt.want {
+			t.Errorf("register %d is %d, want %d", tt.reg, got, tt.want)
+		}
+	}
+
+	//Reads return the time latched by the year, peeks the current one.
+	c.steps += ClockRate
+	c.Write(CLOCK_SECONDS, 30)
+	if c.Read(CLOCK_SECONDS) != 1 || c.Peek(CLOCK_SECONDS) != 2 {
+		t.Errorf("read second %d and peeked %d, want 1 and 2", c.Read(CLOCK_SECONDS), c.Peek(CLOCK_SECONDS))
+	}
+
+	c.Read(CLOCK_YEAR)
+	if c.Read(CLOCK_SECONDS) != 2 {
+		t.Errorf("reading the year didn't latch the time")
+	}
+}
+
+func TestHostClock(t *testing.T) {
+	c := NewClock(0x600, true)
+
+	before := time.Now().UTC()
+	c.Tick()
+	if now := c.Now(); !c.Host() || now.Before(before.Add(-time.Second)) || c.Read(CLOCK_YEAR) != uint16(before.Year()) {
+		t.Errorf("the host clock shows %v at %v", now, before)
+	}
+}
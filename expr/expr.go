@@ -0,0 +1,322 @@
+package expr
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//The environment an expression is evaluated in.
+type Env struct {
+	//Resolves identifiers, returns false if the identifier is unknown.
+	Lookup func(name string) (int, bool)
+
+	//Resolves memory references of the form "[addr]", if nil they are not allowed.
+	Deref func(addr int) (int, bool)
+}
+
+type parser struct {
+	src string
+	pos int
+	env Env
+
+	//Greater than zero while parsing an operand that is not evaluated, the right side of a "&&" or "||" whose result is
+	//known. Its operators and memory references are not applied, so they can't fail.
+	skip int
+}
+
+//Binary operators grouped by precedence, from lowest to highest.
+var precedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"|"},
+	{"^"},
+	{"&"},
+	{"==", "!="},
+	{"<=", ">=", "<", ">"},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+//Evaluates the given expression, supporting C-like integer operators, parentheses, numeric and character literals,
+//identifiers and, if allowed by the environment, memory references.
+func Eval(src string, env Env) (error, int) {
+	p := parser{src: src, env: env}
+
+	err, value := p.parseBinary(0)
+	if err != nil {
+		return err, 0
+	}
+
+	p.skipSpaces()
+	if p.pos < len(p.src) {
+		return fmt.Errorf("Unexpected %q in expression %q", p.src[p.pos:], src), 0
+	}
+
+	return nil, value
+}
+
+//Returns true if the given character can be part of an identifier.
+func IsIdentChar(c byte, first bool) bool {
+	if c == '_' || c == '.' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') {
+		return true
+	}
+
+	return !first && c >= '0' && c <= '9'
+}
+
+func (p *parser) skipSpaces() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+//Consumes the given operator if it's next in the input, care is taken not to match a prefix of a longer operator.
+func (p *parser) accept(op string) bool {
+	p.skipSpaces()
+
+	if !strings.HasPrefix(p.src[p.pos:], op) {
+		return false
+	}
+
+	rest := p.src[p.pos + len(op):]
+	if len(op) == 1 && len(rest) > 0 {
+		switch {
+		case (op == "<" || op == ">") && (rest[0] == op[0] || rest[0] == '='):
+			return false
+		case (op == "&" || op == "|") && rest[0] == op[0]:
+			return false
+		case (op == "!" || op == "=") && rest[0] == '=':
+			return false
+		}
+	}
+
+	p.pos += len(op)
+	return true
+}
+
+func (p *parser) parseBinary(level int) (error, int) {
+	if level == len(precedence) {
+		return p.parseUnary()
+	}
+
+	err, left := p.parseBinary(level + 1)
+	if err != nil {
+		return err, 0
+	}
+
+	for {
+		matched := ""
+		for _, op := range precedence[level] {
+			if p.accept(op) {
+				matched = op
+				break
+			}
+		}
+
+		if matched == "" {
+			return nil, left
+		}
+
+		//Like in C, the right side of "&&" and "||" is only evaluated if the left one doesn't decide the result.
+		decided := (matched == "&&" && left == 0) || (matched == "||" && left != 0)
+		if decided {
+			p.skip++
+		}
+
+		err, right := p.parseBinary(level + 1)
+		if decided {
+			p.skip--
+		}
+		if err != nil {
+			return err, 0
+		}
+
+		switch {
+		case decided:
+			left = btoi(left != 0)
+		case p.skip > 0:
+			left = 0
+		default:
+			err, left = applyBinary(matched, left, right)
+			if err != nil {
+				return err, 0
+			}
+		}
+	}
+}
+
+func applyBinary(op string, l, r int) (error, int) {
+	switch op {
+	case "||":
+		return nil, btoi(l != 0 || r != 0)
+	case "&&":
+		return nil, btoi(l != 0 && r != 0)
+	case "|":
+		return nil, l | r
+	case "^":
+		return nil, l ^ r
+	case "&":
+		return nil, l & r
+	case "==":
+		return nil, btoi(l == r)
+	case "!=":
+		return nil, btoi(l != r)
+	case "<":
+		return nil, btoi(l < r)
+	case "<=":
+		return nil, btoi(l <= r)
+	case ">":
+		return nil, btoi(l > r)
+	case ">=":
+		return nil, btoi(l >= r)
+	case "<<":
+		return nil, l << uint(r & 63)
+	case ">>":
+		return nil, l >> uint(r & 63)
+	case "+":
+		return nil, l + r
+	case "-":
+		return nil, l - r
+	case "*":
+		return nil, l * r
+	case "/", "%":
+		if r == 0 {
+			return errors.New("Division by zero"), 0
+		}
+
+		if op == "/" {
+			return nil, l / r
+		}
+		return nil, l % r
+	}
+
+	return fmt.Errorf("Unknown operator %q", op), 0
+}
+
+func (p *parser) parseUnary() (error, int) {
+	switch {
+	case p.accept("-"):
+		err, v := p.parseUnary()
+		return err, -v
+	case p.accept("+"):
+		return p.parseUnary()
+	case p.accept("~"):
+		err, v := p.parseUnary()
+		return err, ^v
+	case p.accept("!"):
+		err, v := p.parseUnary()
+		return err, btoi(v == 0)
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (error, int) {
+	p.skipSpaces()
+
+	if p.pos >= len(p.src) {
+		return fmt.Errorf("Unexpected end of expression %q", p.src), 0
+	}
+
+	c := p.src[p.pos]
+
+	switch {
+	case c == '(':
+		p.pos++
+		err, v := p.parseBinary(0)
+		if err != nil {
+			return err, 0
+		}
+
+		if !p.accept(")") {
+			return fmt.Errorf("Missing ')' in expression %q", p.src), 0
+		}
+
+		return nil, v
+
+	case c == '[':
+		if p.env.Deref == nil {
+			return fmt.Errorf("Memory references are not allowed in expression %q", p.src), 0
+		}
+
+		p.pos++
+		err, addr := p.parseBinary(0)
+		if err != nil {
+			return err, 0
+		}
+
+		if !p.accept("]") {
+			return fmt.Errorf("Missing ']' in expression %q", p.src), 0
+		}
+
+		if p.skip > 0 {
+			return nil, 0
+		}
+
+		v, ok := p.env.Deref(addr)
+		if !ok {
+			return fmt.Errorf("Invalid memory reference [%d]", addr), 0
+		}
+
+		return nil, v
+
+	case c == '\'':
+		//Character literal, escapes are limited to the common ones.
+		end := strings.IndexByte(p.src[p.pos + 1:], '\'')
+		if end < 0 {
+			return fmt.Errorf("Unterminated character literal in expression %q", p.src), 0
+		}
+
+		lit := p.src[p.pos : p.pos + end + 2]
+		p.pos += end + 2
+
+		s, err := strconv.Unquote(lit)
+		if err != nil || len([]rune(s)) != 1 {
+			return fmt.Errorf("Invalid character literal %s", lit), 0
+		}
+
+		return nil, int([]rune(s)[0])
+
+	case c >= '0' && c <= '9':
+		start := p.pos
+		for p.pos < len(p.src) && IsIdentChar(p.src[p.pos], false) {
+			p.pos++
+		}
+
+		//Using base "0" automatically detects the base based on the string.
+		num, err := strconv.ParseInt(p.src[start:p.pos], 0, 64)
+		if err != nil {
+			return fmt.Errorf("Invalid number %q", p.src[start:p.pos]), 0
+		}
+
+		return nil, int(num)
+
+	case IsIdentChar(c, true):
+		start := p.pos
+		for p.pos < len(p.src) && IsIdentChar(p.src[p.pos], false) {
+			p.pos++
+		}
+
+		name := p.src[start:p.pos]
+
+		if p.env.Lookup != nil {
+			if v, ok := p.env.Lookup(name); ok {
+				return nil, v
+			}
+		}
+
+		return fmt.Errorf("Unknown identifier %q", name), 0
+	}
+
+	return fmt.Errorf("Unexpected %q in expression %q", string(c), p.src), 0
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,142 @@
+package expr
+
+import (
+	"strings"
+	"testing"
+)
+
+//An environment with a few variables and memory cells holding twice their address.
+var testEnv = Env{
+	Lookup: func(name string) (int, bool) {
+		v, ok := map[string]int{"x": 10, "y": 3, "n": 0, "buf": 0x100, ".loc": 7, "$r1": -2}[name]
+		return v, ok
+	},
+	Deref: func(addr int) (int, bool) {
+		if addr < 0 || addr >= 1024 {
+			return 0, false
+		}
+		return addr * 2, true
+	},
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		src string
+		want int
+	}{
+		{"42", 42},
+		{"0x2A", 42},
+		{"0b101010", 42},
+		{"0o52", 42},
+		{"'a'", 'a'},
+		{"'\\n'", '\n'},
+		{"  1 +  2 ", 3},
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"10 - 4 - 3", 3},
+		{"100 / 10 / 5", 2},
+		{"-7 / 2", -3},
+		{"-7 % 2", -1},
+		{"1 << 4 + 1", 32},
+		{"0x80 >> 3", 0x10},
+		{"-1", -1},
+		{"--1", 1},
+		{"+5", 5},
+		{"~0", -1},
+		{"!0 + !5", 1},
+		{"6 & 3", 2},
+		{"6 | 3", 7},
+		{"6 ^ 3", 5},
+		{"1 | 2 ^ 3 & 4", 3},
+		{"3 < 4", 1},
+		{"3 <= 3", 1},
+		{"3 > 4", 0},
+		{"4 >= 5", 0},
+		{"2 == 2", 1},
+		{"2 != 2", 0},
+		{"1 < 2 == 1", 1},
+		{"0 || 3", 1},
+		{"2 && 0", 0},
+		{"1 || 0 && 0", 1},
+		{"x * y + 1", 31},
+		{"buf + .loc", 0x107},
+		{"$r1 * 2", -4},
+		{"[buf]", 0x200},
+		{"[x + 1] - 1", 21},
+		{"[[1]]", 4},
+
+		//The right side of "&&" and "||" isn't evaluated if the left one decides the result.
+		{"n != 0 && 10 / n", 0},
+		{"n == 0 || 10 / n", 1},
+		{"0 && [5000]", 0},
+		{"1 || 1 / 0 + [5000]", 1},
+		{"0 && 1 / 0 || 2", 1},
+		{"n != 0 && (1 % n || 1 / n) || x", 1},
+	}
+
+	for _, tt := range tests {
+		err, got := Eval(tt.src, testEnv)
+		if err != nil {
+			t.Errorf("Eval(%q) failed: %v", tt.src, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Eval(%q) = %d, want %d", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		env Env
+		err string
+	}{
+		{"", testEnv, "Unexpected end"},
+		{"1 +", testEnv, "Unexpected end"},
+		{"(1 + 2", testEnv, "Missing ')'"},
+		{"1 2", testEnv, "Unexpected \"2\""},
+		{"1 / 0", testEnv, "Division by zero"},
+		{"1 % (x - 10)", testEnv, "Division by zero"},
+		{"1 && 1 / n", testEnv, "Division by zero"},
+		{"0 || [5000]", testEnv, "Invalid memory reference [5000]"},
+		//Operands that aren't evaluated must still be valid.
+		{"0 && (1", testEnv, "Missing ')'"},
+		{"1 || z", testEnv, "Unknown identifier \"z\""},
+		{"z", testEnv, "Unknown identifier \"z\""},
+		{"x", Env{}, "Unknown identifier \"x\""},
+		{"0x", testEnv, "Invalid number"},
+		{"12ab", testEnv, "Invalid number"},
+		{"'ab'", testEnv, "Invalid character literal"},
+		{"'a", testEnv, "Unterminated character literal"},
+		{"[1", testEnv, "Missing ']'"},
+		{"[2000]", testEnv, "Invalid memory reference [2000]"},
+		{"[1]", Env{}, "Memory references are not allowed"},
+		{"1 + #", testEnv, "Unexpected \"#\""},
+	}
+
+	for _, tt := range tests {
+		err, _ := Eval(tt.src, tt.env)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Eval(%q): got error %v, want one containing %q", tt.src, err, tt.err)
+		}
+	}
+}
+
+func TestIsIdentChar(t *testing.T) {
+	for _, c := range []byte("_.$aZ") {
+		if !IsIdentChar(c, true) {
+			t.Errorf("%q can't start an identifier", c)
+		}
+	}
+
+	if IsIdentChar('1', true) || !IsIdentChar('1', false) {
+		t.Error("Digits must be allowed in identifiers, but not first")
+	}
+
+	for _, c := range []byte("+-()[] '") {
+		if IsIdentChar(c, false) {
+			t.Errorf("%q is part of an identifier", c)
+		}
+	}
+}
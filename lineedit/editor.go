@@ -0,0 +1,467 @@
+//Reads lines from a terminal with editing, history and completion.
+//
+//Supported keys are the arrows, Home, End, Delete, Backspace, Tab, and the usual control keys: Ctrl-A and Ctrl-E move
+//to the start and end of the line, Ctrl-B and Ctrl-F move by a character, Ctrl-K and Ctrl-U delete to the end and the
+//start of the line, Ctrl-W deletes the previous word, Ctrl-L clears the screen, Ctrl-P and Ctrl-N browse the history and
+//Ctrl-R searches it backwards. When the input is not a terminal lines are read as they are.
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+//Returned by "ReadLine" when Ctrl-C is pressed.
+var ErrInterrupted = errors.New("Interrupted")
+
+//Keys.
+const (
+	keyCtrlA = 1
+	keyCtrlB = 2
+	keyCtrlC = 3
+	keyCtrlD = 4
+	keyCtrlE = 5
+	keyCtrlF = 6
+	keyCtrlG = 7
+	keyBackspaceOld = 8
+	keyTab = 9
+	keyNewline = 10
+	keyCtrlK = 11
+	keyCtrlL = 12
+	keyEnter = 13
+	keyCtrlN = 14
+	keyCtrlP = 16
+	keyCtrlR = 18
+	keyCtrlU = 21
+	keyCtrlW = 23
+	keyEscape = 27
+	keyBackspace = 127
+)
+
+//Keys read from escape sequences, outside of the range of characters.
+const (
+	keyUp = -(iota + 1)
+	keyDown
+	keyRight
+	keyLeft
+	keyHome
+	keyEnd
+	keyDelete
+	keyUnknown
+)
+
+type Editor struct {
+	in *os.File
+	out io.Writer
+	reader *bufio.Reader
+
+	//Receives the line up to the cursor and returns the possible words for the word being typed, the editor only offers
+	//the ones that start with it. Words ending in "/" are not followed by a space once completed, so paths can be
+	//completed a directory at a time. May be nil.
+	Complete func(line string) []string
+
+	History *History
+
+	//Line being edited and cursor position in it.
+	buf []rune
+	pos int
+
+	prompt string
+
+	//Key read but not handled yet.
+	pending rune
+	hasPending bool
+}
+
+func New(in *os.File, out io.Writer) *Editor {
+	return &Editor{in: in, out: out, reader: bufio.NewReader(in), History: NewHistory(1000)}
+}
+
+//Reads a line, without the line ending. If the input is not a terminal the line is read as it is, the last line may end
+//without a newline, in that case it's returned along with "io.EOF". Ctrl-D on an empty line returns "io.EOF", and
+//Ctrl-C "ErrInterrupted".
+func (e *Editor) ReadLine(prompt string) (string, error) {
+	fd := int(e.in.Fd())
+
+	if !isTerminal(fd) {
+		fmt.Fprint(e.out, prompt)
+
+		line, err := e.reader.ReadString('\n')
+		return strings.TrimRight(line, "\r\n"), err
+	}
+
+	err, state := makeRaw(fd)
+	if err != nil {
+		return "", err
+	}
+	defer restore(fd, state)
+
+	e.prompt = prompt
+	e.buf = e.buf[:0]
+	e.pos = 0
+	e.refresh()
+
+	line, err := e.edit()
+	if err == nil {
+		e.History.Add(line)
+	}
+
+	return line, err
+}
+
+//Handles keys until the line is done.
+func (e *Editor) edit() (string, error) {
+	entries := e.History.Entries()
+
+	//Position in the history, the line being typed is kept while browsing.
+	histIndex := len(entries)
+	current := ""
+
+	browse := func(index int) {
+		if index < 0 || index > len(entries) {
+			return
+		}
+
+		if histIndex == len(entries) {
+			current = string(e.buf)
+		}
+
+		histIndex = index
+		if index == len(entries) {
+			e.setLine(current)
+		} else {
+			e.setLine(entries[index])
+		}
+	}
+
+	for {
+		err, key := e.readKey()
+		if err != nil {
+			return "", err
+		}
+
+		switch key {
+		case keyEnter, keyNewline:
+			fmt.Fprint(e.out, "\r\n")
+			return string(e.buf), nil
+
+		case keyCtrlC:
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", ErrInterrupted
+
+		case keyCtrlD:
+			if len(e.buf) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			e.delete(e.pos)
+
+		case keyBackspace, keyBackspaceOld:
+			if e.pos > 0 {
+				e.pos--
+				e.delete(e.pos)
+			}
+
+		case keyDelete:
+			e.delete(e.pos)
+
+		case keyLeft, keyCtrlB:
+			e.pos = max(0, e.pos - 1)
+
+		case keyRight, keyCtrlF:
+			e.pos = min(len(e.buf), e.pos + 1)
+
+		case keyHome, keyCtrlA:
+			e.pos = 0
+
+		case keyEnd, keyCtrlE:
+			e.pos = len(e.buf)
+
+		case keyUp, keyCtrlP:
+			browse(histIndex - 1)
+
+		case keyDown, keyCtrlN:
+			browse(histIndex + 1)
+
+		case keyCtrlK:
+			e.buf = e.buf[:e.pos]
+
+		case keyCtrlU:
+			e.buf = slices.Delete(e.buf, 0, e.pos)
+			e.pos = 0
+
+		case keyCtrlW:
+			//Spaces before the cursor are removed along with the word.
+			start := e.pos
+			for start > 0 && e.buf[start - 1] == ' ' {
+				start--
+			}
+			for start > 0 && e.buf[start - 1] != ' ' {
+				start--
+			}
+
+			e.buf = slices.Delete(e.buf, start, e.pos)
+			e.pos = start
+
+		case keyCtrlL:
+			fmt.Fprint(e.out, "\x1b[H\x1b[2J")
+
+		case keyTab:
+			e.complete()
+
+		case keyCtrlR:
+			if done := e.search(entries); done {
+				fmt.Fprint(e.out, "\r\n")
+				return string(e.buf), nil
+			}
+
+		default:
+			//Ignore the remaining control keys.
+			if key < ' ' {
+				continue
+			}
+
+			e.buf = slices.Insert(e.buf, e.pos, key)
+			e.pos++
+		}
+
+		e.refresh()
+	}
+}
+
+//Reads a key, escape sequences for the arrows and the editing keys are turned into a single key.
+func (e *Editor) readKey() (error, rune) {
+	if e.hasPending {
+		e.hasPending = false
+		return nil, e.pending
+	}
+
+	r, _, err := e.reader.ReadRune()
+	if err != nil || r != keyEscape {
+		return err, r
+	}
+
+	r, _, err = e.reader.ReadRune()
+	if err != nil {
+		return err, 0
+	}
+
+	if r != '[' && r != 'O' {
+		return nil, keyUnknown
+	}
+
+	//Sequences are made of numeric parameters followed by a final character.
+	param := ""
+	for {
+		r, _, err = e.reader.ReadRune()
+		if err != nil {
+			return err, 0
+		}
+
+		if (r < '0' || r > '9') && r != ';' {
+			break
+		}
+		param += string(r)
+	}
+
+	switch r {
+	case 'A':
+		return nil, keyUp
+	case 'B':
+		return nil, keyDown
+	case 'C':
+		return nil, keyRight
+	case 'D':
+		return nil, keyLeft
+	case 'H':
+		return nil, keyHome
+	case 'F':
+		return nil, keyEnd
+	case '~':
+		switch param {
+		case "1", "7":
+			return nil, keyHome
+		case "4", "8":
+			return nil, keyEnd
+		case "3":
+			return nil, keyDelete
+		}
+	}
+
+	return nil, keyUnknown
+}
+
+//Redraws the line and places the cursor.
+func (e *Editor) refresh() {
+	fmt.Fprintf(e.out, "\r%s%s\x1b[K", e.prompt, string(e.buf))
+
+	if back := len(e.buf) - e.pos; back > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", back)
+	}
+}
+
+func (e *Editor) setLine(line string) {
+	e.buf = []rune(line)
+	e.pos = len(e.buf)
+}
+
+func (e *Editor) delete(i int) {
+	if i < len(e.buf) {
+		e.buf = slices.Delete(e.buf, i, i + 1)
+	}
+}
+
+//Returns the start of the word the cursor is in.
+func (e *Editor) wordStart() int {
+	start := e.pos
+	for start > 0 && e.buf[start - 1] != ' ' {
+		start--
+	}
+
+	return start
+}
+
+//Completes the word before the cursor. A single match is inserted, otherwise the longest common prefix is, and if there
+//is nothing to add the matches are listed.
+func (e *Editor) complete() {
+	if e.Complete == nil {
+		return
+	}
+
+	start := e.wordStart()
+	word := string(e.buf[start:e.pos])
+
+	matches := make([]string, 0)
+	for _, c := range e.Complete(string(e.buf[:e.pos])) {
+		if strings.HasPrefix(c, word) && !slices.Contains(matches, c) {
+			matches = append(matches, c)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		fmt.Fprint(e.out, "\a")
+		return
+
+	case 1:
+		completion := matches[0]
+		if !strings.HasSuffix(completion, "/") {
+			completion += " "
+		}
+
+		e.insert(completion[len(word):])
+		return
+	}
+
+	if prefix := commonPrefix(matches); len(prefix) > len(word) {
+		e.insert(prefix[len(word):])
+		return
+	}
+
+	slices.Sort(matches)
+	e.list(matches)
+}
+
+func (e *Editor) insert(s string) {
+	r := []rune(s)
+	e.buf = slices.Insert(e.buf, e.pos, r...)
+	e.pos += len(r)
+}
+
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, w := range words[1:] {
+		for !strings.HasPrefix(w, prefix) {
+			prefix = prefix[:len(prefix) - 1]
+		}
+	}
+
+	return prefix
+}
+
+//Prints the words in columns below the line.
+func (e *Editor) list(words []string) {
+	width := 0
+	for _, w := range words {
+		width = max(width, len(w) + 2)
+	}
+
+	columns := max(1, termWidth(int(e.in.Fd())) / width)
+
+	fmt.Fprint(e.out, "\r\n")
+	for i, w := range words {
+		fmt.Fprintf(e.out, "%-*s", width, w)
+
+		if (i + 1) % columns == 0 || i == len(words) - 1 {
+			fmt.Fprint(e.out, "\r\n")
+		}
+	}
+}
+
+//Searches the history backwards for lines containing the typed text. Enter runs the match, Ctrl-R looks for an older one,
+//Ctrl-G and Ctrl-C cancel the search, and any other key places the match in the line and is then handled as usual.
+//Returns true if the line is done.
+func (e *Editor) search(entries []string) bool {
+	original := string(e.buf)
+	query := ""
+	index := len(entries)
+	match := original
+
+	//Finds the newest match before "from".
+	find := func(from int) {
+		for i := min(from, len(entries)) - 1; i >= 0; i-- {
+			if strings.Contains(entries[i], query) {
+				index = i
+				match = entries[i]
+				return
+			}
+		}
+	}
+
+	for {
+		fmt.Fprintf(e.out, "\r(reverse-i-search)`%s': %s\x1b[K", query, match)
+
+		err, key := e.readKey()
+		if err != nil {
+			return false
+		}
+
+		switch key {
+		case keyCtrlR:
+			find(index)
+
+		case keyBackspace, keyBackspaceOld:
+			if query != "" {
+				q := []rune(query)
+				query = string(q[:len(q) - 1])
+				index = len(entries)
+				find(index)
+			}
+
+		case keyCtrlG, keyCtrlC:
+			e.setLine(original)
+			return false
+
+		case keyEnter, keyNewline:
+			e.setLine(match)
+			return true
+
+		default:
+			if key >= ' ' {
+				query += string(key)
+				//The current match is kept if it still contains the query.
+				find(index + 1)
+				continue
+			}
+
+			e.setLine(match)
+			e.pending, e.hasPending = key, true
+			return false
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//Lines entered in previous sessions, oldest first. If it has a file new lines are appended to it as they are added.
+type History struct {
+	entries []string
+	path string
+	max int
+}
+
+//Returns an empty history that is not saved.
+func NewHistory(max int) *History {
+	return &History{max: max}
+}
+
+//Loads the history from a file, keeping at most "max" lines, a missing file is taken as an empty history. If the file
+//holds more lines than allowed it's rewritten, so it doesn't grow forever.
+func LoadHistory(path string, max int) (error, *History) {
+	h := &History{path: path, max: max}
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, h
+	}
+	if err != nil {
+		return err, h
+	}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			h.entries = append(h.entries, line)
+		}
+	}
+	f.Close()
+
+	if err := scanner.Err(); err != nil {
+		return err, h
+	}
+
+	if len(h.entries) > max {
+		h.entries = h.entries[len(h.entries) - max:]
+		return h.rewrite(), h
+	}
+
+	return nil, h
+}
+
+//Writes all entries to the history file.
+func (h *History) rewrite() error {
+	return os.WriteFile(h.path, []byte(strings.Join(h.entries, "\n") + "\n"), 0o600)
+}
+
+//Adds a line to the history, empty lines and repeats of the last line are ignored.
+func (h *History) Add(line string) error {
+	line = strings.TrimSpace(line)
+	if line == "" || (len(h.entries) > 0 && h.entries[len(h.entries) - 1] == line) {
+		return nil
+	}
+
+	h.entries = append(h.entries, line)
+	if len(h.entries) > h.max {
+		h.entries = h.entries[1:]
+	}
+
+	if h.path == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(h.path), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(h.path, os.O_APPEND | os.O_CREATE | os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintln(f, line); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+//Returns all entries, oldest first.
+func (h *History) Entries() []string {
+	return h.entries
+}
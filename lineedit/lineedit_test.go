@@ -0,0 +1,104 @@
+package lineedit
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dir", "history")
+
+	err, h := LoadHistory(path, 3)
+	if err != nil || len(h.Entries()) != 0 {
+		t.Fatalf("loading a missing history returned %v, %v", err, h.Entries())
+	}
+
+	//Empty lines and repeats are skipped, and only the last "max" lines are kept.
+	for _, line := range []string{"a", " ", "b", "b ", "c", "d", "e"} {
+		if err := h.Add(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if want := []string{"c", "d", "e"}; !reflect.DeepEqual(h.Entries(), want) {
+		t.Errorf("entries %q, want %q", h.Entries(), want)
+	}
+
+	//The file keeps every line until it's loaded again.
+	err, h = LoadHistory(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"d", "e"}; !reflect.DeepEqual(h.Entries(), want) {
+		t.Errorf("loaded entries %q, want %q", h.Entries(), want)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "d\ne\n" {
+		t.Errorf("history file %q after loading it, want it rewritten", data)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	words := []string{"step", "stop", "status", "src/", "break"}
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"br", "break "},
+		{"x st", "x st"},
+		{"sta", "status "},
+		{"sto", "stop "},
+		//Directories are completed without a space.
+		{"sr", "src/"},
+		{"q", "q"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		e := &Editor{out: &out, Complete: func(string) []string { return words }}
+		e.setLine(tt.line)
+		e.complete()
+
+		if got := string(e.buf); got != tt.want {
+			t.Errorf("completing %q gave %q, want %q", tt.line, got, tt.want)
+		}
+	}
+
+	if got := commonPrefix([]string{"status", "step", "stop"}); got != "st" {
+		t.Errorf("commonPrefix = %q, want \"st\"", got)
+	}
+}
+
+func TestReadLineNotTerminal(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	w.WriteString("step 2\r\nlast")
+	w.Close()
+
+	var out bytes.Buffer
+	e := New(r, &out)
+
+	if line, err := e.ReadLine("> "); line != "step 2" || err != nil {
+		t.Errorf("ReadLine = %q, %v", line, err)
+	}
+	if line, err := e.ReadLine("> "); line != "last" || err != io.EOF {
+		t.Errorf("ReadLine = %q, %v, want the last line and EOF", line, err)
+	}
+
+	if out.String() != "> > " {
+		t.Errorf("output %q, want the prompts", out.String())
+	}
+}
@@ -0,0 +1,26 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+
+package lineedit
+
+import (
+	"errors"
+)
+
+//Raw mode is not supported, input is read a line at a time.
+type termState struct{}
+
+func isTerminal(fd int) bool {
+	return false
+}
+
+func makeRaw(fd int) (error, *termState) {
+	return errors.New("Raw mode is not supported on this platform"), nil
+}
+
+func restore(fd int, state *termState) error {
+	return nil
+}
+
+func termWidth(fd int) int {
+	return 80
+}
@@ -0,0 +1,55 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package lineedit
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+//Terminal settings saved before entering raw mode.
+type termState struct {
+	termios unix.Termios
+}
+
+func isTerminal(fd int) bool {
+	_, err := unix.IoctlGetTermios(fd, ioctlGetTermios)
+	return err == nil
+}
+
+//Puts the terminal in raw mode, keys are read as they are pressed, without echo or signals. Output processing is kept,
+//so "\n" still starts a new line.
+func makeRaw(fd int) (error, *termState) {
+	termios, err := unix.IoctlGetTermios(fd, ioctlGetTermios)
+	if err != nil {
+		return err, nil
+	}
+
+	old := &termState{termios: *termios}
+
+	termios.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	termios.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	termios.Cflag &^= unix.CSIZE | unix.PARENB
+	termios.Cflag |= unix.CS8
+	termios.Cc[unix.VMIN] = 1
+	termios.Cc[unix.VTIME] = 0
+
+	if err := unix.IoctlSetTermios(fd, ioctlSetTermios, termios); err != nil {
+		return err, nil
+	}
+
+	return nil, old
+}
+
+func restore(fd int, state *termState) error {
+	return unix.IoctlSetTermios(fd, ioctlSetTermios, &state.termios)
+}
+
+//Returns the width of the terminal in columns, or 80 if it's unknown.
+func termWidth(fd int) int {
+	ws, err := unix.IoctlGetWinsize(fd, unix.TIOCGWINSZ)
+	if err != nil || ws.Col == 0 {
+		return 80
+	}
+
+	return int(ws.Col)
+}
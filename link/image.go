@@ -0,0 +1,344 @@
+package link
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Tinch334/Computer-one-v2/co"
+	"github.com/Tinch334/Computer-one-v2/symbols"
+)
+
+//A contiguous block of words.
+type Segment struct {
+	Addr uint16
+	Words []uint16
+}
+
+//Maps words in memory to the source line they came from.
+type LineInfo struct {
+	File string
+	Line int
+	Addr uint16
+	Size uint16
+	Text string
+}
+
+//A program ready to be loaded into memory.
+type Image struct {
+	Segments []Segment
+	Symbols *symbols.Table
+
+	//Sorted by address.
+	Lines []LineInfo
+
+	Entry uint16
+}
+
+
+//Loads the image into the computer's memory.
+func (img *Image) Load(ci *co.ComputerInfo) error {
+	for _, seg := range img.Segments {
+		if err := ci.SetMemoryBlock(seg.Addr, seg.Words); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//Returns the line that generated the word at the given address.
+func (img *Image) LineAt(addr uint16) (LineInfo, bool) {
+	i := sort.Search(len(img.Lines), func(i int) bool {
+		return img.Lines[i].Addr + img.Lines[i].Size > addr
+	})
+
+	if i < len(img.Lines) && img.Lines[i].Addr <= addr {
+		return img.Lines[i], true
+	}
+
+	return LineInfo{}, false
+}
+
+//Returns the total amount of words in the image.
+func (img *Image) Size() int {
+	size := 0
+	for _, seg := range img.Segments {
+		size += len(seg.Words)
+	}
+	return size
+}
+
+//Returns memory from address 0 up to the last word used, unused words are 0.
+func (img *Image) Flat() []uint16 {
+	end := 0
+	for _, seg := range img.Segments {
+		end = max(end, int(seg.Addr) + len(seg.Words))
+	}
+
+	flat := make([]uint16, end)
+	for _, seg := range img.Segments {
+		copy(flat[seg.Addr:], seg.Words)
+	}
+
+	return flat
+}
+
+//Writes the flat image, as big endian words.
+func (img *Image) WriteFlat(w io.Writer) error {
+	return binary.Write(w, binary.BigEndian, img.Flat())
+}
+
+func (img *Image) WriteFlatFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := img.WriteFlat(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+//Writes the symbol map of a flat image. The entry point and the segments are written first as comment lines, "# entry
+//<addr>" and "# segment <addr> <size>", so the map is still readable by "symbols.Read".
+func (img *Image) WriteSymbolMap(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintf(bw, "# entry 0x%04X\n", img.Entry)
+	for _, seg := range img.Segments {
+		fmt.Fprintf(bw, "# segment 0x%04X %d\n", seg.Addr, len(seg.Words))
+	}
+
+	if err := img.Symbols.Write(bw); err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+func (img *Image) WriteSymbolMapFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := img.WriteSymbolMap(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+//Reads the entry point and the segments of a symbol map written by "WriteSymbolMap", the words of the segments are
+//left empty. Returns false if the map has no entry point.
+func readImageInfo(r io.Reader) (error, bool, uint16, []Segment) {
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+
+	hasEntry := false
+	entry := uint16(0)
+	segments := make([]Segment, 0)
+
+	for scanner.Scan() {
+		lineNum++
+
+		line, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), "#")
+		if !ok {
+			continue
+		}
+
+		fields := strings.Fields(line)
+
+		switch {
+		case len(fields) == 2 && fields[0] == "entry":
+			v, err := strconv.ParseUint(fields[1], 0, 16)
+			if err != nil {
+				return fmt.Errorf("Line %d: invalid entry point %q", lineNum, fields[1]), false, 0, nil
+			}
+
+			hasEntry = true
+			entry = uint16(v)
+
+		case len(fields) == 3 && fields[0] == "segment":
+			addr, err1 := strconv.ParseUint(fields[1], 0, 16)
+			size, err2 := strconv.ParseUint(fields[2], 0, 16)
+			if err1 != nil || err2 != nil {
+				return fmt.Errorf("Line %d: invalid segment", lineNum), false, 0, nil
+			}
+
+			segments = append(segments, Segment{Addr: uint16(addr), Words: make([]uint16, size)})
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err, false, 0, nil
+	}
+
+	return nil, hasEntry, entry, segments
+}
+
+//Writes the line records as a source map, one line per record: "<addr> <size> <file> <line> <text>", with the file and
+//text quoted.
+func (img *Image) WriteSourceMap(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	for _, l := range img.Lines {
+		fmt.Fprintf(bw, "0x%04X %d %s %d %s\n", l.Addr, l.Size, strconv.Quote(l.File), l.Line, strconv.Quote(l.Text))
+	}
+
+	return bw.Flush()
+}
+
+func (img *Image) WriteSourceMapFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := img.WriteSourceMap(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+//Reads a source map written by "WriteSourceMap".
+func ReadSourceMap(r io.Reader) (error, []LineInfo) {
+	lines := make([]LineInfo, 0)
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+
+	for scanner.Scan() {
+		lineNum++
+
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		var l LineInfo
+		if _, err := fmt.Sscanf(scanner.Text(), "0x%X %d %q %d %q", &l.Addr, &l.Size, &l.File, &l.Line, &l.Text); err != nil {
+			return fmt.Errorf("Line %d: invalid source map record", lineNum), nil
+		}
+
+		lines = append(lines, l)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err, nil
+	}
+
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].Addr < lines[j].Addr
+	})
+
+	return nil, lines
+}
+
+func ReadSourceMapFile(path string) (error, []LineInfo) {
+	f, err := os.Open(path)
+	if err != nil {
+		return err, nil
+	}
+	defer f.Close()
+
+	err, lines := ReadSourceMap(f)
+	if err != nil {
+		return fmt.Errorf("%s: %s", path, err), nil
+	}
+
+	return nil, lines
+}
+
+//Reads a flat image, with the symbol map and source map next to it if there are any, "<name>.sym" and "<name>.map".
+//Only the segments listed in the symbol map are loaded, the whole image from address 0 if it lists none. The entry point
+//is the one in the symbol map, otherwise the "start" symbol or 0.
+func ReadFlatFile(path string) (error, *Image) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err, nil
+	}
+
+	if len(data) % 2 != 0 {
+		return fmt.Errorf("%s: odd image size", path), nil
+	}
+
+	if len(data) / 2 > co.MemorySize {
+		return fmt.Errorf("%s: image does not fit in memory", path), nil
+	}
+
+	if len(data) == 0 {
+		return errors.New(path + ": empty image"), nil
+	}
+
+	words := make([]uint16, len(data) / 2)
+	for i := range words {
+		words[i] = binary.BigEndian.Uint16(data[2 * i:])
+	}
+
+	img := &Image{
+		Segments: []Segment{{Addr: 0, Words: words}},
+		Symbols: symbols.NewTable(),
+		Lines: make([]LineInfo, 0),
+	}
+
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+
+	if data, err := os.ReadFile(base + ".sym"); err == nil {
+		err, syms := symbols.Read(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("%s.sym: %s", base, err), nil
+		}
+		img.Symbols = syms
+
+		err, hasEntry, entry, segments := readImageInfo(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("%s.sym: %s", base, err), nil
+		}
+
+		if s, ok := syms.Lookup(EntrySymbol); ok {
+			img.Entry = s.Addr
+		}
+		if hasEntry {
+			img.Entry = entry
+		}
+
+		if len(segments) > 0 {
+			for i := range segments {
+				seg := &segments[i]
+				if int(seg.Addr) + len(seg.Words) > len(words) {
+					return fmt.Errorf("%s.sym: segment at 0x%04X is outside the image", base, seg.Addr), nil
+				}
+
+				copy(seg.Words, words[seg.Addr:])
+			}
+
+			img.Segments = segments
+		}
+	} else if !os.IsNotExist(err) {
+		return err, nil
+	}
+
+	if _, err := os.Stat(base + ".map"); err == nil {
+		err, lines := ReadSourceMapFile(base + ".map")
+		if err != nil {
+			return err, nil
+		}
+		img.Lines = lines
+	}
+
+	return nil, img
+}
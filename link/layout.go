@@ -0,0 +1,121 @@
+package link
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Tinch334/Computer-one-v2/co"
+)
+
+//Places an output section, sections without a fixed address go right after the previous one.
+type Placement struct {
+	Name string
+	Addr uint16
+	Fixed bool
+}
+
+//Describes where sections are placed in memory.
+type Layout struct {
+	//Memory available for relocatable sections, "RegionEnd" is exclusive.
+	RegionStart, RegionEnd int
+
+	Placements []Placement
+
+	//Entry point symbol, if empty "start" is used if defined.
+	Entry string
+}
+
+
+//Returns the layout used when none is given, sections are placed in order starting from address 0.
+func DefaultLayout() *Layout {
+	return &Layout{RegionStart: 0, RegionEnd: co.MemorySize}
+}
+
+//Parses a layout file. Each line is one of:
+//	region <start> <end>	Memory available for relocatable sections, the end is exclusive.
+//	section <name> [addr]	Places a section at <addr>, or right after the previous one.
+//	entry <symbol>		Sets the entry point.
+//Lines starting with "#" are comments.
+func ParseLayout(r io.Reader) (error, *Layout) {
+	l := DefaultLayout()
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+
+	parseAddr := func(s string) (error, int) {
+		//Using base "0" automatically detects the base based on the string.
+		v, err := strconv.ParseUint(s, 0, 16)
+		if err != nil || v > co.MemorySize {
+			return fmt.Errorf("Line %d: invalid address %q", lineNum, s), 0
+		}
+		return nil, int(v)
+	}
+
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+
+		switch {
+		case fields[0] == "region" && len(fields) == 3:
+			e1, start := parseAddr(fields[1])
+			e2, end := parseAddr(fields[2])
+
+			if e1 != nil || e2 != nil || start >= end {
+				return fmt.Errorf("Line %d: invalid region", lineNum), nil
+			}
+
+			l.RegionStart, l.RegionEnd = start, end
+
+		case fields[0] == "section" && (len(fields) == 2 || len(fields) == 3):
+			p := Placement{Name: fields[1]}
+
+			if len(fields) == 3 {
+				err, addr := parseAddr(fields[2])
+				if err != nil || addr >= co.MemorySize {
+					return fmt.Errorf("Line %d: invalid address %q", lineNum, fields[2]), nil
+				}
+
+				p.Addr = uint16(addr)
+				p.Fixed = true
+			}
+
+			l.Placements = append(l.Placements, p)
+
+		case fields[0] == "entry" && len(fields) == 2:
+			l.Entry = fields[1]
+
+		default:
+			return fmt.Errorf("Line %d: invalid layout directive %q", lineNum, line), nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err, nil
+	}
+
+	return nil, l
+}
+
+func ReadLayoutFile(path string) (error, *Layout) {
+	f, err := os.Open(path)
+	if err != nil {
+		return err, nil
+	}
+	defer f.Close()
+
+	err, l := ParseLayout(f)
+	if err != nil {
+		return fmt.Errorf("%s: %s", path, err), nil
+	}
+
+	return nil, l
+}
@@ -0,0 +1,385 @@
+package link
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/Tinch334/Computer-one-v2/co"
+	"github.com/Tinch334/Computer-one-v2/obj"
+	"github.com/Tinch334/Computer-one-v2/symbols"
+)
+
+//Default entry point symbol.
+const EntrySymbol = "start"
+
+//A part of an output section, coming from one object.
+type piece struct {
+	object int
+	section int
+	offset int
+}
+
+//Relocatable sections with the same name are merged into one output section.
+type outputSection struct {
+	name string
+	pieces []piece
+	size int
+
+	placed bool
+	addr int
+}
+
+//A resolved symbol.
+type linkedSymbol struct {
+	addr int
+	kind string
+	size uint16
+
+	//Object that defined it, used in error messages.
+	object string
+}
+
+type linker struct {
+	objs []*obj.Object
+	layout *Layout
+
+	outputs []*outputSection
+	byName map[string]*outputSection
+
+	//Base address of every section, indexed by object and section.
+	bases [][]int
+
+	used [co.MemorySize]bool
+	image [co.MemorySize]uint16
+
+	globals map[string]linkedSymbol
+}
+
+
+//Links the objects into an image, if the layout is nil the default layout is used.
+func Link(objs []*obj.Object, layout *Layout) (error, *Image) {
+	if layout == nil {
+		layout = DefaultLayout()
+	}
+
+	l := &linker{
+		objs: objs,
+		layout: layout,
+		byName: make(map[string]*outputSection),
+		globals: make(map[string]linkedSymbol),
+	}
+
+	steps := []func() error{l.placeAbsolute, l.placeRelocatable, l.copySections, l.resolveGlobals, l.relocate}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return err, nil
+		}
+	}
+
+	return l.buildImage()
+}
+
+//Returns an error if the range is outside memory or overlaps already placed words.
+func (l *linker) reserve(addr int, size int, what string) error {
+	if addr < 0 || addr + size > co.MemorySize {
+		return fmt.Errorf("%s does not fit in memory at 0x%X", what, addr)
+	}
+
+	for i := addr; i < addr + size; i++ {
+		if l.used[i] {
+			return fmt.Errorf("%s at 0x%X overlaps other sections at 0x%X", what, addr, i)
+		}
+	}
+
+	for i := addr; i < addr + size; i++ {
+		l.used[i] = true
+	}
+
+	return nil
+}
+
+//Returns true if the whole range is free.
+func (l *linker) free(addr int, size int) bool {
+	if addr < 0 || addr + size > co.MemorySize {
+		return false
+	}
+
+	for i := addr; i < addr + size; i++ {
+		if l.used[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+
+/*
+	PLACEMENT
+*/
+//Reserves absolute sections and groups relocatable ones.
+func (l *linker) placeAbsolute() error {
+	l.bases = make([][]int, len(l.objs))
+
+	for i, o := range l.objs {
+		l.bases[i] = make([]int, len(o.Sections))
+
+		for j, s := range o.Sections {
+			if s.Absolute {
+				l.bases[i][j] = int(s.Origin)
+
+				if err := l.reserve(int(s.Origin), len(s.Words), fmt.Sprintf("%s: section %s", o.Name, s.Name)); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			out, ok := l.byName[s.Name]
+			if !ok {
+				out = &outputSection{name: s.Name}
+				l.byName[s.Name] = out
+				l.outputs = append(l.outputs, out)
+			}
+
+			out.pieces = append(out.pieces, piece{object: i, section: j, offset: out.size})
+			out.size += len(s.Words)
+		}
+	}
+
+	return nil
+}
+
+//Places relocatable sections, first the ones in the layout, in order, then the rest in order of appearance.
+func (l *linker) placeRelocatable() error {
+	cursor := l.layout.RegionStart
+
+	place := func(out *outputSection, p Placement) error {
+		addr := cursor
+
+		if p.Fixed {
+			addr = int(p.Addr)
+		} else {
+			//First fit, skipping over absolute sections.
+			for addr + out.size <= l.layout.RegionEnd && !l.free(addr, out.size) {
+				addr++
+			}
+
+			if addr + out.size > l.layout.RegionEnd {
+				return fmt.Errorf("section %s (%d words) does not fit in the memory region", out.name, out.size)
+			}
+		}
+
+		if err := l.reserve(addr, out.size, "section " + out.name); err != nil {
+			return err
+		}
+
+		out.placed = true
+		out.addr = addr
+		cursor = addr + out.size
+
+		return nil
+	}
+
+	for _, p := range l.layout.Placements {
+		//Layouts may be shared between programs, sections that don't exist are ignored.
+		out, ok := l.byName[p.Name]
+		if !ok || out.placed {
+			continue
+		}
+
+		if err := place(out, p); err != nil {
+			return err
+		}
+	}
+
+	for _, out := range l.outputs {
+		if !out.placed {
+			if err := place(out, Placement{Name: out.name}); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, out := range l.outputs {
+		for _, p := range out.pieces {
+			l.bases[p.object][p.section] = out.addr + p.offset
+		}
+	}
+
+	return nil
+}
+
+func (l *linker) copySections() error {
+	for i, o := range l.objs {
+		for j, s := range o.Sections {
+			copy(l.image[l.bases[i][j]:], s.Words)
+		}
+	}
+
+	return nil
+}
+
+
+/*
+	SYMBOLS AND RELOCATION
+*/
+func (l *linker) symbolAddr(object int, s obj.Symbol) int {
+	if s.Section == obj.NoSection {
+		return s.Value
+	}
+	return l.bases[object][s.Section] + s.Value
+}
+
+func (l *linker) resolveGlobals() error {
+	for i, o := range l.objs {
+		for _, s := range o.Symbols {
+			if !s.Global {
+				continue
+			}
+
+			if prev, exists := l.globals[s.Name]; exists {
+				return fmt.Errorf("symbol %s defined in both %s and %s", s.Name, prev.object, o.Name)
+			}
+
+			l.globals[s.Name] = linkedSymbol{addr: l.symbolAddr(i, s), kind: s.Kind, size: s.Size, object: o.Name}
+		}
+	}
+
+	return nil
+}
+
+func (l *linker) relocate() error {
+	errs := make([]error, 0)
+
+	for i, o := range l.objs {
+		for _, r := range o.Relocs {
+			var target int
+
+			if r.TargetSection == obj.NoSection {
+				s, ok := l.globals[r.Symbol]
+				if !ok {
+					errs = append(errs, fmt.Errorf("%s: undefined symbol %s", o.Name, r.Symbol))
+					continue
+				}
+
+				target = s.addr
+			} else {
+				target = l.bases[i][r.TargetSection]
+			}
+
+			value := target + r.Addend
+			addr := l.bases[i][r.Section] + int(r.Offset)
+
+			switch r.Kind {
+			case obj.RELOC_IMM7:
+				if value < 0 || value > co.MaxImmediate {
+					errs = append(errs, fmt.Errorf("%s: value 0x%X at 0x%X does not fit in the immediate field", o.Name, value, addr))
+					continue
+				}
+
+				l.image[addr] = l.image[addr] &^ co.MaxImmediate | uint16(value)
+
+			case obj.RELOC_WORD:
+				if value < -0x8000 || value > 0xFFFF {
+					errs = append(errs, fmt.Errorf("%s: value %d at 0x%X does not fit in 16 bits", o.Name, value, addr))
+					continue
+				}
+
+				l.image[addr] = uint16(value)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+//Builds the final image, the symbol map contains all global symbols and local ones whose name is unique.
+func (l *linker) buildImage() (error, *Image) {
+	img := &Image{
+		Segments: make([]Segment, 0),
+		Symbols: symbols.NewTable(),
+		Lines: make([]LineInfo, 0),
+	}
+
+	for addr := 0; addr < co.MemorySize; addr++ {
+		if !l.used[addr] {
+			continue
+		}
+
+		if n := len(img.Segments); n > 0 && int(img.Segments[n - 1].Addr) + len(img.Segments[n - 1].Words) == addr {
+			img.Segments[n - 1].Words = append(img.Segments[n - 1].Words, l.image[addr])
+		} else {
+			img.Segments = append(img.Segments, Segment{Addr: uint16(addr), Words: []uint16{l.image[addr]}})
+		}
+	}
+
+	locals := make(map[string]int)
+	for i, o := range l.objs {
+		for _, s := range o.Symbols {
+			if !s.Global {
+				locals[s.Name]++
+			}
+		}
+
+		for _, line := range o.Lines {
+			img.Lines = append(img.Lines, LineInfo{
+				File: line.File,
+				Line: line.Line,
+				Addr: uint16(l.bases[i][line.Section] + int(line.Offset)),
+				Size: line.Size,
+				Text: line.Text,
+			})
+		}
+	}
+
+	sort.SliceStable(img.Lines, func(i, j int) bool {
+		return img.Lines[i].Addr < img.Lines[j].Addr
+	})
+
+	for i, o := range l.objs {
+		for _, s := range o.Symbols {
+			_, global := l.globals[s.Name]
+
+			if s.Global || (!global && locals[s.Name] == 1) {
+				img.Symbols.Add(symbols.Symbol{Name: s.Name, Addr: uint16(l.symbolAddr(i, s)), Size: s.Size, Kind: s.Kind})
+			}
+		}
+	}
+
+	err, entry := l.entry(img.Symbols)
+	if err != nil {
+		return err, nil
+	}
+	img.Entry = entry
+
+	return nil, img
+}
+
+//Returns the entry point, the layout's entry symbol, "start" or the first word of the first object. The layout's entry
+//symbol must exist.
+func (l *linker) entry(syms *symbols.Table) (error, uint16) {
+	if name := l.layout.Entry; name != "" {
+		s, ok := syms.Lookup(name)
+		if !ok || s.Kind == symbols.KIND_CONST {
+			return fmt.Errorf("Entry point %q is not defined", name), 0
+		}
+
+		return nil, s.Addr
+	}
+
+	if s, ok := syms.Lookup(EntrySymbol); ok && s.Kind != symbols.KIND_CONST {
+		return nil, s.Addr
+	}
+
+	for i, o := range l.objs {
+		for j, s := range o.Sections {
+			if len(s.Words) > 0 {
+				return nil, uint16(l.bases[i][j])
+			}
+		}
+	}
+
+	return nil, 0
+}
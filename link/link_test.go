@@ -0,0 +1,239 @@
+package link
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Tinch334/Computer-one-v2/co"
+	"github.com/Tinch334/Computer-one-v2/obj"
+)
+
+//An object with a single relocatable section of the given words.
+func textObject(name string, words ...uint16) *obj.Object {
+	return &obj.Object{Name: name, Sections: []obj.Section{{Name: "text", Words: words}}}
+}
+
+//Two objects, "a" refers to its own data and to a function in "b".
+func relocObjects() []*obj.Object {
+	a := textObject("a", 0x1100, 0, 0)
+	a.Sections = append(a.Sections, obj.Section{Name: "data", Words: []uint16{7, 8, 9}})
+	a.Imports = []string{"f"}
+	a.Relocs = []obj.Reloc{
+		{Section: 0, Offset: 0, Kind: obj.RELOC_IMM7, TargetSection: 1, Addend: 1},
+		{Section: 0, Offset: 1, Kind: obj.RELOC_WORD, TargetSection: obj.NoSection, Symbol: "f", Addend: 1},
+		{Section: 0, Offset: 2, Kind: obj.RELOC_WORD, TargetSection: 1, Addend: -1},
+	}
+
+	b := textObject("b", 0xAAAA, 0xBBBB)
+	b.Symbols = []obj.Symbol{{Name: "f", Section: 0, Value: 1, Global: true, Kind: "label"}}
+
+	return []*obj.Object{a, b}
+}
+
+func TestRelocation(t *testing.T) {
+	err, img := Link(relocObjects(), &Layout{RegionStart: 0x10, RegionEnd: 0x400})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ci := co.NewComputerInfo()
+	if err := img.Load(ci); err != nil {
+		t.Fatal(err)
+	}
+
+	//Sections with the same name are merged, "text" from both objects at 0x10 and "data" after it at 0x15.
+	_, got := ci.GetMemory(0x10, 0x18)
+	want := []uint16{0x1100 | 0x16, 0x15, 0x14, 0xAAAA, 0xBBBB, 7, 8, 9}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("memory %04X, want %04X", got, want)
+	}
+
+	if s, ok := img.Symbols.Lookup("f"); !ok || s.Addr != 0x14 {
+		t.Errorf("symbol f = %+v, %v", s, ok)
+	}
+}
+
+func TestRelocationErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		change func(objs []*obj.Object)
+		start int
+		err string
+	}{
+		{"imm7 overflow", func(objs []*obj.Object) {}, 0x100, "value 0x106 at 0x100 does not fit in the immediate field"},
+		{"negative imm7", func(objs []*obj.Object) { objs[0].Relocs[0].Addend = -0x20 }, 0x10, "does not fit in the immediate field"},
+		{"word overflow", func(objs []*obj.Object) { objs[0].Relocs[2].Addend = 0x10000 }, 0x10, "does not fit in 16 bits"},
+		{"undefined symbol", func(objs []*obj.Object) { objs[1].Symbols[0].Global = false }, 0x10, "a: undefined symbol f"},
+		{"duplicate symbol", func(objs []*obj.Object) { objs[0].Symbols = objs[1].Symbols }, 0x10, "symbol f defined in both a and b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objs := relocObjects()
+			tt.change(objs)
+
+			err, _ := Link(objs, &Layout{RegionStart: tt.start, RegionEnd: 0x400})
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestEntry(t *testing.T) {
+	o := textObject("a", 1, 2, 3)
+	o.Symbols = []obj.Symbol{
+		{Name: "start", Section: 0, Value: 1, Kind: "label"},
+		{Name: "main", Section: 0, Value: 2, Kind: "label"},
+		{Name: "size", Section: obj.NoSection, Value: 2, Kind: "const"},
+	}
+
+	tests := []struct {
+		name string
+		entry string
+		want uint16
+		err string
+	}{
+		{"start", "", 0x101, ""},
+		{"layout entry", "main", 0x102, ""},
+		{"missing", "nope", 0, `Entry point "nope" is not defined`},
+		{"constant", "size", 0, `Entry point "size" is not defined`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			layout := &Layout{RegionStart: 0x100, RegionEnd: 0x400, Entry: tt.entry}
+
+			err, img := Link([]*obj.Object{o}, layout)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if img.Entry != tt.want {
+				t.Errorf("entry 0x%04X, want 0x%04X", img.Entry, tt.want)
+			}
+		})
+	}
+}
+
+func TestEntryDefaultsToFirstWord(t *testing.T) {
+	err, img := Link([]*obj.Object{textObject("a", 1)}, &Layout{RegionStart: 0x40, RegionEnd: 0x400})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if img.Entry != 0x40 {
+		t.Errorf("entry 0x%04X, want 0x0040", img.Entry)
+	}
+}
+
+func TestFlatRoundTrip(t *testing.T) {
+	o := textObject("a", 0xAAAA, 0xBBBB)
+	o.Symbols = []obj.Symbol{{Name: "main", Section: 0, Value: 1, Global: true, Kind: "label"}}
+	o.Sections = append(o.Sections, obj.Section{Name: "vectors", Absolute: true, Origin: 0x10, Words: []uint16{0xCCCC}})
+
+	err, img := Link([]*obj.Object{o}, &Layout{RegionStart: 0x100, RegionEnd: 0x400, Entry: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "p.bin")
+
+	if err := img.WriteFlatFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := img.WriteSymbolMapFile(filepath.Join(dir, "p.sym")); err != nil {
+		t.Fatal(err)
+	}
+
+	err, got := ReadFlatFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Entry != 0x101 {
+		t.Errorf("entry 0x%04X, want 0x0101", got.Entry)
+	}
+
+	//Only the linked words are loaded, not the padding between them.
+	want := []Segment{{Addr: 0x10, Words: []uint16{0xCCCC}}, {Addr: 0x100, Words: []uint16{0xAAAA, 0xBBBB}}}
+	if !reflect.DeepEqual(got.Segments, want) {
+		t.Errorf("segments %+v, want %+v", got.Segments, want)
+	}
+
+	if s, ok := got.Symbols.Lookup("main"); !ok || s.Addr != 0x101 {
+		t.Errorf("symbol main = %+v, %v", s, ok)
+	}
+}
+
+func TestFlatWithoutSymbolMap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "p.bin")
+	if err := os.WriteFile(path, []byte{0x12, 0x34, 0x56, 0x78}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err, img := ReadFlatFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Segment{{Addr: 0, Words: []uint16{0x1234, 0x5678}}}
+	if !reflect.DeepEqual(img.Segments, want) || img.Entry != 0 {
+		t.Errorf("got %+v entry 0x%04X, want %+v entry 0", img.Segments, img.Entry, want)
+	}
+}
+
+func TestFlatSegmentOutsideImage(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "p.bin")
+
+	if err := os.WriteFile(path, []byte{0, 1}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "p.sym"), []byte("# segment 0x0100 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err, _ := ReadFlatFile(path)
+	if err == nil || !strings.Contains(err.Error(), "outside the image") {
+		t.Errorf("got error %v, want a segment outside the image", err)
+	}
+}
+
+func TestReadFlatErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name string
+		data []byte
+		err string
+	}{
+		{"odd", []byte{1, 2, 3}, "odd image size"},
+		{"empty", []byte{}, "empty image"},
+		{"too big", make([]byte, 2 * co.MemorySize + 2), "does not fit in memory"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name + ".bin")
+			if err := os.WriteFile(path, tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			err, _ := ReadFlatFile(path)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -1,10 +1,57 @@
 package main
 
 import (
+    "flag"
+    "fmt"
+    "os"
+
     "github.com/Tinch334/Computer-one-v2/cli"
 )
 
 
 func main() {
-	cli.RunCli()
-}
\ No newline at end of file
+	script := flag.String("script", "", "Run the debugger commands in the given file and exit")
+	sys := flag.Bool("system", false, "Load the default system, the program is placed after it and runs in user mode")
+	capture := flag.String("capture", "", "Record the display to an animated GIF, or to PNG files in a directory")
+	captureEvery := flag.Int("capture-every", cli.DefaultCaptureEvery, "Instructions between the frames of a capture")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] [program.asm]\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s bench [-n instructions] [program]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.Arg(0) == "bench" {
+		bench(flag.Args()[1:])
+		return
+	}
+
+	cli.RunCli(cli.Options{
+		ScriptPath: *script,
+		ProgramPath: flag.Arg(0),
+		System: *sys,
+		CapturePath: *capture,
+		CaptureEvery: *captureEvery,
+	})
+}
+
+//Measures the simulated instructions per second, of the benchmark suite or of a program.
+func bench(args []string) {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	n := fs.Int("n", cli.DefaultBenchInstructions, "Instructions run by each benchmark")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s bench [-n instructions] [program]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if err := cli.RunBench(cli.BenchOptions{Instructions: *n, ProgramPath: fs.Arg(0)}); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,388 @@
+package obj
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+//First line of every object file.
+const magic = "COOBJ 1"
+
+//Relocation kinds.
+const (
+	//The low 7 bits of the word hold the value, the linker checks it fits.
+	RELOC_IMM7 = "imm7"
+	//The whole word holds the value, used for double mode operands and data.
+	RELOC_WORD = "word"
+)
+
+//Marks a symbol that doesn't belong to any section, constants and absolute addresses.
+const NoSection = -1
+
+type Section struct {
+	Name string
+
+	//Absolute sections are placed at "Origin", relocatable ones are placed by the linker.
+	Absolute bool
+	Origin uint16
+
+	Words []uint16
+}
+
+type Symbol struct {
+	Name string
+
+	//Index of the section the symbol belongs to, its value is an offset into it. "NoSection" for absolute values.
+	Section int
+	Value int
+
+	//Exported symbols are visible to other objects.
+	Global bool
+
+	Kind string
+	Size uint16
+}
+
+//A location whose value depends on where sections end up.
+type Reloc struct {
+	Section int
+	Offset uint16
+	Kind string
+
+	//The value is the address of the target plus the addend, the target is either a section of this object or an
+	//imported symbol, in which case "TargetSection" is "NoSection".
+	TargetSection int
+	Symbol string
+	Addend int
+}
+
+//Maps a range of words to the source line they came from.
+type Line struct {
+	Section int
+	Offset uint16
+	Size uint16
+
+	File string
+	Line int
+	Text string
+}
+
+type Object struct {
+	Name string
+
+	Sections []Section
+	Symbols []Symbol
+	Imports []string
+	Relocs []Reloc
+	Lines []Line
+}
+
+
+/*
+	WRITING
+*/
+//Writes the object in its text format, one record per line.
+func (o *Object) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintf(bw, "%s\n", magic)
+	fmt.Fprintf(bw, "name %s\n", strconv.Quote(o.Name))
+
+	for _, s := range o.Sections {
+		if s.Absolute {
+			fmt.Fprintf(bw, "section %s abs 0x%04X %d\n", strconv.Quote(s.Name), s.Origin, len(s.Words))
+		} else {
+			fmt.Fprintf(bw, "section %s rel 0 %d\n", strconv.Quote(s.Name), len(s.Words))
+		}
+
+		//Words are written in rows of 8, they belong to the last section.
+		for i := 0; i < len(s.Words); i += 8 {
+			row := make([]string, 0, 8)
+			for _, word := range s.Words[i:min(i + 8, len(s.Words))] {
+				row = append(row, fmt.Sprintf("%04x", word))
+			}
+
+			fmt.Fprintf(bw, "data %s\n", strings.Join(row, " "))
+		}
+	}
+
+	for _, s := range o.Symbols {
+		scope := "local"
+		if s.Global {
+			scope = "global"
+		}
+
+		fmt.Fprintf(bw, "symbol %s %d %d %s %s %d\n", strconv.Quote(s.Name), s.Section, s.Value, scope, s.Kind, s.Size)
+	}
+
+	for _, name := range o.Imports {
+		fmt.Fprintf(bw, "import %s\n", strconv.Quote(name))
+	}
+
+	for _, r := range o.Relocs {
+		if r.TargetSection == NoSection {
+			fmt.Fprintf(bw, "reloc %d 0x%04X %s sym %s %d\n", r.Section, r.Offset, r.Kind, strconv.Quote(r.Symbol), r.Addend)
+		} else {
+			fmt.Fprintf(bw, "reloc %d 0x%04X %s sec %d %d\n", r.Section, r.Offset, r.Kind, r.TargetSection, r.Addend)
+		}
+	}
+
+	for _, l := range o.Lines {
+		fmt.Fprintf(bw, "line %d 0x%04X %d %s %d %s\n", l.Section, l.Offset, l.Size, strconv.Quote(l.File), l.Line, strconv.Quote(l.Text))
+	}
+
+	return bw.Flush()
+}
+
+func (o *Object) WriteFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := o.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+
+/*
+	READING
+*/
+//Splits a record into fields, fields may be quoted strings.
+func splitFields(line string) (error, []string) {
+	fields := make([]string, 0)
+
+	for line = strings.TrimSpace(line); line != ""; line = strings.TrimSpace(line) {
+		if line[0] != '"' {
+			field, rest, _ := strings.Cut(line, " ")
+			fields = append(fields, field)
+			line = rest
+			continue
+		}
+
+		quoted, err := strconv.QuotedPrefix(line)
+		if err != nil {
+			return err, nil
+		}
+
+		field, _ := strconv.Unquote(quoted)
+		fields = append(fields, field)
+		line = line[len(quoted):]
+	}
+
+	return nil, fields
+}
+
+//Field parsing helper, remembers the first error.
+type fieldParser struct {
+	fields []string
+	err error
+}
+
+func (p *fieldParser) int(i int) int {
+	v, err := strconv.ParseInt(p.fields[i], 0, 64)
+	if err != nil && p.err == nil {
+		p.err = fmt.Errorf("invalid number %q", p.fields[i])
+	}
+	return int(v)
+}
+
+func (p *fieldParser) word(i int) uint16 {
+	v, err := strconv.ParseUint(p.fields[i], 0, 16)
+	if err != nil && p.err == nil {
+		p.err = fmt.Errorf("invalid word %q", p.fields[i])
+	}
+	return uint16(v)
+}
+
+func Read(r io.Reader) (error, *Object) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64 * 1024), 1024 * 1024)
+
+	if !scanner.Scan() || strings.TrimSpace(scanner.Text()) != magic {
+		return errors.New("Not an object file"), nil
+	}
+
+	o := &Object{}
+	lineNum := 1
+
+	//Words declared by each section record, its data must match.
+	var declared []int
+
+	//Expected amount of fields per record.
+	fieldCount := map[string]int{"name": 2, "section": 5, "symbol": 7, "import": 2, "reloc": 7, "line": 7}
+
+	for scanner.Scan() {
+		lineNum++
+
+		err, fields := splitFields(scanner.Text())
+		if err != nil {
+			return fmt.Errorf("Line %d: %s", lineNum, err), nil
+		}
+
+		if len(fields) == 0 {
+			continue
+		}
+
+		if n, ok := fieldCount[fields[0]]; ok && len(fields) != n {
+			return fmt.Errorf("Line %d: invalid %s record", lineNum, fields[0]), nil
+		}
+
+		p := fieldParser{fields: fields}
+
+		switch fields[0] {
+		case "name":
+			o.Name = fields[1]
+
+		case "section":
+			s := Section{Name: fields[1], Absolute: fields[2] == "abs", Origin: p.word(3)}
+
+			count := p.int(4)
+			if p.err == nil && (count < 0 || count > 0x10000) {
+				return fmt.Errorf("Line %d: invalid section size %d", lineNum, count), nil
+			}
+			if p.err == nil {
+				s.Words = make([]uint16, 0, count)
+			}
+
+			o.Sections = append(o.Sections, s)
+			declared = append(declared, count)
+
+		case "data":
+			if len(o.Sections) == 0 {
+				return fmt.Errorf("Line %d: data outside of a section", lineNum), nil
+			}
+
+			s := &o.Sections[len(o.Sections) - 1]
+			for _, f := range fields[1:] {
+				v, err := strconv.ParseUint(f, 16, 16)
+				if err != nil {
+					return fmt.Errorf("Line %d: invalid word %q", lineNum, f), nil
+				}
+
+				s.Words = append(s.Words, uint16(v))
+			}
+
+			if len(s.Words) > declared[len(declared) - 1] {
+				return fmt.Errorf("Line %d: section %s has more data than the %d words declared", lineNum, s.Name, declared[len(declared) - 1]), nil
+			}
+
+		case "symbol":
+			o.Symbols = append(o.Symbols, Symbol{
+				Name: fields[1],
+				Section: p.int(2),
+				Value: p.int(3),
+				Global: fields[4] == "global",
+				Kind: fields[5],
+				Size: p.word(6),
+			})
+
+		case "import":
+			o.Imports = append(o.Imports, fields[1])
+
+		case "reloc":
+			r := Reloc{Section: p.int(1), Offset: p.word(2), Kind: fields[3], Addend: p.int(6)}
+
+			if fields[4] == "sym" {
+				r.TargetSection = NoSection
+				r.Symbol = fields[5]
+			} else {
+				r.TargetSection = p.int(5)
+			}
+
+			o.Relocs = append(o.Relocs, r)
+
+		case "line":
+			o.Lines = append(o.Lines, Line{
+				Section: p.int(1),
+				Offset: p.word(2),
+				Size: p.word(3),
+				File: fields[4],
+				Line: p.int(5),
+				Text: fields[6],
+			})
+
+		default:
+			return fmt.Errorf("Line %d: unknown record %q", lineNum, fields[0]), nil
+		}
+
+		if p.err != nil {
+			return fmt.Errorf("Line %d: %s", lineNum, p.err), nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err, nil
+	}
+
+	for i, s := range o.Sections {
+		if len(s.Words) != declared[i] {
+			return fmt.Errorf("Section %s has %d words of data, %d were declared", s.Name, len(s.Words), declared[i]), nil
+		}
+	}
+
+	if err := o.Validate(); err != nil {
+		return err, nil
+	}
+
+	return nil, o
+}
+
+func ReadFile(path string) (error, *Object) {
+	f, err := os.Open(path)
+	if err != nil {
+		return err, nil
+	}
+	defer f.Close()
+
+	err, o := Read(f)
+	if err != nil {
+		return fmt.Errorf("%s: %s", path, err), nil
+	}
+
+	return nil, o
+}
+
+//Checks that every section index and offset is in range.
+func (o *Object) Validate() error {
+	validSection := func(i int) bool {
+		return i >= 0 && i < len(o.Sections)
+	}
+
+	for _, s := range o.Symbols {
+		if s.Section != NoSection && !validSection(s.Section) {
+			return fmt.Errorf("Symbol %s: invalid section %d", s.Name, s.Section)
+		}
+	}
+
+	for _, r := range o.Relocs {
+		if !validSection(r.Section) || int(r.Offset) >= len(o.Sections[r.Section].Words) {
+			return fmt.Errorf("Invalid relocation at section %d offset 0x%X", r.Section, r.Offset)
+		}
+
+		if r.TargetSection != NoSection && !validSection(r.TargetSection) {
+			return fmt.Errorf("Invalid relocation target section %d", r.TargetSection)
+		}
+
+		if r.Kind != RELOC_IMM7 && r.Kind != RELOC_WORD {
+			return fmt.Errorf("Invalid relocation kind %q", r.Kind)
+		}
+	}
+
+	for _, l := range o.Lines {
+		if !validSection(l.Section) {
+			return fmt.Errorf("Line information: invalid section %d", l.Section)
+		}
+	}
+
+	return nil
+}
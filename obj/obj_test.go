@@ -0,0 +1,63 @@
+package obj
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriteRead(t *testing.T) {
+	o := &Object{
+		Name: "test.asm",
+		Sections: []Section{
+			{Name: "text", Words: []uint16{1, 2, 3, 4, 5, 6, 7, 8, 9}},
+			{Name: "vectors", Absolute: true, Origin: 0x10, Words: []uint16{0xFFFF}},
+		},
+		Symbols: []Symbol{{Name: "main", Section: 0, Value: 2, Global: true, Kind: "label", Size: 3}},
+		Imports: []string{"putc"},
+		Relocs: []Reloc{
+			{Section: 0, Offset: 1, Kind: RELOC_WORD, TargetSection: NoSection, Symbol: "putc"},
+			{Section: 1, Offset: 0, Kind: RELOC_WORD, TargetSection: 0, Addend: 2},
+		},
+		Lines: []Line{{Section: 0, Offset: 0, Size: 2, File: "test.asm", Line: 3, Text: "MOV R0, \"x\""}},
+	}
+
+	var buf bytes.Buffer
+	if err := o.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	err, got := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, o) {
+		t.Errorf("Read returned %+v, want %+v", got, o)
+	}
+}
+
+func TestReadMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		err string
+	}{
+		{"negative size", "section \"text\" rel 0 -1\n", "invalid section size"},
+		{"missing data", "section \"text\" rel 0 3\ndata 0001 0002\n", "2 words of data, 3 were declared"},
+		{"extra data", "section \"text\" rel 0 1\ndata 0001 0002\n", "more data than"},
+		{"bad size", "section \"text\" rel 0 x\n", "invalid number"},
+		{"data outside section", "data 0001\n", "outside of a section"},
+		{"unknown record", "foo\n", "unknown record"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err, _ := Read(strings.NewReader(magic + "\n" + tt.text))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
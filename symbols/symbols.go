@@ -0,0 +1,286 @@
+package symbols
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//Symbol kinds, any other kind is accepted and treated as an address.
+const (
+	KIND_LABEL = "label"
+	KIND_DATA = "data"
+	KIND_FUNC = "func"
+	//Constants are values, not addresses, they are never used to annotate addresses.
+	KIND_CONST = "const"
+)
+
+type Symbol struct {
+	Name string
+	Addr uint16
+
+	//Amount of words the symbol spans, 0 if unknown.
+	Size uint16
+	Kind string
+}
+
+//A symbol table, symbols are unique by name.
+type Table struct {
+	byName map[string]Symbol
+
+	//Symbols sorted by address, rebuilt lazily.
+	sorted []Symbol
+	dirty bool
+}
+
+
+func NewTable() *Table {
+	return &Table{
+		byName: make(map[string]Symbol),
+		sorted: make([]Symbol, 0),
+	}
+}
+
+/*
+	TABLE FUNCTIONS
+*/
+//Adds a symbol, replacing any symbol with the same name.
+func (t *Table) Add(s Symbol) {
+	if s.Kind == "" {
+		s.Kind = KIND_LABEL
+	}
+
+	t.byName[s.Name] = s
+	t.dirty = true
+}
+
+//Adds all symbols in "other", replacing symbols with the same name.
+func (t *Table) Merge(other *Table) {
+	for _, s := range other.byName {
+		t.Add(s)
+	}
+}
+
+//Removes a symbol, returns false if it didn't exist.
+func (t *Table) Remove(name string) bool {
+	if _, ok := t.byName[name]; !ok {
+		return false
+	}
+
+	delete(t.byName, name)
+	t.dirty = true
+
+	return true
+}
+
+func (t *Table) Clear() {
+	t.byName = make(map[string]Symbol)
+	t.dirty = true
+}
+
+func (t *Table) Len() int {
+	return len(t.byName)
+}
+
+func (t *Table) Lookup(name string) (Symbol, bool) {
+	s, ok := t.byName[name]
+	return s, ok
+}
+
+//Returns all symbols sorted by address, and by name for equal addresses.
+func (t *Table) Symbols() []Symbol {
+	if t.dirty {
+		t.sorted = make([]Symbol, 0, len(t.byName))
+		for _, s := range t.byName {
+			t.sorted = append(t.sorted, s)
+		}
+
+		sort.Slice(t.sorted, func(i, j int) bool {
+			if t.sorted[i].Addr != t.sorted[j].Addr {
+				return t.sorted[i].Addr < t.sorted[j].Addr
+			}
+			return t.sorted[i].Name < t.sorted[j].Name
+		})
+
+		t.dirty = false
+	}
+
+	return t.sorted
+}
+
+//Largest offset from a symbol without a size that is still described with it, farther addresses are not related to it.
+const MaxOffset = 64
+
+//Returns true if the address belongs to the symbol, sized symbols span their size and others up to MaxOffset words.
+func (s Symbol) Covers(addr uint16) bool {
+	if addr < s.Addr {
+		return false
+	}
+
+	if s.Size > 0 {
+		return int(addr) < int(s.Addr) + int(s.Size)
+	}
+
+	return int(addr - s.Addr) <= MaxOffset
+}
+
+//Returns the symbol with the highest address not above "addr" that covers it, constants are ignored. Symbols that don't
+//cover the address are skipped, so an address past the end of a sized symbol may still belong to an earlier one.
+func (t *Table) Nearest(addr uint16) (Symbol, bool) {
+	syms := t.Symbols()
+
+	//First symbol past the address.
+	i := sort.Search(len(syms), func(i int) bool {
+		return syms[i].Addr > addr
+	})
+
+	for i--; i >= 0; i-- {
+		s := syms[i]
+
+		if s.Kind != KIND_CONST && s.Covers(addr) {
+			return s, true
+		}
+	}
+
+	return Symbol{}, false
+}
+
+//Returns the address as "name" or "name+offset" using the symbol "Nearest" returns, an empty string if there is none.
+func (t *Table) Describe(addr uint16) string {
+	s, ok := t.Nearest(addr)
+	if !ok {
+		return ""
+	}
+
+	if s.Addr == addr {
+		return s.Name
+	}
+	return fmt.Sprintf("%s+%d", s.Name, addr - s.Addr)
+}
+
+
+/*
+	FILE FUNCTIONS
+*/
+//Reads a symbol map, each line has the form "name address [size] [kind]", lines starting with "#" are comments.
+func Read(r io.Reader) (error, *Table) {
+	t := NewTable()
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 || len(fields) > 4 {
+			return fmt.Errorf("Line %d: expected \"name address [size] [kind]\"", lineNum), nil
+		}
+
+		if err := ValidateName(fields[0]); err != nil {
+			return fmt.Errorf("Line %d: %s", lineNum, err), nil
+		}
+
+		s := Symbol{Name: fields[0]}
+
+		//Using base "0" automatically detects the base based on the string.
+		addr, err := strconv.ParseUint(fields[1], 0, 16)
+		if err != nil {
+			return fmt.Errorf("Line %d: invalid address %q", lineNum, fields[1]), nil
+		}
+		s.Addr = uint16(addr)
+
+		rest := fields[2:]
+
+		//The size is optional, so a kind may directly follow the address.
+		if len(rest) > 0 {
+			if size, err := strconv.ParseUint(rest[0], 0, 16); err == nil {
+				s.Size = uint16(size)
+				rest = rest[1:]
+			}
+		}
+
+		if len(rest) > 1 {
+			return fmt.Errorf("Line %d: invalid size %q", lineNum, rest[0]), nil
+		}
+
+		if len(rest) == 1 {
+			s.Kind = rest[0]
+		}
+
+		t.Add(s)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err, nil
+	}
+
+	return nil, t
+}
+
+func ReadFile(path string) (error, *Table) {
+	f, err := os.Open(path)
+	if err != nil {
+		return err, nil
+	}
+	defer f.Close()
+
+	err, t := Read(f)
+	if err != nil {
+		return fmt.Errorf("%s: %s", path, err), nil
+	}
+
+	return nil, t
+}
+
+//Writes the table in the format read by "Read".
+func (t *Table) Write(w io.Writer) error {
+	for _, s := range t.Symbols() {
+		if _, err := fmt.Fprintf(w, "%s 0x%04X %d %s\n", s.Name, s.Addr, s.Size, s.Kind); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (t *Table) WriteFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := t.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+//Checks that a name can be used as a symbol.
+func ValidateName(name string) error {
+	if name == "" {
+		return errors.New("Empty symbol name")
+	}
+
+	for i, c := range name {
+		letter := c == '_' || c == '.' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		digit := c >= '0' && c <= '9'
+
+		if !letter && (i == 0 || !digit) {
+			return fmt.Errorf("Invalid symbol name: %q", name)
+		}
+	}
+
+	return nil
+}
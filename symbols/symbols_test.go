@@ -0,0 +1,107 @@
+package symbols
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTable(t *testing.T) {
+	table := NewTable()
+	table.Add(Symbol{Name: "b", Addr: 0x20})
+	table.Add(Symbol{Name: "a", Addr: 0x20, Kind: KIND_DATA})
+	table.Add(Symbol{Name: "c", Addr: 0x10})
+
+	other := NewTable()
+	other.Add(Symbol{Name: "c", Addr: 0x30})
+	table.Merge(other)
+
+	//Sorted by address, then by name. Merged symbols replace those with the same name.
+	var got []string
+	for _, s := range table.Symbols() {
+		got = append(got, s.Name)
+	}
+	if strings.Join(got, " ") != "a b c" {
+		t.Errorf("symbols in order %v, want [a b c]", got)
+	}
+
+	if s, ok := table.Lookup("b"); !ok || s.Kind != KIND_LABEL {
+		t.Errorf("Lookup(b) = %+v, %v, want a label", s, ok)
+	}
+
+	if !table.Remove("b") || table.Remove("b") || table.Len() != 2 {
+		t.Errorf("removing b left %d symbols", table.Len())
+	}
+	if _, ok := table.Lookup("b"); ok {
+		t.Error("b was found after removing it")
+	}
+
+	table.Clear()
+	if table.Len() != 0 || len(table.Symbols()) != 0 {
+		t.Error("symbols remain after clearing the table")
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	table := NewTable()
+	table.Add(Symbol{Name: "main", Addr: 0x100})
+	table.Add(Symbol{Name: "loop", Addr: 0x104})
+	table.Add(Symbol{Name: "func", Addr: 0x200, Size: 0x80, Kind: KIND_FUNC})
+	table.Add(Symbol{Name: "buf", Addr: 0x210, Size: 4, Kind: KIND_DATA})
+	table.Add(Symbol{Name: "count", Addr: 0x220, Kind: KIND_CONST})
+	table.Add(Symbol{Name: "end", Addr: 0x300, Size: 1, Kind: KIND_DATA})
+
+	tests := []struct {
+		addr uint16
+		want string
+	}{
+		{0x0FF, ""},
+		{0x100, "main"},
+		{0x103, "main+3"},
+		{0x104, "loop"},
+		{0x104 + MaxOffset, "loop+64"},
+		//Too far from any symbol without a size.
+		{0x105 + MaxOffset, ""},
+		{0x200, "func"},
+		{0x213, "buf+3"},
+		//Past the end of "buf", but still inside "func".
+		{0x214, "func+20"},
+		//Constants are values, not addresses.
+		{0x220, "func+32"},
+		{0x280, ""},
+		{0x300, "end"},
+		{0x301, ""},
+	}
+
+	for _, tt := range tests {
+		if got := table.Describe(tt.addr); got != tt.want {
+			t.Errorf("Describe(0x%04X) = %q, want %q", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestReadWrite(t *testing.T) {
+	src := "# comment\nmain 0x100\nbuf 0x200 4 data\nsize 8 const\n"
+
+	err, table := Read(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b strings.Builder
+	if err := table.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "size 0x0008 0 const\nmain 0x0100 0 label\nbuf 0x0200 4 data\n"
+	if b.String() != want {
+		t.Errorf("Write produced\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	for _, src := range []string{"main\n", "main 0x10000\n", "main 1 2 3 4\n", "main 1 x y\n", "1main 1\n", "ma-in 1\n", "$i 1\n"} {
+		if err, _ := Read(strings.NewReader(src)); err == nil {
+			t.Errorf("Read(%q) succeeded, want an error", src)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+//Package system holds the default operating system, service routines reached through TRAP and the vector table that
+//points to them.
+package system
+
+import (
+	"fmt"
+
+	"github.com/Tinch334/Computer-one-v2/asm"
+	"github.com/Tinch334/Computer-one-v2/co"
+	"github.com/Tinch334/Computer-one-v2/device"
+	"github.com/Tinch334/Computer-one-v2/link"
+)
+
+//Name of the system source, used in errors and the source map.
+const File = "<system>"
+
+//Memory from address 0 up to this one belongs to the system, the vector table, the service routines and the device
+//registers. User programs are placed after it.
+const End = 0x100
+
+//Trap vectors of the service routines.
+const (
+	TRAP_GETC = iota
+	TRAP_OUT
+	TRAP_PUTS
+	TRAP_HALT
+)
+
+//Address of the console and its registers.
+const (
+	CONSOLE = 0xC0
+
+	KBSR = CONSOLE + device.CONSOLE_KBSR
+	KBDR = CONSOLE + device.CONSOLE_KBDR
+	DSR = CONSOLE + device.CONSOLE_DSR
+	DDR = CONSOLE + device.CONSOLE_DDR
+)
+
+//Addresses of the disk, timer and clock registers, after the console's.
+const (
+	DISK = CONSOLE + 4
+	TIMER = DISK + 4
+	CLOCK = TIMER + 4
+)
+
+//Address of the display, at the end of memory so it stays clear of programs.
+const DISPLAY = co.MemorySize - device.DisplayWords
+
+//Vectors of the device interrupts, the default system halts if one is taken.
+const (
+	VECTOR_KEYBOARD = 0x10
+	VECTOR_DISK = 0x11
+	VECTOR_TIMER = 0x12
+)
+
+//Service routines, arguments and results are passed in R0 and other registers are preserved, flags aren't. Routines run
+//in supervisor mode and return with RTT, unused vectors halt.
+var source = fmt.Sprintf(`
+.equ KBSR, 0x%X
+.equ KBDR, 0x%X
+.equ DDR, 0x%X
+
+.org 0x%X
+	.word getc, out, puts, halt
+	.fill %d, halt
+
+.org 0x20
+; Waits for a key and reads its character into R0.
+getc:
+	LD R0, [KBSR]
+	JMP ZP, getc
+	LD R0, [KBDR]
+	RTT
+
+; Prints the character in R0.
+out:
+	ST R0, [DDR]
+	RTT
+
+; Prints the zero terminated string R0 points to, one character per word.
+puts:
+	ST R0, [saved_r0]
+	ST R1, [saved_r1]
+puts_loop:
+	LD R1, [R0]
+	JMP Z, puts_done
+	ST R1, [DDR]
+	ADD R0, 1
+	JMP puts_loop
+puts_done:
+	LD R0, [saved_r0]
+	LD R1, [saved_r1]
+	RTT
+
+; Stops the machine.
+halt:
+	HLT
+
+saved_r0: .word 0
+saved_r1: .word 0
+`, KBSR, KBDR, DDR, co.TrapTable, co.TrapVectors - TRAP_HALT - 1)
+
+//Returns the source of the default system.
+func Source() string {
+	return source
+}
+
+//Assembles the default system.
+func Image() (error, *link.Image) {
+	return asm.AssembleString(File, source)
+}
+
+//Returns the layout for user programs, which places them after the system.
+func UserLayout() *link.Layout {
+	return &link.Layout{RegionStart: End, RegionEnd: co.MemorySize}
+}
+
+//Returns an error if the program would be loaded over the system, in the memory before End.
+func CheckProgram(img *link.Image) error {
+	for _, seg := range img.Segments {
+		if len(seg.Words) > 0 && int(seg.Addr) < End {
+			return fmt.Errorf("The program is placed at 0x%04X, over the system, programs must be placed from 0x%04X", seg.Addr, End)
+		}
+	}
+
+	return nil
+}
+
+//Loads a system image and protects its memory, so user mode can only reach it through traps.
+func Load(ci *co.ComputerInfo, img *link.Image) error {
+	if err := img.Load(ci); err != nil {
+		return err
+	}
+
+	for page := uint16(0); page < co.PageOf(End); page++ {
+		ci.SetPagePermissions(page, 0)
+	}
+
+	return nil
+}
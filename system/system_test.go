@@ -0,0 +1,136 @@
+package system
+
+import (
+	"testing"
+
+	"github.com/Tinch334/Computer-one-v2/asm"
+	"github.com/Tinch334/Computer-one-v2/co"
+	"github.com/Tinch334/Computer-one-v2/link"
+	"github.com/Tinch334/Computer-one-v2/obj"
+)
+
+//Collects the characters written to the display data register.
+type display struct {
+	co.NoHook
+	out []byte
+}
+
+func (d *display) MemoryWrite(ci *co.ComputerInfo, addr uint16, old uint16, new uint16) {
+	if addr == DDR {
+		d.out = append(d.out, byte(new))
+	}
+}
+
+//Loads the system and the user program, which starts in user mode.
+func boot(t *testing.T, src string) *co.ComputerInfo {
+	t.Helper()
+
+	ci := co.NewComputerInfo()
+
+	err, sys := Image()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Load(ci, sys); err != nil {
+		t.Fatal(err)
+	}
+
+	err, o := asm.AssembleObjectString("user.asm", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err, img := link.Link([]*obj.Object{o}, UserLayout())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := img.Load(ci); err != nil {
+		t.Fatal(err)
+	}
+
+	ci.SetRegisters(co.Registers{PC: img.Entry}, co.Flags{})
+	ci.SetSupervisor(false)
+
+	return ci
+}
+
+func TestServiceRoutines(t *testing.T) {
+	ci := boot(t, `
+start:
+	MOV R1, 0x55
+	MOV R0, 0x68
+	TRAP 1
+	MOV R0, msg
+	TRAP 2
+	TRAP 0
+	MOV R2, R0
+	TRAP 3
+msg:	.string "ok"
+`)
+
+	//A key is waiting.
+	ci.SetMemoryCell(KBSR, 0x8000)
+	ci.SetMemoryCell(KBDR, 'k')
+
+	d := &display{}
+	ci.AddHook(d)
+
+	err, _, running := ci.Run(1000)
+	if err != nil || running {
+		t.Fatalf("got %v, running %v", err, running)
+	}
+
+	if string(d.out) != "hok" {
+		t.Errorf("printed %q, want \"hok\"", d.out)
+	}
+
+	//The halt routine runs in supervisor mode, the other routines return to user mode.
+	if r := ci.GetRegisters(); r.R0 != 'k' || r.R1 != 0x55 || r.R2 != 'k' || !ci.Supervisor() {
+		t.Errorf("registers %+v, supervisor %v", r, ci.Supervisor())
+	}
+}
+
+func TestUnusedVectorsHalt(t *testing.T) {
+	ci := boot(t, "TRAP 31\nNOP\n")
+
+	if err, _, running := ci.Run(100); err != nil || running {
+		t.Errorf("got %v, running %v", err, running)
+	}
+	if r := ci.GetRegisters(); r.PC >= End || r.R7 != End + 1 | co.TRAP_USER_BIT {
+		t.Errorf("registers %+v", r)
+	}
+}
+
+func TestSystemIsProtected(t *testing.T) {
+	ci := boot(t, "LD R0, [0x20]\n")
+
+	err, _ := ci.Step()
+	if f, ok := err.(*co.ProtectionFault); !ok || f.Access != co.ACCESS_READ || f.Addr != 0x20 {
+		t.Errorf("got %v, want a read fault at 0x0020", err)
+	}
+
+	for page := uint16(0); page < co.Pages; page++ {
+		if want := page >= co.PageOf(End); (ci.PagePermissions(page) != 0) != want {
+			t.Errorf("page %d has permissions %s", page, ci.PagePermissions(page))
+		}
+	}
+}
+
+func TestCheckProgram(t *testing.T) {
+	tests := []struct {
+		name string
+		segments []link.Segment
+		ok bool
+	}{
+		{"after the system", []link.Segment{{Addr: End, Words: []uint16{1}}}, true},
+		{"at address 0", []link.Segment{{Addr: 0, Words: []uint16{1}}}, false},
+		{"second segment", []link.Segment{{Addr: End, Words: []uint16{1}}, {Addr: End - 1, Words: []uint16{1}}}, false},
+		{"empty segment", []link.Segment{{Addr: 0}}, true},
+	}
+
+	for _, tt := range tests {
+		if err := CheckProgram(&link.Image{Segments: tt.segments}); (err == nil) != tt.ok {
+			t.Errorf("%s: got %v", tt.name, err)
+		}
+	}
+}